@@ -3,13 +3,16 @@ package stereoscope
 import (
 	"context"
 	"fmt"
+	"io"
 
 	"github.com/anchore/stereoscope/internal/bus"
+	containerdClient "github.com/anchore/stereoscope/internal/containerd"
 	dockerClient "github.com/anchore/stereoscope/internal/docker"
 	"github.com/anchore/stereoscope/internal/log"
 	"github.com/anchore/stereoscope/internal/podman"
 	"github.com/anchore/stereoscope/pkg/file"
 	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/anchore/stereoscope/pkg/image/containerd"
 	"github.com/anchore/stereoscope/pkg/image/docker"
 	"github.com/anchore/stereoscope/pkg/image/oci"
 	"github.com/anchore/stereoscope/pkg/image/sif"
@@ -40,6 +43,18 @@ func WithInsecureAllowHTTP() Option {
 	}
 }
 
+// WithRegistryMirror pulls images for the given registry (e.g. "docker.io") from the given mirror host instead (e.g.
+// "mirror.internal:5000"). Use WithInsecureAllowHTTP for mirrors that are only served over plain HTTP.
+func WithRegistryMirror(registry, mirror string) Option {
+	return func(c *config) error {
+		if c.Registry.Mirrors == nil {
+			c.Registry.Mirrors = make(map[string]string)
+		}
+		c.Registry.Mirrors[registry] = mirror
+		return nil
+	}
+}
+
 func WithCredentials(credentials ...image.RegistryCredentials) Option {
 	return func(c *config) error {
 		c.Registry.Credentials = append(c.Registry.Credentials, credentials...)
@@ -65,6 +80,155 @@ func WithPlatform(platform string) Option {
 	}
 }
 
+// WithRepoTag selects the image with the given repo tag (e.g. "alpine:latest") from a docker archive that contains
+// multiple images (e.g. from "docker image save img1 img2"). Archives with a single image are read without a repo tag.
+func WithRepoTag(repoTag string) Option {
+	return func(c *config) error {
+		c.RepoTag = repoTag
+		return nil
+	}
+}
+
+// WithRefName selects the image with the given "org.opencontainers.image.ref.name" annotation (typically a tag, e.g.
+// "latest") from an OCI layout directory that holds multiple images (e.g. from "skopeo copy docker://<img> oci:<dir>:<tag>").
+func WithRefName(refName string) Option {
+	return func(c *config) error {
+		c.RefName = refName
+		return nil
+	}
+}
+
+// WithReadConcurrency sets the maximum number of image layers that are read at the same time (by default GOMAXPROCS).
+func WithReadConcurrency(workers int) Option {
+	return func(c *config) error {
+		c.AdditionalMetadata = append(c.AdditionalMetadata, image.WithReadConcurrency(workers))
+		return nil
+	}
+}
+
+// WithContentSpillThreshold sets the size in bytes above which contents opened with Image.OpenPathSeekable (that
+// cannot be seeked directly) are spilled to a temp file instead of being held in memory.
+func WithContentSpillThreshold(threshold int64) Option {
+	return func(c *config) error {
+		c.AdditionalMetadata = append(c.AdditionalMetadata, image.WithContentSpillThreshold(threshold))
+		return nil
+	}
+}
+
+// WithMaxUncompressedSize sets the maximum number of bytes that may be decompressed across all image layers, after
+// which reading the image is aborted with an image.ErrSizeLimitExceeded (by default there is no limit). This should be
+// set when reading untrusted images to guard against decompression bombs.
+func WithMaxUncompressedSize(maxBytes int64) Option {
+	return func(c *config) error {
+		c.AdditionalMetadata = append(c.AdditionalMetadata, image.WithMaxUncompressedSize(maxBytes))
+		return nil
+	}
+}
+
+// WithDigestVerification verifies every image layer against the digest from the image manifest and the diff ID from the
+// image config while the layer is read, aborting with an image.ErrLayerDigestMismatch otherwise. This is recommended
+// when reading untrusted images.
+func WithDigestVerification(enabled bool) Option {
+	return func(c *config) error {
+		c.AdditionalMetadata = append(c.AdditionalMetadata, image.WithDigestVerification(enabled))
+		return nil
+	}
+}
+
+// WithMemoryMappedLayers memory maps every uncompressed layer tar, so that file contents are read directly from memory
+// instead of from the tar on disk (see image.WithMemoryMappedLayers). This speeds up random reads of many files.
+func WithMemoryMappedLayers(enabled bool) Option {
+	return func(c *config) error {
+		c.AdditionalMetadata = append(c.AdditionalMetadata, image.WithMemoryMappedLayers(enabled))
+		return nil
+	}
+}
+
+// WithEStargzLayers indexes every eStargz layer of a registry image from its table of contents, so that only the
+// contents of the files that are read are downloaded (see image.WithEStargzLayers). Other layers are read in full.
+func WithEStargzLayers(enabled bool) Option {
+	return func(c *config) error {
+		c.AdditionalMetadata = append(c.AdditionalMetadata, image.WithEStargzLayers(enabled))
+		return nil
+	}
+}
+
+// WithLazyLayers defers fetching each layer until the contents of a file within it are first read, persisting the tar
+// index of every layer to the given directory so that the squashed tree is known without fetching the layer (see
+// image.WithLazyLayers for the tradeoffs). Layers are fetched eagerly by default.
+func WithLazyLayers(indexDir string) Option {
+	return func(c *config) error {
+		c.AdditionalMetadata = append(c.AdditionalMetadata, image.WithLazyLayers(indexDir))
+		return nil
+	}
+}
+
+// WithMaxFileSize sets the maximum size of any single file within the image, after which reading the image is aborted
+// with an image.ErrSizeLimitExceeded (by default there is no limit).
+func WithMaxFileSize(maxBytes int64) Option {
+	return func(c *config) error {
+		c.AdditionalMetadata = append(c.AdditionalMetadata, image.WithMaxFileSize(maxBytes))
+		return nil
+	}
+}
+
+// WithMaxPathDepth sets the maximum number of components of any path within the image (by default
+// image.DefaultMaxPathDepth), after which reading the image is aborted with an image.ErrPathTooDeep (0 means no limit).
+func WithMaxPathDepth(maxDepth int) Option {
+	return func(c *config) error {
+		c.AdditionalMetadata = append(c.AdditionalMetadata, image.WithMaxPathDepth(maxDepth))
+		return nil
+	}
+}
+
+// WithFileDigests computes the sha256 of the contents of every regular file while the image is read, so that it is
+// available from the file metadata and the file trees without reading the contents again (see image.WithFileDigests).
+func WithFileDigests(enabled bool) Option {
+	return func(c *config) error {
+		c.AdditionalMetadata = append(c.AdditionalMetadata, image.WithFileDigests(enabled))
+		return nil
+	}
+}
+
+// WithLayerCache caches every layer read (by layer digest) within the given directory, so that layers shared between
+// images (or read again later) are not downloaded or indexed again. The least recently used layers are removed once the
+// cache exceeds the given size in bytes (0 means no limit).
+func WithLayerCache(dir string, maxSize int64) Option {
+	return func(c *config) error {
+		c.AdditionalMetadata = append(c.AdditionalMetadata, image.WithLayerCache(dir, maxSize))
+		return nil
+	}
+}
+
+// WithIncludedPaths restricts the files indexed from the image to those matching at least one of the given
+// gitignore-style patterns (or living under a matching directory). Files that are not indexed do not appear in the
+// squash tree and cannot be resolved or read from the image.
+func WithIncludedPaths(patterns ...string) Option {
+	return func(c *config) error {
+		c.AdditionalMetadata = append(c.AdditionalMetadata, image.WithIncludedPaths(patterns...))
+		return nil
+	}
+}
+
+// WithExcludedPaths skips indexing any path in the image that matches one of the given gitignore-style patterns (e.g.
+// "/usr/share/doc"), along with everything under a matching directory. Excluded paths do not appear in the squash tree
+// and cannot be resolved or read from the image.
+func WithExcludedPaths(patterns ...string) Option {
+	return func(c *config) error {
+		c.AdditionalMetadata = append(c.AdditionalMetadata, image.WithExcludedPaths(patterns...))
+		return nil
+	}
+}
+
+// WithContainerdNamespace sets the containerd namespace to find images in when using the containerd source (by
+// default the CONTAINERD_NAMESPACE environment variable is used, or "k8s.io" if not set).
+func WithContainerdNamespace(namespace string) Option {
+	return func(c *config) error {
+		c.ContainerdNamespace = namespace
+		return nil
+	}
+}
+
 // GetImageFromSource returns an image from the explicitly provided source.
 func GetImageFromSource(ctx context.Context, imgStr string, source image.Source, options ...Option) (*image.Image, error) {
 	log.Debugf("image: source=%+v location=%+v", source, imgStr)
@@ -79,28 +243,88 @@ func GetImageFromSource(ctx context.Context, imgStr string, source image.Source,
 		}
 	}
 
-	provider, err := selectImageProvider(imgStr, source, cfg)
+	tempDirGenerator := rootTempDirGenerator.NewGenerator()
+	provider, err := selectImageProvider(imgStr, source, cfg, tempDirGenerator)
+	if err != nil {
+		_ = tempDirGenerator.Cleanup()
+		return nil, err
+	}
+
+	return provideImage(ctx, provider, source, cfg, tempDirGenerator)
+}
+
+// GetImageFromReader returns an image from a tar stream (e.g. "docker image save ..." piped to stdin) for the given
+// source, which must be either image.DockerTarballSource or image.OciTarballSource. A docker archive stream requires
+// random access and is spooled to a temp file within the image content directory (removed by image.Image.Cleanup()),
+// while an OCI archive stream is extracted in a single pass.
+func GetImageFromReader(ctx context.Context, reader io.Reader, source image.Source, options ...Option) (*image.Image, error) {
+	log.Debugf("image: source=%+v location=<reader>", source)
+
+	var cfg config
+	for _, option := range options {
+		if option == nil {
+			continue
+		}
+		if err := option(&cfg); err != nil {
+			return nil, fmt.Errorf("unable to parse option: %w", err)
+		}
+	}
+
+	tempDirGenerator := rootTempDirGenerator.NewGenerator()
+	provider, err := selectReaderImageProvider(reader, source, cfg, tempDirGenerator)
 	if err != nil {
+		_ = tempDirGenerator.Cleanup()
 		return nil, err
 	}
 
+	return provideImage(ctx, provider, source, cfg, tempDirGenerator)
+}
+
+// selectReaderImageProvider returns the provider for an image of the given source read from a stream.
+func selectReaderImageProvider(reader io.Reader, source image.Source, cfg config, tempDirGenerator *file.TempDirGenerator) (image.Provider, error) {
+	switch source {
+	case image.DockerTarballSource:
+		if cfg.Platform != nil {
+			return nil, fmt.Errorf("specified platform=%q however image source=%q does not support selecting platform", cfg.Platform.String(), source.String())
+		}
+		return docker.NewProviderFromReader(reader, tempDirGenerator, cfg.RepoTag), nil
+	case image.OciTarballSource:
+		if cfg.RepoTag != "" {
+			return nil, fmt.Errorf("specified repo tag=%q however image source=%q does not support selecting a repo tag", cfg.RepoTag, source.String())
+		}
+		return oci.NewProviderFromReader(reader, tempDirGenerator, cfg.Platform), nil
+	}
+	return nil, fmt.Errorf("image source=%q cannot be read from a stream", source.String())
+}
+
+// provideImage provides and reads the image. All temp dirs created with the given generator (by the provider) are
+// removed by image.Image.Cleanup(), or immediately if the image cannot be provided or read.
+func provideImage(ctx context.Context, provider image.Provider, source image.Source, cfg config, tempDirGenerator *file.TempDirGenerator) (*image.Image, error) {
 	img, err := provider.Provide(ctx, cfg.AdditionalMetadata...)
 	if err != nil {
+		_ = tempDirGenerator.Cleanup()
 		return nil, fmt.Errorf("unable to use %s source: %w", source, err)
 	}
+	img.AddCleanup(tempDirGenerator.Cleanup)
 
-	err = img.Read()
+	err = img.ReadWithContext(ctx)
 	if err != nil {
+		_ = img.Cleanup()
 		return nil, fmt.Errorf("could not read image: %+v", err)
 	}
 
 	return img, nil
 }
 
-func selectImageProvider(imgStr string, source image.Source, cfg config) (image.Provider, error) {
+func selectImageProvider(imgStr string, source image.Source, cfg config, tempDirGenerator *file.TempDirGenerator) (image.Provider, error) {
 	var provider image.Provider
-	tempDirGenerator := rootTempDirGenerator.NewGenerator()
 	platformSelectionUnsupported := fmt.Errorf("specified platform=%q however image source=%q does not support selecting platform", cfg.Platform.String(), source.String())
+	if cfg.RepoTag != "" && source != image.DockerTarballSource {
+		return nil, fmt.Errorf("specified repo tag=%q however image source=%q does not support selecting a repo tag", cfg.RepoTag, source.String())
+	}
+	if cfg.RefName != "" && source != image.OciDirectorySource {
+		return nil, fmt.Errorf("specified ref name=%q however image source=%q does not support selecting a ref name", cfg.RefName, source.String())
+	}
 
 	switch source {
 	case image.DockerTarballSource:
@@ -108,7 +332,7 @@ func selectImageProvider(imgStr string, source image.Source, cfg config) (image.
 			return nil, platformSelectionUnsupported
 		}
 		// note: the imgStr is the path on disk to the tar file
-		provider = docker.NewProviderFromTarball(imgStr, tempDirGenerator)
+		provider = docker.NewProviderFromTarball(imgStr, tempDirGenerator, cfg.RepoTag)
 	case image.DockerDaemonSource:
 		c, err := dockerClient.GetClient()
 		if err != nil {
@@ -127,16 +351,20 @@ func selectImageProvider(imgStr string, source image.Source, cfg config) (image.
 		if err != nil {
 			return nil, err
 		}
-	case image.OciDirectorySource:
-		if cfg.Platform != nil {
-			return nil, platformSelectionUnsupported
+	case image.ContainerdDaemonSource:
+		c, err := containerdClient.GetClient()
+		if err != nil {
+			return nil, err
 		}
-		provider = oci.NewProviderFromPath(imgStr, tempDirGenerator)
-	case image.OciTarballSource:
-		if cfg.Platform != nil {
-			return nil, platformSelectionUnsupported
+		namespace := cfg.ContainerdNamespace
+		if namespace == "" {
+			namespace = containerdClient.Namespace()
 		}
-		provider = oci.NewProviderFromTarball(imgStr, tempDirGenerator)
+		provider = containerd.NewProviderFromDaemon(imgStr, tempDirGenerator, c, namespace, cfg.Platform)
+	case image.OciDirectorySource:
+		provider = oci.NewProviderFromPath(imgStr, tempDirGenerator, cfg.Platform, cfg.RefName)
+	case image.OciTarballSource:
+		provider = oci.NewProviderFromTarball(imgStr, tempDirGenerator, cfg.Platform)
 	case image.OciRegistrySource:
 		provider = oci.NewProviderFromRegistry(imgStr, tempDirGenerator, cfg.Registry, cfg.Platform)
 	case image.SingularitySource:
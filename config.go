@@ -8,4 +8,10 @@ type config struct {
 	Registry           image.RegistryOptions
 	AdditionalMetadata []image.AdditionalMetadata
 	Platform           *image.Platform
+	// RepoTag selects the image from a docker archive with multiple images (e.g. from "docker image save img1 img2")
+	RepoTag string
+	// RefName selects the image from an OCI layout directory by the "org.opencontainers.image.ref.name" annotation
+	RefName string
+	// ContainerdNamespace is the containerd namespace to find images in (defaults to "k8s.io")
+	ContainerdNamespace string
 }
@@ -7,9 +7,7 @@ var active bool
 
 func SetPublisher(p partybus.Publisher) {
 	publisher = p
-	if p != nil {
-		active = true
-	}
+	active = p != nil
 }
 
 func Publish(event partybus.Event) {
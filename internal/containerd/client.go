@@ -0,0 +1,36 @@
+package containerd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/defaults"
+)
+
+// DefaultNamespace is the containerd namespace used by kubernetes (the CRI plugin), which is where images on k8s
+// nodes are found.
+const DefaultNamespace = "k8s.io"
+
+// GetClient returns a client connected to the containerd socket given by CONTAINERD_ADDRESS (or the default socket
+// location for the platform if not set).
+func GetClient() (*containerd.Client, error) {
+	address := os.Getenv("CONTAINERD_ADDRESS")
+	if address == "" {
+		address = defaults.DefaultAddress
+	}
+
+	client, err := containerd.New(address)
+	if err != nil {
+		return nil, fmt.Errorf("failed create containerd client (address=%q): %w", address, err)
+	}
+	return client, nil
+}
+
+// Namespace returns the containerd namespace given by CONTAINERD_NAMESPACE (or DefaultNamespace if not set).
+func Namespace() string {
+	if ns := os.Getenv("CONTAINERD_NAMESPACE"); ns != "" {
+		return ns
+	}
+	return DefaultNamespace
+}
@@ -0,0 +1,28 @@
+package contextio
+
+import (
+	"context"
+	"io"
+)
+
+// NewReader returns a reader that stops reading (returning the context error) once the given context is done, which
+// allows long-running copies (e.g. decompressing or spooling large blobs) to be cancelled promptly. A nil context is
+// treated as one that is never done.
+func NewReader(ctx context.Context, reader io.Reader) io.Reader {
+	if ctx == nil {
+		return reader
+	}
+	return &contextReader{ctx: ctx, reader: reader}
+}
+
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(p)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/anchore/stereoscope/internal/log"
@@ -76,15 +77,19 @@ func ClientOverUnixSocket() (*client.Client, error) {
 
 	if addr == "" { // in some cases there might not be any config file
 		// we can try guessing; podman CLI does that
-		socketPath := fmt.Sprintf("/run/user/%d/podman/podman.sock", os.Getuid())
-		log.Debugf("no socket address was found. Trying default address: %s", socketPath)
-		_, err := os.Stat(socketPath)
-		if err != nil {
-			log.Debugf("looking for socket file: %v", err)
-			return nil, ErrNoSocketAddress
+		for _, socketPath := range defaultSocketPaths(os.Getenv("XDG_RUNTIME_DIR"), os.Getuid()) {
+			log.Debugf("no socket address was found. Trying default address: %s", socketPath)
+			if _, err := os.Stat(socketPath); err != nil {
+				log.Debugf("looking for socket file: %v", err)
+				continue
+			}
+			addr = fmt.Sprintf("unix://%s", socketPath)
+			break
 		}
 
-		addr = fmt.Sprintf("unix://%s", socketPath)
+		if addr == "" {
+			return nil, ErrNoSocketAddress
+		}
 	}
 
 	clientOpts = append(clientOpts, client.WithHost(addr))
@@ -101,6 +106,23 @@ func ClientOverUnixSocket() (*client.Client, error) {
 	return c, err
 }
 
+// defaultSocketPaths returns the candidate podman API socket paths in the order they should be tried: for rootful
+// (uid 0) users the system socket takes precedence, otherwise the rootless socket within the user runtime directory
+// (XDG_RUNTIME_DIR, defaulting to /run/user/<uid>) is preferred.
+func defaultSocketPaths(xdgRuntimeDir string, uid int) []string {
+	const rootfulSocket = "/run/podman/podman.sock"
+
+	if xdgRuntimeDir == "" {
+		xdgRuntimeDir = fmt.Sprintf("/run/user/%d", uid)
+	}
+	rootlessSocket := filepath.Join(xdgRuntimeDir, "podman", "podman.sock")
+
+	if uid == 0 {
+		return []string{rootfulSocket, rootlessSocket}
+	}
+	return []string{rootlessSocket, rootfulSocket}
+}
+
 func GetClient() (*client.Client, error) {
 	c, err := ClientOverUnixSocket()
 	if err == nil {
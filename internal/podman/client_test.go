@@ -0,0 +1,38 @@
+package podman
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_defaultSocketPaths(t *testing.T) {
+	tests := []struct {
+		name          string
+		xdgRuntimeDir string
+		uid           int
+		want          []string
+	}{
+		{
+			name: "rootless without runtime dir",
+			uid:  1000,
+			want: []string{"/run/user/1000/podman/podman.sock", "/run/podman/podman.sock"},
+		},
+		{
+			name:          "rootless with runtime dir",
+			xdgRuntimeDir: "/tmp/runtime-1000",
+			uid:           1000,
+			want:          []string{"/tmp/runtime-1000/podman/podman.sock", "/run/podman/podman.sock"},
+		},
+		{
+			name: "rootful",
+			uid:  0,
+			want: []string{"/run/podman/podman.sock", "/run/user/0/podman/podman.sock"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, defaultSocketPaths(tt.xdgRuntimeDir, tt.uid))
+		})
+	}
+}
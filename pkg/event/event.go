@@ -9,4 +9,5 @@ const (
 	FetchImage      partybus.EventType = "fetch-image-event"
 	ReadImage       partybus.EventType = "read-image-event"
 	ReadLayer       partybus.EventType = "read-layer-event"
+	DownloadLayer   partybus.EventType = "download-layer-event"
 )
@@ -107,3 +107,21 @@ func ParseReadLayer(e partybus.Event) (*image.LayerMetadata, progress.Monitorabl
 
 	return &layerMetadata, prog, nil
 }
+
+func ParseDownloadLayer(e partybus.Event) (string, progress.Progressable, error) {
+	if err := checkEventType(e.Type, event.DownloadLayer); err != nil {
+		return "", nil, err
+	}
+
+	layerDigest, ok := e.Source.(string)
+	if !ok {
+		return "", nil, newPayloadErr(e.Type, "Source", e.Source)
+	}
+
+	prog, ok := e.Value.(progress.Progressable)
+	if !ok {
+		return "", nil, newPayloadErr(e.Type, "Value", e.Value)
+	}
+
+	return layerDigest, prog, nil
+}
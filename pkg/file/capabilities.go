@@ -0,0 +1,199 @@
+package file
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// CapabilityXattr is the extended attribute that holds the linux file capabilities of a file, which grant privileges
+// to the process executing the file (as with setuid, but for individual privileges).
+const CapabilityXattr = "security.capability"
+
+const (
+	vfsCapRevisionMask   = 0xFF000000
+	vfsCapFlagsEffective = 0x000001
+	vfsCapRevision1      = 0x01000000
+	vfsCapRevision2      = 0x02000000
+	vfsCapRevision3      = 0x03000000
+)
+
+// capabilityNames are the names of all known linux capabilities, indexed by capability number.
+var capabilityNames = []string{
+	"cap_chown",
+	"cap_dac_override",
+	"cap_dac_read_search",
+	"cap_fowner",
+	"cap_fsetid",
+	"cap_kill",
+	"cap_setgid",
+	"cap_setuid",
+	"cap_setpcap",
+	"cap_linux_immutable",
+	"cap_net_bind_service",
+	"cap_net_broadcast",
+	"cap_net_admin",
+	"cap_net_raw",
+	"cap_ipc_lock",
+	"cap_ipc_owner",
+	"cap_sys_module",
+	"cap_sys_rawio",
+	"cap_sys_chroot",
+	"cap_sys_ptrace",
+	"cap_sys_pacct",
+	"cap_sys_admin",
+	"cap_sys_boot",
+	"cap_sys_nice",
+	"cap_sys_resource",
+	"cap_sys_time",
+	"cap_sys_tty_config",
+	"cap_mknod",
+	"cap_lease",
+	"cap_audit_write",
+	"cap_audit_control",
+	"cap_setfcap",
+	"cap_mac_override",
+	"cap_mac_admin",
+	"cap_syslog",
+	"cap_wake_alarm",
+	"cap_block_suspend",
+	"cap_audit_read",
+	"cap_perfmon",
+	"cap_bpf",
+	"cap_checkpoint_restore",
+}
+
+// Capabilities is the decoded linux file capability set of a file (see CapabilityXattr).
+type Capabilities struct {
+	// Permitted are the capabilities permitted to the process executing the file (e.g. "cap_net_raw")
+	Permitted []string
+	// Inheritable are the capabilities that may be inherited from the process executing the file
+	Inheritable []string
+	// Effective indicates that the permitted capabilities are raised in the effective set on execution
+	Effective bool
+	// RootID is the user ID that is root within the user namespace the capabilities apply to (only for namespaced
+	// file capabilities, otherwise nil)
+	RootID *uint32
+}
+
+// ErrInvalidCapabilities is returned when the capability extended attribute cannot be decoded.
+type ErrInvalidCapabilities struct {
+	Reason string
+}
+
+func (e *ErrInvalidCapabilities) Error() string {
+	return fmt.Sprintf("invalid %s xattr: %s", CapabilityXattr, e.Reason)
+}
+
+// Capabilities decodes the linux file capabilities from the extended attributes of the file. Nil is returned if the
+// file has no capabilities (there is no CapabilityXattr).
+func (m Metadata) Capabilities() (*Capabilities, error) {
+	value, ok := m.Xattrs[CapabilityXattr]
+	if !ok {
+		return nil, nil
+	}
+	return ParseCapabilities(value)
+}
+
+// ParseCapabilities decodes the value of the capability extended attribute (a little endian vfs_cap_data structure,
+// any revision).
+func ParseCapabilities(value []byte) (*Capabilities, error) {
+	if len(value) < 4 {
+		return nil, &ErrInvalidCapabilities{Reason: fmt.Sprintf("too short (%d bytes)", len(value))}
+	}
+	magic := binary.LittleEndian.Uint32(value)
+
+	var words int
+	var expected int
+	switch magic & vfsCapRevisionMask {
+	case vfsCapRevision1:
+		words, expected = 1, 12
+	case vfsCapRevision2:
+		words, expected = 2, 20
+	case vfsCapRevision3:
+		words, expected = 2, 24
+	default:
+		return nil, &ErrInvalidCapabilities{Reason: fmt.Sprintf("unknown revision=0x%08x", magic&vfsCapRevisionMask)}
+	}
+	if len(value) != expected {
+		return nil, &ErrInvalidCapabilities{Reason: fmt.Sprintf("unexpected length=%d for revision=0x%08x", len(value), magic&vfsCapRevisionMask)}
+	}
+
+	// note: each word holds 32 capabilities, as a permitted and inheritable pair
+	var permitted, inheritable uint64
+	for w := 0; w < words; w++ {
+		offset := 4 + w*8
+		permitted |= uint64(binary.LittleEndian.Uint32(value[offset:])) << (32 * w)
+		inheritable |= uint64(binary.LittleEndian.Uint32(value[offset+4:])) << (32 * w)
+	}
+
+	caps := &Capabilities{
+		Permitted:   capabilitySet(permitted),
+		Inheritable: capabilitySet(inheritable),
+		Effective:   magic&vfsCapFlagsEffective != 0,
+	}
+	if magic&vfsCapRevisionMask == vfsCapRevision3 {
+		rootID := binary.LittleEndian.Uint32(value[20:])
+		caps.RootID = &rootID
+	}
+	return caps, nil
+}
+
+func capabilitySet(bits uint64) []string {
+	var names []string
+	for n := 0; n < 64; n++ {
+		if bits&(1<<uint(n)) == 0 {
+			continue
+		}
+		if n < len(capabilityNames) {
+			names = append(names, capabilityNames[n])
+		} else {
+			names = append(names, fmt.Sprintf("cap_%d", n))
+		}
+	}
+	return names
+}
+
+// String returns the capabilities in the textual form used by getcap (e.g. "cap_net_admin,cap_net_raw=ep"), where the
+// flags are "e" (effective), "i" (inheritable), and "p" (permitted).
+func (c Capabilities) String() string {
+	inheritable := make(map[string]bool)
+	for _, name := range c.Inheritable {
+		inheritable[name] = true
+	}
+	permitted := make(map[string]bool)
+	for _, name := range c.Permitted {
+		permitted[name] = true
+	}
+
+	// note: capabilities with the same flags are grouped into a single clause
+	var order []string
+	groups := make(map[string][]string)
+	add := func(name, flags string) {
+		if _, ok := groups[flags]; !ok {
+			order = append(order, flags)
+		}
+		groups[flags] = append(groups[flags], name)
+	}
+	for _, name := range c.Permitted {
+		flags := ""
+		if c.Effective {
+			flags += "e"
+		}
+		if inheritable[name] {
+			flags += "i"
+		}
+		add(name, flags+"p")
+	}
+	for _, name := range c.Inheritable {
+		if !permitted[name] {
+			add(name, "i")
+		}
+	}
+
+	var clauses []string
+	for _, flags := range order {
+		clauses = append(clauses, strings.Join(groups[flags], ",")+"="+flags)
+	}
+	return strings.Join(clauses, " ")
+}
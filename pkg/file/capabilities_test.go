@@ -0,0 +1,114 @@
+package file
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func capabilityXattr(words ...uint32) []byte {
+	value := make([]byte, 4*len(words))
+	for i, w := range words {
+		binary.LittleEndian.PutUint32(value[4*i:], w)
+	}
+	return value
+}
+
+func TestParseCapabilities(t *testing.T) {
+	rootID := uint32(100000)
+	tests := []struct {
+		name     string
+		value    []byte
+		expected *Capabilities
+		str      string
+		wantErr  bool
+	}{
+		{
+			name:     "revision 2 effective",
+			value:    capabilityXattr(0x02000001, 1<<13, 0, 0, 0),
+			expected: &Capabilities{Permitted: []string{"cap_net_raw"}, Effective: true},
+			str:      "cap_net_raw=ep",
+		},
+		{
+			name:  "revision 2 upper word and inheritable",
+			value: capabilityXattr(0x02000000, 1<<12|1<<13, 1<<13, 1<<7, 0),
+			expected: &Capabilities{
+				Permitted:   []string{"cap_net_admin", "cap_net_raw", "cap_bpf"},
+				Inheritable: []string{"cap_net_raw"},
+			},
+			str: "cap_net_admin,cap_bpf=p cap_net_raw=ip",
+		},
+		{
+			name:     "revision 1",
+			value:    capabilityXattr(0x01000001, 1<<10, 0),
+			expected: &Capabilities{Permitted: []string{"cap_net_bind_service"}, Effective: true},
+			str:      "cap_net_bind_service=ep",
+		},
+		{
+			name:     "revision 3 (namespaced)",
+			value:    capabilityXattr(0x03000001, 1<<13, 0, 0, 0, rootID),
+			expected: &Capabilities{Permitted: []string{"cap_net_raw"}, Effective: true, RootID: &rootID},
+			str:      "cap_net_raw=ep",
+		},
+		{
+			name:     "inheritable only and unknown capability",
+			value:    capabilityXattr(0x02000000, 0, 1<<0, 0, 1<<20),
+			expected: &Capabilities{Inheritable: []string{"cap_chown", "cap_52"}},
+			str:      "cap_chown,cap_52=i",
+		},
+		{
+			name:    "too short",
+			value:   []byte{0x01, 0x00},
+			wantErr: true,
+		},
+		{
+			name:    "unknown revision",
+			value:   capabilityXattr(0x04000000, 0, 0, 0, 0),
+			wantErr: true,
+		},
+		{
+			name:    "length does not match revision",
+			value:   capabilityXattr(0x02000000, 0, 0),
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := ParseCapabilities(test.value)
+			if test.wantErr {
+				var capErr *ErrInvalidCapabilities
+				assert.True(t, errors.As(err, &capErr), "unexpected error: %+v", err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, actual)
+			assert.Equal(t, test.str, actual.String())
+		})
+	}
+}
+
+func TestMetadata_Capabilities(t *testing.T) {
+	f, err := os.Open("test-fixtures/capabilities.tar")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = f.Close() })
+
+	metadata, err := MetadataFromTar(f, "bin/ping")
+	require.NoError(t, err)
+	require.Contains(t, metadata.Xattrs, CapabilityXattr)
+
+	caps, err := metadata.Capabilities()
+	require.NoError(t, err)
+	require.NotNil(t, caps)
+	assert.Equal(t, []string{"cap_net_raw"}, caps.Permitted)
+	assert.True(t, caps.Effective)
+	assert.Equal(t, "cap_net_raw=ep", caps.String())
+
+	// files without the xattr have no capabilities
+	caps, err = Metadata{}.Capabilities()
+	assert.NoError(t, err)
+	assert.Nil(t, caps)
+}
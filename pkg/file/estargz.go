@@ -0,0 +1,107 @@
+package file
+
+import (
+	"archive/tar"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+)
+
+// EStargzVisitor is the type of the function called by WalkEStargz to visit each entry within an eStargz table of
+// contents. The name argument is the path of the entry within the layer (relative to the root, e.g. "etc/hosts").
+type EStargzVisitor func(name string, entry *estargz.TOCEntry) error
+
+// WalkEStargz walks all entries within the table of contents of the given eStargz layer (sorted by path, so parents
+// are visited before children), calling fn for each entry except the root. The eStargz table of contents and landmark
+// files are not visited (see IsEStargzMetadata).
+func WalkEStargz(toc *estargz.Reader, fn EStargzVisitor) error {
+	root, ok := toc.Lookup("")
+	if !ok {
+		return fmt.Errorf("no root directory within the eStargz table of contents")
+	}
+	return walkEStargzDir(root, "", fn)
+}
+
+func walkEStargzDir(dir *estargz.TOCEntry, dirName string, fn EStargzVisitor) error {
+	children := make(map[string]*estargz.TOCEntry)
+	var names []string
+	dir.ForeachChild(func(baseName string, entry *estargz.TOCEntry) bool {
+		name := path.Join(dirName, baseName)
+		if !IsEStargzMetadata(name) {
+			children[name] = entry
+			names = append(names, name)
+		}
+		return true
+	})
+	// note: the children of each entry are not ordered within the table of contents
+	sort.Strings(names)
+
+	for _, name := range names {
+		entry := children[name]
+		if err := fn(name, entry); err != nil {
+			return err
+		}
+		if entry.Type == "dir" {
+			if err := walkEStargzDir(entry, name, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// NewMetadataFromEStargzEntry populates Metadata for the eStargz table of contents entry at the given path. There are
+// no contents to read, so the MIME type is not populated and the tar sequence is not known (-1). Note: the table of
+// contents resolves hardlinks to the entry that they link to, so an entry found at a path other than its own name is a
+// hardlink.
+func NewMetadataFromEStargzEntry(name string, entry *estargz.TOCEntry) Metadata {
+	header := tar.Header{
+		Name:     name,
+		Linkname: entry.LinkName,
+		Size:     entry.Size,
+		Mode:     entry.Mode,
+		Uid:      entry.UID,
+		Gid:      entry.GID,
+		Uname:    entry.Uname,
+		Gname:    entry.Gname,
+		ModTime:  entry.ModTime(),
+		Devmajor: int64(entry.DevMajor),
+		Devminor: int64(entry.DevMinor),
+	}
+	switch entry.Type {
+	case "dir":
+		header.Typeflag = tar.TypeDir
+	case "symlink":
+		header.Typeflag = tar.TypeSymlink
+	case "char":
+		header.Typeflag = tar.TypeChar
+	case "block":
+		header.Typeflag = tar.TypeBlock
+	case "fifo":
+		header.Typeflag = tar.TypeFifo
+	default:
+		header.Typeflag = tar.TypeReg
+	}
+	if entry.Type != "dir" && entry.Name != name {
+		header.Typeflag = tar.TypeLink
+		header.Linkname = entry.Name
+		header.Size = 0
+	}
+
+	metadata := NewMetadata(header, -1, nil)
+	metadata.Xattrs = entry.Xattrs
+	return metadata
+}
+
+// IsEStargzMetadata indicates if the given tar entry name is the eStargz table of contents or a landmark file (which
+// are not part of the layer content).
+func IsEStargzMetadata(name string) bool {
+	switch strings.TrimPrefix(path.Clean("/"+name), "/") {
+	case estargz.TOCTarName, estargz.PrefetchLandmark, estargz.NoPrefetchLandmark:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package file
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+var _ io.ReadCloser = (*lazyTarEntryReadCloser)(nil)
+
+// lazyTarEntryReadCloser is a "lazy" read closer for the contents of a single entry within a tar, allocating a file
+// descriptor for the tar only upon the first Read() call. Unlike the lazyBoundedReadCloser, the entry contents are read
+// through a tar reader (by iterating the tar up to the entry), which is necessary for entries where the raw bytes in
+// the tar do not represent the file contents (e.g. sparse files, where holes are not stored).
+type lazyTarEntryReadCloser struct {
+	// path is the path to the tar file
+	path string
+	// sequence is the nth header in the tar for the entry to read
+	sequence int64
+	// file is the active file handle for the tar
+	file *os.File
+	// reader is the tar reader positioned at the entry
+	reader io.Reader
+}
+
+func newLazyTarEntryReadCloser(path string, sequence int64) *lazyTarEntryReadCloser {
+	return &lazyTarEntryReadCloser{
+		path:     path,
+		sequence: sequence,
+	}
+}
+
+// Read implements the io.Reader interface for the tar entry, opening the tar and seeking to the entry upon the first invocation.
+func (d *lazyTarEntryReadCloser) Read(b []byte) (int, error) {
+	if err := d.openEntry(); err != nil {
+		return 0, err
+	}
+
+	n, err := d.reader.Read(b)
+	if err != nil && errors.Is(err, io.EOF) {
+		// we've reached the end of the entry, force a release of the file descriptor.
+		if closeErr := d.Close(); closeErr != nil {
+			return n, closeErr
+		}
+	}
+	return n, err
+}
+
+// Close implements the io.Closer interface for the opened tar file.
+func (d *lazyTarEntryReadCloser) Close() error {
+	if d.file == nil {
+		return nil
+	}
+
+	err := d.file.Close()
+	if err != nil && errors.Is(err, os.ErrClosed) {
+		// ignore the fact that this file has already been closed
+		err = nil
+	}
+	d.file = nil
+	d.reader = eofReader{}
+	return err
+}
+
+func (d *lazyTarEntryReadCloser) openEntry() error {
+	if d.reader != nil {
+		return nil
+	}
+
+	file, err := os.Open(d.path)
+	if err != nil {
+		return err
+	}
+
+	tarReader := tar.NewReader(file)
+	for sequence := int64(0); sequence <= d.sequence; sequence++ {
+		if _, err := tarReader.Next(); err != nil {
+			_ = file.Close()
+			return fmt.Errorf("unable to find tar entry sequence=%d in %q: %w", d.sequence, d.path, err)
+		}
+	}
+
+	d.file = file
+	d.reader = tarReader
+	return nil
+}
+
+// eofReader is a reader that is always at EOF (used after the underlying tar has been released).
+type eofReader struct{}
+
+func (eofReader) Read([]byte) (int, error) {
+	return 0, io.EOF
+}
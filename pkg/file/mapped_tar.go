@@ -0,0 +1,146 @@
+package file
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// MappedTar provides random access to the entry contents of a tar on disk by memory mapping the whole tar, so that
+// reading any entry neither opens the tar nor seeks within it. The contents of each entry are found by the offset
+// index, which is built by adding the entries of the tar (see MappedTar.Add). Close unmaps the tar, after which any
+// reader given out returns an error.
+type MappedTar struct {
+	lock   sync.RWMutex
+	path   string
+	data   []byte
+	unmap  func() error
+	closed bool
+	// index maps the normalized absolute path of each added entry to the entry contents (the last entry added for a
+	// path wins, as with extraction)
+	index map[Path]mappedTarEntry
+}
+
+type mappedTarEntry struct {
+	offset int64
+	size   int64
+}
+
+// NewMappedTar memory maps the tar at the given path. An error is returned if memory mapping is not supported on the
+// current platform.
+func NewMappedTar(tarPath string) (*MappedTar, error) {
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	data, unmap, err := mmapFile(f, info.Size())
+	if err != nil {
+		return nil, fmt.Errorf("unable to memory map tar=%q: %w", tarPath, err)
+	}
+
+	return &MappedTar{
+		path:  tarPath,
+		data:  data,
+		unmap: unmap,
+		index: make(map[Path]mappedTarEntry),
+	}, nil
+}
+
+// Add records the location of the contents for the given entry of the mapped tar. Sparse entries are not stored
+// contiguously within the tar and are not added (see MappedTar.Opener).
+func (m *MappedTar) Add(entry TarIndexEntry) error {
+	if isSparse(entry.header) {
+		return nil
+	}
+	offset, size := entry.seekPosition, entry.header.Size
+	if offset < 0 || size < 0 || offset+size > int64(len(m.data)) {
+		return fmt.Errorf("tar entry=%q is out of bounds of the mapped tar=%q", entry.header.Name, m.path)
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.index[Path(entry.header.Name).ToAbsolute()] = mappedTarEntry{offset: offset, size: size}
+	return nil
+}
+
+// Open returns a reader for the contents of the last entry added for the given path, or false if no such entry was
+// added.
+func (m *MappedTar) Open(p Path) (io.ReadCloser, bool) {
+	m.lock.RLock()
+	entry, ok := m.index[p.ToAbsolute()]
+	m.lock.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	return m.section(entry.offset, entry.size), true
+}
+
+// Opener returns a function that opens the contents of the given entry from the mapped tar. Sparse entries are read
+// from the tar on disk instead (see TarIndexEntry.Open).
+func (m *MappedTar) Opener(entry TarIndexEntry) Opener {
+	if isSparse(entry.header) {
+		return entry.Open
+	}
+	offset, size := entry.seekPosition, entry.header.Size
+	return func() io.ReadCloser {
+		return m.section(offset, size)
+	}
+}
+
+func (m *MappedTar) section(offset, size int64) io.ReadCloser {
+	return mappedSection{SectionReader: io.NewSectionReader(mappedReaderAt{m}, offset, size)}
+}
+
+// Close unmaps the tar (the tar on disk is not removed).
+func (m *MappedTar) Close() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.closed {
+		return nil
+	}
+	m.closed = true
+	m.data = nil
+	return m.unmap()
+}
+
+var _ io.ReadSeekCloser = (*mappedSection)(nil)
+
+// mappedSection is the contents of a single entry within the mapped tar, which may be seeked and read at any offset
+// (there is nothing to release on close, as the tar stays mapped until MappedTar.Close).
+type mappedSection struct {
+	*io.SectionReader
+}
+
+func (mappedSection) Close() error {
+	return nil
+}
+
+// mappedReaderAt reads from the mapped tar, guarding against reads after the tar has been unmapped (which would
+// otherwise fault).
+type mappedReaderAt struct {
+	m *MappedTar
+}
+
+func (r mappedReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	r.m.lock.RLock()
+	defer r.m.lock.RUnlock()
+	if r.m.closed {
+		return 0, fmt.Errorf("unable to read from tar=%q: %w", r.m.path, os.ErrClosed)
+	}
+	if off >= int64(len(r.m.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, r.m.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
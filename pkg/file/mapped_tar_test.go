@@ -0,0 +1,149 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package file
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTar writes a tar with the given entries (name to contents) in order, returning the tar path.
+func writeTar(t testing.TB, entries [][2]string) string {
+	t.Helper()
+	tarPath := filepath.Join(t.TempDir(), "test.tar")
+	f, err := os.Create(tarPath)
+	require.NoError(t, err)
+	tw := tar.NewWriter(f)
+	for _, entry := range entries {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: entry[0], Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(entry[1]))}))
+		_, err = tw.Write([]byte(entry[1]))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, f.Close())
+	return tarPath
+}
+
+func indexMappedTar(t testing.TB, tarPath string) (*MappedTar, *TarIndex) {
+	t.Helper()
+	mapped, err := NewMappedTar(tarPath)
+	require.NoError(t, err)
+	index, err := NewTarIndex(tarPath, mapped.Add)
+	require.NoError(t, err)
+	return mapped, index
+}
+
+func TestMappedTar(t *testing.T) {
+	tarPath := writeTar(t, [][2]string{
+		{"etc/hosts", "127.0.0.1 localhost\n"},
+		{"./etc/os-release", "ID=test\n"},
+		{"empty", ""},
+		// the last entry for a path wins
+		{"/etc/hosts", "::1 localhost\n"},
+	})
+	mapped, index := indexMappedTar(t, tarPath)
+
+	for p, expected := range map[Path]string{
+		"/etc/hosts":        "::1 localhost\n",
+		"etc/os-release":    "ID=test\n",
+		"/empty":            "",
+		"/etc/../etc/hosts": "::1 localhost\n",
+	} {
+		r, ok := mapped.Open(p)
+		require.True(t, ok, p)
+		contents, err := ioutil.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(contents), p)
+	}
+
+	_, ok := mapped.Open("/missing")
+	assert.False(t, ok)
+
+	// every entry may be opened by offset, and the contents are seekable
+	entries := index.Entries()
+	require.Len(t, entries, 4)
+	r := mapped.Opener(entries[0])()
+	seeker, ok := r.(io.ReadSeeker)
+	require.True(t, ok)
+	_, err := seeker.Seek(10, io.SeekStart)
+	require.NoError(t, err)
+	contents, err := ioutil.ReadAll(seeker)
+	require.NoError(t, err)
+	assert.Equal(t, "localhost\n", string(contents))
+
+	// readers fail (rather than fault) once the tar is unmapped
+	r = mapped.Opener(entries[1])()
+	require.NoError(t, mapped.Close())
+	require.NoError(t, mapped.Close())
+	_, err = ioutil.ReadAll(r)
+	assert.ErrorIs(t, err, os.ErrClosed)
+}
+
+func TestMappedTar_EmptyTar(t *testing.T) {
+	tarPath := filepath.Join(t.TempDir(), "empty.tar")
+	require.NoError(t, ioutil.WriteFile(tarPath, nil, 0644))
+
+	mapped, err := NewMappedTar(tarPath)
+	require.NoError(t, err)
+	_, ok := mapped.Open("/anything")
+	assert.False(t, ok)
+	assert.NoError(t, mapped.Close())
+}
+
+func randomReadFixture(b *testing.B) (string, []Path) {
+	var entries [][2]string
+	var paths []Path
+	contents := string(make([]byte, 16*1024))
+	for i := 0; i < 1000; i++ {
+		name := fmt.Sprintf("usr/lib/file-%d", i)
+		entries = append(entries, [2]string{name, contents})
+		paths = append(paths, Path(name).ToAbsolute())
+	}
+	return writeTar(b, entries), paths
+}
+
+func BenchmarkTarIndex_RandomReads(b *testing.B) {
+	tarPath, paths := randomReadFixture(b)
+	index, err := NewTarIndex(tarPath, nil)
+	require.NoError(b, err)
+	random := rand.New(rand.NewSource(0))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		entries, err := index.EntriesByPath(paths[random.Intn(len(paths))])
+		if err != nil || len(entries) == 0 {
+			b.Fatalf("unable to find entry: %+v", err)
+		}
+		if _, err := io.Copy(ioutil.Discard, entries[0].Reader); err != nil {
+			b.Fatalf("unable to read entry: %+v", err)
+		}
+	}
+}
+
+func BenchmarkMappedTar_RandomReads(b *testing.B) {
+	tarPath, paths := randomReadFixture(b)
+	mapped, _ := indexMappedTar(b, tarPath)
+	b.Cleanup(func() { _ = mapped.Close() })
+	random := rand.New(rand.NewSource(0))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r, ok := mapped.Open(paths[random.Intn(len(paths))])
+		if !ok {
+			b.Fatal("unable to find entry")
+		}
+		if _, err := io.Copy(ioutil.Discard, r); err != nil {
+			b.Fatalf("unable to read entry: %+v", err)
+		}
+	}
+}
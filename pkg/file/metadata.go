@@ -4,8 +4,9 @@ import (
 	"archive/tar"
 	"io"
 	"os"
-	"path"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/sylabs/squashfs"
 )
@@ -27,13 +28,33 @@ type Metadata struct {
 	// TypeFlag is the tar.TypeFlag entry for the file
 	TypeFlag byte
 	IsDir    bool
+	// Mode is the permission and file type bits (including os.ModeSetuid, os.ModeSetgid, and os.ModeSticky)
 	Mode     os.FileMode
 	MIMEType string
+	// ModTime is the last modification time of the file (with sub-second precision when the archive records it, e.g.
+	// within the PAX "mtime" record)
+	ModTime time.Time
+	// AccessTime and ChangeTime are the last access and status change times of the file, only when the archive records
+	// them (e.g. within the PAX "atime" and "ctime" records), otherwise they are zero
+	AccessTime time.Time
+	ChangeTime time.Time
+	// DeviceMajor and DeviceMinor are populated only for character and block devices
+	DeviceMajor int64
+	DeviceMinor int64
+	// Digest is the sha256 of the file contents (e.g. "sha256:..."), only for regular files when digests are computed
+	// while indexing (see image.WithFileDigests)
+	Digest string
+	// Xattrs are the extended attributes of the file (e.g. "security.capability", see Metadata.Capabilities), keyed by
+	// attribute name
+	Xattrs map[string][]byte
 }
 
+// paxXattrPrefix is the PAX record prefix used to encode extended attributes within tar headers
+const paxXattrPrefix = "SCHILY.xattr."
+
 func NewMetadata(header tar.Header, sequence int64, content io.Reader) Metadata {
 	return Metadata{
-		Path:          path.Clean(DirSeparator + header.Name),
+		Path:          string(Path(header.Name).ToAbsolute()),
 		TarHeaderName: header.Name,
 		TarSequence:   sequence,
 		TypeFlag:      header.Typeflag,
@@ -44,7 +65,38 @@ func NewMetadata(header tar.Header, sequence int64, content io.Reader) Metadata
 		GroupID:       header.Gid,
 		IsDir:         header.FileInfo().IsDir(),
 		MIMEType:      MIMEType(content),
+		ModTime:       header.ModTime,
+		AccessTime:    header.AccessTime,
+		ChangeTime:    header.ChangeTime,
+		DeviceMajor:   header.Devmajor,
+		DeviceMinor:   header.Devminor,
+		Xattrs:        xattrsFromHeader(header),
+	}
+}
+
+// xattrsFromHeader returns all extended attributes encoded within the tar header PAX records (or nil if there are none).
+func xattrsFromHeader(header tar.Header) map[string][]byte {
+	var xattrs map[string][]byte
+	for k, v := range header.PAXRecords {
+		if !strings.HasPrefix(k, paxXattrPrefix) {
+			continue
+		}
+		if xattrs == nil {
+			xattrs = make(map[string][]byte)
+		}
+		xattrs[strings.TrimPrefix(k, paxXattrPrefix)] = []byte(v)
+	}
+
+	// note: the deprecated Xattrs field may still be set on headers that were constructed without PAX records
+	for k, v := range header.Xattrs { // nolint:staticcheck
+		if xattrs == nil {
+			xattrs = make(map[string][]byte)
+		}
+		if _, exists := xattrs[k]; !exists {
+			xattrs[k] = []byte(v)
+		}
 	}
+	return xattrs
 }
 
 // NewMetadataFromSquashFSFile populates Metadata for the entry at path, with details from f.
@@ -60,6 +112,7 @@ func NewMetadataFromSquashFSFile(path string, f *squashfs.File) (Metadata, error
 		Size:     fi.Size(),
 		IsDir:    f.IsDir(),
 		Mode:     fi.Mode(),
+		ModTime:  fi.ModTime(),
 	}
 
 	if f.IsRegular() {
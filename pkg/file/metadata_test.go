@@ -4,12 +4,16 @@
 package file
 
 import (
+	"archive/tar"
 	"io"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-test/deep"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestFileMetadataFromTar(t *testing.T) {
@@ -31,7 +35,10 @@ func TestFileMetadataFromTar(t *testing.T) {
 		if strings.HasSuffix(entry.Header.Name, ".txt") {
 			contents = strings.NewReader("#!/usr/bin/env bash\necho 'awesome script'")
 		}
-		actual = append(actual, NewMetadata(entry.Header, entry.Sequence, contents))
+		m := NewMetadata(entry.Header, entry.Sequence, contents)
+		// note: modification times are not stable across fixture generations
+		m.ModTime = time.Time{}
+		actual = append(actual, m)
 		return nil
 	}
 
@@ -43,3 +50,119 @@ func TestFileMetadataFromTar(t *testing.T) {
 		t.Errorf("diff: %s", d)
 	}
 }
+
+func TestNewMetadata_HeaderFields(t *testing.T) {
+	modTime := time.Date(2021, 6, 1, 12, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		header   tar.Header
+		expected Metadata
+	}{
+		{
+			name: "setuid and setgid",
+			header: tar.Header{
+				Name:     "usr/bin/passwd",
+				Typeflag: tar.TypeReg,
+				Mode:     04755 | 02000,
+				Uid:      0,
+				Gid:      42,
+				ModTime:  modTime,
+			},
+			expected: Metadata{
+				Path:          "/usr/bin/passwd",
+				TarHeaderName: "usr/bin/passwd",
+				TypeFlag:      tar.TypeReg,
+				Mode:          os.ModeSetuid | os.ModeSetgid | 0o755,
+				GroupID:       42,
+				ModTime:       modTime,
+			},
+		},
+		{
+			name: "character device",
+			header: tar.Header{
+				Name:     "dev/null",
+				Typeflag: tar.TypeChar,
+				Mode:     0o666,
+				Devmajor: 1,
+				Devminor: 3,
+				ModTime:  modTime,
+			},
+			expected: Metadata{
+				Path:          "/dev/null",
+				TarHeaderName: "dev/null",
+				TypeFlag:      tar.TypeChar,
+				Mode:          os.ModeDevice | os.ModeCharDevice | 0o666,
+				ModTime:       modTime,
+				DeviceMajor:   1,
+				DeviceMinor:   3,
+			},
+		},
+		{
+			name: "xattrs",
+			header: tar.Header{
+				Name:     "usr/bin/ping",
+				Typeflag: tar.TypeReg,
+				Mode:     0o755,
+				ModTime:  modTime,
+				PAXRecords: map[string]string{
+					"SCHILY.xattr.security.capability": "\x01\x00\x00\x02",
+					"SCHILY.xattr.user.note":           "hello",
+					"mtime":                            "1622550600",
+				},
+			},
+			expected: Metadata{
+				Path:          "/usr/bin/ping",
+				TarHeaderName: "usr/bin/ping",
+				TypeFlag:      tar.TypeReg,
+				Mode:          0o755,
+				ModTime:       modTime,
+				Xattrs: map[string][]byte{
+					"security.capability": []byte("\x01\x00\x00\x02"),
+					"user.note":           []byte("hello"),
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, NewMetadata(test.header, 0, nil))
+		})
+	}
+}
+
+func TestMetadataFromTar_Timestamps(t *testing.T) {
+	tests := []struct {
+		name       string
+		modTime    time.Time
+		accessTime time.Time
+		changeTime time.Time
+	}{
+		{
+			name:       "precise.txt",
+			modTime:    time.Unix(1609459200, 123456789),
+			accessTime: time.Unix(1609459260, 500000000),
+			changeTime: time.Unix(1609459320, 1),
+		},
+		{
+			// no sub-second precision, access time, or change time recorded
+			name:    "seconds.txt",
+			modTime: time.Unix(1609459200, 0),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, err := os.Open("test-fixtures/timestamps.tar")
+			require.NoError(t, err)
+			t.Cleanup(func() { _ = f.Close() })
+
+			metadata, err := MetadataFromTar(f, test.name)
+			require.NoError(t, err)
+			assert.True(t, test.modTime.Equal(metadata.ModTime), "unexpected mod time: %s", metadata.ModTime)
+			assert.Equal(t, test.modTime.Nanosecond(), metadata.ModTime.Nanosecond())
+			assert.True(t, test.accessTime.Equal(metadata.AccessTime), "unexpected access time: %s", metadata.AccessTime)
+			assert.True(t, test.changeTime.Equal(metadata.ChangeTime), "unexpected change time: %s", metadata.ChangeTime)
+		})
+	}
+}
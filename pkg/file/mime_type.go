@@ -1,15 +1,23 @@
 package file
 
 import (
+	"bytes"
 	"io"
 	"strings"
 
 	"github.com/gabriel-vasile/mimetype"
 )
 
+// PEMMIMEType is the MIME type reported for PEM encoded content (certificates, keys, etc.), which would otherwise be
+// reported as plain text.
+const PEMMIMEType = "application/x-pem-file"
+
+var pemPrefix = []byte("-----BEGIN ")
+
 // MIMEType attempts to guess at the MIME type of a file given the contents. If there is no contents, then an empty
 // string is returned. If the MIME type could not be determined and the contents are not empty, then a MIME type
-// of "application/octet-stream" is returned.
+// of "application/octet-stream" is returned. Executables are reported by format (e.g. "application/x-executable" for
+// ELF, "application/x-mach-binary" for Mach-O, and "application/vnd.microsoft.portable-executable" for PE).
 func MIMEType(reader io.Reader) string {
 	if reader == nil {
 		return ""
@@ -24,6 +32,10 @@ func MIMEType(reader io.Reader) string {
 		mTypeStr = strings.Split(mType.String(), ";")[0]
 	}
 
+	if mTypeStr == "text/plain" && bytes.HasPrefix(s.prefix, pemPrefix) {
+		mTypeStr = PEMMIMEType
+	}
+
 	// we may have a reader that is not nil but the observed contents was empty
 	if s.size == 0 {
 		return ""
@@ -35,10 +47,18 @@ func MIMEType(reader io.Reader) string {
 type sizer struct {
 	reader io.Reader
 	size   int64
+	// prefix holds the first bytes read (enough to match additional magic values)
+	prefix []byte
 }
 
 func (s *sizer) Read(p []byte) (int, error) {
 	n, err := s.reader.Read(p)
 	s.size += int64(n)
+	if remaining := len(pemPrefix) - len(s.prefix); remaining > 0 && n > 0 {
+		if remaining > n {
+			remaining = n
+		}
+		s.prefix = append(s.prefix, p[:remaining]...)
+	}
 	return n, err
 }
@@ -32,6 +32,21 @@ func Test_MIMEType(t *testing.T) {
 			fixture:  fileReader("test-fixtures/mime/capture.sh"),
 			expected: "text/plain",
 		},
+		{
+			name:     "elf binary",
+			fixture:  strings.NewReader("\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\x3e\x00" + strings.Repeat("\x00", 64)),
+			expected: "application/x-executable",
+		},
+		{
+			name:     "pem certificate",
+			fixture:  strings.NewReader("-----BEGIN CERTIFICATE-----\nMIIBszCCAVmgAwIBAgIUd\n-----END CERTIFICATE-----\n"),
+			expected: PEMMIMEType,
+		},
+		{
+			name:     "text mentioning pem",
+			fixture:  strings.NewReader("see -----BEGIN CERTIFICATE----- below\n"),
+			expected: "text/plain",
+		},
 		{
 			name:     "no contents",
 			fixture:  strings.NewReader(""),
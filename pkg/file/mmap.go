@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package file
+
+import (
+	"errors"
+	"os"
+)
+
+// mmapFile maps the given file into memory, which is not supported on this platform.
+func mmapFile(*os.File, int64) ([]byte, func() error, error) {
+	return nil, nil, errors.New("memory mapping is not supported on this platform")
+}
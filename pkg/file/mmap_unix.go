@@ -0,0 +1,23 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package file
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmapFile maps the given file (of the given size) read-only into memory, returning the mapped contents along with a
+// function to unmap them.
+func mmapFile(f *os.File, size int64) ([]byte, func() error, error) {
+	if size == 0 {
+		// an empty file cannot be mapped (and there is nothing to read)
+		return nil, func() error { return nil }, nil
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
@@ -3,6 +3,7 @@ package file
 import (
 	"fmt"
 	"path"
+	"sort"
 	"strings"
 )
 
@@ -10,6 +11,14 @@ const (
 	WhiteoutPrefix = ".wh."
 	OpaqueWhiteout = WhiteoutPrefix + WhiteoutPrefix + ".opq"
 	DirSeparator   = "/"
+
+	// AufsMetadataPrefix is the basename prefix for metadata written into layers by the (legacy) AUFS storage driver,
+	// such as the "/.wh..wh.aufs" file and the "/.wh..wh.plnk" (hardlink) and "/.wh..wh.orph" (orphan) directories.
+	// Other than OpaqueWhiteout, which shares the prefix, these entries are neither whiteouts nor image content.
+	AufsMetadataPrefix = WhiteoutPrefix + WhiteoutPrefix
+
+	// WindowsDirSeparator is the path separator used within windows container image layers
+	WindowsDirSeparator = `\`
 )
 
 // Path represents a file path
@@ -33,36 +42,325 @@ func (p Path) Normalize() Path {
 	return Path(path.Clean(trimmed))
 }
 
+// ErrInvalidPath is returned when validating a path that contains a NUL byte or another control character, which are
+// never expected in well-formed image paths (and may indicate a crafted archive).
+type ErrInvalidPath struct {
+	Path Path
+	// Offset is the byte offset of the first offending character within the path
+	Offset int
+}
+
+func (e *ErrInvalidPath) Error() string {
+	return fmt.Sprintf("path contains a control character at offset=%d (path=%q)", e.Offset, e.Path)
+}
+
+// Validate returns an ErrInvalidPath if the path contains a NUL byte or any other ASCII control character. Note:
+// Normalize keeps such characters as-is since paths may legitimately contain unusual bytes, so validation is opt-in.
+func (p Path) Validate() error {
+	for i := 0; i < len(p); i++ {
+		if c := p[i]; c < 0x20 || c == 0x7f {
+			return &ErrInvalidPath{Path: p, Offset: i}
+		}
+	}
+	return nil
+}
+
+// EqualFold indicates if both paths are the same once normalized (e.g. "/Foo//Bar/" and "/foo/bar"), comparing case
+// insensitively. This is the same comparison used for case-insensitive link resolution: simple Unicode case folding
+// (see strings.EqualFold), so the Kelvin sign (U+212A) matches "k", however, multi-character foldings are not
+// considered ("ß" does not match "ss"). Note: only "/" is treated as a separator, so windows paths should be
+// converted with NormalizeWindows first.
+func (p Path) EqualFold(other Path) bool {
+	return strings.EqualFold(string(p.Normalize()), string(other.Normalize()))
+}
+
+// NormalizeStrict is like Normalize, but returns an ErrInvalidPath for paths that do not pass Validate.
+func (p Path) NormalizeStrict() (Path, error) {
+	if err := p.Validate(); err != nil {
+		return "", err
+	}
+	return p.Normalize(), nil
+}
+
+// IsExplicitDir indicates if the path, as given (before normalizing), can only refer to a directory. This is the case
+// when the path has a trailing separator (e.g. "/etc/") or ends with a "." or ".." component (e.g. "/etc/."). Note:
+// this is only the path syntax, a path without a trailing separator (e.g. "/etc") may still refer to a directory.
+func (p Path) IsExplicitDir() bool {
+	s := string(p)
+	switch {
+	case strings.HasSuffix(s, DirSeparator):
+		return true
+	case s == "." || s == "..":
+		return true
+	}
+	return strings.HasSuffix(s, DirSeparator+".") || strings.HasSuffix(s, DirSeparator+"..")
+}
+
+// IsRoot indicates if the path refers to the root directory once normalized (e.g. "/", "//", "/.", or "").
+func (p Path) IsRoot() bool {
+	return p.Normalize() == DirSeparator
+}
+
 func (p Path) IsAbsolutePath() bool {
 	return strings.HasPrefix(string(p), DirSeparator)
 }
 
+// ToAbsolute returns the normalized path with a leading separator (e.g. "etc/hosts" = "/etc/hosts"). As with all
+// image paths, relative paths are taken to be relative to the root, so parent references never go above the root
+// (e.g. "../etc" = "/etc").
+func (p Path) ToAbsolute() Path {
+	if p.IsAbsolutePath() {
+		return p.Normalize()
+	}
+	return Path(DirSeparator + string(p)).Normalize()
+}
+
+// ToRelative returns the normalized path without a leading separator (e.g. "/etc/hosts" = "etc/hosts"), which is
+// suitable for joining with a destination directory. The root is "." and, as with ToAbsolute, parent references never
+// go above the root (e.g. "../etc" = "etc").
+func (p Path) ToRelative() Path {
+	absolute := p.ToAbsolute()
+	if absolute == DirSeparator {
+		return "."
+	}
+	return Path(strings.TrimPrefix(string(absolute), DirSeparator))
+}
+
+// SanitizeToRoot cleans the path (collapsing redundant separators and "." segments) such that it can never resolve above
+// the root, which is useful for untrusted paths from archives. Unlike Normalize, which keeps leading ".." segments of
+// relative paths (e.g. "../../x"), parent references above the root are dropped (e.g. "../../x" = "x" and
+// "/a/../../b" = "/b"). An absolute path remains absolute and a relative path remains relative (where "." is the root).
+func (p Path) SanitizeToRoot() Path {
+	if p.IsAbsolutePath() {
+		return p.ToAbsolute()
+	}
+	return p.ToRelative()
+}
+
+// HasPrefix indicates if the path is the given directory or lives under it, matching whole path components only
+// (e.g. "/etc" is a prefix of "/etc/passwd" but not of "/etcd/config"). Both paths are normalized first, and the
+// root directory is a prefix of every path.
+func (p Path) HasPrefix(dir Path) bool {
+	normalizedDir := dir.Normalize()
+	if normalizedDir == DirSeparator {
+		return true
+	}
+
+	normalized := p.Normalize()
+	if normalized == normalizedDir {
+		return true
+	}
+	return strings.HasPrefix(string(normalized), string(normalizedDir)+DirSeparator)
+}
+
+// HasComponentSuffix indicates if the path ends with the given path, matching whole path components only (e.g.
+// "/lib/libc.so" ends with "libc.so" and "lib/libc.so", but not with "bc.so"). Both paths are normalized first. An
+// absolute suffix must match the whole path (e.g. "/lib/libc.so" ends with "/lib/libc.so", but not with "/libc.so").
+func (p Path) HasComponentSuffix(suffix Path) bool {
+	normalizedSuffix := suffix.Normalize()
+	normalized := p.Normalize()
+	if normalized == normalizedSuffix {
+		return true
+	}
+	if strings.HasPrefix(string(normalizedSuffix), DirSeparator) || normalizedSuffix == "." {
+		return false
+	}
+	return strings.HasSuffix(string(normalized), DirSeparator+string(normalizedSuffix))
+}
+
+// IsParentOf indicates if the path is the direct parent directory of the given child path (e.g. "/a" is the parent of
+// "/a/b", but not of "/a/b/c" or "/a"). Both paths are normalized first.
+func (p Path) IsParentOf(child Path) bool {
+	parent, err := child.Normalize().ParentPath()
+	if err != nil {
+		return false
+	}
+	return parent == p.Normalize()
+}
+
+// CommonAncestor returns the deepest path that all of the given (absolute) paths are equal to or live under, matching
+// whole path components only (e.g. "/usr/lib/a" and "/usr/local/b" = "/usr", and "/etc" and "/etcd" = "/"). All paths
+// are normalized first. If one of the paths is an ancestor of all others (or there is a single path) then that path is
+// returned. If no paths are given, or the paths share no common root (e.g. a mix of relative and absolute paths), then
+// an empty path is returned.
+func CommonAncestor(paths ...Path) Path {
+	if len(paths) == 0 {
+		return ""
+	}
+
+	common := strings.Split(string(paths[0].Normalize()), DirSeparator)
+	for _, p := range paths[1:] {
+		components := strings.Split(string(p.Normalize()), DirSeparator)
+		n := 0
+		for n < len(common) && n < len(components) && common[n] == components[n] {
+			n++
+		}
+		common = common[:n]
+	}
+
+	switch {
+	case len(common) == 0:
+		return ""
+	case len(common) == 1 && common[0] == "":
+		// only the leading (empty) component before the root separator is shared
+		return DirSeparator
+	}
+	return Path(strings.Join(common, DirSeparator)).Normalize()
+}
+
+// Depth returns the number of components in the normalized path (e.g. "/" = 0, "/a" = 1, "/a/b" = 2).
+func (p Path) Depth() int {
+	normalized := p.Normalize()
+	if normalized == DirSeparator {
+		return 0
+	}
+	return strings.Count(strings.Trim(string(normalized), DirSeparator), DirSeparator) + 1
+}
+
+// CountSegments returns the number of components in the normalized path, the same as Depth (e.g. "/" = 0, "/a/b" = 2).
+func (p Path) CountSegments() int {
+	return p.Depth()
+}
+
+// RelativeTo returns the portion of the path below the given base directory (e.g. "/a/b/c" relative to "/a" is
+// "b/c"), or "." if the paths are the same. Both paths are normalized first. An error is returned if the path is not
+// the base directory or does not live under it.
+func (p Path) RelativeTo(base Path) (Path, error) {
+	if !p.HasPrefix(base) {
+		return "", fmt.Errorf("path %q is not under %q", p, base)
+	}
+
+	normalized, normalizedBase := p.Normalize(), base.Normalize()
+	if normalized == normalizedBase {
+		return ".", nil
+	}
+	return Path(strings.TrimPrefix(strings.TrimPrefix(string(normalized), string(normalizedBase)), DirSeparator)), nil
+}
+
 // Basename of the path (i.e. filename)
 func (p Path) Basename() string {
 	return path.Base(string(p))
 }
 
+// Join appends the given parts to the path as additional path components and returns the normalized result (e.g.
+// "/usr".Join("lib", "x.so") = "/usr/lib/x.so"). As with POSIX path resolution, a separator at the start of a part is
+// only a redundant separator, it does not reset the path to the root (e.g. "/usr".Join("/lib") = "/usr/lib"), and
+// parent references are resolved lexically (e.g. "/usr/lib".Join("../bin") = "/usr/bin"). An absolute path never goes
+// above the root, however, a relative path keeps any parent references past its start (e.g. "a".Join("../../b") is
+// "../b").
+func (p Path) Join(parts ...string) Path {
+	return Path(path.Join(append([]string{string(p)}, parts...)...)).Normalize()
+}
+
+// Ext returns the file extension of the basename including the dot (e.g. "/etc/nginx.conf" = ".conf",
+// "/a.tar.gz" = ".gz"), or an empty string if there is none. The leading dot of a hidden file is not considered an
+// extension (e.g. "/root/.bashrc" = "", but "/root/.config.json" = ".json").
+func (p Path) Ext() string {
+	base := strings.TrimPrefix(p.Normalize().Basename(), ".")
+	return path.Ext(base)
+}
+
+// IsHidden indicates if the basename is a hidden (dot) file or directory (e.g. "/root/.bashrc" or "/home/user/.config").
+// Names with a whiteout prefix (".wh.", see IsWhiteout and IsAufsMetadata) also start with a dot, however, these
+// describe changes to lower layers (or storage driver metadata) instead of the image content, so are never hidden.
+// The "." and ".." references are not hidden either.
+func (p Path) IsHidden() bool {
+	return isHiddenName(p.Normalize().Basename())
+}
+
+// HasHiddenComponent indicates if any component of the path is hidden (see IsHidden), meaning that the path is either
+// hidden itself or within a hidden directory (e.g. "/home/user/.config/app/settings.json").
+func (p Path) HasHiddenComponent() bool {
+	hidden := false
+	p.EachComponent(func(component string, _ Path) bool {
+		hidden = isHiddenName(component)
+		return !hidden
+	})
+	return hidden
+}
+
+func isHiddenName(name string) bool {
+	if name == "." || name == ".." || strings.HasPrefix(name, WhiteoutPrefix) {
+		return false
+	}
+	return strings.HasPrefix(name, ".")
+}
+
 // IsDirWhiteout indicates if the path has a basename is a opaque whiteout (which means all parent directory contents should be ignored during squashing)
 func (p Path) IsDirWhiteout() bool {
 	return p.Basename() == OpaqueWhiteout
 }
 
-// IsWhiteout indicates if the file basename has a whiteout prefix (which means that the file should be removed during squashing)
+// IsWhiteout indicates if the file basename has a whiteout prefix (which means that the file should be removed during
+// squashing). AUFS metadata (see IsAufsMetadata) is not considered a whiteout.
 func (p Path) IsWhiteout() bool {
-	return strings.HasPrefix(p.Basename(), WhiteoutPrefix)
+	base := p.Basename()
+	return strings.HasPrefix(base, WhiteoutPrefix) && !isAufsMetadataName(base)
 }
 
-// UnWhiteoutPath is a representation of the current path with no whiteout prefixes
-func (p Path) UnWhiteoutPath() (Path, error) {
-	basename := p.Basename()
-	if strings.HasPrefix(basename, OpaqueWhiteout) {
-		return p.ParentPath()
+// IsAufsMetadata indicates if the path is (or is within) metadata written by the AUFS storage driver (e.g.
+// "/.wh..wh.aufs" or "/.wh..wh.plnk/1234.5678"), which should be ignored when reading a layer.
+func (p Path) IsAufsMetadata() bool {
+	for _, name := range strings.Split(string(p.Normalize()), DirSeparator) {
+		if isAufsMetadataName(name) {
+			return true
+		}
 	}
-	parent, err := p.ParentPath()
-	if err != nil {
-		return "", err
+	return false
+}
+
+func isAufsMetadataName(name string) bool {
+	return strings.HasPrefix(name, AufsMetadataPrefix) && name != OpaqueWhiteout
+}
+
+// WhiteoutKind describes the effect a whiteout path has on the contents of lower layers.
+type WhiteoutKind int
+
+const (
+	// NotWhiteout indicates the path is not a whiteout.
+	NotWhiteout WhiteoutKind = iota
+	// FileWhiteout indicates the path removes a single path (and any children) from lower layers (e.g. /a/.wh.b removes /a/b).
+	FileWhiteout
+	// OpaqueDirWhiteout indicates the path removes all lower layer contents of the parent directory, but not the
+	// directory itself (e.g. /a/.wh..wh..opq removes all children of /a).
+	OpaqueDirWhiteout
+)
+
+// WhiteoutKind returns the kind of whiteout the path represents (if any).
+func (p Path) WhiteoutKind() WhiteoutKind {
+	switch {
+	case p.IsDirWhiteout():
+		return OpaqueDirWhiteout
+	case p.IsWhiteout():
+		return FileWhiteout
+	default:
+		return NotWhiteout
+	}
+}
+
+// UnWhiteoutPath returns the path affected by the current whiteout path along with the kind of whiteout. For a file
+// whiteout this is the path being removed, for an opaque whiteout this is the directory whose lower contents are being
+// removed. An opaque whiteout at the root ("/.wh..wh..opq") affects the root directory itself, meaning that everything
+// from lower layers is removed (while paths added by the same or any higher layer are kept). Note: per the OCI image
+// spec, any basename with a whiteout prefix is a whiteout, there is no way to represent a regular file with such a name
+// within a layer (the only exception being AUFS metadata, which is ignored).
+func (p Path) UnWhiteoutPath() (Path, WhiteoutKind, error) {
+	kind := p.WhiteoutKind()
+	switch kind {
+	case NotWhiteout:
+		return "", kind, fmt.Errorf("path is not a whiteout: %q", p)
+	case OpaqueDirWhiteout:
+		// note: the path is normalized first so relative root whiteouts (e.g. "./.wh..wh..opq") also resolve to "/"
+		parent, err := p.Normalize().ParentPath()
+		return parent, kind, err
+	}
+
+	name := strings.TrimPrefix(p.Basename(), WhiteoutPrefix)
+	if name == "" {
+		return "", kind, fmt.Errorf("whiteout does not reference a path: %q", p)
 	}
-	return Path(path.Join(string(parent), strings.TrimPrefix(basename, WhiteoutPrefix))), nil
+
+	return p.WithBasename(name), kind, nil
 }
 
 // ParentPath returns a path object to the current files parent directory (or errors out if there is no parent)
@@ -78,18 +376,49 @@ func (p Path) ParentPath() (Path, error) {
 	return sanitized, nil
 }
 
+// WithBasename returns the normalized sibling path with the basename replaced by the given name (e.g.
+// "/etc/.wh.hosts" = "/etc/hosts" with "hosts"). The root has no basename, so the name is joined to the root instead
+// ("/" = "/name"). As with ParentPath, a relative path with a single component is relative to the root (e.g.
+// "hosts" = "/hosts.bak" with "hosts.bak").
+func (p Path) WithBasename(name string) Path {
+	parent, err := p.Normalize().ParentPath()
+	if err != nil {
+		// only the root has no parent
+		parent = DirSeparator
+	}
+	return parent.Join(name)
+}
+
+// Split returns the normalized parent directory and basename of the path in one call (e.g. "/a/b/c.txt" = ("/a/b",
+// "c.txt")). Unlike ParentPath, the root path is not an error: "/" = ("/", ""). A relative path with a single
+// component has no parent directory (e.g. "c.txt" = ("", "c.txt")).
+func (p Path) Split() (Path, string) {
+	normalized := p.Normalize()
+	if normalized == DirSeparator {
+		return DirSeparator, ""
+	}
+	dir, base := path.Split(string(normalized))
+	if dir == "" {
+		return "", base
+	}
+	return Path(dir).Normalize(), base
+}
+
 // AllPaths returns all constituent paths of the current path + the current path itself (e.g. /home/wagoodman/file.txt -> /, /home, /home/wagoodman, /home/wagoodman/file.txt )
 func (p Path) AllPaths() []Path {
-	fullPaths := p.ConstituentPaths()
-	if p != "/" {
-		fullPaths = append(fullPaths, p)
-	}
-	return fullPaths
+	return append(p.ConstituentPaths(), p.Normalize())
 }
 
-// ConstituentPaths returns all constituent paths for the current path (not including the current path itself) (e.g. /home/wagoodman/file.txt -> /, /home, /home/wagoodman )
+// ConstituentPaths returns all constituent paths for the current path (not including the current path itself) (e.g. /home/wagoodman/file.txt -> /, /home, /home/wagoodman ).
+// The path is normalized first, so redundant or trailing separators do not produce additional entries, and the root
+// path has no constituent paths.
 func (p Path) ConstituentPaths() []Path {
-	parents := strings.Split(strings.Trim(string(p), DirSeparator), DirSeparator)
+	normalized := p.Normalize()
+	if normalized == DirSeparator {
+		return nil
+	}
+
+	parents := strings.Split(strings.Trim(string(normalized), DirSeparator), DirSeparator)
 	fullPaths := make([]Path, len(parents))
 	for idx := range parents {
 		cur := DirSeparator + strings.Join(parents[:idx], DirSeparator)
@@ -98,8 +427,140 @@ func (p Path) ConstituentPaths() []Path {
 	return fullPaths
 }
 
+// EachComponent invokes the given function for each component of the normalized path from the root down, along with
+// the full path up to and including the component (e.g. /home/wagoodman/file.txt -> ("home", /home),
+// ("wagoodman", /home/wagoodman), ("file.txt", /home/wagoodman/file.txt)), stopping early when the function returns
+// false. The root itself is not a component (relative paths are iterated the same way, e.g. a/b -> ("a", a), ("b", a/b)).
+// Unlike AllPaths, no slice is allocated (each full path shares memory with
+// the normalized path).
+func (p Path) EachComponent(fn func(component string, fullPath Path) bool) {
+	normalized := string(p.Normalize())
+	start := 0
+	if strings.HasPrefix(normalized, DirSeparator) {
+		start = 1
+	}
+	for start < len(normalized) {
+		end := strings.Index(normalized[start:], DirSeparator)
+		if end < 0 {
+			end = len(normalized)
+		} else {
+			end += start
+		}
+		if !fn(normalized[start:end], Path(normalized[:end])) {
+			return
+		}
+		start = end + 1
+	}
+}
+
+// windowsParts splits a windows path into a drive letter volume (e.g. "C:", which may be empty) and the remaining
+// normalized path represented with POSIX separators (e.g. "C:\Windows\System32\" -> "C:", "/Windows/System32").
+func (p Path) windowsParts() (string, Path) {
+	s := strings.ReplaceAll(string(p), WindowsDirSeparator, DirSeparator)
+	if len(s) >= 2 && s[1] == ':' && isDriveLetter(s[0]) {
+		rest := s[2:]
+		if !strings.HasPrefix(rest, DirSeparator) {
+			// a bare drive letter (e.g. "C:") refers to the root of the volume
+			rest = DirSeparator + rest
+		}
+		return s[:2], Path(rest).Normalize()
+	}
+	return "", Path(s).Normalize()
+}
+
+// fromWindowsParts is the inverse of windowsParts, converting a POSIX path back to a windows path on the given volume.
+func fromWindowsParts(volume string, p Path) Path {
+	return Path(volume + strings.ReplaceAll(string(p), DirSeparator, WindowsDirSeparator))
+}
+
+func isDriveLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// NormalizeWindows returns the cleaned file path representation for a windows path, treating both "\" and "/" as
+// separators and a drive letter volume (e.g. "C:") as the root (e.g. "C:\Windows\..\Users\" -> "C:\Users").
+func (p Path) NormalizeWindows() Path {
+	volume, rest := p.windowsParts()
+	return fromWindowsParts(volume, rest)
+}
+
+// BasenameWindows is the windows path equivalent of Basename (e.g. "C:\Windows\notepad.exe" -> "notepad.exe").
+func (p Path) BasenameWindows() string {
+	_, rest := p.windowsParts()
+	base := rest.Basename()
+	if base == DirSeparator {
+		return WindowsDirSeparator
+	}
+	return base
+}
+
+// ParentPathWindows is the windows path equivalent of ParentPath (e.g. "C:\Windows\notepad.exe" -> "C:\Windows").
+func (p Path) ParentPathWindows() (Path, error) {
+	volume, rest := p.windowsParts()
+	parent, err := rest.ParentPath()
+	if err != nil {
+		return "", err
+	}
+	return fromWindowsParts(volume, parent), nil
+}
+
+// ConstituentPathsWindows is the windows path equivalent of ConstituentPaths
+// (e.g. "C:\Windows\System32\cmd.exe" -> "C:\", "C:\Windows", "C:\Windows\System32").
+func (p Path) ConstituentPathsWindows() []Path {
+	volume, rest := p.windowsParts()
+	parents := rest.ConstituentPaths()
+	for idx := range parents {
+		parents[idx] = fromWindowsParts(volume, parents[idx])
+	}
+	return parents
+}
+
 type Paths []Path
 
 func (p Paths) Len() int           { return len(p) }
 func (p Paths) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
 func (p Paths) Less(i, j int) bool { return string(p[i]) < string(p[j]) }
+
+// Sort sorts the paths in place lexically (see Less), which is the order that Contains requires.
+func (p Paths) Sort() {
+	sort.Sort(p)
+}
+
+// Contains indicates if the (normalized) query path is within the paths using a binary search. The paths must already
+// be sorted lexically (see Sort) and normalized, otherwise the result is undefined.
+func (p Paths) Contains(query Path) bool {
+	target := query.Normalize()
+	idx := sort.Search(len(p), func(i int) bool {
+		return string(p[i]) >= string(target)
+	})
+	return idx < len(p) && p[idx] == target
+}
+
+// SortTreeOrder sorts the paths in place such that every directory sorts immediately before all of its descendants (a
+// pre-order tree layout), unlike the lexical order of Less, where "/a.txt" sorts between "/a" and "/a/b". Siblings are
+// still sorted lexically.
+func (p Paths) SortTreeOrder() {
+	sort.SliceStable(p, func(i, j int) bool {
+		return TreeOrderLess(p[i], p[j])
+	})
+}
+
+// TreeOrderLess reports whether path a sorts before path b in a pre-order tree layout (see Paths.SortTreeOrder). This
+// is a lexical comparison where the separator sorts before every other character, so a path component always sorts
+// before any longer component that it is a prefix of.
+func TreeOrderLess(a, b Path) bool {
+	for idx := 0; idx < len(a) && idx < len(b); idx++ {
+		x, y := a[idx], b[idx]
+		if x == y {
+			continue
+		}
+		if x == '/' {
+			return true
+		}
+		if y == '/' {
+			return false
+		}
+		return x < y
+	}
+	return len(a) < len(b)
+}
@@ -1,6 +1,12 @@
 package file
 
-import "testing"
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
 
 func TestPath_Normalize(t *testing.T) {
 	cases := []struct {
@@ -79,6 +85,122 @@ func TestPath_AllPaths(t *testing.T) {
 	}
 }
 
+func TestPath_ConstituentPaths(t *testing.T) {
+	cases := []struct {
+		name     string
+		path     string
+		expected []Path
+	}{
+		{
+			name:     "root",
+			path:     "/",
+			expected: nil,
+		},
+		{
+			name:     "padded root",
+			path:     "///",
+			expected: nil,
+		},
+		{
+			name:     "single component",
+			path:     "/a",
+			expected: []Path{"/"},
+		},
+		{
+			name:     "directory path",
+			path:     "/home/wagoodman",
+			expected: []Path{"/", "/home"},
+		},
+		{
+			name:     "trailing slash",
+			path:     "/home/wagoodman/",
+			expected: []Path{"/", "/home"},
+		},
+		{
+			name:     "double slashes",
+			path:     "//a//b",
+			expected: []Path{"/", "/a"},
+		},
+		{
+			name:     "double slashes with trailing slashes",
+			path:     "//a//b//c//",
+			expected: []Path{"/", "/a", "/a/b"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.expected, Path(c.path).ConstituentPaths())
+		})
+	}
+}
+
+func TestPath_AllPaths_Root(t *testing.T) {
+	assert.Equal(t, []Path{"/"}, Path("/").AllPaths())
+	assert.Equal(t, []Path{"/", "/a", "/a/b"}, Path("//a//b/").AllPaths())
+}
+
+func TestPath_EachComponent(t *testing.T) {
+	cases := []struct {
+		path       Path
+		components []string
+		fullPaths  []Path
+	}{
+		{path: "/"},
+		{path: "///"},
+		{path: "/a", components: []string{"a"}, fullPaths: []Path{"/a"}},
+		{path: "//home//wagoodman/file.txt/", components: []string{"home", "wagoodman", "file.txt"}, fullPaths: []Path{"/home", "/home/wagoodman", "/home/wagoodman/file.txt"}},
+		{path: "a/b", components: []string{"a", "b"}, fullPaths: []Path{"a", "a/b"}},
+	}
+
+	for _, c := range cases {
+		t.Run(string(c.path), func(t *testing.T) {
+			var components []string
+			var fullPaths []Path
+			c.path.EachComponent(func(component string, fullPath Path) bool {
+				components = append(components, component)
+				fullPaths = append(fullPaths, fullPath)
+				return true
+			})
+			assert.Equal(t, c.components, components)
+			assert.Equal(t, c.fullPaths, fullPaths)
+			if c.path.Normalize() != DirSeparator && c.path.IsAbsolutePath() {
+				// the full paths are the same as AllPaths (without the root)
+				assert.Equal(t, c.path.AllPaths()[1:], fullPaths)
+			}
+		})
+	}
+
+	// iteration stops early
+	var visited []Path
+	Path("/a/b/c").EachComponent(func(_ string, fullPath Path) bool {
+		visited = append(visited, fullPath)
+		return fullPath != "/a/b"
+	})
+	assert.Equal(t, []Path{"/a", "/a/b"}, visited)
+}
+
+func BenchmarkPath_AllPaths(b *testing.B) {
+	p := Path("/usr/lib/x86_64-linux-gnu/perl/5.30/auto/File/Glob/Glob.so")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, parent := range p.AllPaths() {
+			_ = parent
+		}
+	}
+}
+
+func BenchmarkPath_EachComponent(b *testing.B) {
+	p := Path("/usr/lib/x86_64-linux-gnu/perl/5.30/auto/File/Glob/Glob.so")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		p.EachComponent(func(_ string, fullPath Path) bool {
+			_ = fullPath
+			return true
+		})
+	}
+}
+
 func TestPath_Sanitize_ID(t *testing.T) {
 	patha := Path("/some/path/to/a")
 	pathb := Path("/some/path/to/a/")
@@ -120,6 +242,62 @@ func TestPath_ParentPath_Root(t *testing.T) {
 	}
 }
 
+func TestPath_Split(t *testing.T) {
+	cases := []struct {
+		path         Path
+		expectedDir  Path
+		expectedBase string
+	}{
+		{path: "/some/path/to/a/file.txt", expectedDir: "/some/path/to/a", expectedBase: "file.txt"},
+		{path: "/home", expectedDir: "/", expectedBase: "home"},
+		{path: "/home/", expectedDir: "/", expectedBase: "home"},
+		{path: "//some//path/./to/../file.txt", expectedDir: "/some/path", expectedBase: "file.txt"},
+		{path: "/", expectedDir: "/", expectedBase: ""},
+		{path: "///", expectedDir: "/", expectedBase: ""},
+		{path: "some/file.txt", expectedDir: "some", expectedBase: "file.txt"},
+		{path: "file.txt", expectedDir: "", expectedBase: "file.txt"},
+	}
+
+	for _, c := range cases {
+		t.Run(string(c.path), func(t *testing.T) {
+			dir, base := c.path.Split()
+			assert.Equal(t, c.expectedDir, dir)
+			assert.Equal(t, c.expectedBase, base)
+
+			if c.path.IsAbsolutePath() && base != "" {
+				// consistent with ParentPath and Basename
+				parent, err := c.path.Normalize().ParentPath()
+				assert.NoError(t, err)
+				assert.Equal(t, parent, dir)
+				assert.Equal(t, c.path.Normalize().Basename(), base)
+			}
+		})
+	}
+}
+
+func TestPath_WithBasename(t *testing.T) {
+	cases := []struct {
+		path     Path
+		name     string
+		expected Path
+	}{
+		{path: "/etc/.wh.hosts", name: "hosts", expected: "/etc/hosts"},
+		{path: "/etc/hosts/", name: "hosts.bak", expected: "/etc/hosts.bak"},
+		{path: "//etc/./nginx/../hosts", name: "hostname", expected: "/etc/hostname"},
+		{path: "/hosts", name: "hostname", expected: "/hostname"},
+		{path: "/", name: "name", expected: "/name"},
+		{path: "//", name: "name", expected: "/name"},
+		{path: "etc/hosts", name: "hostname", expected: "etc/hostname"},
+		{path: "hosts", name: "hostname", expected: "/hostname"},
+	}
+
+	for _, c := range cases {
+		t.Run(string(c.path)+":"+c.name, func(t *testing.T) {
+			assert.Equal(t, c.expected, c.path.WithBasename(c.name))
+		})
+	}
+}
+
 func TestPath_Whiteout(t *testing.T) {
 	path := Path("/some/path/to/.wh.afile")
 
@@ -134,24 +312,649 @@ func TestPath_Whiteout(t *testing.T) {
 	}
 }
 
+func TestPath_IsAufsMetadata(t *testing.T) {
+	cases := []struct {
+		path     Path
+		expected bool
+	}{
+		{path: "/.wh..wh.aufs", expected: true},
+		{path: "/.wh..wh.plnk", expected: true},
+		{path: "/.wh..wh.plnk/1234.5678", expected: true},
+		{path: ".wh..wh.orph/", expected: true},
+		{path: "./.wh..wh.orph/file", expected: true},
+		{path: "/some/path/.wh..wh..opq", expected: false},
+		{path: "/some/path/.wh.afile", expected: false},
+		{path: "/some/path/file.txt", expected: false},
+		{path: "/", expected: false},
+	}
+
+	for _, c := range cases {
+		t.Run(string(c.path), func(t *testing.T) {
+			assert.Equal(t, c.expected, c.path.IsAufsMetadata())
+			if c.expected {
+				assert.False(t, c.path.IsWhiteout())
+			}
+		})
+	}
+}
+
 func TestPath_UnWhiteoutPath(t *testing.T) {
-	path := Path("/some/path/to/.wh..wh..opq")
+	cases := []struct {
+		path         Path
+		expectedPath Path
+		expectedKind WhiteoutKind
+		wantErr      bool
+	}{
+		{
+			path:         "/some/path/to/.wh..wh..opq",
+			expectedPath: "/some/path/to",
+			expectedKind: OpaqueDirWhiteout,
+		},
+		{
+			path:         "/a/.wh..wh..opq",
+			expectedPath: "/a",
+			expectedKind: OpaqueDirWhiteout,
+		},
+		{
+			path:         "/.wh..wh..opq",
+			expectedPath: "/",
+			expectedKind: OpaqueDirWhiteout,
+		},
+		{
+			// root opaque whiteouts may be relative (as found in layer tars)
+			path:         ".wh..wh..opq",
+			expectedPath: "/",
+			expectedKind: OpaqueDirWhiteout,
+		},
+		{
+			path:         "./.wh..wh..opq",
+			expectedPath: "/",
+			expectedKind: OpaqueDirWhiteout,
+		},
+		{
+			path:         "/some/path/to/.wh.somefile.txt",
+			expectedPath: "/some/path/to/somefile.txt",
+			expectedKind: FileWhiteout,
+		},
+		{
+			// top-level whiteouts have the root as the parent
+			path:         "/.wh.foo",
+			expectedPath: "/foo",
+			expectedKind: FileWhiteout,
+		},
+		{
+			path:         ".wh.foo",
+			expectedPath: "/foo",
+			expectedKind: FileWhiteout,
+		},
+		{
+			// only an exact opaque basename is an opaque whiteout, anything else with the double prefix is AUFS metadata
+			path:         "/some/path/.wh..wh..opq.txt",
+			expectedKind: NotWhiteout,
+			wantErr:      true,
+		},
+		{
+			path:         "/.wh..wh.aufs",
+			expectedKind: NotWhiteout,
+			wantErr:      true,
+		},
+		{
+			path:         "/.wh..wh.plnk",
+			expectedKind: NotWhiteout,
+			wantErr:      true,
+		},
+		{
+			path:         "/some/path/.wh.",
+			expectedKind: FileWhiteout,
+			wantErr:      true,
+		},
+		{
+			path:         "/some/path/file.txt",
+			expectedKind: NotWhiteout,
+			wantErr:      true,
+		},
+	}
 
-	newPath, err := path.UnWhiteoutPath()
-	if err != nil {
-		t.Fatal("error while unwhiteing out", err)
+	for _, c := range cases {
+		t.Run(string(c.path), func(t *testing.T) {
+			actualPath, actualKind, err := c.path.UnWhiteoutPath()
+			assert.Equal(t, c.expectedKind, actualKind)
+			assert.Equal(t, c.expectedKind, c.path.WhiteoutKind())
+			if c.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, c.expectedPath, actualPath)
+		})
 	}
-	if newPath != Path("/some/path/to") {
-		t.Fatal("path should be a whiteout")
+}
+
+func TestPath_HasPrefix(t *testing.T) {
+	cases := []struct {
+		path     string
+		dir      string
+		expected bool
+	}{
+		{path: "/etc/passwd", dir: "/etc", expected: true},
+		{path: "/etc/passwd", dir: "/etc/", expected: true},
+		{path: "/etc", dir: "/etc", expected: true},
+		{path: "/etc/ssl/certs/ca.pem", dir: "/etc/ssl", expected: true},
+		{path: "/etcd/config", dir: "/etc", expected: false},
+		{path: "/etc", dir: "/etc/passwd", expected: false},
+		{path: "/usr/etc/passwd", dir: "/etc", expected: false},
+		{path: "/etc//passwd", dir: "//etc", expected: true},
+		{path: "/anything/at/all", dir: "/", expected: true},
+		{path: "/", dir: "/", expected: true},
+		{path: "/", dir: "/etc", expected: false},
 	}
 
-	path = "/some/path/to/.wh.somefile.txt"
+	for _, c := range cases {
+		t.Run(c.path+" under "+c.dir, func(t *testing.T) {
+			assert.Equal(t, c.expected, Path(c.path).HasPrefix(Path(c.dir)))
+		})
+	}
+}
 
-	newPath, err = path.UnWhiteoutPath()
-	if err != nil {
-		t.Fatal("error while unwhiteing out", err)
+func TestPath_HasComponentSuffix(t *testing.T) {
+	cases := []struct {
+		path     string
+		suffix   string
+		expected bool
+	}{
+		{path: "/lib/libc.so", suffix: "libc.so", expected: true},
+		{path: "/lib/libc.so", suffix: "lib/libc.so", expected: true},
+		{path: "/lib/libc.so", suffix: "/lib/libc.so", expected: true},
+		{path: "/usr/lib/python3/site-packages/requests/__init__.py", suffix: "site-packages/requests/__init__.py", expected: true},
+		{path: "lib/libc.so", suffix: "libc.so", expected: true},
+		{path: "/lib//libc.so", suffix: "lib/./libc.so", expected: true},
+		{path: "/lib/", suffix: "lib/", expected: true},
+		{path: "/lib/libc.so", suffix: "bc.so", expected: false},
+		{path: "/lib/libc.so", suffix: "ib/libc.so", expected: false},
+		{path: "/lib/libc.so", suffix: "/libc.so", expected: false},
+		{path: "/lib/libc.so", suffix: "lib", expected: false},
+		{path: "/libc.so", suffix: "lib/libc.so", expected: false},
+		{path: "/lib/libc.so", suffix: ".", expected: false},
+		{path: "/lib/libc.so", suffix: "", expected: false},
+		{path: "/", suffix: "/", expected: true},
 	}
-	if newPath != "/some/path/to/somefile.txt" {
-		t.Fatal("path should be a whiteout")
+
+	for _, c := range cases {
+		t.Run(c.path+" ends with "+c.suffix, func(t *testing.T) {
+			assert.Equal(t, c.expected, Path(c.path).HasComponentSuffix(Path(c.suffix)))
+		})
+	}
+}
+
+func TestPath_Windows(t *testing.T) {
+	cases := []struct {
+		name         string
+		path         string
+		normalized   string
+		basename     string
+		parent       string
+		constituents []Path
+	}{
+		{
+			name:         "file on a drive",
+			path:         `C:\Windows\System32\cmd.exe`,
+			normalized:   `C:\Windows\System32\cmd.exe`,
+			basename:     "cmd.exe",
+			parent:       `C:\Windows\System32`,
+			constituents: []Path{`C:\`, `C:\Windows`, `C:\Windows\System32`},
+		},
+		{
+			name:         "relative notation and trailing separators",
+			path:         `C:\Windows\..\Users\\`,
+			normalized:   `C:\Users`,
+			basename:     "Users",
+			parent:       `C:\`,
+			constituents: []Path{`C:\`},
+		},
+		{
+			name:         "mixed separators",
+			path:         `C:/Windows\System32`,
+			normalized:   `C:\Windows\System32`,
+			basename:     "System32",
+			parent:       `C:\Windows`,
+			constituents: []Path{`C:\`, `C:\Windows`},
+		},
+		{
+			name:         "no drive letter",
+			path:         `\Windows\System32`,
+			normalized:   `\Windows\System32`,
+			basename:     "System32",
+			parent:       `\Windows`,
+			constituents: []Path{`\`, `\Windows`},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p := Path(c.path)
+			assert.Equal(t, Path(c.normalized), p.NormalizeWindows())
+			assert.Equal(t, c.basename, p.BasenameWindows())
+			parent, err := p.ParentPathWindows()
+			assert.NoError(t, err)
+			assert.Equal(t, Path(c.parent), parent)
+			assert.Equal(t, c.constituents, p.ConstituentPathsWindows())
+		})
+	}
+}
+
+func TestPath_Windows_DriveRoot(t *testing.T) {
+	for _, p := range []Path{`C:`, `C:\`, `C:\\`} {
+		assert.Equal(t, Path(`C:\`), p.NormalizeWindows())
+		assert.Equal(t, `\`, p.BasenameWindows())
+		_, err := p.ParentPathWindows()
+		assert.Error(t, err)
+	}
+}
+
+func TestPath_Depth(t *testing.T) {
+	cases := []struct {
+		path     Path
+		expected int
+	}{
+		{path: "/", expected: 0},
+		{path: "", expected: 0},
+		{path: "/a", expected: 1},
+		{path: "/a/b", expected: 2},
+		{path: "/a/b/", expected: 2},
+		{path: "/a//b/../c/d", expected: 3},
+		{path: "a/b", expected: 2},
+	}
+
+	for _, c := range cases {
+		t.Run(string(c.path), func(t *testing.T) {
+			assert.Equal(t, c.expected, c.path.Depth())
+			assert.Equal(t, c.expected, c.path.CountSegments())
+		})
+	}
+}
+
+func TestPath_RelativeTo(t *testing.T) {
+	cases := []struct {
+		path     Path
+		base     Path
+		expected Path
+		wantErr  bool
+	}{
+		{path: "/a/b/c", base: "/a", expected: "b/c"},
+		{path: "/a/b/c", base: "/a/", expected: "b/c"},
+		{path: "/a/b/c", base: "/", expected: "a/b/c"},
+		{path: "/a//b/./c/", base: "/a/x/..", expected: "b/c"},
+		{path: "/a", base: "/a", expected: "."},
+		{path: "/", base: "/", expected: "."},
+		{path: "/ab/c", base: "/a", wantErr: true},
+		{path: "/a", base: "/a/b", wantErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(string(c.path)+" from "+string(c.base), func(t *testing.T) {
+			actual, err := c.path.RelativeTo(c.base)
+			if c.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, c.expected, actual)
+		})
+	}
+}
+
+func TestPath_Join(t *testing.T) {
+	cases := []struct {
+		path     Path
+		parts    []string
+		expected Path
+	}{
+		{path: "/", parts: []string{"etc"}, expected: "/etc"},
+		{path: "/", parts: []string{"etc", "hosts"}, expected: "/etc/hosts"},
+		{path: "/", parts: nil, expected: "/"},
+		{path: "/usr", parts: []string{"lib", "x.so"}, expected: "/usr/lib/x.so"},
+		{path: "/usr/", parts: []string{"lib/"}, expected: "/usr/lib"},
+		{path: "/usr/lib", parts: []string{"/bin"}, expected: "/usr/lib/bin"},
+		{path: "/usr/lib", parts: []string{"../bin"}, expected: "/usr/bin"},
+		{path: "/usr", parts: []string{"../../.."}, expected: "/"},
+		{path: "/usr", parts: []string{"", "lib"}, expected: "/usr/lib"},
+		{path: "usr", parts: []string{"lib"}, expected: "usr/lib"},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("%s+%v", c.path, c.parts), func(t *testing.T) {
+			assert.Equal(t, c.expected, c.path.Join(c.parts...))
+		})
+	}
+}
+
+func TestPath_IsHidden(t *testing.T) {
+	cases := []struct {
+		path            Path
+		hidden          bool
+		hiddenComponent bool
+	}{
+		{path: "/root/.bashrc", hidden: true, hiddenComponent: true},
+		{path: "/home/user/.config", hidden: true, hiddenComponent: true},
+		{path: "/home/user/.config/", hidden: true, hiddenComponent: true},
+		{path: ".env", hidden: true, hiddenComponent: true},
+		{path: "/home/user/.config/app/settings.json", hidden: false, hiddenComponent: true},
+		{path: "/etc/hosts", hidden: false, hiddenComponent: false},
+		{path: "/etc/.", hidden: false, hiddenComponent: false},
+		{path: "/etc/..", hidden: false, hiddenComponent: false},
+		{path: "/", hidden: false, hiddenComponent: false},
+		{path: "", hidden: false, hiddenComponent: false},
+		// whiteouts and AUFS metadata are not hidden files
+		{path: "/etc/.wh.hosts", hidden: false, hiddenComponent: false},
+		{path: "/etc/.wh..wh..opq", hidden: false, hiddenComponent: false},
+		{path: "/.wh..wh.plnk/1234.5678", hidden: false, hiddenComponent: false},
+		{path: "/root/.wh.bashrc", hidden: false, hiddenComponent: false},
+		{path: "/root/.ssh/.wh.id_rsa", hidden: false, hiddenComponent: true},
+		// only the prefix matters
+		{path: "/root/.wh", hidden: true, hiddenComponent: true},
+		{path: "/root/..data", hidden: true, hiddenComponent: true},
+	}
+
+	for _, c := range cases {
+		t.Run(string(c.path), func(t *testing.T) {
+			assert.Equal(t, c.hidden, c.path.IsHidden())
+			assert.Equal(t, c.hiddenComponent, c.path.HasHiddenComponent())
+		})
+	}
+}
+
+func TestPath_Ext(t *testing.T) {
+	cases := []struct {
+		path     Path
+		expected string
+	}{
+		{path: "/etc/nginx.conf", expected: ".conf"},
+		{path: "/a.tar.gz", expected: ".gz"},
+		{path: "/usr/bin/tool", expected: ""},
+		{path: "/some.dir/tool", expected: ""},
+		{path: "/root/.bashrc", expected: ""},
+		{path: "/root/.config.json", expected: ".json"},
+		{path: "/file.", expected: "."},
+		{path: "/etc/nginx.conf/", expected: ".conf"},
+		{path: "/", expected: ""},
+	}
+
+	for _, c := range cases {
+		t.Run(string(c.path), func(t *testing.T) {
+			assert.Equal(t, c.expected, c.path.Ext())
+		})
+	}
+}
+
+func TestPath_Validate(t *testing.T) {
+	cases := []struct {
+		name           string
+		path           Path
+		expectedOffset int
+		valid          bool
+	}{
+		{name: "regular path", path: "/some/path.txt", valid: true},
+		{name: "unusual but valid bytes", path: "/some/p\xffath \u00e9", valid: true},
+		{name: "embedded NUL", path: "/tmp/evil\x00.txt", expectedOffset: 9},
+		{name: "trailing NUL", path: "evil\x00", expectedOffset: 4},
+		{name: "newline", path: "/evil\n.txt", expectedOffset: 5},
+		{name: "escape", path: "/\x1b[31m", expectedOffset: 1},
+		{name: "delete", path: "/a\x7f", expectedOffset: 2},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.path.Validate()
+			normalized, strictErr := c.path.NormalizeStrict()
+			if c.valid {
+				assert.NoError(t, err)
+				assert.NoError(t, strictErr)
+				assert.Equal(t, c.path.Normalize(), normalized)
+				return
+			}
+
+			var invalidErr *ErrInvalidPath
+			if assert.ErrorAs(t, err, &invalidErr) {
+				assert.Equal(t, c.path, invalidErr.Path)
+				assert.Equal(t, c.expectedOffset, invalidErr.Offset)
+			}
+			assert.ErrorAs(t, strictErr, &invalidErr)
+			assert.Empty(t, normalized)
+
+			// the non-validating variant keeps the characters as-is
+			assert.Contains(t, string(c.path.Normalize()), string(c.path[c.expectedOffset]))
+		})
+	}
+}
+
+func TestPath_IsExplicitDir(t *testing.T) {
+	cases := []struct {
+		path     Path
+		expected bool
+	}{
+		{path: "/", expected: true},
+		{path: "/etc/", expected: true},
+		{path: "/etc//", expected: true},
+		{path: "etc/", expected: true},
+		{path: "/etc/.", expected: true},
+		{path: "/etc/..", expected: true},
+		{path: ".", expected: true},
+		{path: "..", expected: true},
+		{path: "/etc", expected: false},
+		{path: "/etc/ ", expected: false},
+		{path: "/etc/.hidden", expected: false},
+		{path: "/etc/file.", expected: false},
+		{path: "", expected: false},
+	}
+
+	for _, c := range cases {
+		t.Run(string(c.path), func(t *testing.T) {
+			assert.Equal(t, c.expected, c.path.IsExplicitDir())
+		})
+	}
+}
+
+func TestPath_IsRoot(t *testing.T) {
+	cases := []struct {
+		path     Path
+		expected bool
+	}{
+		{path: "/", expected: true},
+		{path: "//", expected: true},
+		{path: "/.", expected: true},
+		{path: "/./", expected: true},
+		{path: "/..", expected: true},
+		{path: "", expected: true},
+		{path: "/etc/..", expected: true},
+		{path: "/etc", expected: false},
+		{path: ".", expected: false},
+		{path: "etc", expected: false},
+	}
+
+	for _, c := range cases {
+		t.Run(string(c.path), func(t *testing.T) {
+			assert.Equal(t, c.expected, c.path.IsRoot())
+		})
+	}
+}
+
+func TestPath_ToAbsoluteAndRelative(t *testing.T) {
+	cases := []struct {
+		path             Path
+		expectedAbsolute Path
+		expectedRelative Path
+	}{
+		{path: "/etc/hosts", expectedAbsolute: "/etc/hosts", expectedRelative: "etc/hosts"},
+		{path: "etc/hosts", expectedAbsolute: "/etc/hosts", expectedRelative: "etc/hosts"},
+		{path: "//etc/./nginx/../hosts/", expectedAbsolute: "/etc/hosts", expectedRelative: "etc/hosts"},
+		{path: "./etc/hosts", expectedAbsolute: "/etc/hosts", expectedRelative: "etc/hosts"},
+		{path: "../../etc/hosts", expectedAbsolute: "/etc/hosts", expectedRelative: "etc/hosts"},
+		{path: "/", expectedAbsolute: "/", expectedRelative: "."},
+		{path: ".", expectedAbsolute: "/", expectedRelative: "."},
+		{path: "", expectedAbsolute: "/", expectedRelative: "."},
+	}
+
+	for _, c := range cases {
+		t.Run(string(c.path), func(t *testing.T) {
+			assert.Equal(t, c.expectedAbsolute, c.path.ToAbsolute())
+			assert.Equal(t, c.expectedRelative, c.path.ToRelative())
+
+			// conversions are idempotent and reversible
+			assert.Equal(t, c.expectedAbsolute, c.path.ToAbsolute().ToAbsolute())
+			assert.Equal(t, c.expectedRelative, c.path.ToRelative().ToRelative())
+			assert.Equal(t, c.expectedAbsolute, c.path.ToRelative().ToAbsolute())
+		})
+	}
+}
+
+func TestPath_SanitizeToRoot(t *testing.T) {
+	cases := []struct {
+		path     Path
+		expected Path
+	}{
+		{path: "../../x", expected: "x"},
+		{path: "a/../../b", expected: "b"},
+		{path: "/a/b/../../c", expected: "/c"},
+		{path: "/../../etc/passwd", expected: "/etc/passwd"},
+		{path: "a/./b//c/", expected: "a/b/c"},
+		{path: "//a/./b", expected: "/a/b"},
+		{path: "a/b/../c", expected: "a/c"},
+		{path: "..", expected: "."},
+		{path: "/..", expected: "/"},
+		{path: "./", expected: "."},
+	}
+
+	for _, c := range cases {
+		t.Run(string(c.path), func(t *testing.T) {
+			actual := c.path.SanitizeToRoot()
+			assert.Equal(t, c.expected, actual)
+			assert.Equal(t, c.path.IsAbsolutePath(), actual.IsAbsolutePath())
+			assert.Equal(t, actual, actual.SanitizeToRoot())
+		})
+	}
+}
+
+func TestPath_IsParentOf(t *testing.T) {
+	cases := []struct {
+		parent   Path
+		child    Path
+		expected bool
+	}{
+		{parent: "/a", child: "/a/b", expected: true},
+		{parent: "/a/", child: "/a//b/", expected: true},
+		{parent: "/", child: "/a", expected: true},
+		{parent: "/a", child: "/a/b/c", expected: false},
+		{parent: "/a", child: "/a", expected: false},
+		{parent: "/", child: "/", expected: false},
+		{parent: "/a", child: "/ab/c", expected: false},
+		{parent: "/a/b", child: "/a", expected: false},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("%s->%s", c.parent, c.child), func(t *testing.T) {
+			assert.Equal(t, c.expected, c.parent.IsParentOf(c.child))
+		})
+	}
+}
+
+func TestCommonAncestor(t *testing.T) {
+	cases := []struct {
+		name     string
+		paths    []Path
+		expected Path
+	}{
+		{name: "no paths", paths: nil, expected: ""},
+		{name: "single path", paths: []Path{"/a/b/"}, expected: "/a/b"},
+		{name: "siblings", paths: []Path{"/usr/lib/a", "/usr/lib/b"}, expected: "/usr/lib"},
+		{name: "cousins", paths: []Path{"/usr/lib/a", "/usr/local/b", "/usr/bin/c"}, expected: "/usr"},
+		{name: "ancestor given", paths: []Path{"/usr/lib/a", "/usr/lib"}, expected: "/usr/lib"},
+		{name: "whole components only", paths: []Path{"/etc/hosts", "/etcd/config"}, expected: "/"},
+		{name: "root", paths: []Path{"/a", "/b"}, expected: "/"},
+		{name: "root given", paths: []Path{"/", "/a/b"}, expected: "/"},
+		{name: "normalized", paths: []Path{"/usr/./lib//a", "/usr/share/../lib/b"}, expected: "/usr/lib"},
+		{name: "relative", paths: []Path{"a/b/c", "a/b/d"}, expected: "a/b"},
+		{name: "relative and absolute", paths: []Path{"a/b", "/a/b"}, expected: ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.expected, CommonAncestor(c.paths...))
+		})
+	}
+}
+
+func TestPaths_SortTreeOrder(t *testing.T) {
+	paths := Paths{"/a/b", "/a.txt", "/b", "/a", "/a-b/c", "/", "/a/b/c", "/a/a", "/ab"}
+
+	lexical := make(Paths, len(paths))
+	copy(lexical, paths)
+	sort.Sort(lexical)
+	assert.Equal(t, Paths{"/", "/a", "/a-b/c", "/a.txt", "/a/a", "/a/b", "/a/b/c", "/ab", "/b"}, lexical)
+
+	paths.SortTreeOrder()
+	assert.Equal(t, Paths{"/", "/a", "/a/a", "/a/b", "/a/b/c", "/a-b/c", "/a.txt", "/ab", "/b"}, paths)
+
+	assert.True(t, TreeOrderLess("/a/b", "/a.txt"))
+	assert.False(t, TreeOrderLess("/a.txt", "/a/b"))
+	assert.True(t, TreeOrderLess("/a", "/a/b"))
+	assert.False(t, TreeOrderLess("/a", "/a"))
+}
+
+func TestPaths_Contains(t *testing.T) {
+	paths := Paths{"/usr/bin", "/etc/hosts", "/", "/a.txt", "/a/b"}
+	paths.Sort()
+	assert.Equal(t, Paths{"/", "/a.txt", "/a/b", "/etc/hosts", "/usr/bin"}, paths)
+
+	cases := []struct {
+		path     Path
+		expected bool
+	}{
+		{path: "/", expected: true},
+		{path: "/etc/hosts", expected: true},
+		{path: "/usr/bin", expected: true},
+		// the query is normalized
+		{path: "/etc//hosts/", expected: true},
+		{path: "/usr/lib/../bin", expected: true},
+		// only exact paths are members (not substrings or parents)
+		{path: "/etc", expected: false},
+		{path: "/etc/host", expected: false},
+		{path: "/a", expected: false},
+		{path: "/zzz", expected: false},
+	}
+
+	for _, c := range cases {
+		t.Run(string(c.path), func(t *testing.T) {
+			assert.Equal(t, c.expected, paths.Contains(c.path))
+		})
+	}
+
+	assert.False(t, Paths{}.Contains("/"))
+}
+
+func TestPath_EqualFold(t *testing.T) {
+	cases := []struct {
+		a, b     Path
+		expected bool
+	}{
+		{a: "/foo", b: "/foo", expected: true},
+		{a: "/Foo/", b: "/foo", expected: true},
+		{a: "/WINDOWS//System32/./drivers", b: "/windows/system32/drivers", expected: true},
+		{a: "/a/../Etc/HOSTS", b: "/etc/hosts", expected: true},
+		{a: "/foo", b: "/foo/bar", expected: false},
+		{a: "/foo", b: "foo", expected: false},
+		// simple unicode case folding is applied...
+		{a: "/Été", b: "/éTÉ", expected: true},
+		{a: "/\u212a", b: "/k", expected: true}, // the Kelvin sign
+		// ...however, multi-character foldings are not
+		{a: "/straße", b: "/strasse", expected: false},
+		// only "/" is a separator
+		{a: `\Foo`, b: "/foo", expected: false},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("%s=%s", c.a, c.b), func(t *testing.T) {
+			assert.Equal(t, c.expected, c.a.EqualFold(c.b))
+			assert.Equal(t, c.expected, c.b.EqualFold(c.a))
+		})
 	}
 }
@@ -0,0 +1,176 @@
+package file
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// CompiledPattern is a gitignore-style path pattern that has been compiled for matching against many paths.
+type CompiledPattern struct {
+	pattern  string
+	anchored bool
+	negated  bool
+	re       *regexp.Regexp
+}
+
+// CompilePattern compiles a gitignore-style pattern for matching paths with CompiledPattern.Matches. Supported syntax:
+//   - "*" matches any sequence of characters within a single path component (never a separator)
+//   - "?" matches any single character within a path component
+//   - "[...]" matches a character class (e.g. "[a-z]" or "[!0-9]")
+//   - "**" matches any sequence of characters across separators (e.g. "/usr/**/lib" or "**/*.conf")
+//   - "\" escapes the following character
+//
+// A pattern with a leading (or inner) separator is anchored to the root (e.g. "/etc/*" matches "/etc/hosts" but not
+// "/opt/etc/hosts"), while a pattern without a separator matches the basename of a path at any depth (e.g. "*.conf"
+// matches "/etc/nginx/nginx.conf"). A trailing separator is ignored.
+//
+// A leading "!" negates the pattern (use "\!" to match a leading "!" literally). Negation only takes effect when
+// matching against a list of patterns with MatchAny, CompiledPattern.Matches always matches the pattern without the
+// "!".
+func CompilePattern(pattern string) (*CompiledPattern, error) {
+	body := pattern
+	negated := strings.HasPrefix(body, "!")
+	if negated {
+		body = body[1:]
+		if body == "" {
+			return nil, fmt.Errorf("empty negated pattern")
+		}
+	}
+
+	trimmed := strings.TrimRight(body, DirSeparator)
+	if trimmed == "" {
+		if body == "" {
+			return nil, fmt.Errorf("empty pattern")
+		}
+		// the pattern was only separators (the root)
+		trimmed = DirSeparator
+	}
+
+	anchored := strings.Contains(trimmed, DirSeparator)
+	if anchored && !strings.HasPrefix(trimmed, DirSeparator) && !strings.HasPrefix(trimmed, "**") {
+		// inner separators anchor the pattern to the root (as with gitignore)
+		trimmed = DirSeparator + trimmed
+	}
+
+	expr, err := patternToRegex(trimmed)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+
+	re, err := regexp.Compile("^" + expr + "$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+
+	return &CompiledPattern{
+		pattern:  pattern,
+		anchored: anchored,
+		negated:  negated,
+		re:       re,
+	}, nil
+}
+
+// String returns the original (uncompiled) pattern.
+func (c *CompiledPattern) String() string {
+	return c.pattern
+}
+
+// Negated indicates if the pattern has a leading "!" (so that it re-includes paths matched by earlier patterns).
+func (c *CompiledPattern) Negated() bool {
+	return c.negated
+}
+
+// Matches indicates if the given path matches the pattern. The path is normalized before matching.
+func (c *CompiledPattern) Matches(p Path) bool {
+	return c.matches(p.Normalize())
+}
+
+func (c *CompiledPattern) matches(normalized Path) bool {
+	if !c.anchored {
+		return c.re.MatchString(normalized.Basename())
+	}
+	return c.re.MatchString(string(normalized))
+}
+
+// MatchAny indicates if the given path matches the list of patterns using gitignore precedence: the last pattern that
+// matches the path wins, so a path matching a negated pattern ("!...") does not match unless a later (non-negated)
+// pattern matches it again. For example, with ["/usr/**", "!/usr/lib/**", "/usr/lib/*.so"] the path "/usr/bin/tool"
+// matches, "/usr/lib/os-release" does not, and "/usr/lib/libc.so" does. Patterns are checked from last to first, so
+// checking stops at the first (deciding) match. A path that matches no pattern does not match.
+func MatchAny(p Path, patterns []*CompiledPattern) bool {
+	normalized := p.Normalize()
+	for i := len(patterns) - 1; i >= 0; i-- {
+		if patterns[i].matches(normalized) {
+			return !patterns[i].negated
+		}
+	}
+	return false
+}
+
+// Matches indicates if the path matches the given gitignore-style pattern (see CompilePattern for the supported
+// syntax). Invalid patterns never match. When matching many paths against the same pattern, use CompilePattern instead
+// to avoid recompiling the pattern for each path.
+func (p Path) Matches(pattern string) bool {
+	compiled, err := CompilePattern(pattern)
+	if err != nil {
+		return false
+	}
+	return compiled.Matches(p)
+}
+
+// patternToRegex translates the given (trimmed) pattern into an equivalent regular expression.
+// nolint:gocognit
+func patternToRegex(pattern string) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				atStart := i == 0 || pattern[i-1] == '/'
+				// consume all consecutive stars
+				for i+1 < len(pattern) && pattern[i+1] == '*' {
+					i++
+				}
+				if atStart && i+1 < len(pattern) && pattern[i+1] == '/' {
+					// "**/" matches zero or more directories
+					i++
+					sb.WriteString("(?:.*/)?")
+				} else {
+					sb.WriteString(".*")
+				}
+				continue
+			}
+			sb.WriteString("[^/]*")
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated character class")
+			}
+			class := pattern[i+1 : i+1+end]
+			if class == "" {
+				return "", fmt.Errorf("empty character class")
+			}
+			sb.WriteByte('[')
+			if class[0] == '!' || class[0] == '^' {
+				sb.WriteByte('^')
+				class = class[1:]
+			}
+			sb.WriteString(strings.ReplaceAll(class, `\`, `\\`))
+			sb.WriteByte(']')
+			i += end + 1
+		case '\\':
+			if i+1 >= len(pattern) {
+				return "", fmt.Errorf("trailing escape character")
+			}
+			i++
+			sb.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return sb.String(), nil
+}
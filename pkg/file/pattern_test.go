@@ -0,0 +1,145 @@
+package file
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPath_Matches(t *testing.T) {
+	cases := []struct {
+		pattern string
+		path    Path
+		matches bool
+	}{
+		// unanchored patterns match the basename at any depth
+		{pattern: "*.conf", path: "/etc/nginx/nginx.conf", matches: true},
+		{pattern: "*.conf", path: "/nginx.conf", matches: true},
+		{pattern: "*.conf", path: "/etc/nginx.conf/file", matches: false},
+		{pattern: "?.txt", path: "/a/b.txt", matches: true},
+		{pattern: "?.txt", path: "/a/bb.txt", matches: false},
+		{pattern: "file-[0-9]", path: "/a/file-3", matches: true},
+		{pattern: "file-[!0-9]", path: "/a/file-3", matches: false},
+		{pattern: "file-[!0-9]", path: "/a/file-x", matches: true},
+		{pattern: `\*.txt`, path: "/a/*.txt", matches: true},
+		{pattern: `\*.txt`, path: "/a/b.txt", matches: false},
+		// anchored patterns match only from the root
+		{pattern: "/etc/*", path: "/etc/hosts", matches: true},
+		{pattern: "/etc/*", path: "/opt/etc/hosts", matches: false},
+		{pattern: "/etc/*", path: "/etc/ssl/certs", matches: false},
+		{pattern: "etc/*", path: "/etc/hosts", matches: true},
+		{pattern: "etc/*", path: "/opt/etc/hosts", matches: false},
+		{pattern: "/etc/", path: "/etc", matches: true},
+		{pattern: "/", path: "/", matches: true},
+		// "**" matches across separators
+		{pattern: "/usr/**/lib", path: "/usr/lib", matches: true},
+		{pattern: "/usr/**/lib", path: "/usr/local/share/lib", matches: true},
+		{pattern: "/usr/**/lib", path: "/usr/liblib", matches: false},
+		{pattern: "**/*.conf", path: "/nginx.conf", matches: true},
+		{pattern: "**/*.conf", path: "/etc/nginx/nginx.conf", matches: true},
+		{pattern: "/usr/**", path: "/usr/local/bin/tool", matches: true},
+		{pattern: "/usr/**", path: "/usr", matches: false},
+		{pattern: "/usr/*", path: "/usr/local/bin/tool", matches: false},
+		// paths are normalized before matching
+		{pattern: "/etc/hosts", path: "/etc/./ssl/../hosts/", matches: true},
+		// invalid patterns never match
+		{pattern: "", path: "/", matches: false},
+		{pattern: "[a-z", path: "/[a-z", matches: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.pattern+" "+string(c.path), func(t *testing.T) {
+			assert.Equal(t, c.matches, c.path.Matches(c.pattern))
+		})
+	}
+}
+
+func TestCompilePattern(t *testing.T) {
+	cases := []struct {
+		pattern string
+		wantErr bool
+	}{
+		{pattern: "*.conf"},
+		{pattern: "/usr/**/lib"},
+		{pattern: "", wantErr: true},
+		{pattern: "[a-z", wantErr: true},
+		{pattern: "[]", wantErr: true},
+		{pattern: `trailing\`, wantErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.pattern, func(t *testing.T) {
+			compiled, err := CompilePattern(c.pattern)
+			if c.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, c.pattern, compiled.String())
+		})
+	}
+}
+
+func BenchmarkCompiledPattern_Matches(b *testing.B) {
+	compiled, err := CompilePattern("/usr/**/*.so")
+	if err != nil {
+		b.Fatal(err)
+	}
+	p := Path("/usr/lib/x86_64-linux-gnu/libc.so")
+	for i := 0; i < b.N; i++ {
+		compiled.Matches(p)
+	}
+}
+
+func TestMatchAny(t *testing.T) {
+	cases := []struct {
+		name     string
+		patterns []string
+		path     Path
+		matches  bool
+	}{
+		{name: "no patterns", patterns: nil, path: "/etc/hosts", matches: false},
+		{name: "no match", patterns: []string{"*.conf", "/usr/**"}, path: "/etc/hosts", matches: false},
+		{name: "any match", patterns: []string{"*.conf", "/etc/*"}, path: "/etc/hosts", matches: true},
+		{name: "negated", patterns: []string{"/etc/*", "!/etc/hosts"}, path: "/etc/hosts", matches: false},
+		{name: "negation only applies to matching paths", patterns: []string{"/etc/*", "!/etc/hosts"}, path: "/etc/passwd", matches: true},
+		{name: "negation before match has no effect", patterns: []string{"!/etc/hosts", "/etc/*"}, path: "/etc/hosts", matches: true},
+		{name: "only negations", patterns: []string{"!/etc/hosts"}, path: "/etc/hosts", matches: false},
+		// nested include/exclude: the last matching pattern wins
+		{name: "nested outer", patterns: []string{"/usr/**", "!/usr/lib/**", "/usr/lib/*.so"}, path: "/usr/bin/tool", matches: true},
+		{name: "nested middle", patterns: []string{"/usr/**", "!/usr/lib/**", "/usr/lib/*.so"}, path: "/usr/lib/os-release", matches: false},
+		{name: "nested inner", patterns: []string{"/usr/**", "!/usr/lib/**", "/usr/lib/*.so"}, path: "/usr/lib/libc.so", matches: true},
+		{name: "nested inner deeper", patterns: []string{"/usr/**", "!/usr/lib/**", "/usr/lib/*.so"}, path: "/usr/lib/x/libc.so", matches: false},
+		{name: "escaped negation", patterns: []string{`\!important`}, path: "/a/!important", matches: true},
+		{name: "paths are normalized", patterns: []string{"/etc/*", "!/etc/hosts"}, path: "/etc/ssl/../hosts/", matches: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var patterns []*CompiledPattern
+			for _, p := range c.patterns {
+				compiled, err := CompilePattern(p)
+				require.NoError(t, err)
+				patterns = append(patterns, compiled)
+			}
+			assert.Equal(t, c.matches, MatchAny(c.path, patterns))
+		})
+	}
+}
+
+func TestCompilePattern_Negated(t *testing.T) {
+	compiled, err := CompilePattern("!/etc/hosts")
+	require.NoError(t, err)
+	assert.True(t, compiled.Negated())
+	assert.Equal(t, "!/etc/hosts", compiled.String())
+	// negation only applies within MatchAny
+	assert.True(t, compiled.Matches("/etc/hosts"))
+
+	compiled, err = CompilePattern(`\!/etc/hosts`)
+	require.NoError(t, err)
+	assert.False(t, compiled.Negated())
+
+	_, err = CompilePattern("!")
+	assert.Error(t, err)
+}
@@ -2,9 +2,11 @@ package file
 
 import (
 	"fmt"
+	"sync/atomic"
 )
 
-var nextID = 0
+// nextID is the last file reference ID handed out (references may be created concurrently, e.g. when reading layers)
+var nextID uint64
 
 // ID is used for file tree manipulation to uniquely identify tree nodes.
 type ID uint64
@@ -17,10 +19,9 @@ type Reference struct {
 
 // NewFileReference creates a new unique file reference for the given path.
 func NewFileReference(path Path) *Reference {
-	nextID++
 	return &Reference{
 		RealPath: path,
-		id:       ID(nextID),
+		id:       ID(atomic.AddUint64(&nextID, 1)),
 	}
 }
 
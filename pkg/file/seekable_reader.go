@@ -0,0 +1,81 @@
+package file
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// DefaultSpillThreshold is the default size in bytes above which NewSeekableReader spills contents to a temp file
+// instead of holding them in memory.
+const DefaultSpillThreshold = 32 * 1024 * 1024
+
+var _ io.ReadSeekCloser = (*spilledReadCloser)(nil)
+
+// NewSeekableReader provides a seekable reader for the given contents. Contents that can already be seeked (e.g. regular
+// files within an indexed tar) are returned as-is. Other contents (e.g. sparse tar entries or squashfs files) are
+// buffered in memory if they are at most threshold bytes, otherwise they are spilled to a temp file within the given
+// directory, which is removed when the returned reader is closed. The given reader is always closed once read.
+func NewSeekableReader(reader io.ReadCloser, threshold int64, tempDir string) (io.ReadSeekCloser, error) {
+	if seeker, ok := reader.(io.ReadSeekCloser); ok {
+		return seeker, nil
+	}
+	defer reader.Close()
+
+	if threshold < 0 {
+		threshold = 0
+	}
+
+	// read one byte past the threshold to determine if the contents fit in memory
+	buf := &bytes.Buffer{}
+	n, err := io.CopyN(buf, reader, threshold+1)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("unable to read contents: %w", err)
+	}
+	if n <= threshold {
+		return nopSeekCloser{bytes.NewReader(buf.Bytes())}, nil
+	}
+
+	fh, err := ioutil.TempFile(tempDir, "stereoscope-spill-")
+	if err != nil {
+		return nil, fmt.Errorf("unable to create spill file: %w", err)
+	}
+	spilled := &spilledReadCloser{File: fh}
+
+	if _, err = io.Copy(fh, io.MultiReader(buf, reader)); err == nil {
+		_, err = fh.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		_ = spilled.Close()
+		return nil, fmt.Errorf("unable to spill contents to %q: %w", fh.Name(), err)
+	}
+	return spilled, nil
+}
+
+type nopSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (nopSeekCloser) Close() error {
+	return nil
+}
+
+// spilledReadCloser is a temp file that is removed once closed.
+type spilledReadCloser struct {
+	*os.File
+}
+
+func (s *spilledReadCloser) Close() error {
+	err := s.File.Close()
+	if err != nil && errors.Is(err, os.ErrClosed) {
+		// ignore the fact that this file has already been closed
+		err = nil
+	}
+	if rmErr := os.Remove(s.Name()); rmErr != nil && !os.IsNotExist(rmErr) && err == nil {
+		err = rmErr
+	}
+	return err
+}
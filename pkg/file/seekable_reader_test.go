@@ -0,0 +1,71 @@
+package file
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSeekableReader(t *testing.T) {
+	contents := "some contents"
+
+	tests := []struct {
+		name      string
+		threshold int64
+		spilled   bool
+	}{
+		{name: "under the threshold", threshold: int64(len(contents)) + 1},
+		{name: "at the threshold", threshold: int64(len(contents))},
+		{name: "over the threshold", threshold: int64(len(contents)) - 1, spilled: true},
+		{name: "zero threshold", threshold: 0, spilled: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			reader, err := NewSeekableReader(ioutil.NopCloser(strings.NewReader(contents)), test.threshold, dir)
+			require.NoError(t, err)
+
+			spillFiles, err := ioutil.ReadDir(dir)
+			require.NoError(t, err)
+			if test.spilled {
+				assert.Len(t, spillFiles, 1)
+			} else {
+				assert.Empty(t, spillFiles)
+			}
+
+			actual, err := ioutil.ReadAll(reader)
+			require.NoError(t, err)
+			assert.Equal(t, contents, string(actual))
+
+			// the contents can be re-read after seeking
+			_, err = reader.Seek(5, io.SeekStart)
+			require.NoError(t, err)
+			actual, err = ioutil.ReadAll(reader)
+			require.NoError(t, err)
+			assert.Equal(t, "contents", string(actual))
+
+			// any spill file is removed on close
+			require.NoError(t, reader.Close())
+			require.NoError(t, reader.Close())
+			spillFiles, err = ioutil.ReadDir(dir)
+			require.NoError(t, err)
+			assert.Empty(t, spillFiles)
+		})
+	}
+}
+
+func TestNewSeekableReader_AlreadySeekable(t *testing.T) {
+	fh, err := os.Open("test-fixtures/a-file.txt")
+	require.NoError(t, err)
+
+	reader, err := NewSeekableReader(fh, 0, t.TempDir())
+	require.NoError(t, err)
+	assert.Equal(t, fh, reader)
+	assert.NoError(t, reader.Close())
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
 )
 
 type TarIndexVisitor func(TarIndexEntry) error
@@ -11,12 +12,16 @@ type TarIndexVisitor func(TarIndexEntry) error
 // TarIndex is a tar reader capable of O(1) fetching of entry contents after the first read.
 type TarIndex struct {
 	indexByName map[string][]TarIndexEntry
+	// indexByPath holds the same entries keyed by the normalized absolute path (see Path.ToAbsolute), since tar entry
+	// names may encode the same path in several ways (e.g. "etc/hosts", "./etc/hosts", and "/etc/hosts")
+	indexByPath map[Path][]TarIndexEntry
 }
 
 // NewTarIndex creates a new TarIndex that is already indexed.
 func NewTarIndex(tarFilePath string, onIndex TarIndexVisitor) (*TarIndex, error) {
 	t := &TarIndex{
 		indexByName: make(map[string][]TarIndexEntry),
+		indexByPath: make(map[Path][]TarIndexEntry),
 	}
 	tarFileHandle, err := os.Open(tarFilePath)
 	if err != nil {
@@ -40,7 +45,7 @@ func NewTarIndex(tarFilePath string, onIndex TarIndexVisitor) (*TarIndex, error)
 			header:       entry.Header,
 			seekPosition: entrySeekPosition,
 		}
-		t.indexByName[entry.Header.Name] = append(t.indexByName[entry.Header.Name], indexEntry)
+		t.add(indexEntry)
 
 		// run though the visitors
 		if onIndex != nil {
@@ -55,6 +60,42 @@ func NewTarIndex(tarFilePath string, onIndex TarIndexVisitor) (*TarIndex, error)
 	return t, IterateTar(tarFileHandle, visitor)
 }
 
+// NewTarIndexFromEntries creates a new TarIndex from previously indexed entries (see TarIndex.Entries) without reading
+// the tar. The visitor is invoked for each entry in the order given.
+func NewTarIndexFromEntries(entries []TarIndexEntry, onIndex TarIndexVisitor) (*TarIndex, error) {
+	t := &TarIndex{
+		indexByName: make(map[string][]TarIndexEntry),
+		indexByPath: make(map[Path][]TarIndexEntry),
+	}
+	for _, entry := range entries {
+		t.add(entry)
+		if onIndex != nil {
+			if err := onIndex(entry); err != nil {
+				return nil, fmt.Errorf("failed visitor on tar indexEntry: %w", err)
+			}
+		}
+	}
+	return t, nil
+}
+
+func (t *TarIndex) add(entry TarIndexEntry) {
+	t.indexByName[entry.header.Name] = append(t.indexByName[entry.header.Name], entry)
+	p := Path(entry.header.Name).ToAbsolute()
+	t.indexByPath[p] = append(t.indexByPath[p], entry)
+}
+
+// Entries returns all indexed entries, in the order found within the tar.
+func (t *TarIndex) Entries() []TarIndexEntry {
+	var entries []TarIndexEntry
+	for _, indexes := range t.indexByName {
+		entries = append(entries, indexes...)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].sequence < entries[j].sequence
+	})
+	return entries
+}
+
 // EntriesByName fetches all TarFileEntries for the given tar header name.
 func (t *TarIndex) EntriesByName(name string) ([]TarFileEntry, error) {
 	if indexes, exists := t.indexByName[name]; exists {
@@ -66,3 +107,18 @@ func (t *TarIndex) EntriesByName(name string) ([]TarFileEntry, error) {
 	}
 	return nil, nil
 }
+
+// EntriesByPath fetches all TarFileEntries for the given path regardless of how the path is encoded within the tar
+// (e.g. "/etc/hosts" returns entries named "etc/hosts", "./etc/hosts", and "/etc/hosts"), in the order found within
+// the tar (so the last entry is the one that is extracted).
+func (t *TarIndex) EntriesByPath(p Path) ([]TarFileEntry, error) {
+	indexes := t.indexByPath[p.ToAbsolute()]
+	if len(indexes) == 0 {
+		return nil, nil
+	}
+	entries := make([]TarFileEntry, len(indexes))
+	for i, index := range indexes {
+		entries[i] = index.ToTarFileEntry()
+	}
+	return entries, nil
+}
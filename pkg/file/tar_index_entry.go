@@ -3,6 +3,7 @@ package file
 import (
 	"archive/tar"
 	"io"
+	"strings"
 )
 
 type TarIndexEntry struct {
@@ -12,6 +13,33 @@ type TarIndexEntry struct {
 	seekPosition int64
 }
 
+// NewTarIndexEntry creates an entry for the tar (on disk at the given path) with the given header, where the entry
+// contents start at the given seek position (just after the header). This allows for an index to be persisted and
+// restored later without reading the tar (see NewTarIndexFromEntries).
+func NewTarIndexEntry(path string, sequence int64, header tar.Header, seekPosition int64) TarIndexEntry {
+	return TarIndexEntry{
+		path:         path,
+		sequence:     sequence,
+		header:       header,
+		seekPosition: seekPosition,
+	}
+}
+
+// Sequence is the nth header in the tar file this entry was found.
+func (t *TarIndexEntry) Sequence() int64 {
+	return t.sequence
+}
+
+// Header is the tar header for the entry.
+func (t *TarIndexEntry) Header() tar.Header {
+	return t.header
+}
+
+// SeekPosition is the offset within the tar where the entry contents start.
+func (t *TarIndexEntry) SeekPosition() int64 {
+	return t.seekPosition
+}
+
 func (t *TarIndexEntry) ToTarFileEntry() TarFileEntry {
 	return TarFileEntry{
 		Sequence: t.sequence,
@@ -21,5 +49,23 @@ func (t *TarIndexEntry) ToTarFileEntry() TarFileEntry {
 }
 
 func (t *TarIndexEntry) Open() io.ReadCloser {
+	if isSparse(t.header) {
+		// the raw entry bytes do not include holes (and may include the sparse map), so the contents must be read
+		// through a tar reader to be reconstructed
+		return newLazyTarEntryReadCloser(t.path, t.sequence)
+	}
 	return newLazyBoundedReadCloser(t.path, t.seekPosition, t.header.Size)
 }
+
+// isSparse indicates if the tar header describes a sparse file (either in the old GNU format or the GNU PAX formats).
+func isSparse(header tar.Header) bool {
+	if header.Typeflag == tar.TypeGNUSparse {
+		return true
+	}
+	for k := range header.PAXRecords {
+		if strings.HasPrefix(k, "GNU.sparse.") {
+			return true
+		}
+	}
+	return false
+}
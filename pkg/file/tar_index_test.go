@@ -107,6 +107,117 @@ func TestIndexedTarReader_DuplicateEntries(t *testing.T) {
 
 }
 
+func TestIndexedTarIndex_EntriesByPath(t *testing.T) {
+	tempFile, err := ioutil.TempFile(t.TempDir(), "stereoscope-mixed-paths-fixture-XXXXXX")
+	if err != nil {
+		t.Fatalf("could not create tempfile: %+v", err)
+	}
+	tarWriter := tar.NewWriter(tempFile)
+	addFileToTarWriter(t, "./etc/passwd", "first", tarWriter)
+	addFileToTarWriter(t, "etc/passwd", "second", tarWriter)
+	addFileToTarWriter(t, "/etc/passwd", "third", tarWriter)
+	addFileToTarWriter(t, "etc/hosts", "hosts", tarWriter)
+	tarWriter.Close()
+	tempFile.Close()
+
+	reader, err := NewTarIndex(tempFile.Name(), nil)
+	if err != nil {
+		t.Fatal("could not get file reader from tar:", err)
+	}
+
+	for _, p := range []Path{"/etc/passwd", "etc/passwd", "./etc/passwd", "/etc/../etc/passwd"} {
+		entries, err := reader.EntriesByPath(p)
+		if err != nil {
+			t.Fatalf("unable to get %q : %+v", p, err)
+		}
+		var actual []string
+		for _, entry := range entries {
+			contents, err := ioutil.ReadAll(entry.Reader)
+			if err != nil {
+				t.Fatalf("could not read from file reader: %+v", err)
+			}
+			actual = append(actual, string(contents))
+		}
+		if strings.Join(actual, ",") != "first,second,third" {
+			t.Errorf("unexpected entries for path=%q: %+v", p, actual)
+		}
+	}
+
+	entries, err := reader.EntriesByPath("/etc/missing")
+	if err != nil || len(entries) != 0 {
+		t.Errorf("unexpected entries for missing path: %+v (%+v)", entries, err)
+	}
+}
+
+func TestIndexedTarIndex_SparseEntries(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+	}{
+		{
+			name:    "GNU sparse 1.0 (PAX)",
+			fixture: "test-fixtures/sparse-pax.tar",
+		},
+		{
+			name:    "old GNU sparse",
+			fixture: "test-fixtures/sparse-gnu.tar",
+		},
+	}
+
+	// the sparse file has data at the start and end with a hole in between
+	expectedSparse := "head" + strings.Repeat("\x00", 1048572) + "tail"
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reader, err := NewTarIndex(test.fixture, nil)
+			if err != nil {
+				t.Fatal("could not get file reader from tar:", err)
+			}
+
+			entries, err := reader.EntriesByName("sparse.bin")
+			if err != nil {
+				t.Fatalf("unable to get sparse entry: %+v", err)
+			}
+			if len(entries) != 1 {
+				t.Fatalf("unexpected length: %d", len(entries))
+			}
+			entry := entries[0]
+
+			if entry.Header.Size != int64(len(expectedSparse)) {
+				t.Errorf("unexpected header size: %d != %d", entry.Header.Size, len(expectedSparse))
+			}
+
+			if size := NewMetadata(entry.Header, entry.Sequence, nil).Size; size != int64(len(expectedSparse)) {
+				t.Errorf("unexpected metadata size: %d != %d", size, len(expectedSparse))
+			}
+
+			actualContents, err := ioutil.ReadAll(entry.Reader)
+			if err != nil {
+				t.Fatalf("could not read from file reader: %+v", err)
+			}
+			if string(actualContents) != expectedSparse {
+				t.Errorf("sparse contents were not reconstructed (got %d bytes)", len(actualContents))
+			}
+
+			// entries after the sparse file must be unaffected
+			entries, err = reader.EntriesByName("after.txt")
+			if err != nil {
+				t.Fatalf("unable to get entry after sparse file: %+v", err)
+			}
+			if len(entries) != 1 {
+				t.Fatalf("unexpected length: %d", len(entries))
+			}
+			actualContents, err = ioutil.ReadAll(entries[0].Reader)
+			if err != nil {
+				t.Fatalf("could not read from file reader: %+v", err)
+			}
+			if string(actualContents) != "after\n" {
+				t.Errorf("unexpected contents: %q", string(actualContents))
+			}
+		})
+	}
+}
+
 func duplicateEntryTarballFixture(t *testing.T) *os.File {
 	tempFile, err := ioutil.TempFile("", "stereoscope-dup-tar-entry-fixture-XXXXXX")
 	if err != nil {
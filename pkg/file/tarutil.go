@@ -40,6 +40,19 @@ func (e *ErrFileNotFound) Error() string {
 	return fmt.Sprintf("file not found (path=%s)", e.Path)
 }
 
+// ErrPathEscapesRoot is returned from UntarToDirectory (and JoinWithinRoot) if an entry in the given archive would be
+// written outside of the destination directory (e.g. "../../etc/passwd").
+type ErrPathEscapesRoot struct {
+	// Path is the offending entry name within the archive (or the path given to JoinWithinRoot)
+	Path string
+	// Root is the destination directory
+	Root string
+}
+
+func (e *ErrPathEscapesRoot) Error() string {
+	return fmt.Sprintf("path escapes the destination directory (path=%s, root=%s)", e.Path, e.Root)
+}
+
 // IterateTar is a function that reads across a tar and invokes a visitor function for each entry discovered. The iterator
 // stops when there are no more entries to read, if there is an error in the underlying reader or visitor function,
 // or if the visitor function returns a ErrTarStopIteration sentinel error.
@@ -123,14 +136,20 @@ func MetadataFromTar(reader io.ReadCloser, tarPath string) (Metadata, error) {
 	return *metadata, nil
 }
 
-// UntarToDirectory writes the contents of the given tar reader to the given destination
+// UntarToDirectory writes the contents of the given tar reader to the given destination. Absolute entry names are
+// relative to the destination, and an ErrPathEscapesRoot error is returned for any entry that resolves to a location
+// outside of the destination (nothing is written for the offending entry). Only directories and regular files are
+// written, device files are never created (since the tar may not be trusted).
 func UntarToDirectory(reader io.Reader, dst string) error {
 	visitor := func(entry TarFileEntry) error {
-		target := filepath.Join(dst, entry.Header.Name)
+		target, err := JoinWithinRoot(dst, entry.Header.Name)
+		if err != nil {
+			return err
+		}
 
 		switch entry.Header.Typeflag {
 		case tar.TypeDir:
-			if _, err := os.Stat(target); err != nil {
+			if _, err = os.Stat(target); err != nil {
 				if err := os.MkdirAll(target, 0755); err != nil {
 					return err
 				}
@@ -160,3 +179,15 @@ func UntarToDirectory(reader io.Reader, dst string) error {
 
 	return IterateTar(reader, visitor)
 }
+
+// JoinWithinRoot returns the location within the destination directory that the given path (or tar entry name) should
+// be written to. Absolute paths are relative to the destination, and an ErrPathEscapesRoot error is returned if the path
+// resolves to a location outside of the destination. Note: this is a lexical check, links already on disk are not
+// considered.
+func JoinWithinRoot(dst, name string) (string, error) {
+	target := filepath.Join(dst, name)
+	if !Path(filepath.ToSlash(target)).HasPrefix(Path(filepath.ToSlash(dst))) {
+		return "", &ErrPathEscapesRoot{Path: name, Root: dst}
+	}
+	return target, nil
+}
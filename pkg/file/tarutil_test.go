@@ -4,7 +4,10 @@
 package file
 
 import (
+	"archive/tar"
+	"bytes"
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -15,6 +18,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const (
@@ -179,3 +183,118 @@ func fileExists(t testing.TB, filename string) bool {
 	}
 	return !info.IsDir()
 }
+
+func TestUntarToDirectory_PathTraversal(t *testing.T) {
+	tests := []struct {
+		name       string
+		entry      string
+		typeflag   byte
+		expected   string
+		wantEscape bool
+	}{
+		{
+			name:     "relative path",
+			entry:    "a/b.txt",
+			typeflag: tar.TypeReg,
+			expected: "a/b.txt",
+		},
+		{
+			name:     "absolute path is relative to the destination",
+			entry:    "/a/passwd",
+			typeflag: tar.TypeReg,
+			expected: "a/passwd",
+		},
+		{
+			name:     "parent reference within the destination",
+			entry:    "a/../b.txt",
+			typeflag: tar.TypeReg,
+			expected: "b.txt",
+		},
+		{
+			name:       "parent reference escapes the destination",
+			entry:      "../../etc/passwd",
+			typeflag:   tar.TypeReg,
+			wantEscape: true,
+		},
+		{
+			name:       "nested parent reference escapes the destination",
+			entry:      "a/../../escaped.txt",
+			typeflag:   tar.TypeReg,
+			wantEscape: true,
+		},
+		{
+			name:       "directory escapes the destination",
+			entry:      "../escaped-dir/",
+			typeflag:   tar.TypeDir,
+			wantEscape: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := t.TempDir()
+			dst := filepath.Join(root, "dst")
+			require.NoError(t, os.Mkdir(dst, 0755))
+			require.NoError(t, os.Mkdir(filepath.Join(dst, "a"), 0755))
+
+			buf := &bytes.Buffer{}
+			tw := tar.NewWriter(buf)
+			contents := "malicious?"
+			hdr := &tar.Header{Name: test.entry, Typeflag: test.typeflag, Mode: 0644}
+			if test.typeflag == tar.TypeReg {
+				hdr.Size = int64(len(contents))
+			}
+			require.NoError(t, tw.WriteHeader(hdr))
+			if test.typeflag == tar.TypeReg {
+				_, err := tw.Write([]byte(contents))
+				require.NoError(t, err)
+			}
+			require.NoError(t, tw.Close())
+
+			err := UntarToDirectory(buf, dst)
+			if !test.wantEscape {
+				require.NoError(t, err)
+				actual, err := ioutil.ReadFile(filepath.Join(dst, test.expected))
+				require.NoError(t, err)
+				assert.Equal(t, contents, string(actual))
+				return
+			}
+
+			var escapeErr *ErrPathEscapesRoot
+			require.True(t, errors.As(err, &escapeErr), "unexpected error: %+v", err)
+			assert.Equal(t, test.entry, escapeErr.Path)
+
+			// nothing may be written outside of the destination
+			entries, err := ioutil.ReadDir(root)
+			require.NoError(t, err)
+			require.Len(t, entries, 1)
+			assert.Equal(t, "dst", entries[0].Name())
+		})
+	}
+}
+
+func TestMetadataFromTar_Device(t *testing.T) {
+	f, err := os.Open("test-fixtures/devices.tar")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = f.Close() })
+
+	metadata, err := MetadataFromTar(f, "dev/null")
+	require.NoError(t, err)
+	assert.Equal(t, "/dev/null", metadata.Path)
+	assert.Equal(t, byte(tar.TypeChar), metadata.TypeFlag)
+	assert.Equal(t, int64(1), metadata.DeviceMajor)
+	assert.Equal(t, int64(3), metadata.DeviceMinor)
+	assert.True(t, metadata.Mode&os.ModeCharDevice != 0)
+}
+
+func TestUntarToDirectory_DevicesAreSkipped(t *testing.T) {
+	f, err := os.Open("test-fixtures/devices.tar")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = f.Close() })
+
+	dst := t.TempDir()
+	require.NoError(t, UntarToDirectory(f, dst))
+
+	_, err = os.Lstat(filepath.Join(dst, "dev", "null"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -3,13 +3,16 @@ package file
 import (
 	"os"
 	"strings"
+	"sync"
 
 	"github.com/hashicorp/go-multierror"
 )
 
 type TempDirGenerator struct {
+	lock         sync.Mutex
 	rootPrefix   string
 	rootLocation string
+	parent       *TempDirGenerator
 	children     []*TempDirGenerator
 }
 
@@ -33,13 +36,20 @@ func (t *TempDirGenerator) getOrCreateRootLocation() (string, error) {
 
 // NewGenerator creates a child generator capable of making sibling temp directories.
 func (t *TempDirGenerator) NewGenerator() *TempDirGenerator {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
 	gen := NewTempDirGenerator(t.rootPrefix)
+	gen.parent = t
 	t.children = append(t.children, gen)
 	return gen
 }
 
 // NewDirectory creates a new temp dir within the generators prefix temp dir.
 func (t *TempDirGenerator) NewDirectory(name ...string) (string, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
 	location, err := t.getOrCreateRootLocation()
 	if err != nil {
 		return "", err
@@ -48,18 +58,53 @@ func (t *TempDirGenerator) NewDirectory(name ...string) (string, error) {
 	return os.MkdirTemp(location, strings.Join(name, "-")+"-")
 }
 
-// Cleanup deletes all temp dirs created by this generator and any child generator.
+// Cleanup deletes all temp dirs created by this generator and any child generator. All removals are attempted (the
+// errors for any that fail are aggregated), and it is safe to call Cleanup more than once: removals that succeeded are
+// not repeated and removals that failed are retried. Once cleaned up, a child generator is detached from its parent
+// (so that long-lived parent generators do not accumulate children), however, it may still be used to create new
+// temp dirs, which must then be cleaned up explicitly.
 func (t *TempDirGenerator) Cleanup() error {
+	err := t.cleanup()
+	if err == nil && t.parent != nil {
+		t.parent.detach(t)
+	}
+	return err
+}
+
+func (t *TempDirGenerator) cleanup() error {
+	t.lock.Lock()
+	children := t.children
+	t.lock.Unlock()
+
 	var allErrs error
-	for _, gen := range t.children {
-		if err := gen.Cleanup(); err != nil {
+	for _, gen := range children {
+		if err := gen.cleanup(); err != nil {
 			allErrs = multierror.Append(allErrs, err)
+			continue
 		}
+		t.detach(gen)
 	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
 	if t.rootLocation != "" {
 		if err := os.RemoveAll(t.rootLocation); err != nil {
 			allErrs = multierror.Append(allErrs, err)
+		} else {
+			t.rootLocation = ""
 		}
 	}
 	return allErrs
 }
+
+func (t *TempDirGenerator) detach(child *TempDirGenerator) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for idx, gen := range t.children {
+		if gen == child {
+			t.children = append(t.children[:idx], t.children[idx+1:]...)
+			return
+		}
+	}
+}
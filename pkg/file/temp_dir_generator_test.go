@@ -78,6 +78,31 @@ func TestTempDirGenerator(t *testing.T) {
 	}
 }
 
+func TestTempDirGenerator_CleanupIdempotent(t *testing.T) {
+	expectedPrefix := path.Join(os.TempDir(), "c-special-prefix")
+	root := NewTempDirGenerator("c-special-prefix")
+
+	child := root.NewGenerator()
+	_, err := child.NewDirectory("a")
+	assert.NoError(t, err)
+	sibling := root.NewGenerator()
+	_, err = sibling.NewDirectory("b")
+	assert.NoError(t, err)
+	assert.Len(t, root.children, 2)
+
+	// cleaning up a child removes its dirs and detaches it from the parent, without affecting siblings
+	assert.NoError(t, child.Cleanup())
+	assert.NoError(t, child.Cleanup())
+	assert.Empty(t, child.rootLocation)
+	assert.Equal(t, []*TempDirGenerator{sibling}, root.children)
+	assert.True(t, doesGlobExist(t, sibling.rootLocation))
+
+	assert.NoError(t, root.Cleanup())
+	assert.NoError(t, root.Cleanup())
+	assert.Empty(t, root.children)
+	assert.False(t, doesGlobExist(t, expectedPrefix+"*"), "cleanup did not remove prefix temp dir")
+}
+
 func doesGlobExist(t *testing.T, pattern string) bool {
 	t.Helper()
 	m, err := filepath.Glob(pattern)
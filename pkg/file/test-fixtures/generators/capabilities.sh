@@ -0,0 +1,29 @@
+#!/usr/bin/env bash
+set -ue
+
+# generates the static file capabilities tar fixture (this is committed, since setting capabilities to tar requires
+# root and setcap)
+# usage: ./capabilities.sh <output-dir>
+
+OUTPUT_DIR=$(cd "$1" && pwd)
+
+python3 - "${OUTPUT_DIR}/capabilities.tar" <<'PYEOF'
+import io
+import struct
+import sys
+import tarfile
+
+CAP_NET_RAW = 13
+
+# vfs_cap_data revision 2 with the effective flag: cap_net_raw=ep
+capability = struct.pack("<IIIII", 0x02000001, 1 << CAP_NET_RAW, 0, 0, 0)
+
+with tarfile.open(sys.argv[1], "w", format=tarfile.PAX_FORMAT) as tar:
+    contents = b"#!/bin/sh\necho ping\n"
+    ping = tarfile.TarInfo("bin/ping")
+    ping.mode = 0o755
+    ping.size = len(contents)
+    ping.mtime = 1609459200
+    ping.pax_headers = {"SCHILY.xattr.security.capability": capability.decode("utf-8", "surrogateescape")}
+    tar.addfile(ping, io.BytesIO(contents))
+PYEOF
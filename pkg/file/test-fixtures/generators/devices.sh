@@ -0,0 +1,27 @@
+#!/usr/bin/env bash
+set -ue
+
+# generates the static device tar fixture (this is committed, since creating device nodes to tar requires root)
+# usage: ./devices.sh <output-dir>
+
+OUTPUT_DIR=$(cd "$1" && pwd)
+
+python3 - "${OUTPUT_DIR}/devices.tar" <<'PYEOF'
+import sys
+import tarfile
+
+with tarfile.open(sys.argv[1], "w", format=tarfile.USTAR_FORMAT) as tar:
+    dev = tarfile.TarInfo("dev/")
+    dev.type = tarfile.DIRTYPE
+    dev.mode = 0o755
+    dev.mtime = 1609459200
+    tar.addfile(dev)
+
+    null = tarfile.TarInfo("dev/null")
+    null.type = tarfile.CHRTYPE
+    null.mode = 0o666
+    null.devmajor = 1
+    null.devminor = 3
+    null.mtime = 1609459200
+    tar.addfile(null)
+PYEOF
@@ -0,0 +1,23 @@
+#!/usr/bin/env bash
+set -ue
+
+# generates the static sparse tar fixtures (these are committed, since they require GNU tar sparse support to create)
+# usage: ./sparse.sh <output-dir>
+
+OUTPUT_DIR=$(cd "$1" && pwd)
+WORK_DIR=$(mktemp -d)
+trap 'rm -rf "${WORK_DIR}"' EXIT
+
+pushd "${WORK_DIR}"
+
+  # a file of 1 MiB + 4 bytes with data at the start and end and a hole in between
+  printf 'head' > sparse.bin
+  truncate -s 1048576 sparse.bin
+  printf 'tail' >> sparse.bin
+  echo "after" > after.txt
+  touch -d '2021-01-01' sparse.bin after.txt
+
+  tar --sparse -H pax --owner=0 --group=0 --numeric-owner -cf "${OUTPUT_DIR}/sparse-pax.tar" sparse.bin after.txt
+  tar --sparse -H gnu --owner=0 --group=0 --numeric-owner -cf "${OUTPUT_DIR}/sparse-gnu.tar" sparse.bin after.txt
+
+popd
@@ -0,0 +1,31 @@
+#!/usr/bin/env bash
+set -ue
+
+# generates the static PAX timestamps tar fixture (this is committed, since tar implementations differ in which
+# timestamps are recorded and with what precision)
+# usage: ./timestamps.sh <output-dir>
+
+OUTPUT_DIR=$(cd "$1" && pwd)
+
+python3 - "${OUTPUT_DIR}/timestamps.tar" <<'PYEOF'
+import io
+import sys
+import tarfile
+
+with tarfile.open(sys.argv[1], "w", format=tarfile.PAX_FORMAT) as tar:
+    contents = b"reproducible\n"
+    precise = tarfile.TarInfo("precise.txt")
+    precise.mode = 0o644
+    precise.size = len(contents)
+    precise.pax_headers = {
+        "mtime": "1609459200.123456789",
+        "atime": "1609459260.5",
+        "ctime": "1609459320.000000001",
+    }
+    tar.addfile(precise, io.BytesIO(contents))
+
+    seconds = tarfile.TarInfo("seconds.txt")
+    seconds.mode = 0o644
+    seconds.mtime = 1609459200
+    tar.addfile(seconds, io.BytesIO(b""))
+PYEOF
@@ -1,6 +1,9 @@
 package file
 
-import "archive/tar"
+import (
+	"archive/tar"
+	"os"
+)
 
 const (
 	TypeReg             Type = tar.TypeReg
@@ -23,3 +26,52 @@ var AllTypes = []Type{
 }
 
 type Type rune
+
+// TypeFromMode returns the file type for the given file mode (e.g. from a squashfs or directory entry). Note: hardlinks
+// cannot be detected from a mode, and any unsupported type (e.g. a socket) is reported as a regular file.
+func TypeFromMode(mode os.FileMode) Type {
+	switch {
+	case mode&os.ModeSymlink != 0:
+		return TypeSymlink
+	case mode.IsDir():
+		return TypeDir
+	case mode&os.ModeCharDevice != 0:
+		return TypeCharacterDevice
+	case mode&os.ModeDevice != 0:
+		return TypeBlockDevice
+	case mode&os.ModeNamedPipe != 0:
+		return TypeFifo
+	default:
+		return TypeReg
+	}
+}
+
+// IsSpecial indicates if the type is a device or named pipe (which have no contents to read).
+func (t Type) IsSpecial() bool {
+	switch t {
+	case TypeCharacterDevice, TypeBlockDevice, TypeFifo:
+		return true
+	}
+	return false
+}
+
+func (t Type) String() string {
+	switch t {
+	case TypeReg:
+		return "RegularFile"
+	case TypeDir:
+		return "Directory"
+	case TypeSymlink:
+		return "SymbolicLink"
+	case TypeHardLink:
+		return "HardLink"
+	case TypeCharacterDevice:
+		return "CharacterDevice"
+	case TypeBlockDevice:
+		return "BlockDevice"
+	case TypeFifo:
+		return "FIFONode"
+	default:
+		return "Unknown"
+	}
+}
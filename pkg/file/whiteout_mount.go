@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package file
+
+// IsWhiteoutMountAt indicates if the path is an overlayfs whiteout within a layer that is mounted at the given root
+// directory on the host. Overlayfs is only available on linux, so this is always false on other platforms.
+func (p Path) IsWhiteoutMountAt(string) bool {
+	return false
+}
+
+// IsDirWhiteoutMountAt indicates if the path is an overlayfs opaque directory within a layer that is mounted at the
+// given root directory on the host. Overlayfs is only available on linux, so this is always false on other platforms.
+func (p Path) IsDirWhiteoutMountAt(string) bool {
+	return false
+}
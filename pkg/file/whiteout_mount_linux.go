@@ -0,0 +1,54 @@
+//go:build linux
+// +build linux
+
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+const overlayOpaqueXattr = "trusted.overlay.opaque"
+
+// IsWhiteoutMountAt indicates if the path is an overlayfs whiteout within a layer that is mounted at the given root
+// directory on the host. Overlayfs represents removed files as a character device with a 0/0 device number, so the
+// lookup must be made relative to the mount root and not the logical in-image path.
+func (p Path) IsWhiteoutMountAt(root string) bool {
+	info, err := os.Lstat(filepath.Join(root, string(p.Normalize())))
+	if err != nil {
+		return false
+	}
+
+	if info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false
+	}
+	return stat.Rdev == 0
+}
+
+// IsDirWhiteoutMountAt indicates if the path is an overlayfs opaque directory within a layer that is mounted at the
+// given root directory on the host (meaning all lower layer contents of the directory should be ignored). Overlayfs
+// marks opaque directories with the "trusted.overlay.opaque" extended attribute set to "y".
+func (p Path) IsDirWhiteoutMountAt(root string) bool {
+	dir := filepath.Join(root, string(p.Normalize()))
+
+	// a nil buffer returns the size of the attribute value without reading it
+	size, err := syscall.Getxattr(dir, overlayOpaqueXattr, nil)
+	if err != nil || size <= 0 {
+		return false
+	}
+
+	value := make([]byte, size)
+	size, err = syscall.Getxattr(dir, overlayOpaqueXattr, value)
+	if err != nil {
+		return false
+	}
+
+	return strings.TrimSpace(string(value[:size])) == "y"
+}
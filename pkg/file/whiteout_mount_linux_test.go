@@ -0,0 +1,65 @@
+//go:build linux
+// +build linux
+
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPath_IsWhiteoutMountAt(t *testing.T) {
+	root := t.TempDir()
+
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "etc"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "etc", "regular"), []byte("contents"), 0644))
+
+	assert.False(t, Path("/etc/regular").IsWhiteoutMountAt(root), "regular file is not a whiteout")
+	assert.False(t, Path("/etc").IsWhiteoutMountAt(root), "directory is not a whiteout")
+	assert.False(t, Path("/etc/missing").IsWhiteoutMountAt(root), "missing path is not a whiteout")
+
+	// creating the overlay whiteout device requires CAP_MKNOD
+	whiteout := filepath.Join(root, "etc", "removed")
+	if err := syscall.Mknod(whiteout, syscall.S_IFCHR|0000, 0); err != nil {
+		t.Skipf("unable to create whiteout character device: %+v", err)
+	}
+
+	assert.True(t, Path("/etc/removed").IsWhiteoutMountAt(root))
+	assert.False(t, Path("/etc/removed").IsWhiteoutMountAt(t.TempDir()), "path must be relative to the mount root")
+}
+
+func TestPath_IsDirWhiteoutMountAt(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("setting trusted.* extended attributes requires root")
+	}
+
+	// trusted.* extended attributes are supported on tmpfs, which may not be the case for the default temp dir
+	parent := ""
+	if info, err := os.Stat("/dev/shm"); err == nil && info.IsDir() {
+		parent = "/dev/shm"
+	}
+	root, err := os.MkdirTemp(parent, "stereoscope-opaque-")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = os.RemoveAll(root)
+	})
+
+	for _, dir := range []string{"opaque", "not-opaque", "other-value"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, "layer", dir), 0755))
+	}
+
+	if err := syscall.Setxattr(filepath.Join(root, "layer", "opaque"), overlayOpaqueXattr, []byte("y"), 0); err != nil {
+		t.Skipf("unable to set extended attribute: %+v", err)
+	}
+	require.NoError(t, syscall.Setxattr(filepath.Join(root, "layer", "other-value"), overlayOpaqueXattr, []byte("n"), 0))
+
+	assert.True(t, Path("/layer/opaque").IsDirWhiteoutMountAt(root))
+	assert.False(t, Path("/layer/not-opaque").IsDirWhiteoutMountAt(root))
+	assert.False(t, Path("/layer/other-value").IsDirWhiteoutMountAt(root))
+	assert.False(t, Path("/layer/missing").IsDirWhiteoutMountAt(root))
+}
@@ -0,0 +1,72 @@
+package filetree
+
+import (
+	"sort"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree/filenode"
+)
+
+// basenameIndex maps a basename to the real paths of all nodes with that basename.
+type basenameIndex map[string]file.PathSet
+
+func (b basenameIndex) add(p file.Path) {
+	if p == file.DirSeparator {
+		// the root has no basename
+		return
+	}
+	name := p.Basename()
+	paths, ok := b[name]
+	if !ok {
+		paths = file.NewPathSet()
+		b[name] = paths
+	}
+	paths.Add(p)
+}
+
+func (b basenameIndex) remove(p file.Path) {
+	name := p.Basename()
+	paths, ok := b[name]
+	if !ok {
+		return
+	}
+	paths.Remove(p)
+	if len(paths) == 0 {
+		delete(b, name)
+	}
+}
+
+func (b basenameIndex) copy() basenameIndex {
+	c := make(basenameIndex, len(b))
+	for name, paths := range b {
+		pathsCopy := file.NewPathSet()
+		for p := range paths {
+			pathsCopy.Add(p)
+		}
+		c[name] = pathsCopy
+	}
+	return c
+}
+
+// FilesByBasename returns references for all paths in the tree (of any file type) with the given basename (e.g.
+// "package.json"), sorted by real path. This is an index lookup, so unlike FilesByGlob the tree is not walked. Links are
+// not resolved, so the references returned are for the paths with the basename (not what they link to). Directories
+// that are only implied by other paths have no reference and are not returned.
+func (t *FileTree) FilesByBasename(name string) []file.Reference {
+	paths := t.basenames[name]
+
+	var refs []file.Reference
+	for p := range paths {
+		n := t.tree.Node(filenode.IDByPath(p))
+		if n == nil {
+			continue
+		}
+		if f := n.(*filenode.FileNode); f.Reference != nil {
+			refs = append(refs, *f.Reference)
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		return refs[i].RealPath < refs[j].RealPath
+	})
+	return refs
+}
@@ -0,0 +1,100 @@
+package filetree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+func basenameResults(refs []file.Reference) []file.Path {
+	var paths []file.Path
+	for _, ref := range refs {
+		paths = append(paths, ref.RealPath)
+	}
+	return paths
+}
+
+func TestFileTree_FilesByBasename(t *testing.T) {
+	tr := NewFileTree()
+	for _, p := range []file.Path{"/app/package.json", "/app/node_modules/a/package.json", "/package.json/readme"} {
+		_, err := tr.AddFile(p)
+		require.NoError(t, err)
+	}
+	_, err := tr.AddSymLink("/link/package.json", "/app/package.json")
+	require.NoError(t, err)
+	_, err = tr.AddDir("/opt/package.json")
+	require.NoError(t, err)
+
+	// note: "/package.json" is only implied by "/package.json/readme", so it has no reference
+	assert.Equal(t, []file.Path{
+		"/app/node_modules/a/package.json",
+		"/app/package.json",
+		"/link/package.json",
+		"/opt/package.json",
+	}, basenameResults(tr.FilesByBasename("package.json")))
+
+	assert.Equal(t, []file.Path{"/package.json/readme"}, basenameResults(tr.FilesByBasename("readme")))
+	assert.Empty(t, tr.FilesByBasename("missing"))
+	assert.Empty(t, tr.FilesByBasename("/"))
+
+	// the index is kept in sync as paths are removed
+	require.NoError(t, tr.RemovePath("/app/node_modules"))
+	require.NoError(t, tr.RemoveChildPaths("/link"))
+	assert.Equal(t, []file.Path{
+		"/app/package.json",
+		"/opt/package.json",
+	}, basenameResults(tr.FilesByBasename("package.json")))
+}
+
+func TestFileTree_FilesByBasename_Copy(t *testing.T) {
+	tr := NewFileTree()
+	_, err := tr.AddFile("/a/go.mod")
+	require.NoError(t, err)
+
+	cp, err := tr.Copy()
+	require.NoError(t, err)
+	_, err = cp.AddFile("/b/go.mod")
+	require.NoError(t, err)
+	require.NoError(t, tr.RemovePath("/a/go.mod"))
+
+	assert.Empty(t, tr.FilesByBasename("go.mod"))
+	assert.Equal(t, []file.Path{"/a/go.mod", "/b/go.mod"}, basenameResults(cp.FilesByBasename("go.mod")))
+}
+
+func TestFileTree_FilesByBasename_Squash(t *testing.T) {
+	lower := NewFileTree()
+	for _, p := range []file.Path{"/a/pom.xml", "/b/pom.xml", "/c/pom.xml"} {
+		_, err := lower.AddFile(p)
+		require.NoError(t, err)
+	}
+
+	upper := NewFileTree()
+	for _, p := range []file.Path{"/a/.wh.pom.xml", "/b/.wh..wh..opq", "/b/nested/pom.xml", "/d/pom.xml"} {
+		_, err := upper.AddFile(p)
+		require.NoError(t, err)
+	}
+
+	union := NewUnionFileTree()
+	union.PushTree(lower)
+	union.PushTree(upper)
+	squashed, err := union.Squash()
+	require.NoError(t, err)
+
+	expected := []file.Path{"/b/nested/pom.xml", "/c/pom.xml", "/d/pom.xml"}
+	assert.Equal(t, expected, basenameResults(squashed.FilesByBasename("pom.xml")))
+
+	// the index must agree with a full scan of the tree
+	var scanned []file.Path
+	for _, ref := range squashed.AllFiles(file.AllTypes...) {
+		if ref.RealPath.Basename() == "pom.xml" {
+			scanned = append(scanned, ref.RealPath)
+		}
+	}
+	assert.Equal(t, expected, scanned)
+
+	// the lower tree is not affected by the squash
+	assert.Equal(t, []file.Path{"/a/pom.xml", "/b/pom.xml", "/c/pom.xml"}, basenameResults(lower.FilesByBasename("pom.xml")))
+}
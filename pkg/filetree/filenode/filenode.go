@@ -12,6 +12,7 @@ type FileNode struct {
 	FileType  file.Type
 	LinkPath  file.Path // a relative or absolute path to another file
 	Reference *file.Reference
+	Digest    string // the content digest of a regular file (e.g. "sha256:..."), only when recorded
 }
 
 func NewDir(p file.Path, ref *file.Reference) *FileNode {
@@ -30,6 +31,16 @@ func NewFile(p file.Path, ref *file.Reference) *FileNode {
 	}
 }
 
+// NewSpecialFile creates a node for a device or named pipe (the given type should be one of file.TypeCharacterDevice,
+// file.TypeBlockDevice, or file.TypeFifo).
+func NewSpecialFile(p file.Path, fileType file.Type, ref *file.Reference) *FileNode {
+	return &FileNode{
+		RealPath:  p,
+		FileType:  fileType,
+		Reference: ref,
+	}
+}
+
 func NewSymLink(p, linkPath file.Path, ref *file.Reference) *FileNode {
 	return &FileNode{
 		RealPath:  p,
@@ -60,6 +71,7 @@ func (n *FileNode) Copy() node.Node {
 		FileType:  n.FileType,
 		LinkPath:  n.LinkPath,
 		Reference: n.Reference,
+		Digest:    n.Digest,
 	}
 }
 
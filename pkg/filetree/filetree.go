@@ -3,11 +3,14 @@ package filetree
 import (
 	"errors"
 	"fmt"
+	"io/fs"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/anchore/stereoscope/internal"
+	"github.com/anchore/stereoscope/internal/log"
 	"github.com/anchore/stereoscope/pkg/file"
 	"github.com/anchore/stereoscope/pkg/filetree/filenode"
 	"github.com/anchore/stereoscope/pkg/tree"
@@ -18,9 +21,24 @@ import (
 var ErrRemovingRoot = errors.New("cannot remove the root path (`/`) from the FileTree")
 var ErrLinkCycleDetected = errors.New("cycle during symlink resolution")
 
-// FileTree represents a file/directory Tree
+// maxLinkResolutionDepth is the maximum length of a chain of links that may be followed while resolving a path (the
+// same limit as the linux kernel). Exceeding this limit is reported as a cycle, since cycles that pass through ancestor
+// directories cannot otherwise be detected.
+const maxLinkResolutionDepth = 40
+
+// FileTree represents a file/directory Tree. Iteration over the tree (AllFiles, AllRealPaths, Walk, WalkFrom, and
+// squashing) is in sorted path order, and is therefore stable for the same tree contents.
+//
+// Read-only operations (e.g. File, Resolve, HasPath, Walk, ListPaths, FilesByGlob, and Copy) never modify the tree, so
+// they are safe for concurrent use once the tree is no longer being mutated (e.g. the squashed tree of a read image).
+// Mutations (adding or removing paths, and Merge) are not synchronized: there must be a single writer, and no reads
+// may happen concurrently with a mutation.
 type FileTree struct {
 	tree *tree.Tree
+	// basenames indexes the real paths of all nodes by basename (see FilesByBasename)
+	basenames basenameIndex
+	// hardLinks indexes the real paths of all hardlinks by link path (see HardLinks)
+	hardLinks hardLinkIndex
 }
 
 // NewFileTree creates a new FileTree instance.
@@ -31,18 +49,25 @@ func NewFileTree() *FileTree {
 	_ = t.AddRoot(filenode.NewDir("/", nil))
 
 	return &FileTree{
-		tree: t,
+		tree:      t,
+		basenames: make(basenameIndex),
+		hardLinks: newHardLinkIndex(),
 	}
 }
 
-// Copy returns a Copy of the current FileTree.
+// Copy returns a Copy of the current FileTree. The node structure (and any index) is cloned, so the copy may be mutated
+// without affecting the original tree, however, file references are immutable and are shared between both trees.
 func (t *FileTree) Copy() (*FileTree, error) {
 	ct := NewFileTree()
 	ct.tree = t.tree.Copy()
+	ct.basenames = t.basenames.copy()
+	ct.hardLinks = t.hardLinks.copy()
 	return ct, nil
 }
 
 // AllFiles returns all files within the FileTree (defaults to regular files only, but you can provide one or more allow types).
+// Files are returned sorted by real path, so the results are stable for the same tree contents regardless of the order
+// that paths were added.
 func (t *FileTree) AllFiles(types ...file.Type) []file.Reference {
 	if len(types) == 0 {
 		types = []file.Type{file.TypeReg}
@@ -60,9 +85,58 @@ func (t *FileTree) AllFiles(types ...file.Type) []file.Reference {
 			files = append(files, *f.Reference)
 		}
 	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].RealPath < files[j].RealPath
+	})
 	return files
 }
 
+// FilesUnder returns all file.References of the given types (regular files by default) within the given directory,
+// recursively (sorted by real path). Links to the directory (or its ancestors) are followed to find the directory,
+// however, only the subtree beneath it is descended (symlinks within the subtree are not followed). Returns nil if the
+// path does not exist or is not a directory.
+func (t *FileTree) FilesUnder(dir file.Path, types ...file.Type) ([]file.Reference, error) {
+	if len(types) == 0 {
+		types = []file.Type{file.TypeReg}
+	}
+
+	typeSet := internal.NewStringSet()
+	for _, t := range types {
+		typeSet.Add(string(t))
+	}
+
+	n, err := t.node(dir, linkResolutionStrategy{
+		FollowAncestorLinks: true,
+		FollowBasenameLinks: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if n == nil || n.FileType != file.TypeDir {
+		return nil, nil
+	}
+
+	var files []file.Reference
+	stack := t.tree.Children(n)
+	for len(stack) > 0 {
+		f := stack[len(stack)-1].(*filenode.FileNode)
+		stack = stack[:len(stack)-1]
+
+		if typeSet.Contains(string(f.FileType)) && f.Reference != nil {
+			files = append(files, *f.Reference)
+		}
+		if f.FileType == file.TypeDir {
+			stack = append(stack, t.tree.Children(f)...)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].RealPath < files[j].RealPath
+	})
+	return files, nil
+}
+
+// AllRealPaths returns the real paths of all nodes within the FileTree (sorted), including directories implied by
+// other paths.
 func (t *FileTree) AllRealPaths() []file.Path {
 	var files []file.Path
 	for _, n := range t.tree.Nodes() {
@@ -71,9 +145,21 @@ func (t *FileTree) AllRealPaths() []file.Path {
 			files = append(files, f.RealPath)
 		}
 	}
+	sort.Sort(file.Paths(files))
 	return files
 }
 
+// HardLinks returns the real paths of all hardlinks within the FileTree that point to the given path (sorted).
+func (t *FileTree) HardLinks(target file.Path) []file.Path {
+	return t.hardLinksWithin(target, false)
+}
+
+// hardLinksWithin returns the real paths of all hardlinks that point to the given path (or when includeChildren is
+// set, that point to any descendant path).
+func (t *FileTree) hardLinksWithin(target file.Path, includeChildren bool) []file.Path {
+	return t.hardLinks.within(target.Normalize(), includeChildren)
+}
+
 func (t *FileTree) ListPaths(dir file.Path) ([]file.Path, error) {
 	n, err := t.node(dir, linkResolutionStrategy{
 		FollowAncestorLinks: true,
@@ -114,6 +200,14 @@ func (t *FileTree) ListPaths(dir file.Path) ([]file.Path, error) {
 // File fetches a file.Reference for the given path. Returns nil if the path does not exist in the FileTree.
 func (t *FileTree) File(path file.Path, options ...LinkResolutionOption) (bool, *file.Reference, error) {
 	userStrategy := newLinkResolutionStrategy(options...)
+	if userStrategy.CaseInsensitive {
+		var err error
+		path, err = t.matchCase(path)
+		if err != nil {
+			return false, nil, err
+		}
+	}
+
 	// For:             /some/path/here
 	// Where:           /some/path -> /other/place
 	// And resolves to: /other/place/here
@@ -154,6 +248,81 @@ func (t *FileTree) File(path file.Path, options ...LinkResolutionOption) (bool,
 	return false, nil, err
 }
 
+// Resolve follows all links for the given path (both for constituent paths and the basename) the same way the
+// kernel would, returning the node at the real path that is found. Relative link targets are resolved relative to the
+// directory of the link, and targets that would escape the root are clamped to the root. Returns nil if the path does
+// not resolve (it does not exist or is a dead link). ErrLinkCycleDetected is returned if a cycle is found or too many
+// links are followed. The only option that affects resolution is CaseInsensitive.
+func (t *FileTree) Resolve(path file.Path, options ...LinkResolutionOption) (*filenode.FileNode, error) {
+	if newLinkResolutionStrategy(options...).CaseInsensitive {
+		var err error
+		path, err = t.matchCase(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return t.node(path, linkResolutionStrategy{
+		FollowAncestorLinks: true,
+		FollowBasenameLinks: true,
+	})
+}
+
+// matchCase returns the given path with each component replaced by the casing of the matching tree entry (compared
+// case-insensitively, following links for ancestors). Components that do not match any entry are left as-is.
+func (t *FileTree) matchCase(p file.Path) (file.Path, error) {
+	normalized := p.Normalize()
+	if normalized == file.DirSeparator {
+		return normalized, nil
+	}
+
+	parts := strings.Split(strings.Trim(string(normalized), file.DirSeparator), file.DirSeparator)
+	current := file.Path(file.DirSeparator)
+	for idx, part := range parts {
+		dir, err := t.node(current, linkResolutionStrategy{
+			FollowAncestorLinks: true,
+			FollowBasenameLinks: true,
+		})
+		if err != nil {
+			return "", err
+		}
+		if dir == nil {
+			// there is nothing further to match against
+			return file.Path(path.Join(string(current), strings.Join(parts[idx:], file.DirSeparator))), nil
+		}
+		current = file.Path(path.Join(string(current), t.matchChildCase(dir, part)))
+	}
+	return current, nil
+}
+
+// matchChildCase returns the basename of the child of the given node that matches the name case-insensitively. An
+// exact match is always preferred, otherwise the lexically first of any colliding entries is chosen.
+func (t *FileTree) matchChildCase(dir *filenode.FileNode, name string) string {
+	var candidates []string
+	for _, child := range t.tree.Children(dir) {
+		if child == nil {
+			continue
+		}
+		childName := child.(*filenode.FileNode).RealPath.Basename()
+		if childName == name {
+			return name
+		}
+		if strings.EqualFold(childName, name) {
+			candidates = append(candidates, childName)
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return name
+	case 1:
+		return candidates[0]
+	}
+
+	sort.Strings(candidates)
+	log.Debugf("multiple paths within %q match %q case-insensitively (%s), using %q", dir.RealPath, name, strings.Join(candidates, ", "), candidates[0])
+	return candidates[0]
+}
+
 func (t *FileTree) node(p file.Path, strategy linkResolutionStrategy) (*filenode.FileNode, error) {
 	normalizedPath := p.Normalize()
 	nodeID := filenode.IDByPath(normalizedPath)
@@ -168,7 +337,7 @@ func (t *FileTree) node(p file.Path, strategy linkResolutionStrategy) (*filenode
 	var currentNode *filenode.FileNode
 	var err error
 	if strategy.FollowAncestorLinks {
-		currentNode, err = t.resolveAncestorLinks(normalizedPath)
+		currentNode, err = t.resolveAncestorLinks(normalizedPath, 0)
 		if err != nil {
 			return currentNode, err
 		}
@@ -185,14 +354,15 @@ func (t *FileTree) node(p file.Path, strategy linkResolutionStrategy) (*filenode
 	}
 
 	if strategy.FollowBasenameLinks {
-		currentNode, err = t.resolveNodeLinks(currentNode, !strategy.DoNotFollowDeadBasenameLinks)
+		currentNode, err = t.resolveNodeLinks(currentNode, !strategy.DoNotFollowDeadBasenameLinks, 0)
 	}
 	return currentNode, err
 }
 
 // return FileNode of the basename in the given path (no resolution is done at or past the basename). Note: it is
-// assumed that the given path has already been normalized.
-func (t *FileTree) resolveAncestorLinks(path file.Path) (*filenode.FileNode, error) {
+// assumed that the given path has already been normalized. The linksFollowed count is the length of the chain of links
+// that led to this resolution (zero if none).
+func (t *FileTree) resolveAncestorLinks(path file.Path, linksFollowed int) (*filenode.FileNode, error) {
 	// performance optimization... see if there is a node at the path (as if it is a real path). If so,
 	// use it, otherwise, continue with ancestor resolution
 	currentNode, err := t.node(path, linkResolutionStrategy{})
@@ -248,7 +418,7 @@ func (t *FileTree) resolveAncestorLinks(path file.Path) (*filenode.FileNode, err
 		// links until the next Node is resolved (or not).
 		isLastPart := idx == len(pathParts)-1
 		if !isLastPart && currentNode.IsLink() {
-			currentNode, err = t.resolveNodeLinks(currentNode, true)
+			currentNode, err = t.resolveNodeLinks(currentNode, true, linksFollowed)
 			if err != nil {
 				// only expected to happen on cycles
 				return currentNode, err
@@ -264,9 +434,16 @@ func (t *FileTree) resolveAncestorLinks(path file.Path) (*filenode.FileNode, err
 	return currentNode, nil
 }
 
-// followNode takes the given FileNode and resolves all links at the base of the real path for the node (this implies
-// that NO ancestors are considered).
-func (t *FileTree) resolveNodeLinks(n *filenode.FileNode, followDeadBasenameLinks bool) (*filenode.FileNode, error) {
+// resolveNodeLinks takes the given FileNode and resolves all links at the base of the real path for the node (this implies
+// that NO ancestors are considered). The linksFollowed count is the length of the chain of links that led to this
+// resolution (zero if none).
+func (t *FileTree) resolveNodeLinks(n *filenode.FileNode, followDeadBasenameLinks bool, linksFollowed int) (*filenode.FileNode, error) {
+	return t.resolveNodeLinksTraversed(n, followDeadBasenameLinks, linksFollowed, nil)
+}
+
+// resolveNodeLinksTraversed is resolveNodeLinks, additionally calling the given function (when not nil) with the
+// destination of every link followed, and the real path that each destination resolved to (see ResolveLinkChain).
+func (t *FileTree) resolveNodeLinksTraversed(n *filenode.FileNode, followDeadBasenameLinks bool, linksFollowed int, traversed func(file.Path)) (*filenode.FileNode, error) {
 	if n == nil {
 		return nil, fmt.Errorf("cannot resolve links with nil Node given")
 	}
@@ -295,20 +472,15 @@ func (t *FileTree) resolveNodeLinks(n *filenode.FileNode, followDeadBasenameLink
 			break
 		}
 
+		linksFollowed++
+		if linksFollowed > maxLinkResolutionDepth {
+			return nil, fmt.Errorf("%w: more than %d links followed", ErrLinkCycleDetected, maxLinkResolutionDepth)
+		}
+
 		// prepare for the next iteration
 		alreadySeen.Add(string(currentNode.RealPath))
 
-		var nextPath file.Path
-		if currentNode.LinkPath.IsAbsolutePath() {
-			// use links with absolute paths blindly
-			nextPath = currentNode.LinkPath
-		} else {
-			// resolve relative link paths
-			var parentDir string
-			parentDir, _ = filepath.Split(string(currentNode.RealPath))
-			// assemble relative link path by normalizing: "/cur/dir/../file1.txt" --> "/cur/file1.txt"
-			nextPath = file.Path(path.Clean(path.Join(parentDir, string(currentNode.LinkPath))))
-		}
+		nextPath := linkDestination(currentNode)
 
 		// no more links to follow
 		if string(nextPath) == "" {
@@ -318,12 +490,19 @@ func (t *FileTree) resolveNodeLinks(n *filenode.FileNode, followDeadBasenameLink
 		// preserve the current Node for the next loop (in case we shouldn't follow a potentially dead link)
 		lastNode = currentNode
 
+		if traversed != nil {
+			traversed(nextPath)
+		}
+
 		// get the next Node (based on the next path)
-		currentNode, err = t.resolveAncestorLinks(nextPath)
+		currentNode, err = t.resolveAncestorLinks(nextPath, linksFollowed)
 		if err != nil {
 			// only expected to occur upon cycle detection
 			return currentNode, err
 		}
+		if traversed != nil && currentNode != nil {
+			traversed(currentNode.RealPath)
+		}
 	}
 
 	if currentNode == nil && !followDeadBasenameLinks {
@@ -333,6 +512,54 @@ func (t *FileTree) resolveNodeLinks(n *filenode.FileNode, followDeadBasenameLink
 	return currentNode, nil
 }
 
+// linkDestination returns the path that the given link node points to, relative to the root of the tree.
+func linkDestination(n *filenode.FileNode) file.Path {
+	if n.LinkPath.IsAbsolutePath() {
+		// use links with absolute paths blindly (only cleaned, so that "/../x" is clamped to "/x")
+		return file.Path(path.Clean(string(n.LinkPath)))
+	}
+	// resolve relative link paths
+	parentDir, _ := filepath.Split(string(n.RealPath))
+	// assemble relative link path by normalizing: "/cur/dir/../file1.txt" --> "/cur/file1.txt" (note: any relative path
+	// that would escape the root is clamped to the root)
+	return file.Path(path.Clean(path.Join(parentDir, string(n.LinkPath))))
+}
+
+// ResolveLinkChain follows all links for the given path (the same way as Resolve) and returns every path traversed in
+// order, starting with the given path and ending with the real path that the resolution ended at. Each link followed
+// contributes its destination, and where the destination is within a linked directory, the real path as well (e.g.
+// "/lib64/x.so" followed by "/usr/lib/x.so" where "/lib64" links to "/usr/lib"). If the chain ends at a path that is
+// not in the tree (e.g. a dead link), that path is the last entry. ErrLinkCycleDetected is returned (along with the
+// chain traversed so far) if a cycle is found or too many links are followed. The only option that affects resolution
+// is CaseInsensitive.
+func (t *FileTree) ResolveLinkChain(p file.Path, options ...LinkResolutionOption) ([]file.Path, error) {
+	current := p.Normalize()
+	if newLinkResolutionStrategy(options...).CaseInsensitive {
+		var err error
+		current, err = t.matchCase(current)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	chain := []file.Path{current}
+	traversed := func(p file.Path) {
+		if p != chain[len(chain)-1] {
+			chain = append(chain, p)
+		}
+	}
+
+	n, err := t.resolveAncestorLinks(current, 0)
+	if err != nil || n == nil {
+		// note: when there is no node, the chain ends at a path that does not exist (which has already been recorded)
+		return chain, err
+	}
+	traversed(n.RealPath)
+
+	_, err = t.resolveNodeLinksTraversed(n, true, 0, traversed)
+	return chain, err
+}
+
 // FilesByGlob fetches zero to many file.References for the given glob pattern (considers symlinks).
 func (t *FileTree) FilesByGlob(query string, options ...LinkResolutionOption) ([]GlobResult, error) {
 	results := make([]GlobResult, 0)
@@ -341,17 +568,8 @@ func (t *FileTree) FilesByGlob(query string, options ...LinkResolutionOption) ([
 		return nil, fmt.Errorf("no glob pattern given")
 	}
 
-	if query[0] != file.DirSeparator[0] {
-		// this is for an image, so it should always be relative to root
-		query = file.DirSeparator + query
-	}
-
-	doNotFollowDeadBasenameLinks := false
-	for _, o := range options {
-		if o == DoNotFollowDeadBasenameLinks {
-			doNotFollowDeadBasenameLinks = true
-		}
-	}
+	query = rootedGlobPattern(query)
+	doNotFollowDeadBasenameLinks := hasDoNotFollowDeadBasenameLinks(options)
 
 	matches, err := doublestar.Glob(&osAdapter{
 		filetree:                     t,
@@ -362,38 +580,133 @@ func (t *FileTree) FilesByGlob(query string, options ...LinkResolutionOption) ([
 	}
 
 	for _, match := range matches {
-		// consumers need to understand that these are absolute paths and not relative
-		// ex: directory resolver should stop at the dir input and not traverse up the filetree
-		matchPath := file.Path(match)
-		if !path.IsAbs(match) {
-			matchPath = file.Path(path.Join("/", match))
-		}
-		fn, err := t.node(matchPath, linkResolutionStrategy{
-			FollowAncestorLinks:          true,
-			FollowBasenameLinks:          true,
-			DoNotFollowDeadBasenameLinks: doNotFollowDeadBasenameLinks,
-		})
+		result, err := t.globResult(match, doNotFollowDeadBasenameLinks)
 		if err != nil {
 			return nil, err
 		}
-		// the Node must exist and should not be a directory
-		if fn != nil && fn.FileType != file.TypeDir {
-			result := GlobResult{
-				MatchPath: matchPath,
-				RealPath:  fn.RealPath,
-				// we should not be given a link Node UNLESS it is dead
-				IsDeadLink: fn.IsLink(),
+		if result != nil {
+			results = append(results, *result)
+		}
+	}
+
+	return results, nil
+}
+
+// FilesByGlobs fetches zero to many file.References that match at least one of the given glob patterns (considers
+// symlinks). Patterns prefixed with "!" are negations: any path matching a negated pattern is excluded from the
+// results. Matches are streamed from the tree as they are found (instead of gathering all matching paths upfront)
+// and each match path is reported at most once.
+func (t *FileTree) FilesByGlobs(patterns []string, options ...LinkResolutionOption) ([]GlobResult, error) {
+	var includes, excludes []string
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "!") {
+			pattern = strings.TrimPrefix(pattern, "!")
+			if len(pattern) == 0 {
+				return nil, fmt.Errorf("no glob pattern given for negation")
 			}
-			if fn.Reference != nil {
-				result.Reference = *fn.Reference
+			excludes = append(excludes, rootedGlobPattern(pattern))
+			continue
+		}
+		if len(pattern) == 0 {
+			return nil, fmt.Errorf("no glob pattern given")
+		}
+		includes = append(includes, rootedGlobPattern(pattern))
+	}
+
+	for _, pattern := range append(includes, excludes...) {
+		if !doublestar.ValidatePattern(pattern) {
+			return nil, fmt.Errorf("invalid glob pattern: %q", pattern)
+		}
+	}
+
+	doNotFollowDeadBasenameLinks := hasDoNotFollowDeadBasenameLinks(options)
+	adapter := &osAdapter{
+		filetree:                     t,
+		doNotFollowDeadBasenameLinks: doNotFollowDeadBasenameLinks,
+	}
+
+	results := make([]GlobResult, 0)
+	seen := file.NewPathSet()
+	visitor := func(match string, _ fs.DirEntry) error {
+		result, err := t.globResult(match, doNotFollowDeadBasenameLinks)
+		if err != nil {
+			return err
+		}
+		if result == nil || seen.Contains(result.MatchPath) {
+			return nil
+		}
+		seen.Add(result.MatchPath)
+
+		for _, exclude := range excludes {
+			// note: the patterns have already been validated, so there is no error to check
+			if excluded, _ := doublestar.Match(exclude, string(result.MatchPath)); excluded {
+				return nil
 			}
-			results = append(results, result)
+		}
+
+		results = append(results, *result)
+		return nil
+	}
+
+	for _, include := range includes {
+		if err := doublestar.GlobWalk(adapter, include, visitor); err != nil {
+			return nil, err
 		}
 	}
 
 	return results, nil
 }
 
+// globResult creates a GlobResult for the given glob match, or nil if the match is not a (non-directory) path within the tree.
+func (t *FileTree) globResult(match string, doNotFollowDeadBasenameLinks bool) (*GlobResult, error) {
+	// consumers need to understand that these are absolute paths and not relative
+	// ex: directory resolver should stop at the dir input and not traverse up the filetree
+	matchPath := file.Path(match)
+	if !path.IsAbs(match) {
+		matchPath = file.Path(path.Join("/", match))
+	}
+	fn, err := t.node(matchPath, linkResolutionStrategy{
+		FollowAncestorLinks:          true,
+		FollowBasenameLinks:          true,
+		DoNotFollowDeadBasenameLinks: doNotFollowDeadBasenameLinks,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// the Node must exist and should not be a directory
+	if fn == nil || fn.FileType == file.TypeDir {
+		return nil, nil
+	}
+
+	result := GlobResult{
+		MatchPath: matchPath,
+		RealPath:  fn.RealPath,
+		// we should not be given a link Node UNLESS it is dead
+		IsDeadLink: fn.IsLink(),
+	}
+	if fn.Reference != nil {
+		result.Reference = *fn.Reference
+	}
+	return &result, nil
+}
+
+// rootedGlobPattern ensures the given glob pattern is relative to root (since this is for an image).
+func rootedGlobPattern(pattern string) string {
+	if pattern[0] != file.DirSeparator[0] {
+		return file.DirSeparator + pattern
+	}
+	return pattern
+}
+
+func hasDoNotFollowDeadBasenameLinks(options []LinkResolutionOption) bool {
+	for _, o := range options {
+		if o == DoNotFollowDeadBasenameLinks {
+			return true
+		}
+	}
+	return false
+}
+
 // AddFile adds a new path representing a REGULAR file to the Tree. It also adds any ancestors of the path that are not already
 // present in the Tree. The resulting file.Reference of the new (leaf) addition is returned. Note: NO symlink or
 // hardlink resolution is performed on the given path --which implies that the given path MUST be a real path (have no
@@ -423,6 +736,66 @@ func (t *FileTree) AddFile(realPath file.Path) (*file.Reference, error) {
 	return newFn.Reference, t.setFileNode(newFn)
 }
 
+// AddPath adds a REGULAR file at the given path with the given (existing) file.Reference, such as a reference whose
+// metadata is already held elsewhere, adding any ancestors of the path that are not already present in the Tree. Any
+// existing path is replaced (along with everything beneath it). This is a direct mutation of the tree which bypasses
+// whiteout semantics: a whiteout path (e.g. "/etc/.wh.hosts") is added as a regular entry and nothing is removed (use
+// Merge to apply whiteouts). Note: NO symlink or hardlink resolution is performed on the given path --which implies
+// that the given path MUST be a real path (have no links in constituent paths)
+func (t *FileTree) AddPath(realPath file.Path, ref file.Reference) error {
+	realPath = realPath.Normalize()
+	if realPath.IsRoot() {
+		return fmt.Errorf("cannot replace the root path with a file")
+	}
+
+	fn, err := t.node(realPath, linkResolutionStrategy{})
+	if err != nil {
+		return err
+	}
+	if fn != nil {
+		// note: the existing path may be a directory, in which case the file cannot keep its children
+		if err := t.removeNode(fn); err != nil {
+			return err
+		}
+	}
+
+	if err := t.addParentPaths(realPath); err != nil {
+		return err
+	}
+	return t.setFileNode(filenode.NewFile(realPath, &ref))
+}
+
+// AddSpecialFile adds a new path representing a DEVICE or NAMED PIPE (of the given file type) to the Tree. It also adds any
+// ancestors of the path that are not already present in the Tree. The resulting file.Reference of the new (leaf) addition
+// is returned. Note: NO symlink or hardlink resolution is performed on the given path --which implies that the given path
+// MUST be a real path (have no links in constituent paths)
+func (t *FileTree) AddSpecialFile(realPath file.Path, fileType file.Type) (*file.Reference, error) {
+	if !fileType.IsSpecial() {
+		return nil, fmt.Errorf("file type=%s is not a device or named pipe (path=%q)", fileType, realPath)
+	}
+	fn, err := t.node(realPath, linkResolutionStrategy{})
+	if err != nil {
+		return nil, err
+	}
+	if fn != nil {
+		// this path already exists
+		if fn.FileType != fileType {
+			return nil, fmt.Errorf("path=%q already exists but is NOT a %s", realPath, fileType)
+		}
+		if fn.Reference == nil {
+			fn.Reference = file.NewFileReference(realPath)
+		}
+		return fn.Reference, nil
+	}
+
+	// this is a new path... add the new Node + parents
+	if err := t.addParentPaths(realPath); err != nil {
+		return nil, err
+	}
+	newFn := filenode.NewSpecialFile(realPath, fileType, file.NewFileReference(realPath))
+	return newFn.Reference, t.setFileNode(newFn)
+}
+
 // AddSymLink adds a new path to the Tree that represents a SYMLINK. A new file.Reference with a absolute or relative
 // link path captured and returned. Note: NO symlink or hardlink resolution is performed on the given path --which
 // implies that the given path MUST be a real path (have no links in constituent paths)
@@ -462,9 +835,9 @@ func (t *FileTree) AddHardLink(realPath file.Path, linkPath file.Path) (*file.Re
 	if fn != nil {
 		// this path already exists
 		if fn.FileType != file.TypeHardLink {
-			return nil, fmt.Errorf("path=%q already exists but is NOT a symlink file", realPath)
+			return nil, fmt.Errorf("path=%q already exists but is NOT a hardlink file", realPath)
 		}
-		// this is a symlink file, provide a new or existing file.Reference
+		// this is a hardlink file, provide a new or existing file.Reference
 		if fn.Reference == nil {
 			fn.Reference = file.NewFileReference(realPath)
 		}
@@ -476,7 +849,9 @@ func (t *FileTree) AddHardLink(realPath file.Path, linkPath file.Path) (*file.Re
 		return nil, err
 	}
 
-	newFn := filenode.NewHardLink(realPath, linkPath, file.NewFileReference(realPath))
+	// note: tar hardlink names are relative to the archive root (not the directory of the link), so the link path is
+	// always treated as an absolute path
+	newFn := filenode.NewHardLink(realPath, (file.DirSeparator + linkPath).Normalize(), file.NewFileReference(realPath))
 
 	return newFn.Reference, t.setFileNode(newFn)
 }
@@ -561,6 +936,9 @@ func (t *FileTree) setFileNode(fn *filenode.FileNode) error {
 	}
 
 	if existingNode := t.tree.Node(filenode.IDByPath(fn.RealPath)); existingNode != nil {
+		// note: the path is the same, so the basename index does not change (however, the link path may)
+		t.hardLinks.remove(existingNode.(*filenode.FileNode))
+		t.hardLinks.add(fn)
 		return t.tree.Replace(existingNode, fn)
 	}
 
@@ -577,14 +955,31 @@ func (t *FileTree) setFileNode(fn *filenode.FileNode) error {
 		return fmt.Errorf("unable to find parent path=%q while adding path=%q", parentPath, fn.RealPath)
 	}
 
-	return t.tree.AddChild(parentNode, fn)
+	if err := t.tree.AddChild(parentNode, fn); err != nil {
+		return err
+	}
+	t.basenames.add(fn.RealPath)
+	t.hardLinks.add(fn)
+	return nil
 }
 
-// RemovePath deletes the file.Reference from the FileTree by the given path. If the basename of the given path
-// is a symlink then the symlink is removed (not the destination of the symlink). If the path does not exist, this is a
-// nop.
+// removeNode removes the given node and all descendants from the Tree (and the basename and hardlink indexes).
+func (t *FileTree) removeNode(n node.Node) error {
+	removed, err := t.tree.RemoveNode(n)
+	for _, r := range removed {
+		fn := r.(*filenode.FileNode)
+		t.basenames.remove(fn.RealPath)
+		t.hardLinks.remove(fn)
+	}
+	return err
+}
+
+// RemovePath deletes the file.Reference from the FileTree by the given path, along with all paths beneath it (when the
+// path is a directory). If the basename of the given path is a symlink then the symlink is removed (not the destination
+// of the symlink). If the path does not exist, this is a nop. As with AddPath, this bypasses whiteout semantics (no
+// whiteout is recorded for the removed paths).
 func (t *FileTree) RemovePath(path file.Path) error {
-	if path.Normalize() == "/" {
+	if path.IsRoot() {
 		return ErrRemovingRoot
 	}
 
@@ -599,11 +994,7 @@ func (t *FileTree) RemovePath(path file.Path) error {
 		return nil
 	}
 
-	_, err = t.tree.RemoveNode(fn)
-	if err != nil {
-		return err
-	}
-	return nil
+	return t.removeNode(fn)
 }
 
 // RemoveChildPaths deletes all children of the given path (not including the given path). Note: if the given path
@@ -622,8 +1013,7 @@ func (t *FileTree) RemoveChildPaths(path file.Path) error {
 		return nil
 	}
 	for _, child := range t.tree.Children(fn) {
-		_, err := t.tree.RemoveNode(child)
-		if err != nil {
+		if err := t.removeNode(child); err != nil {
 			return err
 		}
 	}
@@ -682,16 +1072,89 @@ func (t *FileTree) HasPath(path file.Path, options ...LinkResolutionOption) bool
 	return exists
 }
 
+// Type returns the file type of the node at the given path (as derived from the tar header type flag, e.g. a regular
+// file, directory, symlink, or device), and whether the path is in the tree at all. Ancestor links are always followed,
+// however, by default the type of a link itself is returned (use FollowBasenameLinks for the type of what it links to).
+// Directories that are only implied by other paths are reported as directories.
+func (t *FileTree) Type(path file.Path, options ...LinkResolutionOption) (file.Type, bool) {
+	n := t.typedNode(path, options...)
+	if n == nil {
+		return 0, false
+	}
+	return n.FileType, true
+}
+
+// Digest returns the content digest of the regular file at the given path (e.g. "sha256:...", see SetDigest), and
+// whether the path is in the tree at all. Only regular files have a content digest: directories, links, and devices
+// always have an empty digest, as do regular files without a recorded digest. As with Type, ancestor links are always
+// followed, however, basename links are only followed with FollowBasenameLinks (giving the digest of what it links to).
+func (t *FileTree) Digest(path file.Path, options ...LinkResolutionOption) (string, bool) {
+	n := t.typedNode(path, options...)
+	if n == nil {
+		return "", false
+	}
+	if n.FileType != file.TypeReg {
+		return "", true
+	}
+	return n.Digest, true
+}
+
+// typedNode returns the node at the given path as resolved for Type and Digest (ancestor links are always followed,
+// the remaining link resolution and case matching are from the given options), or nil if there is no such node.
+func (t *FileTree) typedNode(path file.Path, options ...LinkResolutionOption) *filenode.FileNode {
+	userStrategy := newLinkResolutionStrategy(options...)
+	if userStrategy.CaseInsensitive {
+		var err error
+		path, err = t.matchCase(path)
+		if err != nil {
+			return nil
+		}
+	}
+
+	n, err := t.node(path, linkResolutionStrategy{
+		FollowAncestorLinks:          true,
+		FollowBasenameLinks:          userStrategy.FollowBasenameLinks,
+		DoNotFollowDeadBasenameLinks: userStrategy.DoNotFollowDeadBasenameLinks,
+	})
+	if err != nil {
+		return nil
+	}
+	return n
+}
+
+// SetDigest records the content digest of the regular file at the given (real) path, which is kept when the tree is
+// copied or merged (see Digest).
+func (t *FileTree) SetDigest(realPath file.Path, digest string) error {
+	n, err := t.node(realPath, linkResolutionStrategy{})
+	if err != nil {
+		return err
+	}
+	if n == nil {
+		return fmt.Errorf("path=%q does not exist", realPath)
+	}
+	if n.FileType != file.TypeReg {
+		return fmt.Errorf("path=%q is NOT a regular file", realPath)
+	}
+	n.Digest = digest
+	return nil
+}
+
 // Walk takes a visitor function and invokes it for all paths within the FileTree in depth-first ordering.
 func (t *FileTree) Walk(fn func(path file.Path, f filenode.FileNode) error, conditions *WalkConditions) error {
 	return NewDepthFirstPathWalker(t, fn, conditions).WalkAll()
 }
 
-// merge takes the given Tree and combines it with the current Tree, preferring files in the other Tree if there
-// are path conflicts. This is the basis function for squashing (where the current Tree is the bottom Tree and the
-// given Tree is the top Tree).
+// Merge overlays the given (upper) tree onto the current (lower) tree, preferring paths from the upper tree where both
+// trees have the same path. Whiteouts within the upper tree are applied to the current tree: a file whiteout removes
+// the path (and any children), and an opaque whiteout removes all children of its directory, but whiteout entries
+// themselves are never added. This is the basis function for squashing (see UnionFileTree.Squash).
+//
+// The current tree is modified in place and the upper tree is not modified. In order to keep the current tree intact
+// (e.g. when the tree is a layer tree) merge into a copy instead (see Copy). Note that file references are shared
+// between the trees (not copied), so references in the merged tree can still be used to look up file metadata and
+// contents.
 // nolint:gocognit,funlen
-func (t *FileTree) merge(upper *FileTree) error {
+func (t *FileTree) Merge(upper *FileTree) error {
 	conditions := tree.WalkConditions{
 		ShouldContinueBranch: func(n node.Node) bool {
 			p := file.Path(n.ID())
@@ -710,6 +1173,9 @@ func (t *FileTree) merge(upper *FileTree) error {
 		upperNode := n.(*filenode.FileNode)
 		// opaque directories must be processed first
 		if upper.hasOpaqueDirectory(upperNode.RealPath) {
+			if err := t.removeHardLinksWithin(upperNode.RealPath, upper); err != nil {
+				return err
+			}
 			err := t.RemoveChildPaths(upperNode.RealPath)
 			if err != nil {
 				return fmt.Errorf("filetree merge failed to remove child paths (upperPath=%s): %w", upperNode.RealPath, err)
@@ -717,11 +1183,20 @@ func (t *FileTree) merge(upper *FileTree) error {
 		}
 
 		if upperNode.RealPath.IsWhiteout() {
-			lowerPath, err := upperNode.RealPath.UnWhiteoutPath()
+			lowerPath, kind, err := upperNode.RealPath.UnWhiteoutPath()
 			if err != nil {
 				return fmt.Errorf("filetree merge failed to find original upperPath for whiteout (upperPath=%s): %w", upperNode.RealPath, err)
 			}
 
+			if kind == file.OpaqueDirWhiteout {
+				// opaque whiteouts are handled when visiting the parent directory (above)
+				return nil
+			}
+
+			if err := t.removeHardLinksWithin(lowerPath, upper); err != nil {
+				return err
+			}
+
 			err = t.RemovePath(lowerPath)
 			if err != nil {
 				return fmt.Errorf("filetree merge failed to remove upperPath (upperPath=%s): %w", lowerPath, err)
@@ -749,6 +1224,16 @@ func (t *FileTree) merge(upper *FileTree) error {
 		// keep original file references if the upper tree does not have them (only for the same file types)
 		if lowerNode != nil && lowerNode.Reference != nil && upperNode.Reference == nil && upperNode.FileType == lowerNode.FileType {
 			nodeCopy.Reference = lowerNode.Reference
+			nodeCopy.Digest = lowerNode.Digest
+		}
+
+		if lowerNode != nil && (upperNode.FileType == file.TypeDir) != (lowerNode.FileType == file.TypeDir) {
+			// a file replaced with a directory (or a directory replaced with a file) removes the lower path as with a
+			// whiteout (matching overlayfs), so hardlinks to the lower path (or to paths beneath it) do not survive (note:
+			// this is a lookup within the hardlink index, not a walk of the lower tree)
+			if err := t.removeHardLinksWithin(upperNode.RealPath, upper); err != nil {
+				return err
+			}
 		}
 
 		if lowerNode != nil && upperNode.FileType != file.TypeDir && lowerNode.FileType == file.TypeDir {
@@ -773,6 +1258,21 @@ func (t *FileTree) merge(upper *FileTree) error {
 	return tree.NewDepthFirstWalkerWithConditions(upper.Reader(), visitor, conditions).WalkAll()
 }
 
+// removeHardLinksWithin removes all hardlinks that point to the given path (or any descendant path) since hardlinks
+// share content with their target and do not survive the removal of the target. Hardlinks that the upper tree provides
+// again are kept.
+func (t *FileTree) removeHardLinksWithin(target file.Path, upper *FileTree) error {
+	for _, hardLink := range t.hardLinksWithin(target, true) {
+		if upperLink, err := upper.node(hardLink, linkResolutionStrategy{}); err == nil && upperLink != nil {
+			continue
+		}
+		if err := t.RemovePath(hardLink); err != nil {
+			return fmt.Errorf("filetree merge failed to remove hardlink to removed path (link=%s): %w", hardLink, err)
+		}
+	}
+	return nil
+}
+
 func (t *FileTree) hasOpaqueDirectory(directoryPath file.Path) bool {
 	opaqueWhiteoutChild := file.Path(path.Join(string(directoryPath), file.OpaqueWhiteout))
 	return t.HasPath(opaqueWhiteoutChild)
@@ -3,12 +3,15 @@ package filetree
 import (
 	"errors"
 	"fmt"
+	"sort"
+	"sync"
 	"testing"
 
 	"github.com/anchore/stereoscope/internal"
 	"github.com/anchore/stereoscope/pkg/file"
 	"github.com/anchore/stereoscope/pkg/filetree/filenode"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestFileTree_AddPath(t *testing.T) {
@@ -84,6 +87,200 @@ func TestFileTree_RemovePath(t *testing.T) {
 	}
 }
 
+func TestFileTree_AddPathWithReference(t *testing.T) {
+	tr := NewFileTree()
+	ref := *file.NewFileReference("/usr/bin/app")
+	require.NoError(t, tr.AddPath("/usr/bin//app/", ref))
+
+	// parents are implied directories
+	for _, p := range []file.Path{"/usr", "/usr/bin"} {
+		ty, exists := tr.Type(p)
+		assert.True(t, exists)
+		assert.Equal(t, file.TypeDir, ty)
+		_, parentRef, err := tr.File(p)
+		require.NoError(t, err)
+		assert.Nil(t, parentRef)
+	}
+	_, actual, err := tr.File("/usr/bin/app")
+	require.NoError(t, err)
+	require.NotNil(t, actual)
+	assert.Equal(t, ref.ID(), actual.ID())
+
+	// replacing a directory removes its subtree
+	_, err = tr.AddFile("/opt/tool/bin/tool")
+	require.NoError(t, err)
+	replacement := *file.NewFileReference("/opt/tool")
+	require.NoError(t, tr.AddPath("/opt/tool", replacement))
+	assert.False(t, tr.HasPath("/opt/tool/bin/tool"))
+	ty, _ := tr.Type("/opt/tool")
+	assert.Equal(t, file.TypeReg, ty)
+
+	// whiteouts are regular entries
+	require.NoError(t, tr.AddPath("/usr/bin/.wh.app", *file.NewFileReference("/usr/bin/.wh.app")))
+	assert.True(t, tr.HasPath("/usr/bin/app"))
+	assert.True(t, tr.HasPath("/usr/bin/.wh.app"))
+
+	// removing a directory removes its subtree
+	require.NoError(t, tr.RemovePath("/usr"))
+	assert.False(t, tr.HasPath("/usr/bin/app"))
+	assert.False(t, tr.HasPath("/usr"))
+
+	assert.Error(t, tr.AddPath("/", ref))
+}
+
+func TestFileTree_Copy(t *testing.T) {
+	tr := NewFileTree()
+	original, err := tr.AddFile("/home/wagoodman/file.txt")
+	require.NoError(t, err)
+	_, err = tr.AddSymLink("/home/link", "/home/wagoodman")
+	require.NoError(t, err)
+
+	cp, err := tr.Copy()
+	require.NoError(t, err)
+	assert.Equal(t, tr.AllFiles(file.AllTypes...), cp.AllFiles(file.AllTypes...))
+
+	// mutating the copy does not affect the original...
+	_, err = cp.AddFile("/home/wagoodman/other.txt")
+	require.NoError(t, err)
+	require.NoError(t, cp.RemovePath("/home/link"))
+	assert.False(t, tr.HasPath("/home/wagoodman/other.txt"))
+	assert.True(t, tr.HasPath("/home/link"))
+	assert.Len(t, tr.tree.Children(tr.tree.Node(filenode.IDByPath("/home/wagoodman"))), 1)
+
+	// ...and vice versa
+	require.NoError(t, tr.RemovePath("/home/wagoodman"))
+	assert.True(t, cp.HasPath("/home/wagoodman/file.txt"))
+
+	// the (immutable) references are shared between both trees
+	_, copied, err := cp.File("/home/wagoodman/file.txt")
+	require.NoError(t, err)
+	require.NotNil(t, copied)
+	assert.Same(t, original, copied)
+}
+
+func TestFileTree_Type(t *testing.T) {
+	tr := NewFileTree()
+	_, err := tr.AddFile("/etc/hosts")
+	require.NoError(t, err)
+	_, err = tr.AddSymLink("/etc/link", "/etc/hosts")
+	require.NoError(t, err)
+	_, err = tr.AddSymLink("/link-dir", "/etc")
+	require.NoError(t, err)
+	_, err = tr.AddHardLink("/etc/hard", "/etc/hosts")
+	require.NoError(t, err)
+	_, err = tr.AddSpecialFile("/dev/null", file.TypeCharacterDevice)
+	require.NoError(t, err)
+	_, err = tr.AddSpecialFile("/dev/sda", file.TypeBlockDevice)
+	require.NoError(t, err)
+	_, err = tr.AddSpecialFile("/run/pipe", file.TypeFifo)
+	require.NoError(t, err)
+
+	tests := []struct {
+		path     file.Path
+		options  []LinkResolutionOption
+		expected file.Type
+		exists   bool
+	}{
+		{path: "/etc/hosts", expected: file.TypeReg, exists: true},
+		{path: "/etc", expected: file.TypeDir, exists: true},
+		// implied directories are still directories
+		{path: "/dev", expected: file.TypeDir, exists: true},
+		{path: "/etc/link", expected: file.TypeSymlink, exists: true},
+		{path: "/etc/link", options: []LinkResolutionOption{FollowBasenameLinks}, expected: file.TypeReg, exists: true},
+		{path: "/link-dir/hosts", expected: file.TypeReg, exists: true},
+		{path: "/etc/hard", expected: file.TypeHardLink, exists: true},
+		{path: "/dev/null", expected: file.TypeCharacterDevice, exists: true},
+		{path: "/dev/sda", expected: file.TypeBlockDevice, exists: true},
+		{path: "/run/pipe", expected: file.TypeFifo, exists: true},
+		{path: "/missing"},
+	}
+	for _, test := range tests {
+		t.Run(string(test.path), func(t *testing.T) {
+			actual, exists := tr.Type(test.path, test.options...)
+			assert.Equal(t, test.exists, exists)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+
+	// special files are neither regular files nor can they be added as other types
+	assert.Equal(t, []file.Reference{*mustRef(t, tr, "/etc/hosts")}, tr.AllFiles())
+	_, err = tr.AddSpecialFile("/dev/null", file.TypeFifo)
+	assert.Error(t, err)
+	_, err = tr.AddFile("/dev/null")
+	assert.Error(t, err)
+	_, err = tr.AddSpecialFile("/dev/other", file.TypeReg)
+	assert.Error(t, err)
+}
+
+func TestFileTree_Digest(t *testing.T) {
+	tr := NewFileTree()
+	_, err := tr.AddFile("/etc/hosts")
+	require.NoError(t, err)
+	require.NoError(t, tr.SetDigest("/etc/hosts", "sha256:hosts"))
+	_, err = tr.AddFile("/etc/no-digest")
+	require.NoError(t, err)
+	_, err = tr.AddSymLink("/etc/link", "/etc/hosts")
+	require.NoError(t, err)
+	_, err = tr.AddHardLink("/etc/hard", "/etc/hosts")
+	require.NoError(t, err)
+	_, err = tr.AddSpecialFile("/dev/null", file.TypeCharacterDevice)
+	require.NoError(t, err)
+
+	// only regular files can have a digest
+	assert.Error(t, tr.SetDigest("/etc", "sha256:dir"))
+	assert.Error(t, tr.SetDigest("/etc/link", "sha256:link"))
+	assert.Error(t, tr.SetDigest("/dev/null", "sha256:device"))
+	assert.Error(t, tr.SetDigest("/missing", "sha256:missing"))
+
+	tests := []struct {
+		path     file.Path
+		options  []LinkResolutionOption
+		expected string
+		exists   bool
+	}{
+		{path: "/etc/hosts", expected: "sha256:hosts", exists: true},
+		{path: "/etc/no-digest", exists: true},
+		{path: "/etc", exists: true},
+		{path: "/etc/link", exists: true},
+		{path: "/etc/link", options: []LinkResolutionOption{FollowBasenameLinks}, expected: "sha256:hosts", exists: true},
+		{path: "/etc/hard", exists: true},
+		{path: "/etc/hard", options: []LinkResolutionOption{FollowBasenameLinks}, expected: "sha256:hosts", exists: true},
+		{path: "/dev/null", exists: true},
+		{path: "/missing"},
+	}
+	for _, test := range tests {
+		t.Run(string(test.path), func(t *testing.T) {
+			actual, exists := tr.Digest(test.path, test.options...)
+			assert.Equal(t, test.exists, exists)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+
+	// digests are kept when copying and merging
+	copied, err := tr.Copy()
+	require.NoError(t, err)
+	actual, _ := copied.Digest("/etc/hosts")
+	assert.Equal(t, "sha256:hosts", actual)
+
+	upper := NewFileTree()
+	_, err = upper.AddFile("/etc/no-digest")
+	require.NoError(t, err)
+	require.NoError(t, upper.SetDigest("/etc/no-digest", "sha256:upper"))
+	require.NoError(t, copied.Merge(upper))
+	actual, _ = copied.Digest("/etc/no-digest")
+	assert.Equal(t, "sha256:upper", actual)
+	actual, _ = copied.Digest("/etc/hosts")
+	assert.Equal(t, "sha256:hosts", actual)
+}
+
+func mustRef(t *testing.T, tr *FileTree, p file.Path) *file.Reference {
+	t.Helper()
+	_, ref, err := tr.File(p)
+	require.NoError(t, err)
+	require.NotNil(t, ref)
+	return ref
+}
+
 func TestFileTree_FilesByGlob(t *testing.T) {
 	tr := NewFileTree()
 
@@ -325,6 +522,328 @@ func TestFileTree_FilesByGlob(t *testing.T) {
 
 }
 
+func TestFileTree_FilesByGlobs(t *testing.T) {
+	tr := NewFileTree()
+
+	paths := []string{
+		"/usr/lib/libc.so",
+		"/usr/lib/x86_64/libssl.so",
+		"/usr/lib/x86_64/debug/libssl.so",
+		"/usr/lib/python3/site.py",
+		"/usr/share/doc/readme.txt",
+		"/etc/app.conf",
+	}
+	for _, p := range paths {
+		_, err := tr.AddFile(file.Path(p))
+		require.NoError(t, err)
+	}
+	_, err := tr.AddSymLink("/lib", "/usr/lib")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		patterns []string
+		expected []string
+		wantErr  bool
+	}{
+		{
+			name:     "single pattern",
+			patterns: []string{"/usr/lib/**/*.so"},
+			expected: []string{"/usr/lib/libc.so", "/usr/lib/x86_64/debug/libssl.so", "/usr/lib/x86_64/libssl.so"},
+		},
+		{
+			name:     "multiple patterns",
+			patterns: []string{"/usr/lib/*.so", "**/*.conf"},
+			expected: []string{"/etc/app.conf", "/usr/lib/libc.so"},
+		},
+		{
+			name:     "overlapping patterns are reported once",
+			patterns: []string{"/usr/lib/*.so", "/usr/lib/libc.*"},
+			expected: []string{"/usr/lib/libc.so"},
+		},
+		{
+			name:     "negation",
+			patterns: []string{"/usr/lib/**/*.so", "!**/debug/**"},
+			expected: []string{"/usr/lib/libc.so", "/usr/lib/x86_64/libssl.so"},
+		},
+		{
+			name:     "negation applies to the match path (not the real path)",
+			patterns: []string{"/lib/*.so", "/usr/lib/*.so", "!/lib/**"},
+			expected: []string{"/usr/lib/libc.so"},
+		},
+		{
+			name:     "relative patterns are relative to root",
+			patterns: []string{"etc/*.conf"},
+			expected: []string{"/etc/app.conf"},
+		},
+		{
+			name:     "only negations",
+			patterns: []string{"!**/*.so"},
+			expected: nil,
+		},
+		{
+			name:     "empty pattern",
+			patterns: []string{""},
+			wantErr:  true,
+		},
+		{
+			name:     "invalid pattern",
+			patterns: []string{"/usr/[lib"},
+			wantErr:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			results, err := tr.FilesByGlobs(test.patterns)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			var actual []string
+			for _, r := range results {
+				actual = append(actual, string(r.MatchPath))
+			}
+			sort.Strings(actual)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestFileTree_Resolve(t *testing.T) {
+	tr := NewFileTree()
+
+	_, err := tr.AddFile("/usr/lib/python3.9/bin/python3.9")
+	require.NoError(t, err)
+	_, err = tr.AddFile("/etc/hosts")
+	require.NoError(t, err)
+
+	links := map[file.Path]file.Path{
+		// relative chain across directories
+		"/usr/bin/python":      "python3",
+		"/usr/bin/python3":     "../lib/python3",
+		"/usr/lib/python3":     "python3.9/bin/python3.9",
+		"/usr/local/bin/py":    "/usr/bin/python",
+		"/usr/local/lib":       "../lib",
+		"/absolute-dotted":     "/usr/../etc/hosts",
+		"/escapes-root":        "../../../../etc/hosts",
+		"/etc/escapes-root":    "../../../etc/hosts",
+		"/dead":                "/does/not/exist",
+		"/cycle/a":             "b",
+		"/cycle/b":             "a",
+		"/ancestor-cycle/a":    "/ancestor-cycle/b/x",
+		"/ancestor-cycle/b":    "/ancestor-cycle/a",
+		"/via-linked-ancestor": "/usr/local/lib/python3.9/bin/python3.9",
+	}
+	for linkPath, target := range links {
+		_, err := tr.AddSymLink(linkPath, target)
+		require.NoError(t, err)
+	}
+
+	tests := []struct {
+		path     file.Path
+		expected file.Path
+		wantErr  bool
+	}{
+		{path: "/usr/bin/python", expected: "/usr/lib/python3.9/bin/python3.9"},
+		{path: "/usr/local/bin/py", expected: "/usr/lib/python3.9/bin/python3.9"},
+		{path: "/via-linked-ancestor", expected: "/usr/lib/python3.9/bin/python3.9"},
+		{path: "/usr/local/lib/python3.9/bin", expected: "/usr/lib/python3.9/bin"},
+		{path: "/absolute-dotted", expected: "/etc/hosts"},
+		{path: "/escapes-root", expected: "/etc/hosts"},
+		{path: "/etc/escapes-root", expected: "/etc/hosts"},
+		{path: "/dead"},
+		{path: "/missing"},
+		{path: "/cycle/a", wantErr: true},
+		{path: "/ancestor-cycle/a", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.path), func(t *testing.T) {
+			n, err := tr.Resolve(test.path)
+			if test.wantErr {
+				assert.ErrorIs(t, err, ErrLinkCycleDetected)
+				return
+			}
+			require.NoError(t, err)
+			if test.expected == "" {
+				assert.Nil(t, n)
+				return
+			}
+			require.NotNil(t, n)
+			assert.Equal(t, test.expected, n.RealPath)
+		})
+	}
+}
+
+func TestFileTree_ResolveLinkChain(t *testing.T) {
+	tr := NewFileTree()
+	for _, p := range []file.Path{"/usr/lib/libc.so.6", "/etc/hosts"} {
+		_, err := tr.AddFile(p)
+		require.NoError(t, err)
+	}
+	for link, target := range map[file.Path]file.Path{
+		"/lib64":               "/usr/lib",
+		"/usr/lib/libc.so":     "libc.so.6",
+		"/usr/bin/libc":        "/lib64/libc.so",
+		"/usr/bin/hosts":       "../../etc/hosts",
+		"/usr/bin/dead":        "/missing",
+		"/usr/bin/dead-parent": "/lib32/libc.so",
+		"/cycle/a":             "b",
+		"/cycle/b":             "a",
+	} {
+		_, err := tr.AddSymLink(link, target)
+		require.NoError(t, err)
+	}
+
+	tests := []struct {
+		name     string
+		path     file.Path
+		expected []file.Path
+		wantErr  error
+	}{
+		{
+			name:     "regular file",
+			path:     "/etc/hosts",
+			expected: []file.Path{"/etc/hosts"},
+		},
+		{
+			name:     "relative link",
+			path:     "/usr/bin/hosts",
+			expected: []file.Path{"/usr/bin/hosts", "/etc/hosts"},
+		},
+		{
+			name:     "links through a linked directory",
+			path:     "/usr/bin/libc",
+			expected: []file.Path{"/usr/bin/libc", "/lib64/libc.so", "/usr/lib/libc.so", "/usr/lib/libc.so.6"},
+		},
+		{
+			name:     "linked ancestor",
+			path:     "/lib64/libc.so.6",
+			expected: []file.Path{"/lib64/libc.so.6", "/usr/lib/libc.so.6"},
+		},
+		{
+			name:     "dead link",
+			path:     "/usr/bin/dead",
+			expected: []file.Path{"/usr/bin/dead", "/missing"},
+		},
+		{
+			name:     "dead ancestor",
+			path:     "/usr/bin/dead-parent",
+			expected: []file.Path{"/usr/bin/dead-parent", "/lib32/libc.so"},
+		},
+		{
+			name:     "missing path",
+			path:     "/missing",
+			expected: []file.Path{"/missing"},
+		},
+		{
+			name:     "cycle",
+			path:     "/cycle/a",
+			expected: []file.Path{"/cycle/a", "/cycle/b", "/cycle/a"},
+			wantErr:  ErrLinkCycleDetected,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := tr.ResolveLinkChain(test.path)
+			if test.wantErr != nil {
+				assert.True(t, errors.Is(err, test.wantErr), "unexpected error: %+v", err)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, test.expected, actual)
+
+			if test.wantErr == nil {
+				// the chain ends where Resolve does
+				resolved, err := tr.Resolve(test.path)
+				require.NoError(t, err)
+				if resolved != nil {
+					assert.Equal(t, resolved.RealPath, actual[len(actual)-1])
+				}
+			}
+		})
+	}
+}
+
+func TestFileTree_Resolve_MaxLinkDepth(t *testing.T) {
+	// link-0 -> link-1 -> ... -> link-N -> /target
+	newChain := func(length int) *FileTree {
+		tr := NewFileTree()
+		_, err := tr.AddFile("/target")
+		require.NoError(t, err)
+		for i := 0; i < length; i++ {
+			next := file.Path(fmt.Sprintf("/link-%d", i+1))
+			if i == length-1 {
+				next = "/target"
+			}
+			_, err := tr.AddSymLink(file.Path(fmt.Sprintf("/link-%d", i)), next)
+			require.NoError(t, err)
+		}
+		return tr
+	}
+
+	n, err := newChain(maxLinkResolutionDepth).Resolve("/link-0")
+	require.NoError(t, err)
+	require.NotNil(t, n)
+	assert.Equal(t, file.Path("/target"), n.RealPath)
+
+	_, err = newChain(maxLinkResolutionDepth + 1).Resolve("/link-0")
+	assert.ErrorIs(t, err, ErrLinkCycleDetected)
+}
+
+func TestFileTree_CaseInsensitive(t *testing.T) {
+	tr := NewFileTree()
+	cmd, err := tr.AddFile("/Windows/System32/cmd.exe")
+	require.NoError(t, err)
+	_, err = tr.AddSymLink("/Windows/SysLink", "System32")
+	require.NoError(t, err)
+	upper, err := tr.AddFile("/Collide/FILE.txt")
+	require.NoError(t, err)
+	lower, err := tr.AddFile("/Collide/file.txt")
+	require.NoError(t, err)
+	_, err = tr.AddFile("/Collide/File.TXT")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		path     file.Path
+		expected *file.Reference
+	}{
+		{name: "different case", path: "/windows/system32/CMD.EXE", expected: cmd},
+		{name: "exact case", path: "/Windows/System32/cmd.exe", expected: cmd},
+		{name: "through a link", path: "/WINDOWS/syslink/Cmd.exe", expected: cmd},
+		{name: "collision prefers exact match", path: "/collide/file.txt", expected: lower},
+		{name: "collision without exact match is deterministic", path: "/collide/file.Txt", expected: upper},
+		{name: "missing", path: "/windows/system32/missing.exe"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			exists, ref, err := tr.File(test.path, FollowBasenameLinks, CaseInsensitive)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected != nil, exists)
+			assert.Equal(t, test.expected, ref)
+
+			n, err := tr.Resolve(test.path, CaseInsensitive)
+			require.NoError(t, err)
+			if test.expected == nil {
+				assert.Nil(t, n)
+				return
+			}
+			require.NotNil(t, n)
+			assert.Equal(t, test.expected.RealPath, n.RealPath)
+		})
+	}
+
+	// the default behavior remains case-sensitive
+	exists, _, err := tr.File("/windows/system32/CMD.EXE")
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
 func TestFileTree_Merge(t *testing.T) {
 	tr1 := NewFileTree()
 	tr1.AddFile("/home/wagoodman/awesome/file-1.txt")
@@ -332,7 +851,7 @@ func TestFileTree_Merge(t *testing.T) {
 	tr2 := NewFileTree()
 	tr2.AddFile("/home/wagoodman/awesome/file-2.txt")
 
-	if err := tr1.merge(tr2); err != nil {
+	if err := tr1.Merge(tr2); err != nil {
 		t.Fatalf("error on merge : %+v", err)
 	}
 
@@ -350,7 +869,7 @@ func TestFileTree_Merge_Overwrite(t *testing.T) {
 	tr2 := NewFileTree()
 	newRef, _ := tr2.AddFile("/home/wagoodman/awesome/file.txt")
 
-	if err := tr1.merge(tr2); err != nil {
+	if err := tr1.Merge(tr2); err != nil {
 		t.Fatalf("error on merge : %+v", err)
 	}
 
@@ -368,7 +887,7 @@ func TestFileTree_Merge_OpaqueWhiteout(t *testing.T) {
 	tr2 := NewFileTree()
 	tr2.AddFile("/home/wagoodman/.wh..wh..opq")
 
-	if err := tr1.merge(tr2); err != nil {
+	if err := tr1.Merge(tr2); err != nil {
 		t.Fatalf("error on merge : %+v", err)
 	}
 
@@ -393,7 +912,7 @@ func TestFileTree_Merge_OpaqueWhiteout_NoLowerDirectory(t *testing.T) {
 	tr2 := NewFileTree()
 	tr2.AddFile("/home/luhring/.wh..wh..opq")
 
-	if err := tr1.merge(tr2); err != nil {
+	if err := tr1.Merge(tr2); err != nil {
 		t.Fatalf("error on merge : %+v", err)
 	}
 
@@ -404,6 +923,64 @@ func TestFileTree_Merge_OpaqueWhiteout_NoLowerDirectory(t *testing.T) {
 	}
 }
 
+func TestFileTree_Merge_OpaqueWhiteout_Nested(t *testing.T) {
+	tr1 := NewFileTree()
+	tr1.AddFile("/a/keep.txt")
+	tr1.AddFile("/a/b/removed.txt")
+	tr1.AddFile("/a/b/c/removed.txt")
+
+	tr2 := NewFileTree()
+	tr2.AddFile("/a/b/.wh..wh..opq")
+	tr2.AddFile("/a/b/added.txt")
+
+	if err := tr1.Merge(tr2); err != nil {
+		t.Fatalf("error on merge : %+v", err)
+	}
+
+	for _, p := range []file.Path{"/a", "/a/keep.txt", "/a/b", "/a/b/added.txt"} {
+		if !tr1.HasPath(p) {
+			t.Errorf("missing expected path: %s", p)
+		}
+	}
+
+	for _, p := range []file.Path{"/a/b/removed.txt", "/a/b/c", "/a/b/c/removed.txt", "/a/b/.wh..wh..opq"} {
+		if tr1.HasPath(p) {
+			t.Errorf("expected path to be deleted: %s", p)
+		}
+	}
+}
+
+func TestFileTree_Merge_OpaqueWhiteout_Root(t *testing.T) {
+	tr1 := NewFileTree()
+	tr1.AddFile("/etc/hosts")
+	tr1.AddFile("/bin/busybox")
+	tr1.AddSymLink("/bin/sh", "/bin/busybox")
+	tr1.AddHardLink("/bin/ls", "/bin/busybox")
+	tr1.AddFile("/app/overwritten.txt")
+
+	// a root opaque whiteout removes everything from the lower tree, but keeps all additions from the same tree
+	tr2 := NewFileTree()
+	tr2.AddFile("/.wh..wh..opq")
+	tr2.AddFile("/app/overwritten.txt")
+	tr2.AddFile("/app/added.txt")
+
+	if err := tr1.Merge(tr2); err != nil {
+		t.Fatalf("error on merge : %+v", err)
+	}
+
+	for _, p := range []file.Path{"/", "/app", "/app/overwritten.txt", "/app/added.txt"} {
+		if !tr1.HasPath(p) {
+			t.Errorf("missing expected path: %s", p)
+		}
+	}
+
+	for _, p := range []file.Path{"/etc", "/etc/hosts", "/bin", "/bin/busybox", "/bin/sh", "/bin/ls", "/.wh..wh..opq"} {
+		if tr1.HasPath(p) {
+			t.Errorf("expected path to be deleted: %s", p)
+		}
+	}
+}
+
 func TestFileTree_Merge_Whiteout(t *testing.T) {
 	tr1 := NewFileTree()
 	tr1.AddFile("/home/wagoodman/awesome/file.txt")
@@ -411,7 +988,7 @@ func TestFileTree_Merge_Whiteout(t *testing.T) {
 	tr2 := NewFileTree()
 	tr2.AddFile("/home/wagoodman/awesome/.wh.file.txt")
 
-	if err := tr1.merge(tr2); err != nil {
+	if err := tr1.Merge(tr2); err != nil {
 		t.Fatalf("error on merge : %+v", err)
 	}
 
@@ -429,6 +1006,95 @@ func TestFileTree_Merge_Whiteout(t *testing.T) {
 
 }
 
+func TestFileTree_HardLinks(t *testing.T) {
+	tr := NewFileTree()
+	target, err := tr.AddFile("/usr/bin/busybox")
+	require.NoError(t, err)
+	// note: tar hardlink names are relative to the archive root
+	_, err = tr.AddHardLink("/bin/sh", "usr/bin/busybox")
+	require.NoError(t, err)
+	_, err = tr.AddHardLink("/usr/bin/ls", "/usr/bin/busybox")
+	require.NoError(t, err)
+	_, err = tr.AddHardLink("/other", "/usr/bin/other")
+	require.NoError(t, err)
+
+	assert.Equal(t, []file.Path{"/bin/sh", "/usr/bin/ls"}, tr.HardLinks("/usr/bin/busybox"))
+	assert.Empty(t, tr.HardLinks("/bin/sh"))
+
+	for _, p := range []file.Path{"/bin/sh", "/usr/bin/ls"} {
+		n, err := tr.Resolve(p)
+		require.NoError(t, err)
+		require.NotNil(t, n)
+		assert.Equal(t, target, n.Reference)
+	}
+}
+
+func TestFileTree_HardLinks_Index(t *testing.T) {
+	tr := NewFileTree()
+	_, err := tr.AddFile("/usr/bin/busybox")
+	require.NoError(t, err)
+	_, err = tr.AddHardLink("/bin/sh", "/usr/bin/busybox")
+	require.NoError(t, err)
+	_, err = tr.AddHardLink("/sbin/init", "/usr/bin/busybox")
+	require.NoError(t, err)
+	_, err = tr.AddHardLink("/opt/ls", "/usr/bin/busybox")
+	require.NoError(t, err)
+
+	// copies have their own index
+	copied, err := tr.Copy()
+	require.NoError(t, err)
+
+	// removed hardlinks (including those within removed directories) are no longer found
+	require.NoError(t, tr.RemovePath("/bin"))
+	require.NoError(t, tr.RemoveChildPaths("/sbin"))
+	assert.Equal(t, []file.Path{"/opt/ls"}, tr.HardLinks("/usr/bin/busybox"))
+	assert.Equal(t, []file.Path{"/bin/sh", "/opt/ls", "/sbin/init"}, copied.HardLinks("/usr/bin/busybox"))
+
+	// merged hardlinks are added, and hardlinks replaced by other file types are removed
+	upper := NewFileTree()
+	_, err = upper.AddHardLink("/usr/bin/ls", "/usr/bin/busybox")
+	require.NoError(t, err)
+	_, err = upper.AddFile("/opt/ls")
+	require.NoError(t, err)
+	require.NoError(t, tr.Merge(upper))
+	assert.Equal(t, []file.Path{"/usr/bin/ls"}, tr.HardLinks("/usr/bin/busybox"))
+	assert.Equal(t, []file.Path{"/usr/bin/ls"}, tr.hardLinksWithin("/usr", true))
+	assert.Empty(t, tr.hardLinksWithin("/opt", true))
+}
+
+func TestFileTree_Merge_WhiteoutHardLinkTarget(t *testing.T) {
+	tr1 := NewFileTree()
+	tr1.AddFile("/usr/bin/busybox")
+	tr1.AddFile("/opt/app/data")
+	tr1.AddHardLink("/bin/sh", "/usr/bin/busybox")
+	tr1.AddHardLink("/bin/ls", "/usr/bin/busybox")
+	tr1.AddHardLink("/bin/kept", "/usr/bin/busybox")
+	tr1.AddHardLink("/var/data", "/opt/app/data")
+	tr1.AddFile("/bin/bash")
+
+	tr2 := NewFileTree()
+	tr2.AddFile("/usr/bin/.wh.busybox")
+	tr2.AddFile("/opt/app/.wh..wh..opq")
+	// the upper layer provides this link again, so it should not be removed
+	tr2.AddHardLink("/bin/kept", "/bin/bash")
+
+	if err := tr1.Merge(tr2); err != nil {
+		t.Fatalf("error on merge : %+v", err)
+	}
+
+	for _, p := range []file.Path{"/usr/bin/busybox", "/bin/sh", "/bin/ls", "/opt/app/data", "/var/data"} {
+		if tr1.HasPath(p) {
+			t.Errorf("expected path to be deleted: %s", p)
+		}
+	}
+
+	for _, p := range []file.Path{"/bin/bash", "/bin/kept", "/opt/app", "/var"} {
+		if !tr1.HasPath(p) {
+			t.Errorf("missing expected path: %s", p)
+		}
+	}
+}
+
 func TestFileTree_Merge_DirOverride(t *testing.T) {
 	tr1 := NewFileTree()
 	tr1.AddFile("/home/wagoodman/awesome/place")
@@ -436,7 +1102,7 @@ func TestFileTree_Merge_DirOverride(t *testing.T) {
 	tr2 := NewFileTree()
 	tr2.AddFile("/home/wagoodman/awesome/place/thing.txt")
 
-	if err := tr1.merge(tr2); err != nil {
+	if err := tr1.Merge(tr2); err != nil {
 		t.Fatalf("error on merge : %+v", err)
 	}
 
@@ -470,7 +1136,7 @@ func TestFileTree_Merge_RemoveChildPathsOnOverride(t *testing.T) {
 	upperTree.AddFile("/home/wagoodman/awesome/place")
 
 	// merge the upper tree into the lower tree
-	if err := lowerTree.merge(upperTree); err != nil {
+	if err := lowerTree.Merge(upperTree); err != nil {
 		t.Fatalf("error on merge : %+v", err)
 	}
 
@@ -499,6 +1165,40 @@ func TestFileTree_Merge_RemoveChildPathsOnOverride(t *testing.T) {
 
 }
 
+func TestFileTree_Merge_TypeChangeRemovesHardLinks(t *testing.T) {
+	lowerTree := NewFileTree()
+	lowerTree.AddFile("/opt/config")
+	lowerTree.AddFile("/srv/data/file")
+	lowerTree.AddFile("/bin/tool")
+	lowerTree.AddHardLink("/etc/config", "/opt/config")
+	lowerTree.AddHardLink("/var/file", "/srv/data/file")
+	lowerTree.AddHardLink("/usr/bin/tool", "/bin/tool")
+
+	upperTree := NewFileTree()
+	// a file replaced with a directory
+	upperTree.AddFile("/opt/config/settings.yaml")
+	// a directory replaced with a file
+	upperTree.AddFile("/srv/data")
+	// a file replaced with a file
+	upperTree.AddFile("/bin/tool")
+
+	require.NoError(t, lowerTree.Merge(upperTree))
+
+	ty, exists := lowerTree.Type("/opt/config")
+	require.True(t, exists)
+	assert.Equal(t, file.TypeDir, ty)
+	ty, exists = lowerTree.Type("/srv/data")
+	require.True(t, exists)
+	assert.Equal(t, file.TypeReg, ty)
+
+	// hardlinks to replaced paths (or to paths within a replaced directory) do not survive
+	assert.False(t, lowerTree.HasPath("/etc/config"))
+	assert.False(t, lowerTree.HasPath("/var/file"))
+	assert.False(t, lowerTree.HasPath("/srv/data/file"))
+	// replacing a file with another file is not a type change
+	assert.True(t, lowerTree.HasPath("/usr/bin/tool"))
+}
+
 func TestFileTree_File_Symlink(t *testing.T) {
 
 	tests := []struct {
@@ -877,3 +1577,308 @@ func TestFileTree_AllFiles(t *testing.T) {
 	}
 
 }
+
+func TestFileTree_FilesUnder(t *testing.T) {
+	tr := NewFileTree()
+	for _, p := range []file.Path{"/usr/lib/libc.so", "/usr/lib/x86_64/libm.so", "/usr/libexec/tool", "/usr/bin/env", "/etc/hosts"} {
+		_, err := tr.AddFile(p)
+		require.NoError(t, err)
+	}
+	_, err := tr.AddSymLink("/usr/lib/link", "/etc")
+	require.NoError(t, err)
+	_, err = tr.AddSymLink("/lib", "/usr/lib")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		dir      file.Path
+		types    []file.Type
+		expected []string
+	}{
+		{
+			name:     "subtree",
+			dir:      "/usr/lib",
+			expected: []string{"/usr/lib/libc.so", "/usr/lib/x86_64/libm.so"},
+		},
+		{
+			name:     "root",
+			dir:      "/",
+			expected: []string{"/etc/hosts", "/usr/bin/env", "/usr/lib/libc.so", "/usr/lib/x86_64/libm.so", "/usr/libexec/tool"},
+		},
+		{
+			name:     "with types",
+			dir:      "/usr/lib",
+			types:    []file.Type{file.TypeReg, file.TypeSymlink},
+			expected: []string{"/usr/lib/libc.so", "/usr/lib/link", "/usr/lib/x86_64/libm.so"},
+		},
+		{
+			name:     "via link",
+			dir:      "/lib/x86_64",
+			expected: []string{"/usr/lib/x86_64/libm.so"},
+		},
+		{
+			name: "missing directory",
+			dir:  "/opt",
+		},
+		{
+			name: "not a directory",
+			dir:  "/etc/hosts",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			refs, err := tr.FilesUnder(test.dir, test.types...)
+			require.NoError(t, err)
+			var actual []string
+			for _, ref := range refs {
+				actual = append(actual, string(ref.RealPath))
+			}
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestFileTree_WalkFrom(t *testing.T) {
+	tr := NewFileTree()
+	for _, p := range []file.Path{"/a/z.txt", "/a/b/file.txt", "/a/c/file.txt", "/d/file.txt"} {
+		_, err := tr.AddFile(p)
+		require.NoError(t, err)
+	}
+	_, err := tr.AddSymLink("/a/link-to-d", "/d")
+	require.NoError(t, err)
+	_, err = tr.AddSymLink("/d/cycle", "/a")
+	require.NoError(t, err)
+	_, err = tr.AddSymLink("/via-link", "/a")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		root     file.Path
+		skip     file.Path
+		options  []LinkResolutionOption
+		expected []file.Path
+		wantErr  require.ErrorAssertionFunc
+	}{
+		{
+			name: "links are opaque by default",
+			root: "/a",
+			expected: []file.Path{
+				"/a",
+				"/a/b",
+				"/a/b/file.txt",
+				"/a/c",
+				"/a/c/file.txt",
+				"/a/link-to-d",
+				"/a/z.txt",
+			},
+		},
+		{
+			name: "skip directory",
+			root: "/a",
+			skip: "/a/b",
+			expected: []file.Path{
+				"/a",
+				"/a/b",
+				"/a/c",
+				"/a/c/file.txt",
+				"/a/link-to-d",
+				"/a/z.txt",
+			},
+		},
+		{
+			name: "skip root",
+			root: "/a",
+			skip: "/a",
+			expected: []file.Path{
+				"/a",
+			},
+		},
+		{
+			name: "follow links without revisiting cycles",
+			root: "/a",
+			skip: "/a/b",
+			options: []LinkResolutionOption{
+				FollowBasenameLinks,
+			},
+			expected: []file.Path{
+				"/a",
+				"/a/b",
+				"/a/c",
+				"/a/c/file.txt",
+				"/a/link-to-d",
+				"/a/link-to-d/cycle",
+				"/a/link-to-d/file.txt",
+				"/a/z.txt",
+			},
+		},
+		{
+			name: "root ancestor links are followed",
+			root: "/via-link/c",
+			expected: []file.Path{
+				"/via-link/c",
+				"/via-link/c/file.txt",
+			},
+		},
+		{
+			name:    "missing root",
+			root:    "/does-not-exist",
+			wantErr: require.Error,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.wantErr == nil {
+				test.wantErr = require.NoError
+			}
+			var visited []file.Path
+			err := tr.WalkFrom(test.root, func(path file.Path, f filenode.FileNode) error {
+				visited = append(visited, path)
+				if path == test.skip {
+					return SkipDir
+				}
+				return nil
+			}, test.options...)
+			test.wantErr(t, err)
+			assert.Equal(t, test.expected, visited)
+		})
+	}
+}
+
+func TestFileTree_WalkFrom_VisitorError(t *testing.T) {
+	tr := NewFileTree()
+	_, err := tr.AddFile("/a/file.txt")
+	require.NoError(t, err)
+	_, err = tr.AddFile("/b/file.txt")
+	require.NoError(t, err)
+
+	expectedErr := errors.New("stop")
+	var visited []file.Path
+	err = tr.WalkFrom("/", func(path file.Path, f filenode.FileNode) error {
+		visited = append(visited, path)
+		if path == "/a/file.txt" {
+			return expectedErr
+		}
+		return nil
+	})
+	assert.ErrorIs(t, err, expectedErr)
+	assert.Equal(t, []file.Path{"/", "/a", "/a/file.txt"}, visited)
+}
+
+func TestFileTree_Merge_InPlace(t *testing.T) {
+	lower := NewFileTree()
+	_, err := lower.AddFile("/a/keep.txt")
+	require.NoError(t, err)
+	_, err = lower.AddFile("/b/x.txt")
+	require.NoError(t, err)
+	_, err = lower.AddFile("/c/y.txt")
+	require.NoError(t, err)
+
+	upper := NewFileTree()
+	_, err = upper.AddFile("/a/.wh..wh..opq")
+	require.NoError(t, err)
+	newRef, err := upper.AddFile("/a/new.txt")
+	require.NoError(t, err)
+	_, err = upper.AddFile("/.wh.b")
+	require.NoError(t, err)
+	upperPaths := upper.AllRealPaths()
+
+	require.NoError(t, lower.Merge(upper))
+
+	assert.Equal(t, []file.Path{"/", "/a", "/a/new.txt", "/c", "/c/y.txt"}, lower.AllRealPaths())
+	_, ref, err := lower.File("/a/new.txt")
+	require.NoError(t, err)
+	require.NotNil(t, ref)
+	assert.Equal(t, newRef.ID(), ref.ID(), "file references should be shared with the upper tree")
+
+	// the upper tree (including its whiteouts) is left as-is
+	assert.Equal(t, upperPaths, upper.AllRealPaths())
+}
+
+func TestFileTree_ConcurrentReads(t *testing.T) {
+	lower := NewFileTree()
+	upper := NewFileTree()
+	for i := 0; i < 20; i++ {
+		_, err := lower.AddFile(file.Path(fmt.Sprintf("/usr/lib/lib-%d.so", i)))
+		require.NoError(t, err)
+		_, err = upper.AddFile(file.Path(fmt.Sprintf("/etc/conf-%d", i)))
+		require.NoError(t, err)
+	}
+	_, err := lower.AddSymLink("/lib", "/usr/lib")
+	require.NoError(t, err)
+	_, err = upper.AddFile("/usr/lib/lib-0.so")
+	require.NoError(t, err)
+
+	union := NewUnionFileTree()
+	union.PushTree(lower)
+	union.PushTree(upper)
+	squashed, err := union.Squash()
+	require.NoError(t, err)
+
+	// note: this is only meaningful with the race detector enabled (go test -race)
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				exists, ref, err := squashed.File(file.Path(fmt.Sprintf("/lib/lib-%d.so", i)), FollowBasenameLinks)
+				assert.NoError(t, err)
+				assert.True(t, exists)
+				assert.NotNil(t, ref)
+
+				assert.True(t, squashed.HasPath(file.Path(fmt.Sprintf("/etc/conf-%d", i))))
+			}
+
+			results, err := squashed.FilesByGlob("**/lib-*.so", FollowBasenameLinks)
+			assert.NoError(t, err)
+			assert.NotEmpty(t, results)
+
+			var walked int
+			assert.NoError(t, squashed.Walk(func(file.Path, filenode.FileNode) error {
+				walked++
+				return nil
+			}, nil))
+			assert.NotZero(t, walked)
+
+			assert.Len(t, squashed.AllFiles(), 40)
+			assert.Len(t, squashed.FilesByBasename(fmt.Sprintf("lib-%d.so", g)), 1)
+			_, err = squashed.ListPaths("/etc")
+			assert.NoError(t, err)
+			_, err = squashed.FilesUnder("/lib")
+			assert.NoError(t, err)
+			chain, err := squashed.ResolveLinkChain("/lib/lib-1.so")
+			assert.NoError(t, err)
+			assert.NotEmpty(t, chain)
+			_, err = squashed.Copy()
+			assert.NoError(t, err)
+		}(g)
+	}
+	wg.Wait()
+}
+
+func BenchmarkFileTree_Merge_TypeChanges(b *testing.B) {
+	// a large lower tree with hardlinks, where the upper tree replaces many files with directories
+	lower := NewFileTree()
+	upper := NewFileTree()
+	for i := 0; i < 10000; i++ {
+		p := file.Path(fmt.Sprintf("/usr/lib/file-%d", i))
+		_, _ = lower.AddFile(p)
+		_, _ = lower.AddHardLink(file.Path(fmt.Sprintf("/usr/bin/link-%d", i)), p)
+		if i%2 == 0 {
+			_, _ = upper.AddDir(p)
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tr, err := lower.Copy()
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := tr.Merge(upper); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
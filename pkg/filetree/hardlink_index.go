@@ -0,0 +1,102 @@
+package filetree
+
+import (
+	"sort"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree/filenode"
+)
+
+// hardLinkIndex indexes the real paths of all hardlinks by the (absolute) link path, along with every ancestor of the
+// link path, so that finding the hardlinks to a path (or to anything beneath a directory) does not walk the tree.
+type hardLinkIndex struct {
+	// byLinkPath maps a link path to the real paths of all hardlinks with exactly that link path
+	byLinkPath map[file.Path]file.PathSet
+	// byAncestor maps a path to the real paths of all hardlinks with a link path at or beneath that path
+	byAncestor map[file.Path]file.PathSet
+}
+
+func newHardLinkIndex() hardLinkIndex {
+	return hardLinkIndex{
+		byLinkPath: make(map[file.Path]file.PathSet),
+		byAncestor: make(map[file.Path]file.PathSet),
+	}
+}
+
+func (h hardLinkIndex) add(fn *filenode.FileNode) {
+	if fn == nil || fn.FileType != file.TypeHardLink {
+		return
+	}
+	addToPathSets(h.byLinkPath, fn.LinkPath, fn.RealPath)
+	for _, p := range fn.LinkPath.AllPaths() {
+		addToPathSets(h.byAncestor, p, fn.RealPath)
+	}
+}
+
+func (h hardLinkIndex) remove(fn *filenode.FileNode) {
+	if fn == nil || fn.FileType != file.TypeHardLink {
+		return
+	}
+	removeFromPathSets(h.byLinkPath, fn.LinkPath, fn.RealPath)
+	for _, p := range fn.LinkPath.AllPaths() {
+		removeFromPathSets(h.byAncestor, p, fn.RealPath)
+	}
+}
+
+func (h hardLinkIndex) copy() hardLinkIndex {
+	return hardLinkIndex{
+		byLinkPath: copyPathSets(h.byLinkPath),
+		byAncestor: copyPathSets(h.byAncestor),
+	}
+}
+
+// within returns the real paths of all hardlinks that point to the given (normalized) path, or when includeChildren is
+// set, that point to any descendant path (sorted).
+func (h hardLinkIndex) within(target file.Path, includeChildren bool) []file.Path {
+	paths := h.byLinkPath[target]
+	if includeChildren {
+		paths = h.byAncestor[target]
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+
+	links := make([]file.Path, 0, len(paths))
+	for p := range paths {
+		links = append(links, p)
+	}
+	sort.Sort(file.Paths(links))
+	return links
+}
+
+func addToPathSets(sets map[file.Path]file.PathSet, key, p file.Path) {
+	paths, ok := sets[key]
+	if !ok {
+		paths = file.NewPathSet()
+		sets[key] = paths
+	}
+	paths.Add(p)
+}
+
+func removeFromPathSets(sets map[file.Path]file.PathSet, key, p file.Path) {
+	paths, ok := sets[key]
+	if !ok {
+		return
+	}
+	paths.Remove(p)
+	if len(paths) == 0 {
+		delete(sets, key)
+	}
+}
+
+func copyPathSets(sets map[file.Path]file.PathSet) map[file.Path]file.PathSet {
+	c := make(map[file.Path]file.PathSet, len(sets))
+	for key, paths := range sets {
+		pathsCopy := file.NewPathSet()
+		for p := range paths {
+			pathsCopy.Add(p)
+		}
+		c[key] = pathsCopy
+	}
+	return c
+}
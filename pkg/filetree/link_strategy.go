@@ -13,6 +13,11 @@ const (
 	// the non-existing path. This is useful when the caller wants to do custom link resolution (e.g. for container
 	// images: the link is dead in this layer squash, but does it resolve in a higher layer?).
 	DoNotFollowDeadBasenameLinks
+
+	// CaseInsensitive matches path components of the given path regardless of case (e.g. for filesystems derived from
+	// windows or macOS). The original casing is still what is stored and returned from the tree. When several entries
+	// differ only in case, an exact match is preferred, otherwise the lexically first entry is used.
+	CaseInsensitive
 )
 
 // LinkResolutionOption is a single link resolution rule.
@@ -23,6 +28,7 @@ type linkResolutionStrategy struct {
 	FollowAncestorLinks          bool
 	FollowBasenameLinks          bool
 	DoNotFollowDeadBasenameLinks bool
+	CaseInsensitive              bool
 }
 
 // newLinkResolutionStrategy creates a new linkResolutionStrategy for the given set of LinkResolutionOptions.
@@ -36,6 +42,8 @@ func newLinkResolutionStrategy(options ...LinkResolutionOption) linkResolutionSt
 			s.DoNotFollowDeadBasenameLinks = true
 		case followAncestorLinks:
 			s.FollowAncestorLinks = true
+		case CaseInsensitive:
+			s.CaseInsensitive = true
 		}
 	}
 	return s
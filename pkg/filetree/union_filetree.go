@@ -35,7 +35,7 @@ func (u *UnionFileTree) Squash() (*FileTree, error) {
 			continue
 		}
 
-		if err = squashedTree.merge(refTree); err != nil {
+		if err = squashedTree.Merge(refTree); err != nil {
 			return nil, fmt.Errorf("unable to squash layer=%d : %w", layerIdx, err)
 		}
 	}
@@ -0,0 +1,127 @@
+package filetree
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree/filenode"
+)
+
+// SkipDir can be returned from a WalkFunc to indicate that the directory being visited should not be descended into.
+// When returned while visiting a non-directory there is no additional effect (the walk continues). This is the same
+// value as fs.SkipDir (and filepath.SkipDir), so either may be used.
+var SkipDir = fs.SkipDir
+
+// WalkFunc is the visitor invoked by FileTree.WalkFrom for each path. The node given is the node at the path itself,
+// so links are visited as links (not as the node they resolve to). Returning SkipDir prunes the directory from the
+// walk, returning any other error stops the walk and the error is returned from WalkFrom.
+type WalkFunc func(path file.Path, f filenode.FileNode) error
+
+// WalkFrom invokes the given visitor for the given root path and all paths beneath it in depth-first, lexically sorted
+// order. Ancestor links of the root are always followed to find the starting point, however symlinks found during the
+// walk are treated as opaque (visited but not descended into) unless the FollowBasenameLinks option is given. When
+// following links, a link that resolves to a directory already being walked (a cycle) is visited but not descended
+// into again.
+func (t *FileTree) WalkFrom(root file.Path, fn WalkFunc, options ...LinkResolutionOption) error {
+	root = root.Normalize()
+	n, err := t.node(root, linkResolutionStrategy{
+		FollowAncestorLinks: true,
+	})
+	if err != nil {
+		return err
+	}
+	if n == nil {
+		return fmt.Errorf("unable to walk from path=%q: path does not exist", root)
+	}
+
+	w := treeWalk{
+		tree:        t,
+		visitor:     fn,
+		followLinks: newLinkResolutionStrategy(options...).FollowBasenameLinks,
+		walking:     file.NewPathSet(),
+	}
+
+	err = w.walk(root, n)
+	if errors.Is(err, SkipDir) {
+		// skipping the root directory is not an error
+		return nil
+	}
+	return err
+}
+
+// treeWalk is the state for a single FileTree.WalkFrom invocation.
+type treeWalk struct {
+	tree        *FileTree
+	visitor     WalkFunc
+	followLinks bool
+	// walking is the set of real directory paths that are currently being descended into (for cycle detection)
+	walking file.PathSet
+}
+
+func (w *treeWalk) walk(p file.Path, n *filenode.FileNode) error {
+	if err := w.visitor(p, *n); err != nil {
+		return err
+	}
+
+	dir, err := w.directory(n)
+	if err != nil || dir == nil {
+		return err
+	}
+
+	if w.walking.Contains(dir.RealPath) {
+		// this is a link cycle, the directory contents are already being walked
+		return nil
+	}
+	w.walking.Add(dir.RealPath)
+	defer w.walking.Remove(dir.RealPath)
+
+	childPaths, err := w.tree.ListPaths(p)
+	if err != nil {
+		return err
+	}
+	sort.Sort(file.Paths(childPaths))
+
+	for _, childPath := range childPaths {
+		child, err := w.tree.node(childPath, linkResolutionStrategy{
+			FollowAncestorLinks: true,
+		})
+		if err != nil {
+			return err
+		}
+		if child == nil {
+			continue
+		}
+
+		if err := w.walk(childPath, child); err != nil && !errors.Is(err, SkipDir) {
+			return err
+		}
+	}
+	return nil
+}
+
+// directory returns the directory node that should be descended into for the given node (if any).
+func (w *treeWalk) directory(n *filenode.FileNode) (*filenode.FileNode, error) {
+	switch n.FileType {
+	case file.TypeDir:
+		return n, nil
+	case file.TypeSymlink:
+		if !w.followLinks {
+			return nil, nil
+		}
+		resolved, err := w.tree.resolveNodeLinks(n, false, 0)
+		if err != nil {
+			if errors.Is(err, ErrLinkCycleDetected) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		if resolved == nil || resolved.FileType != file.TypeDir {
+			return nil, nil
+		}
+		return resolved, nil
+	}
+	return nil, nil
+}
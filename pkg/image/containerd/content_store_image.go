@@ -0,0 +1,129 @@
+package containerd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/containerd/containerd/content"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+var _ partial.CompressedImageCore = (*contentStoreImage)(nil)
+
+// contentStoreImage is an image with blobs that are read lazily from a containerd content store.
+type contentStoreImage struct {
+	ctx         context.Context
+	provider    content.Provider
+	descriptor  ocispec.Descriptor
+	rawManifest []byte
+	rawConfig   []byte
+	layers      map[string]ocispec.Descriptor
+}
+
+func newContentStoreImage(ctx context.Context, provider content.Provider, manifestDesc ocispec.Descriptor) (*contentStoreImage, error) {
+	rawManifest, err := content.ReadBlob(ctx, provider, manifestDesc)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read manifest=%q: %w", manifestDesc.Digest, err)
+	}
+
+	var manifest ocispec.Manifest
+	if err := json.Unmarshal(rawManifest, &manifest); err != nil {
+		return nil, fmt.Errorf("unable to parse manifest=%q: %w", manifestDesc.Digest, err)
+	}
+
+	rawConfig, err := content.ReadBlob(ctx, provider, manifest.Config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config=%q: %w", manifest.Config.Digest, err)
+	}
+
+	layers := make(map[string]ocispec.Descriptor)
+	for _, l := range manifest.Layers {
+		layers[l.Digest.String()] = l
+	}
+
+	return &contentStoreImage{
+		ctx:         ctx,
+		provider:    provider,
+		descriptor:  manifestDesc,
+		rawManifest: rawManifest,
+		rawConfig:   rawConfig,
+		layers:      layers,
+	}, nil
+}
+
+// RawConfigFile implements partial.CompressedImageCore.
+func (i *contentStoreImage) RawConfigFile() ([]byte, error) {
+	return i.rawConfig, nil
+}
+
+// MediaType implements partial.CompressedImageCore.
+func (i *contentStoreImage) MediaType() (types.MediaType, error) {
+	return types.MediaType(i.descriptor.MediaType), nil
+}
+
+// RawManifest implements partial.CompressedImageCore.
+func (i *contentStoreImage) RawManifest() ([]byte, error) {
+	return i.rawManifest, nil
+}
+
+// LayerByDigest implements partial.CompressedImageCore.
+func (i *contentStoreImage) LayerByDigest(h v1.Hash) (partial.CompressedLayer, error) {
+	desc, ok := i.layers[h.String()]
+	if !ok {
+		return nil, fmt.Errorf("layer=%q not found in manifest=%q", h, i.descriptor.Digest)
+	}
+	return &contentStoreLayer{
+		image:      i,
+		descriptor: desc,
+	}, nil
+}
+
+var _ partial.CompressedLayer = (*contentStoreLayer)(nil)
+
+// contentStoreLayer is a (compressed) layer blob within a containerd content store.
+type contentStoreLayer struct {
+	image      *contentStoreImage
+	descriptor ocispec.Descriptor
+}
+
+// Digest implements partial.CompressedLayer.
+func (l *contentStoreLayer) Digest() (v1.Hash, error) {
+	return v1.NewHash(l.descriptor.Digest.String())
+}
+
+// Compressed implements partial.CompressedLayer.
+func (l *contentStoreLayer) Compressed() (io.ReadCloser, error) {
+	ra, err := l.image.provider.ReaderAt(l.image.ctx, l.descriptor)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read layer=%q from the content store: %w", l.descriptor.Digest, err)
+	}
+	return &readerAtCloser{
+		Reader: io.NewSectionReader(ra, 0, ra.Size()),
+		closer: ra,
+	}, nil
+}
+
+// Size implements partial.CompressedLayer.
+func (l *contentStoreLayer) Size() (int64, error) {
+	return l.descriptor.Size, nil
+}
+
+// MediaType implements partial.CompressedLayer.
+func (l *contentStoreLayer) MediaType() (types.MediaType, error) {
+	return types.MediaType(l.descriptor.MediaType), nil
+}
+
+type readerAtCloser struct {
+	io.Reader
+	closer io.Closer
+}
+
+func (r *readerAtCloser) Close() error {
+	return r.closer.Close()
+}
@@ -0,0 +1,213 @@
+package containerd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/containerd/platforms"
+	"github.com/containerd/containerd/reference/docker"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/anchore/stereoscope/internal/log"
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+)
+
+// apiClient is the subset of the containerd client needed to read images from the content store.
+type apiClient interface {
+	ImageService() images.Store
+	ContentStore() content.Store
+	Close() error
+}
+
+// DaemonImageProvider is an image.Provider capable of representing a container image already present in the
+// containerd content store (e.g. on a kubernetes node), without pulling the image from a registry.
+type DaemonImageProvider struct {
+	imageStr  string
+	tmpDirGen *file.TempDirGenerator
+	client    apiClient
+	namespace string
+	platform  *image.Platform
+}
+
+// NewProviderFromDaemon creates a new provider instance for a specific image within the given containerd namespace.
+// When no platform is given, the platform of the current host is used to select a manifest from multi-platform images.
+// The provider takes ownership of the given client: since the image contents are read from the content store through
+// the client, it is closed once the provided image is cleaned up (or as soon as providing the image fails).
+func NewProviderFromDaemon(imgStr string, tmpDirGen *file.TempDirGenerator, c apiClient, namespace string, platform *image.Platform) *DaemonImageProvider {
+	return &DaemonImageProvider{
+		imageStr:  imgStr,
+		tmpDirGen: tmpDirGen,
+		client:    c,
+		namespace: namespace,
+		platform:  platform,
+	}
+}
+
+// Provide an image object that represents the image from the containerd content store.
+func (p *DaemonImageProvider) Provide(ctx context.Context, userMetadata ...image.AdditionalMetadata) (*image.Image, error) {
+	img, err := p.provide(ctx, userMetadata...)
+	if err != nil {
+		if closeErr := p.client.Close(); closeErr != nil {
+			log.Warnf("unable to close containerd client: %+v", closeErr)
+		}
+		return nil, err
+	}
+	img.AddCleanup(p.client.Close)
+	return img, nil
+}
+
+func (p *DaemonImageProvider) provide(ctx context.Context, userMetadata ...image.AdditionalMetadata) (*image.Image, error) {
+	ctx = namespaces.WithNamespace(ctx, p.namespace)
+
+	record, err := p.findImage(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debugf("using image=%q from the containerd content store (namespace=%q)", record.Name, p.namespace)
+
+	store := p.client.ContentStore()
+
+	manifestDesc, err := resolveManifest(ctx, store, record.Target, p.platformMatcher(), p.platform != nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve manifest for image=%q: %w", record.Name, err)
+	}
+
+	img, err := newContentStoreImage(ctx, store, manifestDesc)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read image=%q from the containerd content store: %w", record.Name, err)
+	}
+
+	v1Img, err := partial.CompressedToImage(img)
+	if err != nil {
+		return nil, err
+	}
+
+	contentTempDir, err := p.tmpDirGen.NewDirectory("containerd-daemon-image")
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := []image.AdditionalMetadata{
+		image.WithManifest(img.rawManifest),
+		image.WithConfig(img.rawConfig),
+		image.WithTags(record.Name),
+	}
+
+	if record.Target.Digest != "" {
+		if named, err := docker.ParseDockerRef(record.Name); err == nil {
+			metadata = append(metadata, image.WithRepoDigests(fmt.Sprintf("%s@%s", named.Name(), record.Target.Digest)))
+		}
+	}
+
+	if platform := manifestPlatform(manifestDesc, img.rawConfig); platform != nil {
+		metadata = append(metadata,
+			image.WithArchitecture(platform.Architecture, platform.Variant),
+			image.WithOS(platform.OS),
+		)
+	}
+
+	// apply user-supplied metadata last to override any default behavior
+	metadata = append(metadata, userMetadata...)
+
+	return image.NewImage(v1Img, contentTempDir, metadata...), nil
+}
+
+// findImage looks up the image record by the reference as given, then by the fully qualified reference (which is how
+// containerd names images, e.g. "alpine" is stored as "docker.io/library/alpine:latest").
+func (p *DaemonImageProvider) findImage(ctx context.Context) (*images.Image, error) {
+	candidates := []string{p.imageStr}
+	if named, err := docker.ParseDockerRef(p.imageStr); err == nil && named.String() != p.imageStr {
+		candidates = append(candidates, named.String())
+	}
+
+	var lastErr error
+	for _, candidate := range candidates {
+		record, err := p.client.ImageService().Get(ctx, candidate)
+		if err == nil {
+			return &record, nil
+		}
+		lastErr = err
+	}
+	return nil, fmt.Errorf("unable to find image=%q in containerd namespace=%q: %w", p.imageStr, p.namespace, lastErr)
+}
+
+func (p *DaemonImageProvider) platformMatcher() platforms.MatchComparer {
+	if p.platform == nil {
+		return platforms.Default()
+	}
+	return platforms.OnlyStrict(ocispec.Platform{
+		OS:           p.platform.OS,
+		Architecture: p.platform.Architecture,
+		Variant:      p.platform.Variant,
+	})
+}
+
+// manifestPlatform returns the platform of the resolved image manifest, as described by the index entry (when resolved
+// from an index) or otherwise by the image config.
+func manifestPlatform(desc ocispec.Descriptor, rawConfig []byte) *ocispec.Platform {
+	if desc.Platform != nil {
+		return desc.Platform
+	}
+	var cfg ocispec.Image
+	if err := json.Unmarshal(rawConfig, &cfg); err != nil || cfg.Architecture == "" {
+		return nil
+	}
+	return &ocispec.Platform{OS: cfg.OS, Architecture: cfg.Architecture, Variant: cfg.Variant}
+}
+
+// resolveManifest returns the descriptor for the single image manifest referenced by the given descriptor, selecting
+// the best matching platform from (potentially nested) indexes. When a platform was requested, index entries without
+// a platform are only considered when they are nested indexes (which are resolved against the requested platform).
+func resolveManifest(ctx context.Context, provider content.Provider, desc ocispec.Descriptor, matcher platforms.MatchComparer, platformRequested bool) (ocispec.Descriptor, error) {
+	switch {
+	case images.IsManifestType(desc.MediaType):
+		return desc, nil
+	case images.IsIndexType(desc.MediaType):
+		raw, err := content.ReadBlob(ctx, provider, desc)
+		if err != nil {
+			return ocispec.Descriptor{}, err
+		}
+
+		var index ocispec.Index
+		if err := json.Unmarshal(raw, &index); err != nil {
+			return ocispec.Descriptor{}, fmt.Errorf("unable to parse index=%q: %w", desc.Digest, err)
+		}
+
+		var candidates []ocispec.Descriptor
+		for _, m := range index.Manifests {
+			switch {
+			case m.Platform != nil:
+				if matcher.Match(*m.Platform) {
+					candidates = append(candidates, m)
+				}
+			case !platformRequested || images.IsIndexType(m.MediaType):
+				candidates = append(candidates, m)
+			}
+		}
+
+		// prefer the best platform match (manifests without a platform are the least preferred)
+		sort.SliceStable(candidates, func(i, j int) bool {
+			if candidates[i].Platform == nil || candidates[j].Platform == nil {
+				return candidates[j].Platform == nil && candidates[i].Platform != nil
+			}
+			return matcher.Less(*candidates[i].Platform, *candidates[j].Platform)
+		})
+
+		for _, candidate := range candidates {
+			if !images.IsManifestType(candidate.MediaType) && !images.IsIndexType(candidate.MediaType) {
+				continue
+			}
+			return resolveManifest(ctx, provider, candidate, matcher, platformRequested)
+		}
+		return ocispec.Descriptor{}, fmt.Errorf("no manifest found in index=%q for the requested platform", desc.Digest)
+	}
+	return ocispec.Descriptor{}, fmt.Errorf("unsupported media type for image: %q", desc.MediaType)
+}
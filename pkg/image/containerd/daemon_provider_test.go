@@ -0,0 +1,229 @@
+package containerd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/content/local"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+type fakeClient struct {
+	images.Store
+	namespace string
+	records   map[string]images.Image
+	content   content.Store
+	closed    int
+}
+
+func (c *fakeClient) Close() error {
+	c.closed++
+	return nil
+}
+
+func (c *fakeClient) ImageService() images.Store {
+	return c
+}
+
+func (c *fakeClient) ContentStore() content.Store {
+	return c.content
+}
+
+func (c *fakeClient) Get(ctx context.Context, name string) (images.Image, error) {
+	ns, err := namespaces.NamespaceRequired(ctx)
+	if err != nil {
+		return images.Image{}, err
+	}
+	record, ok := c.records[name]
+	if !ok || ns != c.namespace {
+		return images.Image{}, errdefs.ErrNotFound
+	}
+	return record, nil
+}
+
+func writeBlob(t *testing.T, store content.Store, mediaType string, blob []byte) ocispec.Descriptor {
+	t.Helper()
+	desc := ocispec.Descriptor{
+		MediaType: mediaType,
+		Digest:    digest.FromBytes(blob),
+		Size:      int64(len(blob)),
+	}
+	require.NoError(t, content.WriteBlob(context.Background(), store, desc.Digest.String(), bytes.NewReader(blob), desc))
+	return desc
+}
+
+// writeImage writes all blobs for the given image to the content store, returning the manifest descriptor.
+func writeImage(t *testing.T, store content.Store, img v1.Image) ocispec.Descriptor {
+	t.Helper()
+	layers, err := img.Layers()
+	require.NoError(t, err)
+	for _, l := range layers {
+		rc, err := l.Compressed()
+		require.NoError(t, err)
+		buf := &bytes.Buffer{}
+		_, err = buf.ReadFrom(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+		mediaType, err := l.MediaType()
+		require.NoError(t, err)
+		writeBlob(t, store, string(mediaType), buf.Bytes())
+	}
+
+	rawConfig, err := img.RawConfigFile()
+	require.NoError(t, err)
+	writeBlob(t, store, ocispec.MediaTypeImageConfig, rawConfig)
+
+	rawManifest, err := img.RawManifest()
+	require.NoError(t, err)
+	mediaType, err := img.MediaType()
+	require.NoError(t, err)
+	return writeBlob(t, store, string(mediaType), rawManifest)
+}
+
+func TestDaemonImageProvider_Provide(t *testing.T) {
+	store, err := local.NewStore(t.TempDir())
+	require.NoError(t, err)
+
+	amd64Img, err := random.Image(1024, 2)
+	require.NoError(t, err)
+	arm64Img, err := random.Image(1024, 3)
+	require.NoError(t, err)
+
+	amd64Desc := writeImage(t, store, amd64Img)
+	amd64Desc.Platform = &ocispec.Platform{OS: "linux", Architecture: "amd64"}
+	arm64Desc := writeImage(t, store, arm64Img)
+	arm64Desc.Platform = &ocispec.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}
+
+	rawIndex, err := json.Marshal(ocispec.Index{
+		MediaType: ocispec.MediaTypeImageIndex,
+		Manifests: []ocispec.Descriptor{amd64Desc, arm64Desc},
+	})
+	require.NoError(t, err)
+	indexDesc := writeBlob(t, store, ocispec.MediaTypeImageIndex, rawIndex)
+
+	// a manifest without a platform (e.g. an attestation manifest) listed before the platform-specific manifests
+	unknownImg, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	unknownDesc := writeImage(t, store, unknownImg)
+	rawUnknownIndex, err := json.Marshal(ocispec.Index{
+		MediaType: ocispec.MediaTypeImageIndex,
+		Manifests: []ocispec.Descriptor{unknownDesc, amd64Desc},
+	})
+	require.NoError(t, err)
+	unknownIndexDesc := writeBlob(t, store, ocispec.MediaTypeImageIndex, rawUnknownIndex)
+
+	client := &fakeClient{
+		namespace: "k8s.io",
+		content:   store,
+		records: map[string]images.Image{
+			"docker.io/library/single:latest": {Name: "docker.io/library/single:latest", Target: amd64Desc},
+			"docker.io/library/multi:latest":  {Name: "docker.io/library/multi:latest", Target: indexDesc},
+			"docker.io/library/mixed:latest":  {Name: "docker.io/library/mixed:latest", Target: unknownIndexDesc},
+		},
+	}
+
+	tests := []struct {
+		name           string
+		imageStr       string
+		namespace      string
+		platform       *image.Platform
+		expectedLayers int
+		expectedDigest digest.Digest
+		expectedArch   string
+		wantErr        require.ErrorAssertionFunc
+	}{
+		{
+			name:           "single platform image by short name",
+			imageStr:       "single",
+			namespace:      "k8s.io",
+			expectedLayers: 2,
+			expectedDigest: amd64Desc.Digest,
+			expectedArch:   "amd64",
+		},
+		{
+			name:           "select platform from index",
+			imageStr:       "docker.io/library/multi:latest",
+			namespace:      "k8s.io",
+			platform:       &image.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"},
+			expectedLayers: 3,
+			expectedDigest: arm64Desc.Digest,
+			expectedArch:   "arm64",
+		},
+		{
+			name:           "manifest without a platform is skipped when a platform is requested",
+			imageStr:       "mixed",
+			namespace:      "k8s.io",
+			platform:       &image.Platform{OS: "linux", Architecture: "amd64"},
+			expectedLayers: 2,
+			expectedDigest: amd64Desc.Digest,
+			expectedArch:   "amd64",
+		},
+		{
+			name:      "manifest without a platform does not match the requested platform",
+			imageStr:  "mixed",
+			namespace: "k8s.io",
+			platform:  &image.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"},
+			wantErr:   require.Error,
+		},
+		{
+			name:      "platform missing from index",
+			imageStr:  "multi",
+			namespace: "k8s.io",
+			platform:  &image.Platform{OS: "linux", Architecture: "s390x"},
+			wantErr:   require.Error,
+		},
+		{
+			name:      "image in another namespace",
+			imageStr:  "single",
+			namespace: "default",
+			wantErr:   require.Error,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.wantErr == nil {
+				test.wantErr = require.NoError
+			}
+			generator := file.NewTempDirGenerator("stereoscope-containerd-test")
+			t.Cleanup(func() { _ = generator.Cleanup() })
+
+			client.closed = 0
+			provider := NewProviderFromDaemon(test.imageStr, generator, client, test.namespace, test.platform)
+			img, err := provider.Provide(context.Background())
+			test.wantErr(t, err)
+			if err != nil {
+				// the client is closed as soon as providing the image fails
+				assert.Equal(t, 1, client.closed)
+				return
+			}
+
+			// the client is needed to read the image contents, so it is only closed on cleanup
+			require.NoError(t, img.Read())
+			assert.Equal(t, 0, client.closed)
+			require.NoError(t, img.Cleanup())
+			assert.Equal(t, 1, client.closed)
+
+			assert.Len(t, img.Layers, test.expectedLayers)
+			assert.Equal(t, test.expectedDigest.String(), img.Metadata.ManifestDigest)
+			// the platform of the resolved manifest is recorded (not the requested platform)
+			assert.Equal(t, test.expectedArch, img.Metadata.Architecture)
+			require.Len(t, img.Metadata.Tags, 1)
+			assert.Contains(t, img.Metadata.Tags[0].String(), "library/")
+		})
+	}
+}
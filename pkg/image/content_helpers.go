@@ -18,6 +18,9 @@ func fetchFileContentsByPath(ft *filetree.FileTree, fileCatalog *FileCatalog, pa
 	if !exists && fileReference == nil {
 		return nil, fmt.Errorf("could not find file path in Tree: %s", path)
 	}
+	if fileReference == nil {
+		return nil, fmt.Errorf("no contents available for path (e.g. directory or dead link): %s", path)
+	}
 
 	reader, err := fileCatalog.FileContents(*fileReference)
 	if err != nil {
@@ -26,6 +29,24 @@ func fetchFileContentsByPath(ft *filetree.FileTree, fileCatalog *FileCatalog, pa
 	return reader, nil
 }
 
+// fetchFileMetadataByPath is a common helper function for resolving the file metadata (as captured from the tar
+// header) for a path from the file catalog relative to the given tree.
+func fetchFileMetadataByPath(ft *filetree.FileTree, fileCatalog *FileCatalog, path file.Path) (file.Metadata, error) {
+	exists, fileReference, err := ft.File(path, filetree.FollowBasenameLinks)
+	if err != nil {
+		return file.Metadata{}, err
+	}
+	if !exists || fileReference == nil {
+		return file.Metadata{}, fmt.Errorf("could not find file path in Tree: %s", path)
+	}
+
+	entry, err := fileCatalog.Get(*fileReference)
+	if err != nil {
+		return file.Metadata{}, err
+	}
+	return entry.Metadata, nil
+}
+
 // fetchFileContentsByPath is a common helper function for resolving file references for a MIME type from the file
 // catalog relative to the given tree.
 func fetchFilesByMIMEType(ft *filetree.FileTree, fileCatalog *FileCatalog, mType string) ([]file.Reference, error) {
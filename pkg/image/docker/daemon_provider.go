@@ -15,6 +15,7 @@ import (
 	"time"
 
 	"github.com/anchore/stereoscope/internal/bus"
+	"github.com/anchore/stereoscope/internal/contextio"
 	"github.com/anchore/stereoscope/internal/log"
 	"github.com/anchore/stereoscope/pkg/event"
 	"github.com/anchore/stereoscope/pkg/file"
@@ -34,24 +35,37 @@ type DaemonImageProvider struct {
 	tmpDirGen *file.TempDirGenerator
 	client    client.APIClient
 	platform  *image.Platform
+	// digest is the digest that the image reference is pinned to (if any)
+	digest string
+	// digestTag is the tag given along with the digest (if any), which is not used to find the image
+	digestTag string
 }
 
-// NewProviderFromDaemon creates a new provider instance for a specific image that will later be cached to the given directory.
+// NewProviderFromDaemon creates a new provider instance for a specific image that will later be cached to the given
+// directory. A reference pinned to a digest (e.g. "alpine@sha256:...") is always resolved by the digest, even when a
+// tag is also given (e.g. "alpine:3.14@sha256:...").
 func NewProviderFromDaemon(imgStr string, tmpDirGen *file.TempDirGenerator, c client.APIClient, platform *image.Platform) (*DaemonImageProvider, error) {
 	ref, err := name.ParseReference(imgStr, name.WithDefaultRegistry(""))
 	if err != nil {
 		return nil, err
 	}
-	tag, ok := ref.(name.Tag)
-	if ok {
-		imgStr = tag.Name()
-	}
-	return &DaemonImageProvider{
-		imageStr:  imgStr,
+	provider := &DaemonImageProvider{
 		tmpDirGen: tmpDirGen,
 		client:    c,
 		platform:  platform,
-	}, nil
+	}
+	switch r := ref.(type) {
+	case name.Tag:
+		imgStr = r.Name()
+	case name.Digest:
+		if tag, ok := image.ReferenceTag(imgStr, name.WithDefaultRegistry("")); ok {
+			provider.digestTag = tag.Name()
+		}
+		provider.digest = r.DigestStr()
+		imgStr = r.Context().Name() + "@" + r.DigestStr()
+	}
+	provider.imageStr = imgStr
+	return provider, nil
 }
 
 type daemonProvideProgress struct {
@@ -239,13 +253,17 @@ func (p *DaemonImageProvider) Provide(ctx context.Context, userMetadata ...image
 		return nil, err
 	}
 
+	if err := p.validateDigest(ctx, inspectResult); err != nil {
+		return nil, err
+	}
+
 	tarFileName, err := p.saveImage(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	// use the existing tarball provider to process what was pulled from the docker daemon
-	return NewProviderFromTarball(tarFileName, p.tmpDirGen).Provide(ctx, withInspectMetadata(inspectResult, userMetadata)...)
+	return NewProviderFromTarball(tarFileName, p.tmpDirGen, "").Provide(ctx, withInspectMetadata(inspectResult, userMetadata)...)
 }
 
 func (p *DaemonImageProvider) saveImage(ctx context.Context) (string, error) {
@@ -300,8 +318,10 @@ func (p *DaemonImageProvider) saveImage(ctx context.Context) (string, error) {
 	// save the image contents to the temp file
 	// note: this is the same image that will be used to querying image content during analysis
 	providerProgress.Stage.Current = "saving image to disk"
-	nBytes, err := io.Copy(io.MultiWriter(tempTarFile, providerProgress.CopyProgress), readCloser)
+	nBytes, err := io.Copy(io.MultiWriter(tempTarFile, providerProgress.CopyProgress), contextio.NewReader(ctx, readCloser))
 	if err != nil {
+		// don't leave a partial image tar behind (e.g. when cancelled)
+		_ = os.Remove(tempTarFile.Name())
 		return "", fmt.Errorf("unable to save image to tar: %w", err)
 	}
 	if nBytes == 0 {
@@ -352,6 +372,38 @@ func (p *DaemonImageProvider) validatePlatform(i types.ImageInspect) error {
 	return nil
 }
 
+// validateDigest ensures the image found is the one that the reference is pinned to (if any), warning if the tag given
+// along with the digest refers to a different image.
+func (p *DaemonImageProvider) validateDigest(ctx context.Context, i types.ImageInspect) error {
+	if p.digest == "" {
+		return nil
+	}
+
+	found := false
+	for _, repoDigest := range i.RepoDigests {
+		if strings.HasSuffix(repoDigest, "@"+p.digest) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("image=%q does not have the requested digest (repo digests: %+v)", p.imageStr, i.RepoDigests)
+	}
+
+	if p.digestTag == "" {
+		return nil
+	}
+	tagged, _, err := p.client.ImageInspectWithRaw(ctx, p.digestTag)
+	if err != nil {
+		log.Debugf("unable to check tag=%q of image=%q: %+v", p.digestTag, p.imageStr, err)
+		return nil
+	}
+	if tagged.ID != i.ID {
+		log.Warnf("image=%q: tag=%q refers to a different image (id=%q), using the image with the given digest (id=%q) instead", p.imageStr, p.digestTag, tagged.ID, i.ID)
+	}
+	return nil
+}
+
 func withInspectMetadata(i types.ImageInspect, userMetadata []image.AdditionalMetadata) (metadata []image.AdditionalMetadata) {
 	metadata = append(metadata,
 		image.WithTags(i.RepoTags...),
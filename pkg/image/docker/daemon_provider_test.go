@@ -1,12 +1,16 @@
 package docker
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"github.com/stretchr/testify/require"
 	"testing"
 
 	configTypes "github.com/docker/cli/cli/config/types"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -113,8 +117,13 @@ func TestNewProviderFromDaemon_imageParsing(t *testing.T) {
 			want:  "alpine@sha256:95cf004f559831017cdf4628aaf1bb30133677be8702a8c5f2994629f637a209",
 		},
 		{
+			// the digest is always preferred over the tag
 			image: "alpine:sometag@sha256:95cf004f559831017cdf4628aaf1bb30133677be8702a8c5f2994629f637a209",
-			want:  "alpine:sometag@sha256:95cf004f559831017cdf4628aaf1bb30133677be8702a8c5f2994629f637a209",
+			want:  "alpine@sha256:95cf004f559831017cdf4628aaf1bb30133677be8702a8c5f2994629f637a209",
+		},
+		{
+			image: "registry.place.io/thing:version@sha256:95cf004f559831017cdf4628aaf1bb30133677be8702a8c5f2994629f637a209",
+			want:  "registry.place.io/thing@sha256:95cf004f559831017cdf4628aaf1bb30133677be8702a8c5f2994629f637a209",
 		},
 	}
 	for _, tt := range tests {
@@ -132,3 +141,64 @@ func TestNewProviderFromDaemon_imageParsing(t *testing.T) {
 		})
 	}
 }
+
+// inspectClient is a docker client that only supports inspecting the given images (keyed by reference).
+type inspectClient struct {
+	client.APIClient
+	images map[string]types.ImageInspect
+}
+
+func (c inspectClient) ImageInspectWithRaw(_ context.Context, ref string) (types.ImageInspect, []byte, error) {
+	if i, ok := c.images[ref]; ok {
+		return i, nil, nil
+	}
+	return types.ImageInspect{}, nil, fmt.Errorf("no such image: %s", ref)
+}
+
+func TestDaemonImageProvider_validateDigest(t *testing.T) {
+	const digest = "sha256:95cf004f559831017cdf4628aaf1bb30133677be8702a8c5f2994629f637a209"
+	pinned := types.ImageInspect{ID: "sha256:pinned", RepoDigests: []string{"alpine@" + digest}}
+
+	tests := []struct {
+		name    string
+		image   string
+		inspect types.ImageInspect
+		wantErr require.ErrorAssertionFunc
+	}{
+		{
+			name:    "matching digest",
+			image:   "alpine@" + digest,
+			inspect: pinned,
+		},
+		{
+			// the tag refers to another image, which is only warned about
+			name:    "matching digest with a different tag",
+			image:   "alpine:3.14@" + digest,
+			inspect: pinned,
+		},
+		{
+			name:    "mismatched digest",
+			image:   "alpine@" + digest,
+			inspect: types.ImageInspect{ID: "sha256:other", RepoDigests: []string{"alpine@sha256:0000000000000000000000000000000000000000000000000000000000000000"}},
+			wantErr: require.Error,
+		},
+		{
+			name:    "no digest",
+			image:   "alpine:3.14",
+			inspect: types.ImageInspect{ID: "sha256:other"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantErr == nil {
+				tt.wantErr = require.NoError
+			}
+			c := inspectClient{images: map[string]types.ImageInspect{
+				"alpine:3.14": {ID: "sha256:tagged"},
+			}}
+			provider, err := NewProviderFromDaemon(tt.image, nil, c, nil)
+			require.NoError(t, err)
+			tt.wantErr(t, provider.validateDigest(context.Background(), tt.inspect))
+		})
+	}
+}
@@ -7,9 +7,11 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"strings"
 
 	"github.com/anchore/stereoscope/internal/log"
 	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/tarball"
 	"github.com/google/go-containerregistry/pkg/v1/types"
@@ -43,6 +45,35 @@ func (m dockerManifest) allTags() (tags []string) {
 	return tags
 }
 
+// image returns the entry for the image with the given repo tag (e.g. "alpine:latest"). If no repo tag is given then the
+// manifest must describe a single image, which is returned.
+func (m dockerManifest) image(repoTag string) (*tarball.Descriptor, error) {
+	if repoTag == "" {
+		if len(m.parsed) != 1 {
+			return nil, ErrMultipleManifests
+		}
+		return &m.parsed[0], nil
+	}
+
+	tag, err := name.NewTag(repoTag)
+	if err != nil {
+		return nil, fmt.Errorf("invalid repo tag=%q: %w", repoTag, err)
+	}
+	for idx, entry := range m.parsed {
+		for _, candidate := range entry.RepoTags {
+			candidateTag, err := name.NewTag(candidate)
+			if err != nil {
+				continue
+			}
+			// compare the resolved names, since there are several ways to specify the same tag (e.g. "alpine" and "docker.io/library/alpine:latest")
+			if candidateTag.Name() == tag.Name() {
+				return &m.parsed[idx], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no image with repo tag=%q found (available tags: %s)", repoTag, strings.Join(m.allTags(), ", "))
+}
+
 // extractManifest is helper function for extracting and parsing a docker image manifest (V2) from a docker image tar.
 func extractManifest(tarPath string) (*dockerManifest, error) {
 	f, err := os.Open(tarPath)
@@ -69,8 +100,8 @@ func extractManifest(tarPath string) (*dockerManifest, error) {
 	return newManifest(contents)
 }
 
-// generateOCIManifest takes a docker manifest and a path to the tar and generates an OCI manifest derived from the given arguments and the docker config.
-func generateOCIManifest(tarPath string, manifest *dockerManifest) (*v1.Manifest, []byte, error) {
+// generateOCIManifest takes a docker manifest entry and a path to the tar and generates an OCI manifest derived from the given arguments and the docker config.
+func generateOCIManifest(tarPath string, descriptor *tarball.Descriptor) (*v1.Manifest, []byte, error) {
 	f, err := os.Open(tarPath)
 	if err != nil {
 		return nil, nil, err
@@ -83,11 +114,7 @@ func generateOCIManifest(tarPath string, manifest *dockerManifest) (*v1.Manifest
 		}
 	}()
 
-	if len(manifest.parsed) != 1 {
-		return nil, nil, ErrMultipleManifests
-	}
-
-	configReader, err := file.ReaderFromTar(f, manifest.parsed[0].Config)
+	configReader, err := file.ReaderFromTar(f, descriptor.Config)
 	if err != nil {
 		return nil, nil, fmt.Errorf("unable to find docker config: %w", err)
 	}
@@ -97,8 +124,8 @@ func generateOCIManifest(tarPath string, manifest *dockerManifest) (*v1.Manifest
 		return nil, nil, fmt.Errorf("unable to read docker config: %w", err)
 	}
 
-	var layerSizes = make([]int64, len(manifest.parsed[0].Layers))
-	for idx, layerTarPath := range manifest.parsed[0].Layers {
+	var layerSizes = make([]int64, len(descriptor.Layers))
+	for idx, layerTarPath := range descriptor.Layers {
 		_, err = f.Seek(0, io.SeekStart)
 		if err != nil {
 			return nil, nil, fmt.Errorf("unable to reset tar reader: %w", err)
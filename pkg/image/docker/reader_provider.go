@@ -0,0 +1,69 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/anchore/stereoscope/internal/contextio"
+	"github.com/anchore/stereoscope/internal/log"
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+)
+
+// ReaderImageProvider is a image.Provider for a docker image (V2) tar that is streamed from a reader (e.g. the output
+// from "docker image save ..." piped to stdin).
+type ReaderImageProvider struct {
+	reader    io.Reader
+	tmpDirGen *file.TempDirGenerator
+	repoTag   string
+}
+
+// NewProviderFromReader creates a new provider instance for the docker image tar stream from the given reader. If a repo
+// tag is given then the image with that tag is selected from a stream with multiple images (see NewProviderFromTarball).
+func NewProviderFromReader(reader io.Reader, tmpDirGen *file.TempDirGenerator, repoTag string) *ReaderImageProvider {
+	return &ReaderImageProvider{
+		reader:    reader,
+		tmpDirGen: tmpDirGen,
+		repoTag:   repoTag,
+	}
+}
+
+// Provide an image object that represents the docker image tar read from the configured reader.
+func (p *ReaderImageProvider) Provide(ctx context.Context, userMetadata ...image.AdditionalMetadata) (*image.Image, error) {
+	contentTempDir, err := p.tmpDirGen.NewDirectory("docker-tarball-image")
+	if err != nil {
+		return nil, err
+	}
+
+	// note: the manifest and config may be located anywhere within the tar (typically after the layers), so random
+	// access is required. The stream is spooled to the image content directory, which means it is removed along with
+	// all other cached content when the image is cleaned up.
+	tarPath := filepath.Join(contentTempDir, "image.tar")
+	if err := spoolToFile(contextio.NewReader(ctx, p.reader), tarPath); err != nil {
+		return nil, fmt.Errorf("unable to read docker image tar stream: %w", err)
+	}
+
+	return imageFromTarball(tarPath, p.repoTag, contentTempDir, userMetadata...)
+}
+
+func spoolToFile(reader io.Reader, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	n, err := io.Copy(f, reader)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// don't leave a partial image tar behind (e.g. when cancelled)
+		_ = os.Remove(path)
+		return err
+	}
+	log.Debugf("spooled docker image tar stream to %q (%d bytes)", path, n)
+	return nil
+}
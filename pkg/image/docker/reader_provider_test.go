@@ -0,0 +1,58 @@
+package docker
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ReaderProvide(t *testing.T) {
+	img, err := random.Image(1024, 2)
+	require.NoError(t, err)
+
+	tag, err := name.NewTag("example.com/stream:latest")
+	require.NoError(t, err)
+
+	var stream bytes.Buffer
+	require.NoError(t, tarball.Write(tag, img, &stream))
+
+	spooledTars := func() []string {
+		matches, err := filepath.Glob(filepath.Join(os.TempDir(), "stereoscope-reader-test-*", "docker-tarball-image-*", "image.tar"))
+		require.NoError(t, err)
+		return matches
+	}
+	require.Empty(t, spooledTars())
+
+	generator := file.NewTempDirGenerator("stereoscope-reader-test")
+	t.Cleanup(func() { _ = generator.Cleanup() })
+
+	image, err := NewProviderFromReader(&stream, generator, "").Provide(nil)
+	require.NoError(t, err)
+	require.NoError(t, image.Read())
+
+	assert.Len(t, image.Layers, 2)
+	require.Len(t, image.Metadata.Tags, 1)
+	assert.Equal(t, tag.String(), image.Metadata.Tags[0].String())
+
+	// the spooled tar must be removed with the rest of the image content
+	require.Len(t, spooledTars(), 1)
+	require.NoError(t, image.Cleanup())
+	assert.Empty(t, spooledTars())
+}
+
+func Test_ReaderProvide_Fails(t *testing.T) {
+	generator := file.NewTempDirGenerator("tempDir")
+	t.Cleanup(func() { _ = generator.Cleanup() })
+
+	image, err := NewProviderFromReader(bytes.NewBufferString("not a tar"), generator, "").Provide(nil)
+	assert.Error(t, err)
+	assert.Nil(t, image)
+}
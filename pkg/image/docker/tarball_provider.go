@@ -4,10 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/anchore/stereoscope/internal/log"
 	"github.com/anchore/stereoscope/pkg/file"
 	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/tarball"
 )
@@ -18,22 +20,58 @@ var ErrMultipleManifests = fmt.Errorf("cannot process multiple docker manifests"
 type TarballImageProvider struct {
 	path      string
 	tmpDirGen *file.TempDirGenerator
+	repoTag   string
 }
 
-// NewProviderFromTarball creates a new provider instance for the specific image already at the given path.
-func NewProviderFromTarball(path string, tmpDirGen *file.TempDirGenerator) *TarballImageProvider {
+// NewProviderFromTarball creates a new provider instance for the specific image already at the given path. If a repo tag
+// is given then the image with that tag is selected from an archive with multiple images (e.g. from "docker image save
+// img1 img2"), otherwise the archive must contain a single image.
+func NewProviderFromTarball(path string, tmpDirGen *file.TempDirGenerator, repoTag string) *TarballImageProvider {
 	return &TarballImageProvider{
 		path:      path,
 		tmpDirGen: tmpDirGen,
+		repoTag:   repoTag,
 	}
 }
 
+// ListImages returns the repo tags of all images within the docker image tar (images saved without a tag are not listed).
+func (p *TarballImageProvider) ListImages() ([]string, error) {
+	theManifest, err := extractManifest(p.path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list images from tarball: %w", err)
+	}
+	return theManifest.allTags(), nil
+}
+
 // Provide an image object that represents the docker image tar at the configured location on disk.
 func (p *TarballImageProvider) Provide(_ context.Context, userMetadata ...image.AdditionalMetadata) (*image.Image, error) {
-	img, err := tarball.ImageFromPath(p.path, nil)
+	contentTempDir, err := p.tmpDirGen.NewDirectory("docker-tarball-image")
+	if err != nil {
+		return nil, err
+	}
+
+	return imageFromTarball(p.path, p.repoTag, contentTempDir, userMetadata...)
+}
+
+// imageFromTarball creates an image object for the docker image tar at the given path (selecting the image with the
+// given repo tag, if any), caching content to the given directory.
+func imageFromTarball(path, repoTag, contentTempDir string, userMetadata ...image.AdditionalMetadata) (*image.Image, error) {
+	var tag *name.Tag
+	if repoTag != "" {
+		t, err := name.NewTag(repoTag)
+		if err != nil {
+			return nil, fmt.Errorf("invalid repo tag=%q: %w", repoTag, err)
+		}
+		tag = &t
+	}
+
+	img, err := tarball.ImageFromPath(path, tag)
 	if err != nil {
 		// raise a more controlled error for when there are multiple images within the given tar (from https://github.com/anchore/grype/issues/215)
 		if err.Error() == "tarball must contain only a single image to be used with tarball.Image" {
+			if theManifest, manifestErr := extractManifest(path); manifestErr == nil {
+				return nil, fmt.Errorf("%w (select one of the available tags: %s)", ErrMultipleManifests, strings.Join(theManifest.allTags(), ", "))
+			}
 			return nil, ErrMultipleManifests
 		}
 		return nil, fmt.Errorf("unable to provide image from tarball: %w", err)
@@ -45,16 +83,21 @@ func (p *TarballImageProvider) Provide(_ context.Context, userMetadata ...image.
 	var ociManifest *v1.Manifest
 	var metadata []image.AdditionalMetadata
 
-	theManifest, err := extractManifest(p.path)
+	theManifest, err := extractManifest(path)
 	if err != nil {
 		log.Warnf("could not extract manifest: %+v", err)
 	}
 
 	if theManifest != nil {
+		descriptor, err := theManifest.image(repoTag)
+		if err != nil {
+			return nil, err
+		}
+
 		// given that we have a manifest, continue processing to get the tags and OCI manifest
-		metadata = append(metadata, image.WithTags(theManifest.allTags()...))
+		metadata = append(metadata, image.WithTags(descriptor.RepoTags...))
 
-		ociManifest, rawConfig, err = generateOCIManifest(p.path, theManifest)
+		ociManifest, rawConfig, err = generateOCIManifest(path, descriptor)
 		if err != nil {
 			log.Warnf("failed to generate OCI manifest from docker archive: %+v", err)
 		}
@@ -77,10 +120,5 @@ func (p *TarballImageProvider) Provide(_ context.Context, userMetadata ...image.
 	// apply user-supplied metadata last to override any default behavior
 	metadata = append(metadata, userMetadata...)
 
-	contentTempDir, err := p.tmpDirGen.NewDirectory("docker-tarball-image")
-	if err != nil {
-		return nil, err
-	}
-
 	return image.NewImage(img, contentTempDir, metadata...), nil
 }
@@ -0,0 +1,105 @@
+package docker
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// multiImageFixture is generated by test-fixtures/generators/multi-image.go
+const multiImageFixture = "test-fixtures/multi-image.tar"
+
+func TestTarballImageProvider_ListImages(t *testing.T) {
+	generator := file.NewTempDirGenerator("tempDir")
+	t.Cleanup(func() { _ = generator.Cleanup() })
+
+	tags, err := NewProviderFromTarball(multiImageFixture, generator, "").ListImages()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"example.com/first:latest", "example.com/second:v1"}, tags)
+}
+
+func TestTarballImageProvider_Provide_MultipleImages(t *testing.T) {
+	tests := []struct {
+		repoTag      string
+		expectedTag  string
+		expectedFile file.Path
+		layers       int
+	}{
+		{
+			repoTag:      "example.com/first:latest",
+			expectedTag:  "example.com/first:latest",
+			expectedFile: "/first.txt",
+			layers:       1,
+		},
+		{
+			// the tag is resolved before matching
+			repoTag:      "example.com/first",
+			expectedTag:  "example.com/first:latest",
+			expectedFile: "/first.txt",
+			layers:       1,
+		},
+		{
+			repoTag:      "example.com/second:v1",
+			expectedTag:  "example.com/second:v1",
+			expectedFile: "/extra.txt",
+			layers:       2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.repoTag, func(t *testing.T) {
+			generator := file.NewTempDirGenerator("tempDir")
+			t.Cleanup(func() { _ = generator.Cleanup() })
+
+			img, err := NewProviderFromTarball(multiImageFixture, generator, test.repoTag).Provide(nil)
+			require.NoError(t, err)
+			require.NoError(t, img.Read())
+			t.Cleanup(func() { _ = img.Cleanup() })
+
+			assert.Len(t, img.Layers, test.layers)
+			require.Len(t, img.Metadata.Tags, 1)
+			assert.Equal(t, test.expectedTag, img.Metadata.Tags[0].String())
+			assert.True(t, img.SquashedTree().HasPath(test.expectedFile))
+		})
+	}
+}
+
+func TestTarballImageProvider_Provide_MultipleImagesWithoutRepoTag(t *testing.T) {
+	generator := file.NewTempDirGenerator("tempDir")
+	t.Cleanup(func() { _ = generator.Cleanup() })
+
+	_, err := NewProviderFromTarball(multiImageFixture, generator, "").Provide(nil)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrMultipleManifests))
+	assert.Contains(t, err.Error(), "example.com/second:v1")
+
+	_, err = NewProviderFromTarball(multiImageFixture, generator, "example.com/missing:latest").Provide(nil)
+	assert.Error(t, err)
+}
+
+func TestTarballImageProvider_Provide_SingleImage(t *testing.T) {
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	tag, err := name.NewTag("example.com/single:latest")
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "image.tar")
+	require.NoError(t, tarball.WriteToFile(path, tag, img))
+
+	generator := file.NewTempDirGenerator("tempDir")
+	t.Cleanup(func() { _ = generator.Cleanup() })
+
+	// a single image is selected without a repo tag
+	provided, err := NewProviderFromTarball(path, generator, "").Provide(nil)
+	require.NoError(t, err)
+	require.NoError(t, provided.Read())
+	t.Cleanup(func() { _ = provided.Cleanup() })
+	assert.Len(t, provided.Layers, 1)
+}
@@ -0,0 +1,71 @@
+//go:build ignore
+// +build ignore
+
+// generates a docker archive (as from "docker save") holding two images with distinct repo tags:
+// example.com/first:latest (one layer) and example.com/second:v1 (two layers)
+// usage: go run multi-image.go <output-tar>
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+// layer creates a layer with a single regular file (with a zero mtime, which keeps the generated tar stable)
+func layer(path, contents string) v1.Layer {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	if err := tw.WriteHeader(&tar.Header{Name: path, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(contents))}); err != nil {
+		log.Fatal(err)
+	}
+	if _, err := tw.Write([]byte(contents)); err != nil {
+		log.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		log.Fatal(err)
+	}
+	b := buf.Bytes()
+	l, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(b)), nil
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	return l
+}
+
+func main() {
+	if len(os.Args) != 2 {
+		log.Fatal("usage: go run multi-image.go <output-tar>")
+	}
+
+	first, err := mutate.AppendLayers(empty.Image, layer("first.txt", "first image\n"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	second, err := mutate.AppendLayers(empty.Image,
+		layer("second.txt", "second image\n"),
+		layer("extra.txt", "second image, second layer\n"),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	images := map[name.Tag]v1.Image{
+		name.MustParseReference("example.com/first:latest").(name.Tag): first,
+		name.MustParseReference("example.com/second:v1").(name.Tag):    second,
+	}
+	if err := tarball.MultiWriteToFile(os.Args[1], images); err != nil {
+		log.Fatal(err)
+	}
+}
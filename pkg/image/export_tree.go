@@ -0,0 +1,95 @@
+package image
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree/filenode"
+)
+
+// ExportTreeOptions control what is written by Image.ExportTree.
+type ExportTreeOptions struct {
+	// Digests includes the sha256 of the contents of every regular file (this reads all file contents).
+	Digests bool
+}
+
+// ExportedPath describes a single path of the squashed tree, as written by Image.ExportTree.
+type ExportedPath struct {
+	Path file.Path `json:"path"`
+	// Type is the file type name (see file.Type.String)
+	Type string `json:"type"`
+	// Implied indicates a directory without an entry in any layer (implied by the paths within it), so there is no
+	// metadata for the path
+	Implied    bool   `json:"implied,omitempty"`
+	Size       int64  `json:"size,omitempty"`
+	Mode       string `json:"mode,omitempty"`
+	UserID     int    `json:"uid,omitempty"`
+	GroupID    int    `json:"gid,omitempty"`
+	LinkTarget string `json:"linkTarget,omitempty"`
+	MIMEType   string `json:"mimeType,omitempty"`
+	// Layer is the index of the layer that provided the path (only for paths that are not implied)
+	Layer *uint `json:"layer,omitempty"`
+	// Digest is the sha256 of the file contents (only for regular files when ExportTreeOptions.Digests is set)
+	Digest string `json:"digest,omitempty"`
+}
+
+// ExportTree writes the squashed tree as a JSON array with the metadata of every path (see ExportedPath), but not the
+// file contents. Paths are written in tree order (every directory before its contents, siblings sorted lexically), so
+// the output is stable for the same squashed filesystem and is suitable for snapshot tests.
+func (i *Image) ExportTree(w io.Writer, opts ExportTreeOptions) error {
+	paths, err := i.exportedPaths(opts)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(paths)
+}
+
+func (i *Image) exportedPaths(opts ExportTreeOptions) ([]ExportedPath, error) {
+	// note: the walk is depth-first with lexically sorted siblings and symlinks are not descended into
+	paths := []ExportedPath{}
+	err := i.SquashedTree().WalkFrom(file.DirSeparator, func(p file.Path, f filenode.FileNode) error {
+		exported := ExportedPath{
+			Path: p,
+			Type: f.FileType.String(),
+		}
+		if f.Reference == nil {
+			exported.Implied = true
+			paths = append(paths, exported)
+			return nil
+		}
+
+		entry, err := i.FileCatalog.Get(*f.Reference)
+		if err != nil {
+			return fmt.Errorf("unable to get metadata for path=%q: %w", p, err)
+		}
+		exported.Size = entry.Metadata.Size
+		exported.Mode = entry.Metadata.Mode.String()
+		exported.UserID = entry.Metadata.UserID
+		exported.GroupID = entry.Metadata.GroupID
+		exported.LinkTarget = entry.Metadata.Linkname
+		exported.MIMEType = entry.Metadata.MIMEType
+		if entry.Layer != nil {
+			layer := entry.Layer.Metadata.Index
+			exported.Layer = &layer
+		}
+
+		if opts.Digests && f.FileType == file.TypeReg {
+			digest, err := i.contentDigest(*f.Reference)
+			if err != nil {
+				return err
+			}
+			exported.Digest = "sha256:" + digest
+		}
+
+		paths = append(paths, exported)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
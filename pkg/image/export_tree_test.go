@@ -0,0 +1,64 @@
+package image
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImage_ExportTree(t *testing.T) {
+	img, err := NewMockBuilder().
+		AddDir("/etc", 0755).
+		AddFile("/etc/hosts", "stale", 0600).
+		AddFile("/usr/bin/app", "#!/bin/sh\n", 0755).
+		AddLayer().
+		AddFile("/etc/hosts", "127.0.0.1 localhost\n", 0644).
+		AddSymlink("/usr/bin/link", "app").
+		Build()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = img.Cleanup() })
+
+	expected := `[
+  {"path": "/", "type": "Directory", "implied": true},
+  {"path": "/etc", "type": "Directory", "mode": "drwxr-xr-x", "layer": 0},
+  {
+    "path": "/etc/hosts",
+    "type": "RegularFile",
+    "size": 20,
+    "mode": "-rw-r--r--",
+    "mimeType": "text/plain",
+    "layer": 1,
+    "digest": "sha256:081ef9d5367595d16e30b4b4549d9f43537320508b4ce0788963e10e4f808857"
+  },
+  {"path": "/usr", "type": "Directory", "implied": true},
+  {"path": "/usr/bin", "type": "Directory", "implied": true},
+  {
+    "path": "/usr/bin/app",
+    "type": "RegularFile",
+    "size": 10,
+    "mode": "-rwxr-xr-x",
+    "mimeType": "text/plain",
+    "layer": 0,
+    "digest": "sha256:a8076d3d28d21e02012b20eaf7dbf75409a6277134439025f282e368e3305abf"
+  },
+  {"path": "/usr/bin/link", "type": "SymbolicLink", "mode": "Lrwxrwxrwx", "linkTarget": "app", "layer": 1}
+]`
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, img.ExportTree(buf, ExportTreeOptions{Digests: true}))
+	assert.JSONEq(t, expected, buf.String())
+
+	// the output is stable
+	again := &bytes.Buffer{}
+	require.NoError(t, img.ExportTree(again, ExportTreeOptions{Digests: true}))
+	assert.Equal(t, buf.String(), again.String())
+
+	// file contents are only read when digests are requested
+	paths, err := img.exportedPaths(ExportTreeOptions{})
+	require.NoError(t, err)
+	for _, p := range paths {
+		assert.Empty(t, p.Digest, "path=%q", p.Path)
+	}
+}
@@ -0,0 +1,239 @@
+package image
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/anchore/stereoscope/internal/log"
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+// ExtractOptions control how the squashed filesystem is written to disk by Image.Extract.
+type ExtractOptions struct {
+	// PreserveOwnership sets the user and group of every extracted path to those found in the image (this typically
+	// requires running as root).
+	PreserveOwnership bool
+	// FollowSymlinks writes a copy of the file that each symlink resolves to (within the image) instead of the symlink
+	// itself. Symlinks that resolve to directories, or that do not resolve at all, are not extracted.
+	FollowSymlinks bool
+	// CreateDevices recreates character and block devices with the device number found in the image (see
+	// file.Metadata.DeviceMajor and DeviceMinor). This is disabled by default since device nodes from an untrusted
+	// image (e.g. a raw disk) grant access to the devices of the host. Creating device nodes on disk requires running
+	// as root (on linux), devices are skipped with a warning otherwise.
+	CreateDevices bool
+}
+
+// extractModeBits are the mode bits that are applied to extracted paths (the file type bits are implied by how each
+// path is created).
+const extractModeBits = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+// Extract writes the squashed filesystem (with all whiteouts already applied) to the given destination directory,
+// recreating directories, regular files (with contents), hardlinks, and symlinks along with their modes. The destination
+// is created if it does not exist and should otherwise be empty. Every path is guarded such that nothing is written
+// outside of the destination, neither lexically nor through a symlink already on disk (an ErrPathEscapesRoot error is
+// returned otherwise), and symlinks are only created after all other paths have been written. Link targets are written as-is, so absolute symlinks point to
+// locations relative to the host root unless the destination is used as a root (e.g. with chroot). Named pipes are not
+// extracted, nor are device files unless ExtractOptions.CreateDevices is set.
+func (i *Image) Extract(destDir string, opts ExtractOptions) error {
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return fmt.Errorf("unable to create destination directory: %w", err)
+	}
+	return i.ExtractTo(NewOSExtractTarget(destDir), opts)
+}
+
+// ExtractTo writes the squashed filesystem to the given target, the same as Extract (e.g. to an in-memory target, see
+// NewMemoryExtractTarget).
+func (i *Image) ExtractTo(target ExtractTarget, opts ExtractOptions) error {
+	tree := i.SquashedTree()
+	byType := make(map[file.Type][]file.Reference)
+	for _, ty := range file.AllTypes {
+		byType[ty] = tree.AllFiles(ty)
+	}
+
+	// create all directories first (implied directories are created along the way with default permissions)...
+	var dirs []extractedPath
+	for _, ref := range byType[file.TypeDir] {
+		entry, err := i.extractEntry(ref)
+		if err != nil {
+			return err
+		}
+		// note: the final mode is applied after all contents have been written (the directory may not be writable)
+		if err := target.MkdirAll(ref.RealPath); err != nil {
+			return fmt.Errorf("unable to create directory=%q: %w", ref.RealPath, err)
+		}
+		dirs = append(dirs, extractedPath{path: ref.RealPath, metadata: entry.Metadata})
+	}
+
+	// ...then regular files and hardlinks (which must be able to refer to the extracted regular files)...
+	for _, ref := range byType[file.TypeReg] {
+		entry, err := i.extractEntry(ref)
+		if err != nil {
+			return err
+		}
+		if err := i.extractFile(target, ref.RealPath, ref, entry.Metadata, opts); err != nil {
+			return err
+		}
+	}
+
+	for _, ref := range byType[file.TypeHardLink] {
+		entry, err := i.extractEntry(ref)
+		if err != nil {
+			return err
+		}
+		if err := mkdirParent(target, ref.RealPath); err != nil {
+			return err
+		}
+		if err := target.Link(file.Path(entry.Metadata.Linkname).ToAbsolute().Normalize(), ref.RealPath); err != nil {
+			return fmt.Errorf("unable to create hardlink=%q: %w", ref.RealPath, err)
+		}
+	}
+
+	for _, ty := range []file.Type{file.TypeCharacterDevice, file.TypeBlockDevice} {
+		for _, ref := range byType[ty] {
+			if !opts.CreateDevices {
+				log.Debugf("not extracting path=%q (type=%s)", ref.RealPath, ty)
+				continue
+			}
+			if err := i.extractDevice(target, ref, ty, opts); err != nil {
+				return err
+			}
+		}
+	}
+
+	// ...then symlinks, so that no other path can be written through a symlink that leads outside of the destination...
+	for _, ref := range byType[file.TypeSymlink] {
+		entry, err := i.extractEntry(ref)
+		if err != nil {
+			return err
+		}
+		if err := i.extractSymlink(target, ref, entry.Metadata, opts); err != nil {
+			return err
+		}
+	}
+
+	for _, ref := range byType[file.TypeFifo] {
+		log.Debugf("not extracting path=%q (type=%s)", ref.RealPath, file.TypeFifo)
+	}
+
+	// ...and finally the directory modes and ownership, deepest first (so every parent remains writable until done)
+	sort.Slice(dirs, func(a, b int) bool {
+		return dirs[a].path > dirs[b].path
+	})
+	for _, dir := range dirs {
+		if err := applyMetadata(target, dir.path, dir.metadata, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type extractedPath struct {
+	path     file.Path
+	metadata file.Metadata
+}
+
+// extractEntry returns the catalog entry for the given reference.
+func (i *Image) extractEntry(ref file.Reference) (FileCatalogEntry, error) {
+	entry, err := i.FileCatalog.Get(ref)
+	if err != nil {
+		return FileCatalogEntry{}, fmt.Errorf("unable to get metadata for path=%q: %w", ref.RealPath, err)
+	}
+	return entry, nil
+}
+
+// extractFile writes the contents (and metadata) of the given reference to the given path within the target.
+func (i *Image) extractFile(target ExtractTarget, p file.Path, ref file.Reference, metadata file.Metadata, opts ExtractOptions) error {
+	if err := mkdirParent(target, p); err != nil {
+		return err
+	}
+
+	reader, err := i.FileCatalog.FileContents(ref)
+	if err != nil {
+		return fmt.Errorf("unable to read contents for path=%q: %w", ref.RealPath, err)
+	}
+	defer reader.Close()
+
+	if err := target.WriteFile(p, reader); err != nil {
+		return fmt.Errorf("unable to write contents for path=%q: %w", ref.RealPath, err)
+	}
+	return applyMetadata(target, p, metadata, opts)
+}
+
+func (i *Image) extractSymlink(target ExtractTarget, ref file.Reference, metadata file.Metadata, opts ExtractOptions) error {
+	if !opts.FollowSymlinks {
+		if err := mkdirParent(target, ref.RealPath); err != nil {
+			return err
+		}
+		if err := target.Symlink(metadata.Linkname, ref.RealPath); err != nil {
+			return fmt.Errorf("unable to create symlink=%q: %w", ref.RealPath, err)
+		}
+		if opts.PreserveOwnership {
+			if err := target.Lchown(ref.RealPath, metadata.UserID, metadata.GroupID); err != nil {
+				return fmt.Errorf("unable to set ownership for path=%q: %w", ref.RealPath, err)
+			}
+		}
+		return nil
+	}
+
+	resolved, err := i.SquashedTree().Resolve(ref.RealPath)
+	if err != nil {
+		return fmt.Errorf("unable to resolve symlink=%q: %w", ref.RealPath, err)
+	}
+	if resolved == nil || resolved.FileType != file.TypeReg || resolved.Reference == nil {
+		log.Debugf("not extracting symlink=%q (it does not resolve to a regular file)", ref.RealPath)
+		return nil
+	}
+
+	entry, err := i.FileCatalog.Get(*resolved.Reference)
+	if err != nil {
+		return fmt.Errorf("unable to get metadata for path=%q: %w", resolved.RealPath, err)
+	}
+	return i.extractFile(target, ref.RealPath, *resolved.Reference, entry.Metadata, opts)
+}
+
+// extractDevice creates the given character or block device within the target (see ExtractOptions.CreateDevices).
+func (i *Image) extractDevice(target ExtractTarget, ref file.Reference, fileType file.Type, opts ExtractOptions) error {
+	entry, err := i.extractEntry(ref)
+	if err != nil {
+		return err
+	}
+	if err := mkdirParent(target, ref.RealPath); err != nil {
+		return err
+	}
+	metadata := entry.Metadata
+	err = target.Mknod(ref.RealPath, fileType, metadata.Mode&os.ModePerm, metadata.DeviceMajor, metadata.DeviceMinor)
+	if errors.Is(err, ErrDevicesNotSupported) {
+		log.Warnf("skipping device=%q during extraction: %+v", ref.RealPath, err)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to create device=%q: %w", ref.RealPath, err)
+	}
+	return applyMetadata(target, ref.RealPath, metadata, opts)
+}
+
+// mkdirParent creates any missing parent directories of the given path (which are implied by the image, but have no
+// entry of their own).
+func mkdirParent(target ExtractTarget, p file.Path) error {
+	parent, err := p.ParentPath()
+	if err != nil {
+		return err
+	}
+	return target.MkdirAll(parent)
+}
+
+// applyMetadata sets the mode (and optionally the ownership) of an extracted path to that found in the image.
+func applyMetadata(target ExtractTarget, p file.Path, metadata file.Metadata, opts ExtractOptions) error {
+	if opts.PreserveOwnership {
+		if err := target.Lchown(p, metadata.UserID, metadata.GroupID); err != nil {
+			return fmt.Errorf("unable to set ownership for path=%q: %w", metadata.Path, err)
+		}
+	}
+	// note: this is done after changing ownership, since chown may clear the setuid and setgid bits
+	if err := target.Chmod(p, metadata.Mode&extractModeBits); err != nil {
+		return fmt.Errorf("unable to set mode for path=%q: %w", metadata.Path, err)
+	}
+	return nil
+}
@@ -0,0 +1,294 @@
+package image
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+// ExtractTarget is the filesystem that Image.ExtractTo writes the squashed filesystem to. All paths given are absolute
+// and normalized relative to the root of the target (e.g. "/etc/hosts"), and the parent directory of every path is
+// created (with MkdirAll) before anything is written within it.
+type ExtractTarget interface {
+	// MkdirAll creates the directory along with any missing parents (existing directories are kept as-is).
+	MkdirAll(p file.Path) error
+	// WriteFile creates (or truncates) the regular file with the given contents.
+	WriteFile(p file.Path, contents io.Reader) error
+	// Link creates a hardlink at the given path to an existing path that has already been written.
+	Link(existing, p file.Path) error
+	// Symlink creates a symlink at the given path that points to the given link target, which is written as-is.
+	Symlink(linkname string, p file.Path) error
+	// Chmod sets the mode bits of the given path (see extractModeBits), following symlinks.
+	Chmod(p file.Path, mode os.FileMode) error
+	// Lchown sets the user and group of the given path, without following symlinks.
+	Lchown(p file.Path, uid, gid int) error
+	// Mknod creates the character or block device (see file.TypeCharacterDevice and file.TypeBlockDevice) with the
+	// given device number, only invoked when ExtractOptions.CreateDevices is set. An ErrDevicesNotSupported is returned
+	// when the target cannot create devices, in which case the device is skipped with a warning.
+	Mknod(p file.Path, fileType file.Type, mode os.FileMode, major, minor int64) error
+}
+
+// ErrDevicesNotSupported is returned by ExtractTarget.Mknod when device nodes cannot be created (e.g. when not running
+// as root).
+var ErrDevicesNotSupported = errors.New("creating device nodes is not supported")
+
+// OSExtractTarget is an ExtractTarget that writes to a directory on disk (as used by Image.Extract). Every path is
+// guarded such that nothing is written outside of the directory: paths must be lexically within the directory, and no
+// path is written through a symlink already on disk (an ErrPathEscapesRoot error is returned otherwise).
+type OSExtractTarget struct {
+	root string
+}
+
+// NewOSExtractTarget creates an ExtractTarget that writes to the given (existing) directory.
+func NewOSExtractTarget(root string) *OSExtractTarget {
+	return &OSExtractTarget{root: root}
+}
+
+// location returns where the given path is written on disk. Every existing ancestor of the path below the root is
+// checked with Lstat, so that nothing is written through a symlink (e.g. one extracted earlier that points outside of
+// the root). The path itself is only checked when the operation would follow it (followsPath), otherwise the path is
+// never resolved (as with Lchown, or creating a link).
+func (t *OSExtractTarget) location(p file.Path, followsPath bool) (string, error) {
+	target, err := file.JoinWithinRoot(t.root, string(p))
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(t.root, target)
+	if err != nil {
+		return "", err
+	}
+	if rel == "." {
+		return target, nil
+	}
+
+	parts := strings.Split(rel, string(filepath.Separator))
+	if !followsPath {
+		parts = parts[:len(parts)-1]
+	}
+	current := t.root
+	for _, part := range parts {
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			// nothing below a missing path exists either
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return "", &file.ErrPathEscapesRoot{Path: string(p), Root: t.root}
+		}
+	}
+	return target, nil
+}
+
+func (t *OSExtractTarget) MkdirAll(p file.Path) error {
+	target, err := t.location(p, true)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(target, 0755)
+}
+
+func (t *OSExtractTarget) WriteFile(p file.Path, contents io.Reader) error {
+	target, err := t.location(p, true)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, contents)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (t *OSExtractTarget) Link(existing, p file.Path) error {
+	existingTarget, err := t.location(existing, false)
+	if err != nil {
+		return err
+	}
+	target, err := t.location(p, false)
+	if err != nil {
+		return err
+	}
+	return os.Link(existingTarget, target)
+}
+
+func (t *OSExtractTarget) Symlink(linkname string, p file.Path) error {
+	target, err := t.location(p, false)
+	if err != nil {
+		return err
+	}
+	return os.Symlink(linkname, target)
+}
+
+func (t *OSExtractTarget) Chmod(p file.Path, mode os.FileMode) error {
+	target, err := t.location(p, true)
+	if err != nil {
+		return err
+	}
+	return os.Chmod(target, mode)
+}
+
+func (t *OSExtractTarget) Lchown(p file.Path, uid, gid int) error {
+	target, err := t.location(p, false)
+	if err != nil {
+		return err
+	}
+	return os.Lchown(target, uid, gid)
+}
+
+// Mknod creates the device node on disk, which is only supported on linux when running as root.
+func (t *OSExtractTarget) Mknod(p file.Path, fileType file.Type, mode os.FileMode, major, minor int64) error {
+	target, err := t.location(p, false)
+	if err != nil {
+		return err
+	}
+	return mknod(target, fileType, mode, major, minor)
+}
+
+// MemoryExtractEntry is a single path written to a MemoryExtractTarget. Hardlinked paths share the same entry.
+type MemoryExtractEntry struct {
+	Type file.Type
+	// Mode holds only the mode bits set with Chmod (see extractModeBits)
+	Mode os.FileMode
+	// Contents is populated only for regular files
+	Contents []byte
+	// Linkname is populated only for symlinks
+	Linkname string
+	UserID   int
+	GroupID  int
+	// DeviceMajor and DeviceMinor are populated only for character and block devices
+	DeviceMajor int64
+	DeviceMinor int64
+}
+
+// MemoryExtractTarget is an ExtractTarget that keeps all paths in memory (e.g. to inspect or test an extraction without
+// writing to disk). It is not safe for concurrent use.
+type MemoryExtractTarget struct {
+	entries map[file.Path]*MemoryExtractEntry
+}
+
+// NewMemoryExtractTarget creates an in-memory ExtractTarget with only the root directory.
+func NewMemoryExtractTarget() *MemoryExtractTarget {
+	return &MemoryExtractTarget{
+		entries: map[file.Path]*MemoryExtractEntry{
+			file.DirSeparator: {Type: file.TypeDir, Mode: 0755},
+		},
+	}
+}
+
+// Get returns the entry written at the given path (or nil if there is none).
+func (t *MemoryExtractTarget) Get(p file.Path) *MemoryExtractEntry {
+	return t.entries[p.Normalize()]
+}
+
+// Paths returns all paths written (including the root directory), sorted.
+func (t *MemoryExtractTarget) Paths() []file.Path {
+	paths := make([]file.Path, 0, len(t.entries))
+	for p := range t.entries {
+		paths = append(paths, p)
+	}
+	sort.Sort(file.Paths(paths))
+	return paths
+}
+
+func (t *MemoryExtractTarget) lookup(p file.Path) (*MemoryExtractEntry, error) {
+	entry, ok := t.entries[p]
+	if !ok {
+		return nil, fmt.Errorf("no such file or directory: %s", p)
+	}
+	return entry, nil
+}
+
+// put adds the entry at the given path, which must not already exist within an existing directory.
+func (t *MemoryExtractTarget) put(p file.Path, entry *MemoryExtractEntry) error {
+	parent, err := p.ParentPath()
+	if err != nil {
+		return err
+	}
+	if dir, ok := t.entries[parent]; !ok || dir.Type != file.TypeDir {
+		return fmt.Errorf("no such directory: %s", parent)
+	}
+	if _, ok := t.entries[p]; ok {
+		return fmt.Errorf("file exists: %s", p)
+	}
+	t.entries[p] = entry
+	return nil
+}
+
+func (t *MemoryExtractTarget) MkdirAll(p file.Path) error {
+	for _, dir := range p.AllPaths() {
+		existing, ok := t.entries[dir]
+		if !ok {
+			t.entries[dir] = &MemoryExtractEntry{Type: file.TypeDir, Mode: 0755}
+			continue
+		}
+		if existing.Type != file.TypeDir {
+			return fmt.Errorf("not a directory: %s", dir)
+		}
+	}
+	return nil
+}
+
+func (t *MemoryExtractTarget) WriteFile(p file.Path, contents io.Reader) error {
+	buf := &bytes.Buffer{}
+	if _, err := io.Copy(buf, contents); err != nil {
+		return err
+	}
+	if existing, ok := t.entries[p]; ok && existing.Type == file.TypeReg {
+		existing.Contents = buf.Bytes()
+		return nil
+	}
+	return t.put(p, &MemoryExtractEntry{Type: file.TypeReg, Mode: 0600, Contents: buf.Bytes()})
+}
+
+func (t *MemoryExtractTarget) Link(existing, p file.Path) error {
+	entry, err := t.lookup(existing)
+	if err != nil {
+		return err
+	}
+	return t.put(p, entry)
+}
+
+func (t *MemoryExtractTarget) Symlink(linkname string, p file.Path) error {
+	return t.put(p, &MemoryExtractEntry{Type: file.TypeSymlink, Mode: 0777, Linkname: linkname})
+}
+
+func (t *MemoryExtractTarget) Chmod(p file.Path, mode os.FileMode) error {
+	entry, err := t.lookup(p)
+	if err != nil {
+		return err
+	}
+	entry.Mode = mode
+	return nil
+}
+
+func (t *MemoryExtractTarget) Lchown(p file.Path, uid, gid int) error {
+	entry, err := t.lookup(p)
+	if err != nil {
+		return err
+	}
+	entry.UserID = uid
+	entry.GroupID = gid
+	return nil
+}
+
+func (t *MemoryExtractTarget) Mknod(p file.Path, fileType file.Type, mode os.FileMode, major, minor int64) error {
+	if fileType != file.TypeCharacterDevice && fileType != file.TypeBlockDevice {
+		return fmt.Errorf("file type=%s is not a device", fileType)
+	}
+	return t.put(p, &MemoryExtractEntry{Type: fileType, Mode: mode, DeviceMajor: major, DeviceMinor: minor})
+}
@@ -0,0 +1,227 @@
+package image
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func extractTestImage(t *testing.T) *Image {
+	t.Helper()
+	img, err := NewMockBuilder().
+		AddDir("/etc", 0755).
+		AddFile("/etc/hosts", "stale", 0644).
+		AddFile("/etc/removed", "removed", 0644).
+		AddDir("/opt/readonly", 0555).
+		AddFile("/opt/readonly/file", "read only", 0444).
+		AddLayer().
+		AddFile("/etc/hosts", "127.0.0.1 localhost\n", 0600).
+		AddWhiteout("/etc/removed").
+		AddFile("/usr/bin/app", "binary", 0755).
+		AddSymlink("/usr/bin/link", "app").
+		AddSymlink("/usr/bin/dir-link", "/etc").
+		AddSymlink("/usr/bin/dead-link", "/missing").
+		Build()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = img.Cleanup() })
+	return img
+}
+
+func requireExtractedFile(t *testing.T, path, contents string, mode os.FileMode) {
+	t.Helper()
+	info, err := os.Lstat(path)
+	require.NoError(t, err)
+	assert.True(t, info.Mode().IsRegular(), "not a regular file: %s", path)
+	assert.Equal(t, mode, info.Mode().Perm(), "unexpected mode: %s", path)
+
+	actual, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, contents, string(actual))
+}
+
+func TestImage_Extract(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "rootfs")
+	require.NoError(t, extractTestImage(t).Extract(dest, ExtractOptions{}))
+
+	requireExtractedFile(t, filepath.Join(dest, "etc/hosts"), "127.0.0.1 localhost\n", 0600)
+	requireExtractedFile(t, filepath.Join(dest, "usr/bin/app"), "binary", 0755)
+	requireExtractedFile(t, filepath.Join(dest, "opt/readonly/file"), "read only", 0444)
+
+	// whiteouts are applied (and never extracted)
+	for _, p := range []string{"etc/removed", "etc/.wh.removed"} {
+		_, err := os.Lstat(filepath.Join(dest, p))
+		assert.True(t, os.IsNotExist(err), "unexpected path: %s", p)
+	}
+
+	// directory modes are applied once the contents are written
+	info, err := os.Stat(filepath.Join(dest, "opt/readonly"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0555), info.Mode().Perm())
+	t.Cleanup(func() { _ = os.Chmod(filepath.Join(dest, "opt/readonly"), 0755) })
+
+	// symlinks are preserved as-is
+	for p, expected := range map[string]string{
+		"usr/bin/link":      "app",
+		"usr/bin/dir-link":  "/etc",
+		"usr/bin/dead-link": "/missing",
+	} {
+		target, err := os.Readlink(filepath.Join(dest, p))
+		require.NoError(t, err)
+		assert.Equal(t, expected, target)
+	}
+}
+
+func TestImage_Extract_SymlinkThroughSymlink(t *testing.T) {
+	outside := t.TempDir()
+	symlink := func(name, target string) testTarEntry {
+		return testTarEntry{header: tar.Header{Name: name, Typeflag: tar.TypeSymlink, Linkname: target, Mode: 0777}}
+	}
+	// the second symlink would be written through the first, which points to a directory outside of the destination
+	img := newTestImage(t, []testTarEntry{
+		symlink("a", outside),
+		symlink("a/b", "/etc/passwd"),
+	})
+
+	dest := filepath.Join(t.TempDir(), "rootfs")
+	err := img.Extract(dest, ExtractOptions{})
+	var escapeErr *file.ErrPathEscapesRoot
+	require.ErrorAs(t, err, &escapeErr)
+
+	_, err = os.Lstat(filepath.Join(outside, "b"))
+	assert.True(t, os.IsNotExist(err), "path written outside of the destination")
+}
+
+func TestOSExtractTarget_RefusesSymlinkAncestors(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	require.NoError(t, os.Symlink(outside, filepath.Join(root, "link")))
+	target := NewOSExtractTarget(root)
+
+	var escapeErr *file.ErrPathEscapesRoot
+	assert.ErrorAs(t, target.MkdirAll("/link/dir"), &escapeErr)
+	assert.ErrorAs(t, target.WriteFile("/link/file", strings.NewReader("contents")), &escapeErr)
+	assert.ErrorAs(t, target.Symlink("/etc", "/link/symlink"), &escapeErr)
+	assert.ErrorAs(t, target.Link("/link", "/link/hardlink"), &escapeErr)
+	// the link itself is only refused where it would be followed
+	assert.ErrorAs(t, target.Chmod("/link", 0700), &escapeErr)
+	assert.NoError(t, target.Lchown("/link", os.Getuid(), os.Getgid()))
+
+	entries, err := ioutil.ReadDir(outside)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestImage_Extract_FollowSymlinks(t *testing.T) {
+	dest := t.TempDir()
+	require.NoError(t, extractTestImage(t).Extract(dest, ExtractOptions{FollowSymlinks: true}))
+	t.Cleanup(func() { _ = os.Chmod(filepath.Join(dest, "opt/readonly"), 0755) })
+
+	// links to regular files are replaced with a copy of the file...
+	requireExtractedFile(t, filepath.Join(dest, "usr/bin/link"), "binary", 0755)
+
+	// ...and any other links are not extracted
+	for _, p := range []string{"usr/bin/dir-link", "usr/bin/dead-link"} {
+		_, err := os.Lstat(filepath.Join(dest, p))
+		assert.True(t, os.IsNotExist(err), "unexpected path: %s", p)
+	}
+}
+
+func TestImage_Extract_HardLinks(t *testing.T) {
+	img := newTestImage(t, []testTarEntry{
+		regularEntry("bin/original", "contents"),
+		hardLinkEntry("bin/link", "bin/original"),
+	})
+
+	dest := t.TempDir()
+	require.NoError(t, img.Extract(dest, ExtractOptions{}))
+	requireExtractedFile(t, filepath.Join(dest, "bin/link"), "contents", 0644)
+
+	original, err := os.Stat(filepath.Join(dest, "bin/original"))
+	require.NoError(t, err)
+	link, err := os.Stat(filepath.Join(dest, "bin/link"))
+	require.NoError(t, err)
+	assert.True(t, os.SameFile(original, link))
+}
+
+func TestImage_Extract_PreserveOwnership(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("preserving ownership requires running as root")
+	}
+	img, err := NewMockBuilder().
+		AddFile("/owned", "contents", 0644).
+		Build()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = img.Cleanup() })
+
+	dest := t.TempDir()
+	require.NoError(t, img.Extract(dest, ExtractOptions{PreserveOwnership: true}))
+	requireExtractedFile(t, filepath.Join(dest, "owned"), "contents", 0644)
+}
+
+func TestImage_ExtractTo_Memory(t *testing.T) {
+	target := NewMemoryExtractTarget()
+	require.NoError(t, extractTestImage(t).ExtractTo(target, ExtractOptions{}))
+
+	assert.Equal(t, []file.Path{
+		"/", "/etc", "/etc/hosts", "/opt", "/opt/readonly", "/opt/readonly/file",
+		"/usr", "/usr/bin", "/usr/bin/app", "/usr/bin/dead-link", "/usr/bin/dir-link", "/usr/bin/link",
+	}, target.Paths())
+
+	hosts := target.Get("/etc/hosts")
+	require.NotNil(t, hosts)
+	assert.Equal(t, file.TypeReg, hosts.Type)
+	assert.Equal(t, "127.0.0.1 localhost\n", string(hosts.Contents))
+	assert.Equal(t, os.FileMode(0600), hosts.Mode)
+
+	assert.Equal(t, os.FileMode(0555), target.Get("/opt/readonly").Mode)
+
+	link := target.Get("/usr/bin/dir-link")
+	require.NotNil(t, link)
+	assert.Equal(t, file.TypeSymlink, link.Type)
+	assert.Equal(t, "/etc", link.Linkname)
+}
+
+func TestImage_ExtractTo_MemoryHardLinks(t *testing.T) {
+	img := newTestImage(t, []testTarEntry{
+		regularEntry("bin/original", "contents"),
+		hardLinkEntry("bin/link", "bin/original"),
+	})
+
+	target := NewMemoryExtractTarget()
+	require.NoError(t, img.ExtractTo(target, ExtractOptions{}))
+
+	// hardlinks share the same entry
+	original := target.Get("/bin/original")
+	require.NotNil(t, original)
+	assert.Same(t, original, target.Get("/bin/link"))
+	assert.Equal(t, "contents", string(original.Contents))
+}
+
+func TestImage_ExtractTo_MemoryDevices(t *testing.T) {
+	img := newTestImage(t, []testTarEntry{
+		{header: tar.Header{Name: "dev/null", Typeflag: tar.TypeChar, Mode: 0666, Devmajor: 1, Devminor: 3}},
+		{header: tar.Header{Name: "dev/sda", Typeflag: tar.TypeBlock, Mode: 0660, Devmajor: 8, Devminor: 0}},
+		{header: tar.Header{Name: "run/pipe", Typeflag: tar.TypeFifo, Mode: 0644}},
+	})
+
+	// devices are only created when opted in
+	target := NewMemoryExtractTarget()
+	require.NoError(t, img.ExtractTo(target, ExtractOptions{}))
+	assert.Nil(t, target.Get("/dev/null"))
+	assert.Nil(t, target.Get("/dev/sda"))
+
+	target = NewMemoryExtractTarget()
+	require.NoError(t, img.ExtractTo(target, ExtractOptions{CreateDevices: true}))
+
+	assert.Equal(t, &MemoryExtractEntry{Type: file.TypeCharacterDevice, Mode: 0666, DeviceMajor: 1, DeviceMinor: 3}, target.Get("/dev/null"))
+	assert.Equal(t, &MemoryExtractEntry{Type: file.TypeBlockDevice, Mode: 0660, DeviceMajor: 8, DeviceMinor: 0}, target.Get("/dev/sda"))
+	// named pipes are never extracted
+	assert.Nil(t, target.Get("/run/pipe"))
+}
@@ -3,6 +3,7 @@ package image
 import (
 	"fmt"
 	"io"
+	"sort"
 	"sync"
 
 	"github.com/anchore/stereoscope/pkg/file"
@@ -88,9 +89,22 @@ func (c *FileCatalog) GetByMIMEType(mType string) ([]FileCatalogEntry, error) {
 		entries = append(entries, entry)
 	}
 
+	// layers may be cataloged concurrently, however, files within each layer are added in order. Sorting by layer
+	// keeps the results in the same order as if all layers were read serially.
+	sort.SliceStable(entries, func(i, j int) bool {
+		return layerIndex(entries[i].Layer) < layerIndex(entries[j].Layer)
+	})
+
 	return entries, nil
 }
 
+func layerIndex(l *Layer) int {
+	if l == nil {
+		return -1
+	}
+	return int(l.Metadata.Index)
+}
+
 // FetchContents reads the file contents for the given file reference from the underlying image/layer blob. An error
 // is returned if there is no file at the given path and layer or the read operation cannot continue.
 func (c *FileCatalog) FileContents(f file.Reference) (io.ReadCloser, error) {
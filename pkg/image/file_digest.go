@@ -0,0 +1,48 @@
+package image
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+
+	"github.com/anchore/stereoscope/internal/log"
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+// WithFileDigests computes the sha256 of the contents of every regular file while each layer is indexed, which is
+// recorded within the file metadata (see file.Metadata.Digest) and the layer trees (see filetree.FileTree.Digest), so
+// that the digest is available without reading the contents again (e.g. for deduplication, or SquashedDigest). This
+// reads every file in full while the image is read, so it is disabled by default. Directories, links, and devices have
+// no content digest.
+func WithFileDigests(enabled bool) AdditionalMetadata {
+	return func(image *Image) error {
+		image.fileDigests = enabled
+		return nil
+	}
+}
+
+// digestFile records the content digest of the given regular file within the file metadata and the layer tree (only
+// when enabled, see WithFileDigests). The contents are hashed as they are streamed, never buffered in full. Unlike a
+// file.Opener, the given open function surfaces open errors, so that a file that cannot be opened is never recorded with
+// the digest of empty contents.
+func (l *Layer) digestFile(metadata *file.Metadata, open func() (io.ReadCloser, error)) error {
+	if !l.fileDigests {
+		return nil
+	}
+	contents, err := open()
+	if err != nil {
+		return fmt.Errorf("unable to open contents to digest for path=%q: %w", metadata.Path, err)
+	}
+	defer func() {
+		if err := contents.Close(); err != nil {
+			log.Warnf("unable to close file while indexing layer: %+v", err)
+		}
+	}()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, contents); err != nil {
+		return fmt.Errorf("unable to digest contents for path=%q: %w", metadata.Path, err)
+	}
+	metadata.Digest = fmt.Sprintf("%s%x", digestPrefix, hasher.Sum(nil))
+	return l.Tree.SetDigest(file.Path(metadata.Path), metadata.Digest)
+}
@@ -0,0 +1,117 @@
+package image
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImage_FileDigests(t *testing.T) {
+	layers := [][]testTarEntry{
+		{
+			{header: tar.Header{Name: "etc/", Typeflag: tar.TypeDir, Mode: 0755}},
+			regularEntry("etc/hosts", "stale"),
+			regularEntry("etc/empty", ""),
+			{header: tar.Header{Name: "etc/link", Typeflag: tar.TypeSymlink, Linkname: "hosts", Mode: 0777}},
+			{header: tar.Header{Name: "dev/null", Typeflag: tar.TypeChar, Mode: 0666, Devmajor: 1, Devminor: 3}},
+		},
+		{
+			regularEntry("etc/hosts", "127.0.0.1 localhost\n"),
+			hardLinkEntry("etc/hard", "etc/hosts"),
+		},
+	}
+	readImage := func(t *testing.T, options ...AdditionalMetadata) *Image {
+		t.Helper()
+		var v1Layers []v1.Layer
+		for _, entries := range layers {
+			v1Layers = append(v1Layers, newTestLayer(t, entries...))
+		}
+		v1Img, err := mutate.AppendLayers(empty.Image, v1Layers...)
+		require.NoError(t, err)
+
+		img := NewImage(v1Img, t.TempDir(), options...)
+		require.NoError(t, img.Read())
+		t.Cleanup(func() { _ = img.Cleanup() })
+		return img
+	}
+	sha := func(contents string) string {
+		return fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(contents)))
+	}
+
+	img := readImage(t, WithFileDigests(true))
+
+	tests := []struct {
+		path     file.Path
+		expected string
+	}{
+		{path: "/etc/hosts", expected: sha("127.0.0.1 localhost\n")},
+		{path: "/etc/empty", expected: sha("")},
+		// directories, links, and devices have no content digest
+		{path: "/etc"},
+		{path: "/etc/link"},
+		{path: "/etc/hard"},
+		{path: "/dev/null"},
+	}
+	for _, test := range tests {
+		t.Run(string(test.path), func(t *testing.T) {
+			digest, exists := img.SquashedTree().Digest(test.path)
+			assert.True(t, exists)
+			assert.Equal(t, test.expected, digest)
+
+			// note: links are not followed, so this is the metadata of the link itself
+			_, ref, err := img.SquashedTree().File(test.path)
+			require.NoError(t, err)
+			require.NotNil(t, ref)
+			entry, err := img.FileCatalog.Get(*ref)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, entry.Metadata.Digest)
+		})
+	}
+
+	// each layer tree has the digest of the contents within that layer
+	digest, _ := img.Layers[0].Tree.Digest("/etc/hosts")
+	assert.Equal(t, sha("stale"), digest)
+
+	// links resolve to the digest of what they link to
+	digest, _ = img.SquashedTree().Digest("/etc/link", filetree.FollowBasenameLinks)
+	assert.Equal(t, sha("127.0.0.1 localhost\n"), digest)
+
+	// digests are not computed by default, but do not change the squashed digest
+	plain := readImage(t)
+	digest, exists := plain.SquashedTree().Digest("/etc/hosts")
+	assert.True(t, exists)
+	assert.Empty(t, digest)
+
+	expected, err := plain.SquashedDigest()
+	require.NoError(t, err)
+	actual, err := img.SquashedDigest()
+	require.NoError(t, err)
+	assert.Equal(t, expected, actual)
+}
+
+func TestLayer_DigestFile_OpenError(t *testing.T) {
+	l := &Layer{Tree: filetree.NewFileTree(), fileDigests: true}
+	_, err := l.Tree.AddFile("/etc/hosts")
+	require.NoError(t, err)
+
+	// a file that cannot be opened must not be recorded with the digest of empty contents
+	metadata := file.Metadata{Path: "/etc/hosts"}
+	err = l.digestFile(&metadata, func() (io.ReadCloser, error) { return nil, fs.ErrNotExist })
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.Empty(t, metadata.Digest)
+
+	digest, exists := l.Tree.Digest("/etc/hosts")
+	assert.True(t, exists)
+	assert.Empty(t, digest)
+}
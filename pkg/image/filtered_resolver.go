@@ -0,0 +1,166 @@
+package image
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree"
+	"github.com/anchore/stereoscope/pkg/filetree/filenode"
+)
+
+// FilteredResolver is a read-only view of the squashed tree of an image that only contains the paths allowed by the
+// given include and exclude patterns (the same gitignore-style patterns as WithIncludedPaths and WithExcludedPaths,
+// with the same precedence). Excluded paths behave as if they did not exist: they cannot be resolved or read, and are
+// left out of glob and walk results. A path is also excluded when it resolves (through links) to an excluded path, so
+// links cannot be used to reach excluded files. Unlike the load-time path filters, the image is only read once and may
+// be viewed with any number of different filters.
+type FilteredResolver struct {
+	image  *Image
+	filter pathFilter
+}
+
+// NewFilteredResolver creates a view of the squashed tree of the given (read) image restricted to paths that match at
+// least one of the include patterns (or all paths when there are none), and none of the exclude patterns.
+func NewFilteredResolver(inner *Image, includeGlobs, excludeGlobs []string) (*FilteredResolver, error) {
+	include, err := compilePatterns(includeGlobs)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := compilePatterns(excludeGlobs)
+	if err != nil {
+		return nil, err
+	}
+	return &FilteredResolver{
+		image: inner,
+		filter: pathFilter{
+			include: include,
+			exclude: exclude,
+		},
+	}, nil
+}
+
+// allowed indicates if the given path is within the view. Directories are always allowed by the include patterns (so
+// that the paths within them can be reached), only exclude patterns apply to them.
+func (r *FilteredResolver) allowed(p file.Path, isDir bool) bool {
+	return !r.filter.skip(p.Normalize(), isDir)
+}
+
+// allowedRef indicates if the given path, and the real path that it resolves to, are within the view.
+func (r *FilteredResolver) allowedRef(p file.Path, ref *file.Reference, options ...filetree.LinkResolutionOption) bool {
+	ty, _ := r.image.SquashedTree().Type(p, options...)
+	if !r.allowed(p, ty == file.TypeDir) {
+		return false
+	}
+	if ref == nil || ref.RealPath == p.Normalize() {
+		return true
+	}
+	realType, _ := r.image.SquashedTree().Type(ref.RealPath)
+	return r.allowed(ref.RealPath, realType == file.TypeDir)
+}
+
+// Resolve returns the file reference for the given path within the filtered view of the squashed tree (links are
+// handled the same as Image.SquashedTree().File). Nil is returned if the path does not exist or is excluded.
+func (r *FilteredResolver) Resolve(path file.Path, options ...filetree.LinkResolutionOption) (*file.Reference, error) {
+	exists, ref, err := r.image.SquashedTree().File(path, options...)
+	if err != nil || !exists {
+		return nil, err
+	}
+	if !r.allowedRef(path, ref, options...) {
+		return nil, nil
+	}
+	return ref, nil
+}
+
+// HasPath indicates if the given path exists within the filtered view of the squashed tree.
+func (r *FilteredResolver) HasPath(path file.Path, options ...filetree.LinkResolutionOption) bool {
+	exists, ref, err := r.image.SquashedTree().File(path, options...)
+	if err != nil || !exists {
+		return false
+	}
+	return r.allowedRef(path, ref, options...)
+}
+
+// FilesByGlob returns the results of the glob query against the squashed tree (see FileTree.FilesByGlob), without
+// any excluded paths.
+func (r *FilteredResolver) FilesByGlob(query string, options ...filetree.LinkResolutionOption) ([]filetree.GlobResult, error) {
+	results, err := r.image.SquashedTree().FilesByGlob(query, options...)
+	if err != nil {
+		return nil, err
+	}
+	var filtered []filetree.GlobResult
+	for _, result := range results {
+		ref := result.Reference
+		if r.allowedRef(result.MatchPath, &ref, options...) {
+			filtered = append(filtered, result)
+		}
+	}
+	return filtered, nil
+}
+
+// AllFiles returns all files within the filtered view of the squashed tree (see FileTree.AllFiles).
+func (r *FilteredResolver) AllFiles(types ...file.Type) []file.Reference {
+	var filtered []file.Reference
+	for _, ref := range r.image.SquashedTree().AllFiles(types...) {
+		ref := ref
+		if r.allowedRef(ref.RealPath, &ref) {
+			filtered = append(filtered, ref)
+		}
+	}
+	return filtered
+}
+
+// WalkFrom walks the filtered view of the squashed tree from the given root (see FileTree.WalkFrom). Excluded paths
+// (including links that resolve to excluded paths) are not visited, and excluded directories are not descended into.
+func (r *FilteredResolver) WalkFrom(root file.Path, fn filetree.WalkFunc, options ...filetree.LinkResolutionOption) error {
+	return r.image.SquashedTree().WalkFrom(root, func(p file.Path, f filenode.FileNode) error {
+		isDir := f.FileType == file.TypeDir
+		if !r.allowed(p, isDir) {
+			if isDir {
+				return filetree.SkipDir
+			}
+			return nil
+		}
+		if f.FileType == file.TypeSymlink || f.FileType == file.TypeHardLink {
+			// note: dead links do not resolve to any path, so they are kept
+			_, ref, err := r.image.SquashedTree().File(p, filetree.FollowBasenameLinks)
+			if err != nil {
+				return err
+			}
+			if !r.allowedRef(p, ref) {
+				return nil
+			}
+		}
+		return fn(p, f)
+	}, options...)
+}
+
+// FileMetadata returns the file metadata for the given path within the filtered view of the squashed tree (see
+// Image.FileMetadataFromSquash). An error is returned if the path does not exist or is excluded.
+func (r *FilteredResolver) FileMetadata(path file.Path) (file.Metadata, error) {
+	ref, err := r.Resolve(path, filetree.FollowBasenameLinks)
+	if err != nil {
+		return file.Metadata{}, err
+	}
+	if ref == nil {
+		return file.Metadata{}, fmt.Errorf("could not find file path in Tree: %s", path)
+	}
+	entry, err := r.image.FileCatalog.Get(*ref)
+	if err != nil {
+		return file.Metadata{}, err
+	}
+	return entry.Metadata, nil
+}
+
+// FileContents reads the file contents for the given path within the filtered view of the squashed tree (see
+// Image.FileContentsFromSquash). An error is returned if the path does not exist or is excluded.
+func (r *FilteredResolver) FileContents(path file.Path) (io.ReadCloser, error) {
+	ref, err := r.Resolve(path, filetree.FollowBasenameLinks)
+	if err != nil {
+		return nil, err
+	}
+	if ref == nil {
+		return nil, fmt.Errorf("could not find file path in Tree: %s", path)
+	}
+	return r.image.FileCatalog.FileContents(*ref)
+}
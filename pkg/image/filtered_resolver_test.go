@@ -0,0 +1,103 @@
+package image
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree"
+	"github.com/anchore/stereoscope/pkg/filetree/filenode"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilteredResolver(t *testing.T) {
+	img := newTestImage(t,
+		[]testTarEntry{
+			regularEntry("etc/hosts", "127.0.0.1 localhost\n"),
+			regularEntry("etc/ssl/private/key.pem", "secret"),
+			regularEntry("usr/lib/libc.so", "libc"),
+			regularEntry("usr/share/doc/readme", "docs"),
+			{header: tar.Header{Name: "etc/key", Typeflag: tar.TypeSymlink, Linkname: "ssl/private/key.pem"}},
+		},
+	)
+
+	resolver, err := NewFilteredResolver(img, []string{"/etc", "/usr/lib"}, []string{"/etc/ssl/private"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		path    file.Path
+		allowed bool
+	}{
+		{path: "/etc/hosts", allowed: true},
+		{path: "/usr/lib/libc.so", allowed: true},
+		// directories are always allowed by the include patterns
+		{path: "/usr", allowed: true},
+		// not included
+		{path: "/usr/share/doc/readme", allowed: false},
+		// excluded (along with everything beneath)
+		{path: "/etc/ssl/private", allowed: false},
+		{path: "/etc/ssl/private/key.pem", allowed: false},
+		// links cannot reach excluded paths
+		{path: "/etc/key", allowed: false},
+		{path: "/does/not/exist", allowed: false},
+	}
+	for _, test := range tests {
+		t.Run(string(test.path), func(t *testing.T) {
+			assert.Equal(t, test.allowed, resolver.HasPath(test.path, filetree.FollowBasenameLinks))
+
+			ref, err := resolver.Resolve(test.path, filetree.FollowBasenameLinks)
+			require.NoError(t, err)
+			_, metadataErr := resolver.FileMetadata(test.path)
+			if !test.allowed {
+				assert.Nil(t, ref)
+				assert.Error(t, metadataErr)
+				return
+			}
+			if test.path != "/usr" {
+				assert.NotNil(t, ref)
+				assert.NoError(t, metadataErr)
+			}
+		})
+	}
+
+	reader, err := resolver.FileContents("/etc/hosts")
+	require.NoError(t, err)
+	contents, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1 localhost\n", string(contents))
+
+	_, err = resolver.FileContents("/etc/ssl/private/key.pem")
+	assert.Error(t, err)
+
+	results, err := resolver.FilesByGlob("**/*", filetree.FollowBasenameLinks)
+	require.NoError(t, err)
+	var matched []string
+	for _, r := range results {
+		matched = append(matched, string(r.MatchPath))
+	}
+	assert.Contains(t, matched, "/etc/hosts")
+	assert.Contains(t, matched, "/usr/lib/libc.so")
+	assert.NotContains(t, matched, "/etc/ssl/private/key.pem")
+	assert.NotContains(t, matched, "/etc/key")
+	assert.NotContains(t, matched, "/usr/share/doc/readme")
+
+	assert.ElementsMatch(t, []file.Path{"/etc/hosts", "/usr/lib/libc.so"}, realPaths(resolver.AllFiles()))
+
+	var walked []string
+	require.NoError(t, resolver.WalkFrom("/", func(p file.Path, _ filenode.FileNode) error {
+		walked = append(walked, string(p))
+		return nil
+	}))
+	assert.Equal(t, []string{"/", "/etc", "/etc/hosts", "/etc/ssl", "/usr", "/usr/lib", "/usr/lib/libc.so", "/usr/share", "/usr/share/doc"}, walked)
+
+	// the image itself is not affected
+	assert.True(t, img.SquashedTree().HasPath("/etc/ssl/private/key.pem"))
+}
+
+func TestNewFilteredResolver_InvalidPattern(t *testing.T) {
+	img := newTestImage(t, []testTarEntry{regularEntry("etc/hosts", "")})
+	_, err := NewFilteredResolver(img, []string{"["}, nil)
+	assert.Error(t, err)
+}
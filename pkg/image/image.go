@@ -1,10 +1,14 @@
 package image
 
 import (
+	"bytes"
+	"context"
 	"crypto/sha256"
 	"fmt"
 	"io"
 	"os"
+	"runtime"
+	"sync"
 
 	"github.com/scylladb/go-set/strset"
 
@@ -33,6 +37,37 @@ type Image struct {
 	FileCatalog FileCatalog
 
 	overrideMetadata []AdditionalMetadata
+	// readConcurrency is the maximum number of layers that are read at the same time (defaults to GOMAXPROCS)
+	readConcurrency int
+	// spillThreshold is the size in bytes above which OpenPathSeekable spills contents to a temp file
+	spillThreshold int64
+	// maxUncompressedSize is the maximum number of bytes decompressed across all layers (0 = unlimited)
+	maxUncompressedSize int64
+	// maxFileSize is the maximum size of any single file within the image (0 = unlimited)
+	maxFileSize int64
+	// maxPathDepth is the maximum number of components of any path within the image (0 = unlimited)
+	maxPathDepth int
+	// fileDigests computes the content digest of every regular file while indexing (see WithFileDigests)
+	fileDigests bool
+	// pathFilter decides which layer entries are indexed
+	pathFilter pathFilter
+	// cleaner tracks all temp paths (and other resources) to release on Cleanup
+	cleaner *imageCleaner
+	// cleanerLock guards creating the cleaner for images that were not created with NewImage (see AddCleanup, which is
+	// invoked concurrently while reading layers)
+	cleanerLock sync.Mutex
+	// squashReport is the audit log recorded while squashing the layers
+	squashReport []SquashEvent
+	// layerCache persists layers across images (optional, see WithLayerCache)
+	layerCache *layerCache
+	// verifyDigests checks every layer read against the manifest digest and diff ID (see WithDigestVerification)
+	verifyDigests bool
+	// memoryMapLayers reads file contents from memory mapped layer tars (see WithMemoryMappedLayers)
+	memoryMapLayers bool
+	// estargzLayers indexes eStargz layers from their table of contents (see WithEStargzLayers)
+	estargzLayers bool
+	// layerIndexes persists layer tar indexes to read layers lazily (optional, see WithLazyLayers)
+	layerIndexes *layerIndexStore
 }
 
 type AdditionalMetadata func(*Image) error
@@ -61,6 +96,10 @@ func WithManifest(manifest []byte) AdditionalMetadata {
 	return func(image *Image) error {
 		image.Metadata.RawManifest = manifest
 		image.Metadata.ManifestDigest = fmt.Sprintf("sha256:%x", sha256.Sum256(manifest))
+		// the annotations should be from the same manifest that is being reported
+		if parsed, err := v1.ParseManifest(bytes.NewReader(manifest)); err == nil {
+			image.Metadata.Annotations = parsed.Annotations
+		}
 		return nil
 	}
 }
@@ -127,6 +166,42 @@ func WithOS(o string) AdditionalMetadata {
 	}
 }
 
+// WithReadConcurrency sets the maximum number of layers that are read (decompressed and indexed) at the same time when
+// the image is read. Each layer being read holds a decompression stream open, so this also bounds the memory used while
+// reading. By default GOMAXPROCS layers are read at a time, a value of 1 reads layers serially.
+func WithReadConcurrency(workers int) AdditionalMetadata {
+	return func(image *Image) error {
+		if workers < 0 {
+			return fmt.Errorf("invalid read concurrency: %d", workers)
+		}
+		image.readConcurrency = workers
+		return nil
+	}
+}
+
+// WithContentSpillThreshold sets the size in bytes above which contents opened with OpenPathSeekable that cannot be
+// seeked directly are spilled to a temp file instead of being held in memory (by default file.DefaultSpillThreshold).
+func WithContentSpillThreshold(threshold int64) AdditionalMetadata {
+	return func(image *Image) error {
+		if threshold < 0 {
+			return fmt.Errorf("invalid content spill threshold: %d", threshold)
+		}
+		image.spillThreshold = threshold
+		return nil
+	}
+}
+
+// WithMemoryMappedLayers memory maps every uncompressed layer tar once the layer has been decompressed, so that the
+// contents of any file are read directly from memory (by offset) instead of opening and seeking within the tar on disk.
+// This speeds up random access to many files within large images. Layers are unmapped on Cleanup. On platforms that do
+// not support memory mapping (or if mapping fails) the contents are read from disk as usual.
+func WithMemoryMappedLayers(enabled bool) AdditionalMetadata {
+	return func(image *Image) error {
+		image.memoryMapLayers = enabled
+		return nil
+	}
+}
+
 // NewImage provides a new, unread image object.
 func NewImage(image v1.Image, contentCacheDir string, additionalMetadata ...AdditionalMetadata) *Image {
 	imgObj := &Image{
@@ -134,10 +209,26 @@ func NewImage(image v1.Image, contentCacheDir string, additionalMetadata ...Addi
 		contentCacheDir:  contentCacheDir,
 		FileCatalog:      NewFileCatalog(),
 		overrideMetadata: additionalMetadata,
+		spillThreshold:   file.DefaultSpillThreshold,
+		maxPathDepth:     DefaultMaxPathDepth,
+		cleaner:          newImageCleaner(contentCacheDir),
 	}
 	return imgObj
 }
 
+// AddCleanup registers a function that releases a resource created for the image (e.g. removing temp dirs that were
+// created while providing the image), which is invoked by Cleanup.
+func (i *Image) AddCleanup(fn func() error) {
+	i.cleanerLock.Lock()
+	if i.cleaner == nil {
+		i.cleaner = newImageCleaner(i.contentCacheDir)
+	}
+	cleaner := i.cleaner
+	i.cleanerLock.Unlock()
+
+	cleaner.add(fn)
+}
+
 func (i *Image) IDs() []string {
 	var ids = make([]string, len(i.Metadata.Tags))
 	for idx, t := range i.Metadata.Tags {
@@ -147,6 +238,43 @@ func (i *Image) IDs() []string {
 	return ids
 }
 
+// RawManifest returns the image manifest bytes exactly as provided by the image source (e.g. as fetched from the
+// registry), without being parsed and serialized again, so that the manifest digest can be recomputed (e.g. for
+// signature verification). Note: for sources without a manifest (e.g. docker archives without an OCI manifest) the
+// manifest is generated from the image. Nil is returned if the manifest is not available.
+func (i *Image) RawManifest() []byte {
+	if i.Metadata.RawManifest != nil {
+		return i.Metadata.RawManifest
+	}
+	if i.image == nil {
+		return nil
+	}
+	manifest, err := i.image.RawManifest()
+	if err != nil {
+		log.Debugf("unable to get raw manifest: %+v", err)
+		return nil
+	}
+	return manifest
+}
+
+// RawConfig returns the image config bytes exactly as provided by the image source, without being parsed and
+// serialized again, so that the config digest (the image ID) can be recomputed. Nil is returned if the config is not
+// available.
+func (i *Image) RawConfig() []byte {
+	if i.Metadata.RawConfig != nil {
+		return i.Metadata.RawConfig
+	}
+	if i.image == nil {
+		return nil
+	}
+	config, err := i.image.RawConfigFile()
+	if err != nil {
+		log.Debugf("unable to get raw config: %+v", err)
+		return nil
+	}
+	return config
+}
+
 func (i *Image) trackReadProgress(metadata Metadata) *progress.Manual {
 	prog := &progress.Manual{
 		// x2 for read and squash of each layer
@@ -174,7 +302,21 @@ func (i *Image) applyOverrideMetadata() error {
 // Read parses information from the underlying image tar into this struct. This includes image metadata, layer
 // metadata, layer file trees, and layer squash trees (which implies the image squash tree).
 func (i *Image) Read() error {
-	var layers = make([]*Layer, 0)
+	return i.ReadWithContext(context.Background())
+}
+
+// ReadWithContext is like Read, however, reading stops (including any layer download, decompression, indexing, and
+// squashing) once the given context is done, in which case the context error is returned. Any partially written layer
+// cache is removed, however, the image should still be cleaned up.
+func (i *Image) ReadWithContext(ctx context.Context) error {
+	err := i.read(ctx)
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+func (i *Image) read(ctx context.Context) error {
 	var err error
 	i.Metadata, err = readImageMetadata(i.image)
 	if err != nil {
@@ -199,33 +341,136 @@ func (i *Image) Read() error {
 	// let consumers know of a monitorable event (image save + copy stages)
 	readProg := i.trackReadProgress(i.Metadata)
 
-	for idx, v1Layer := range v1Layers {
-		layer := NewLayer(v1Layer)
-		err := layer.Read(&i.FileCatalog, i.Metadata, idx, i.contentCacheDir)
-		if err != nil {
-			return err
-		}
+	layers, err := i.readLayers(ctx, v1Layers, readProg)
+	if err != nil {
+		return err
+	}
+	for _, layer := range layers {
 		i.Metadata.Size += layer.Metadata.Size
-		layers = append(layers, layer)
-
-		readProg.N++
 	}
 
 	i.Layers = layers
 
 	// in order to resolve symlinks all squashed trees must be available
-	return i.squash(readProg)
+	return i.squash(ctx, readProg)
+}
+
+// readLayers reads all layers using a pool of workers (since each layer is read independently of the others), returning
+// the layers in the same order as given. If any layer cannot be read then no more layers are started and the error
+// for the lowest failing layer is returned.
+func (i *Image) readLayers(ctx context.Context, v1Layers []v1.Layer, prog *progress.Manual) ([]*Layer, error) {
+	workers := i.readConcurrency
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(v1Layers) {
+		workers = len(v1Layers)
+	}
+
+	layers := make([]*Layer, len(v1Layers))
+	errs := make([]error, len(v1Layers))
+	indexes := make(chan int)
+	done := make(chan int)
+	stop := make(chan struct{})
+
+	// note: the limits are tracked across all layers
+	limiter := newSizeLimiter(i.maxUncompressedSize, i.maxFileSize)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range indexes {
+				layer := NewLayer(v1Layers[idx])
+				layer.limiter = limiter
+				layer.maxPathDepth = i.maxPathDepth
+				layer.fileDigests = i.fileDigests
+				layer.pathFilter = i.pathFilter
+				layer.cache = i.layerCache
+				layer.verifyDigests = i.verifyDigests
+				layer.memoryMap = i.memoryMapLayers
+				layer.estargz = i.estargzLayers
+				layer.indexes = i.layerIndexes
+				errs[idx] = layer.read(ctx, &i.FileCatalog, i.Metadata, idx, i.contentCacheDir)
+				if release := layer.releaseCache; release != nil {
+					i.AddCleanup(func() error {
+						release()
+						return nil
+					})
+				}
+				if layer.mapped != nil {
+					i.AddCleanup(layer.mapped.Close)
+				}
+				if layer.squashfsFile != nil {
+					i.AddCleanup(layer.squashfsFile.Close)
+				}
+				layers[idx] = layer
+				done <- idx
+			}
+		}()
+	}
+
+	go func() {
+		defer close(indexes)
+		for idx := range v1Layers {
+			select {
+			case indexes <- idx:
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	// note: progress is only updated from this goroutine
+	var failed bool
+	for idx := range done {
+		if errs[idx] != nil {
+			if !failed {
+				failed = true
+				close(stop)
+			}
+			continue
+		}
+		prog.N++
+	}
+
+	if err := ctx.Err(); err != nil {
+		// note: not all layers may have been started
+		return nil, err
+	}
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return layers, nil
 }
 
 // squash generates a squash tree for each layer in the image. For instance, layer 2 squash =
 // squash(layer 0, layer 1, layer 2), layer 3 squash = squash(layer 0, layer 1, layer 2, layer 3), and so on.
-func (i *Image) squash(prog *progress.Manual) error {
+func (i *Image) squash(ctx context.Context, prog *progress.Manual) error {
 	var lastSquashTree *filetree.FileTree
+	recorder := newSquashRecorder()
 
 	for idx, layer := range i.Layers {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := recorder.record(idx, layer.Tree, lastSquashTree); err != nil {
+			return fmt.Errorf("failed to record squash of tree %d: %w", idx, err)
+		}
 		if idx == 0 {
 			lastSquashTree = layer.Tree
 			layer.SquashedTree = layer.Tree
+			prog.N++
 			continue
 		}
 
@@ -244,12 +489,14 @@ func (i *Image) squash(prog *progress.Manual) error {
 		prog.N++
 	}
 
+	i.squashReport = recorder.events
 	prog.SetCompleted()
 
 	return nil
 }
 
-// SquashedTree returns the pre-computed image squash file tree.
+// SquashedTree returns the pre-computed image squash file tree. The squash is computed once when the image is read
+// and the same instance is returned on every call (until Cleanup is called, after which an empty tree is returned).
 func (i *Image) SquashedTree() *filetree.FileTree {
 	layerCount := len(i.Layers)
 
@@ -258,16 +505,68 @@ func (i *Image) SquashedTree() *filetree.FileTree {
 	}
 
 	topLayer := i.Layers[layerCount-1]
+	if topLayer.SquashedTree == nil {
+		return filetree.NewFileTree()
+	}
 	return topLayer.SquashedTree
 }
 
+// SquashedTreeAt returns the squash of layers 0 through n (inclusive), which is the filesystem as it existed once layer
+// n was applied, with the whiteouts of every layer up to n applied cumulatively. The squash of every layer is computed
+// incrementally (from the squash of the layer below) once when the image is read, so this does not squash again and
+// the same instance is returned on every call (see Layer.SquashedTree). An error is returned if there is no layer n
+// (or after Cleanup is called). The returned tree must not be mutated.
+func (i *Image) SquashedTreeAt(n int) (*filetree.FileTree, error) {
+	layer := i.Layer(n)
+	if layer == nil {
+		return nil, fmt.Errorf("no layer at index=%d (the image has %d layers)", n, len(i.Layers))
+	}
+	if layer.SquashedTree == nil {
+		return nil, fmt.Errorf("layer at index=%d has not been squashed", n)
+	}
+	return layer.SquashedTree, nil
+}
+
+// ResolveLinkChain returns every path traversed while resolving the links of the given path within the squashed tree,
+// ending with the real path that the resolution ended at (see filetree.FileTree.ResolveLinkChain).
+func (i *Image) ResolveLinkChain(path file.Path) ([]file.Path, error) {
+	return i.SquashedTree().ResolveLinkChain(path)
+}
+
 // FileContentsFromSquash fetches file contents for a single path, relative to the image squash tree.
 // If the path does not exist an error is returned.
 func (i *Image) FileContentsFromSquash(path file.Path) (io.ReadCloser, error) {
 	return fetchFileContentsByPath(i.SquashedTree(), &i.FileCatalog, path)
 }
 
-// FilesByMIMETypeFromSquash returns file references for files that match at least one of the given MIME types.
+// FileMetadataFromSquash returns the file metadata (ownership, permissions, modification time, xattrs, etc.) for a
+// single path, relative to the image squash tree. If the path does not exist an error is returned.
+func (i *Image) FileMetadataFromSquash(path file.Path) (file.Metadata, error) {
+	return fetchFileMetadataByPath(i.SquashedTree(), &i.FileCatalog, path)
+}
+
+// OpenPath is an alias of FileContentsFromSquash. The contents are read from the topmost layer that provides the path
+// (honoring whiteouts in higher layers) by seeking directly to the entry within the already-indexed layer tar, so no
+// layer is extracted to disk and the full file is never buffered in memory.
+func (i *Image) OpenPath(path file.Path) (io.ReadCloser, error) {
+	return i.FileContentsFromSquash(path)
+}
+
+// OpenPathSeekable is like OpenPath, but provides seekable contents. Most contents are seeked directly within the
+// indexed layer tar, however, contents that cannot be (e.g. sparse files or files within squashfs layers) are held in
+// memory, or spilled to a temp file when larger than the spill threshold (see WithContentSpillThreshold). Temp files
+// are removed when the reader is closed (or when the image is cleaned up).
+func (i *Image) OpenPathSeekable(path file.Path) (io.ReadSeekCloser, error) {
+	reader, err := i.OpenPath(path)
+	if err != nil {
+		return nil, err
+	}
+	return file.NewSeekableReader(reader, i.spillThreshold, i.contentCacheDir)
+}
+
+// FilesByMIMETypeFromSquash returns file references for files that match at least one of the given MIME types (see
+// file.MIMEType for the detected types). The MIME type of each file is detected once from the leading file contents when
+// the layer is indexed and is held in the file catalog, so no file contents are read by this query.
 func (i *Image) FilesByMIMETypeFromSquash(mimeTypes ...string) ([]file.Reference, error) {
 	var refs []file.Reference
 	for _, ty := range mimeTypes {
@@ -286,6 +585,15 @@ func (i *Image) FileContentsByRef(ref file.Reference) (io.ReadCloser, error) {
 	return i.FileCatalog.FileContents(ref)
 }
 
+// Layer returns the layer at the given index (where 0 is the lowest layer), or nil if there is no such layer. The
+// layer tree (Layer.Tree) holds the individual layer contents before being squashed with any other layers.
+func (i *Image) Layer(idx int) *Layer {
+	if idx < 0 || idx >= len(i.Layers) {
+		return nil
+	}
+	return i.Layers[idx]
+}
+
 // ResolveLinkByLayerSquash resolves a symlink or hardlink for the given file reference relative to the result from
 // the layer squash of the given layer index argument.
 // If the given file reference is not a link type, or is a unresolvable (dead) link, then the given file reference is returned.
@@ -303,15 +611,32 @@ func (i *Image) ResolveLinkByImageSquash(ref file.Reference, options ...filetree
 	return resolvedRef, err
 }
 
-// Cleanup removes all temporary files created from parsing the image. Future calls to image will not function correctly after this call.
+// Cleanup removes all temporary files created from parsing the image (and any resources registered with AddCleanup).
+// All removals are attempted even if some fail, in which case the aggregated error is returned. It is safe to call
+// Cleanup more than once (anything that failed to be removed is retried). Cleanup is also invoked when the image is
+// garbage collected, however, this is only a safety net and Cleanup should always be called explicitly. Future calls
+// to image will not function correctly after this call.
 func (i *Image) Cleanup() error {
 	if i == nil {
 		return nil
 	}
-	if i.contentCacheDir != "" {
-		if err := os.RemoveAll(i.contentCacheDir); err != nil {
-			return err
+	// release the (potentially large) per-layer and cached squash trees
+	for _, layer := range i.Layers {
+		if layer == nil {
+			continue
 		}
+		layer.Tree = nil
+		layer.SquashedTree = nil
 	}
-	return nil
+	i.cleanerLock.Lock()
+	cleaner := i.cleaner
+	i.cleanerLock.Unlock()
+	if cleaner == nil {
+		// the image was not created with NewImage
+		if i.contentCacheDir != "" {
+			return os.RemoveAll(i.contentCacheDir)
+		}
+		return nil
+	}
+	return cleaner.cleanup()
 }
@@ -0,0 +1,71 @@
+package image
+
+import (
+	"os"
+	"runtime"
+	"sync"
+
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/anchore/stereoscope/internal/log"
+)
+
+// imageCleaner tracks everything that must be removed when an image is cleaned up. Note: this is separate from the
+// Image so that the finalizer safety net is not attached to the image itself, since images and layers reference each
+// other and cyclic structures with a finalizer are never garbage collected. Since anything read from an image (layers,
+// catalog entries) refers back to the image, the cleaner is only unreachable once the image is.
+type imageCleaner struct {
+	lock  sync.Mutex
+	paths []string
+	funcs []func() error
+}
+
+func newImageCleaner(paths ...string) *imageCleaner {
+	c := &imageCleaner{}
+	for _, p := range paths {
+		if p != "" {
+			c.paths = append(c.paths, p)
+		}
+	}
+	runtime.SetFinalizer(c, func(c *imageCleaner) {
+		if err := c.cleanup(); err != nil {
+			log.Warnf("unable to cleanup image temp files: %+v", err)
+		}
+	})
+	return c
+}
+
+func (c *imageCleaner) add(fn func() error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.funcs = append(c.funcs, fn)
+}
+
+// cleanup invokes all cleanup functions and then removes all tracked paths, keeping only those that failed (to be retried).
+func (c *imageCleaner) cleanup() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var allErrs error
+
+	// note: the functions run first since they may release resources within the paths (e.g. open files)
+	var failedFuncs []func() error
+	for _, fn := range c.funcs {
+		if err := fn(); err != nil {
+			allErrs = multierror.Append(allErrs, err)
+			failedFuncs = append(failedFuncs, fn)
+		}
+	}
+	c.funcs = failedFuncs
+
+	var failedPaths []string
+	for _, p := range c.paths {
+		if err := os.RemoveAll(p); err != nil {
+			allErrs = multierror.Append(allErrs, err)
+			failedPaths = append(failedPaths, p)
+		}
+	}
+	c.paths = failedPaths
+
+	return allErrs
+}
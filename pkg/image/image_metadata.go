@@ -23,6 +23,10 @@ type Metadata struct {
 	Architecture   string
 	Variant        string
 	OS             string
+	// Labels are the image labels from the image config (e.g. set with the LABEL Dockerfile instruction)
+	Labels map[string]string
+	// Annotations are the manifest level annotations (e.g. "org.opencontainers.image.source"), if a manifest is available
+	Annotations map[string]string
 }
 
 // readImageMetadata extracts the most pertinent information from the underlying image tar.
@@ -48,9 +52,21 @@ func readImageMetadata(img v1.Image) (Metadata, error) {
 	}
 
 	return Metadata{
-		ID:        id.String(),
-		Config:    *config,
-		MediaType: mediaType,
-		RawConfig: rawConfig,
+		ID:          id.String(),
+		Config:      *config,
+		MediaType:   mediaType,
+		RawConfig:   rawConfig,
+		Labels:      config.Config.Labels,
+		Annotations: manifestAnnotations(img),
 	}, nil
 }
+
+// manifestAnnotations makes a best-effort attempt at getting the manifest annotations (not all image sources have a
+// manifest, for instance a docker archive without an OCI manifest).
+func manifestAnnotations(img v1.Image) map[string]string {
+	manifest, err := img.Manifest()
+	if err != nil || manifest == nil {
+		return nil
+	}
+	return manifest.Annotations
+}
@@ -1,16 +1,92 @@
 package image
 
 import (
+	"archive/tar"
+	"bytes"
+	"context"
 	"crypto/sha256"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree"
 	"github.com/go-test/deep"
 	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wagoodman/go-progress"
 )
 
+// testTarEntry is a single entry within an in-memory test layer.
+type testTarEntry struct {
+	header tar.Header
+	body   string
+}
+
+func hardLinkEntry(name, target string) testTarEntry {
+	return testTarEntry{header: tar.Header{Name: name, Typeflag: tar.TypeLink, Linkname: target, Mode: 0644}}
+}
+
+func regularEntry(name, body string) testTarEntry {
+	return testTarEntry{header: tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(body))}, body: body}
+}
+
+// newTestLayer creates an in-memory layer from the given tar entries.
+func newTestLayer(t *testing.T, entries ...testTarEntry) v1.Layer {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, e := range entries {
+		hdr := e.header
+		require.NoError(t, tw.WriteHeader(&hdr))
+		if e.body != "" {
+			_, err := tw.Write([]byte(e.body))
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, tw.Close())
+	content := buf.Bytes()
+
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(content)), nil
+	})
+	require.NoError(t, err)
+	return layer
+}
+
+// newTestImage creates and reads an in-memory image made of one layer per given set of tar entries.
+func newTestImage(t *testing.T, layers ...[]testTarEntry) *Image {
+	t.Helper()
+	var v1Layers []v1.Layer
+	for _, entries := range layers {
+		v1Layers = append(v1Layers, newTestLayer(t, entries...))
+	}
+	img, err := mutate.AppendLayers(empty.Image, v1Layers...)
+	require.NoError(t, err)
+
+	result := NewImage(img, t.TempDir())
+	require.NoError(t, result.Read())
+	t.Cleanup(func() {
+		_ = result.Cleanup()
+	})
+	return result
+}
+
 func TestImageAdditionalMetadata(t *testing.T) {
 	theTag, err := name.NewTag("a/tag:latest")
 	if err != nil {
@@ -131,3 +207,995 @@ func TestImage_SquashedTree(t *testing.T) {
 		}
 	})
 }
+
+func TestImage_OpenPath(t *testing.T) {
+	img := newTestImage(t,
+		[]testTarEntry{
+			regularEntry("etc/config", "lower config"),
+			regularEntry("etc/removed", "removed"),
+			regularEntry("etc/recreated", "original"),
+		},
+		[]testTarEntry{
+			regularEntry("etc/.wh.removed", ""),
+			regularEntry("etc/.wh.recreated", ""),
+		},
+		[]testTarEntry{
+			regularEntry("etc/recreated", "recreated"),
+		},
+	)
+
+	tests := []struct {
+		path     string
+		expected string
+		wantErr  bool
+	}{
+		{path: "/etc/config", expected: "lower config"},
+		{path: "/etc/recreated", expected: "recreated"},
+		{path: "/etc/removed", wantErr: true},
+		{path: "/etc", wantErr: true},
+		{path: "/missing", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			reader, err := img.OpenPath(file.Path(test.path))
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			defer reader.Close()
+
+			contents, err := ioutil.ReadAll(reader)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, string(contents))
+		})
+	}
+}
+
+func TestImage_SquashedTree_Cached(t *testing.T) {
+	img := newTestImage(t,
+		[]testTarEntry{regularEntry("a.txt", "a")},
+		[]testTarEntry{regularEntry("b.txt", "b")},
+	)
+
+	first := img.SquashedTree()
+	assert.True(t, first.HasPath("/a.txt"))
+	assert.True(t, first.HasPath("/b.txt"))
+	assert.Same(t, first, img.SquashedTree())
+
+	require.NoError(t, img.Cleanup())
+	for _, l := range img.Layers {
+		assert.Nil(t, l.Tree)
+		assert.Nil(t, l.SquashedTree)
+	}
+	assert.NotSame(t, first, img.SquashedTree())
+	assert.False(t, img.SquashedTree().HasPath("/a.txt"))
+}
+
+// newLayeredTestImage creates an image with the given number of layers (with only file trees, no content) where each
+// layer adds new files and overwrites files from the layer below.
+func newLayeredTestImage(b *testing.B, layerCount, filesPerLayer int) *Image {
+	b.Helper()
+	img := &Image{}
+	for l := 0; l < layerCount; l++ {
+		tr := filetree.NewFileTree()
+		for f := 0; f < filesPerLayer; f++ {
+			if _, err := tr.AddFile(file.Path(fmt.Sprintf("/layer-%d/dir-%d/file.txt", l, f))); err != nil {
+				b.Fatal(err)
+			}
+			if _, err := tr.AddFile(file.Path(fmt.Sprintf("/shared/dir-%d/file.txt", f))); err != nil {
+				b.Fatal(err)
+			}
+		}
+		img.Layers = append(img.Layers, &Layer{Tree: tr})
+	}
+	if err := img.squash(context.Background(), &progress.Manual{}); err != nil {
+		b.Fatal(err)
+	}
+	return img
+}
+
+func BenchmarkImage_SquashedTree(b *testing.B) {
+	img := newLayeredTestImage(b, 50, 100)
+
+	b.Run("cached", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			_ = img.SquashedTree()
+		}
+	})
+
+	b.Run("recomputed", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			if err := img.squash(context.Background(), &progress.Manual{}); err != nil {
+				b.Fatal(err)
+			}
+			_ = img.SquashedTree()
+		}
+	})
+}
+
+func TestImage_HardLinks(t *testing.T) {
+	img := newTestImage(t,
+		[]testTarEntry{
+			regularEntry("usr/bin/busybox", "busybox contents"),
+			hardLinkEntry("bin/sh", "usr/bin/busybox"),
+			hardLinkEntry("bin/ls", "usr/bin/busybox"),
+			hardLinkEntry("usr/bin/cat", "usr/bin/busybox"),
+			regularEntry("etc/data", "data contents"),
+			hardLinkEntry("etc/data-link", "etc/data"),
+		},
+		[]testTarEntry{
+			regularEntry("etc/.wh.data", ""),
+		},
+	)
+
+	lower := img.Layers[0].SquashedTree
+	assert.Equal(t, []file.Path{"/bin/ls", "/bin/sh", "/usr/bin/cat"}, lower.HardLinks("/usr/bin/busybox"))
+
+	for _, p := range []file.Path{"/bin/sh", "/bin/ls", "/usr/bin/cat"} {
+		reader, err := img.OpenPath(p)
+		require.NoError(t, err)
+		contents, err := ioutil.ReadAll(reader)
+		require.NoError(t, err)
+		require.NoError(t, reader.Close())
+		assert.Equal(t, "busybox contents", string(contents))
+	}
+
+	squashed := img.SquashedTree()
+	assert.False(t, squashed.HasPath("/etc/data"))
+	assert.False(t, squashed.HasPath("/etc/data-link"))
+	assert.True(t, lower.HasPath("/etc/data-link"))
+}
+
+func TestImage_SquashedTreeAt(t *testing.T) {
+	img := newTestImage(t,
+		[]testTarEntry{
+			regularEntry("etc/hosts", "hosts"),
+			regularEntry("etc/passwd", "passwd"),
+			regularEntry("var/cache/a", "a"),
+		},
+		[]testTarEntry{
+			regularEntry("etc/.wh.hosts", ""),
+			regularEntry("var/cache/.wh..wh..opq", ""),
+			regularEntry("var/cache/b", "b"),
+		},
+		[]testTarEntry{
+			regularEntry("etc/hosts", "hosts again"),
+			regularEntry("var/cache/.wh.b", ""),
+		},
+	)
+
+	expected := [][]file.Path{
+		{"/etc/hosts", "/etc/passwd", "/var/cache/a"},
+		{"/etc/passwd", "/var/cache/b"},
+		{"/etc/hosts", "/etc/passwd"},
+	}
+	for n, paths := range expected {
+		tree, err := img.SquashedTreeAt(n)
+		require.NoError(t, err)
+		assert.Equal(t, paths, realPaths(tree.AllFiles()), "layer %d", n)
+	}
+
+	// the top prefix is the image squash
+	top, err := img.SquashedTreeAt(2)
+	require.NoError(t, err)
+	assert.Same(t, img.SquashedTree(), top)
+
+	for _, n := range []int{-1, 3} {
+		_, err := img.SquashedTreeAt(n)
+		assert.Error(t, err)
+	}
+}
+
+func TestImage_SquashedTree_FileDirTransitions(t *testing.T) {
+	img := newTestImage(t,
+		[]testTarEntry{
+			regularEntry("foo", "file"),
+			regularEntry("baz", "file"),
+			regularEntry("dir/child", "child"),
+			regularEntry("dir/sub/deep", "deep"),
+			{header: tar.Header{Name: "links/child", Typeflag: tar.TypeLink, Linkname: "dir/child"}},
+		},
+		[]testTarEntry{
+			// file -> directory, implied by a path within it
+			regularEntry("foo/bar", "bar"),
+			// file -> directory, from a directory entry
+			{header: tar.Header{Name: "baz/", Typeflag: tar.TypeDir, Mode: 0755}},
+			// directory -> file
+			regularEntry("dir", "now a file"),
+		},
+	)
+
+	tests := []struct {
+		path     file.Path
+		fileType file.Type
+		exists   bool
+	}{
+		{path: "/foo", fileType: file.TypeDir, exists: true},
+		{path: "/foo/bar", fileType: file.TypeReg, exists: true},
+		{path: "/baz", fileType: file.TypeDir, exists: true},
+		{path: "/dir", fileType: file.TypeReg, exists: true},
+		{path: "/dir/child"},
+		{path: "/dir/sub/deep"},
+		{path: "/links/child"},
+	}
+	for _, test := range tests {
+		t.Run(string(test.path), func(t *testing.T) {
+			ty, exists := img.SquashedTree().Type(test.path)
+			require.Equal(t, test.exists, exists)
+			if exists {
+				assert.Equal(t, test.fileType, ty)
+			}
+		})
+	}
+
+	metadata, err := img.FileMetadataFromSquash("/baz")
+	require.NoError(t, err)
+	assert.True(t, metadata.IsDir)
+
+	reader, err := img.FileContentsFromSquash("/dir")
+	require.NoError(t, err)
+	contents, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "now a file", string(contents))
+}
+
+func TestImage_SquashedTree_MixedPathEncodings(t *testing.T) {
+	img := newTestImage(t,
+		[]testTarEntry{
+			regularEntry("./etc/passwd", "root:x:0:0"),
+			regularEntry("usr/bin/tool", "tool"),
+			regularEntry("/opt/app/config", "old config"),
+			hardLinkEntry("./bin/tool", "/usr/bin/tool"),
+		},
+		[]testTarEntry{
+			regularEntry("etc/passwd", "root:x:0:0\nuser:x:1000:1000"),
+			regularEntry("./usr/bin/.wh.tool", ""),
+			regularEntry("opt/app/config", "new config"),
+			// a later entry for the same path in a different encoding still overrides it within the layer
+			regularEntry("/opt/app/config", "newest config"),
+		},
+	)
+
+	squashed := img.SquashedTree()
+	assert.ElementsMatch(t, []file.Path{"/etc/passwd", "/opt/app/config"}, realPaths(squashed.AllFiles(file.AllTypes...)))
+	assert.False(t, squashed.HasPath("/usr/bin/tool"))
+	// the hardlink is to the whited out path
+	assert.True(t, img.Layers[0].Tree.HasPath("/bin/tool"))
+	assert.False(t, squashed.HasPath("/bin/tool"))
+
+	for p, expected := range map[file.Path]string{
+		"/etc/passwd":     "root:x:0:0\nuser:x:1000:1000",
+		"/opt/app/config": "newest config",
+	} {
+		reader, err := img.OpenPath(p)
+		require.NoError(t, err)
+		contents, err := ioutil.ReadAll(reader)
+		require.NoError(t, err)
+		require.NoError(t, reader.Close())
+		assert.Equal(t, expected, string(contents), "path=%q", p)
+
+		metadata, err := img.FileMetadataFromSquash(p)
+		require.NoError(t, err)
+		assert.Equal(t, string(p), metadata.Path)
+	}
+}
+
+func TestImage_SquashedTree_FileTypes(t *testing.T) {
+	img := newTestImage(t,
+		[]testTarEntry{
+			regularEntry("etc/hosts", "127.0.0.1 localhost\n"),
+			{header: tar.Header{Name: "dev/null", Typeflag: tar.TypeChar, Mode: 0666, Devmajor: 1, Devminor: 3}},
+			{header: tar.Header{Name: "dev/sda", Typeflag: tar.TypeBlock, Mode: 0660, Devmajor: 8}},
+			{header: tar.Header{Name: "run/pipe", Typeflag: tar.TypeFifo, Mode: 0600}},
+			regularEntry("etc/removed", "removed"),
+		},
+		[]testTarEntry{
+			regularEntry("etc/.wh.removed", ""),
+		},
+	)
+
+	tree := img.SquashedTree()
+	for p, expected := range map[file.Path]file.Type{
+		"/etc/hosts": file.TypeReg,
+		"/dev":       file.TypeDir,
+		"/dev/null":  file.TypeCharacterDevice,
+		"/dev/sda":   file.TypeBlockDevice,
+		"/run/pipe":  file.TypeFifo,
+	} {
+		actual, exists := tree.Type(p)
+		assert.True(t, exists, p)
+		assert.Equal(t, expected, actual, p)
+	}
+
+	// whiteouts (and what they remove) do not appear in the squashed tree
+	for _, p := range []file.Path{"/etc/removed", "/etc/.wh.removed"} {
+		_, exists := tree.Type(p)
+		assert.False(t, exists, p)
+	}
+
+	// devices and pipes are not regular files
+	assert.Equal(t, []file.Path{"/etc/hosts"}, realPaths(tree.AllFiles()))
+}
+
+func realPaths(refs []file.Reference) []file.Path {
+	var paths []file.Path
+	for _, ref := range refs {
+		paths = append(paths, ref.RealPath)
+	}
+	return paths
+}
+
+func TestImage_FileMetadataFromSquash(t *testing.T) {
+	modTime := time.Date(2021, 6, 1, 12, 30, 0, 0, time.UTC)
+	img := newTestImage(t,
+		[]testTarEntry{
+			{header: tar.Header{Name: "usr/bin/passwd", Typeflag: tar.TypeReg, Mode: 04755, Uid: 0, Gid: 42, ModTime: modTime, Size: 4}, body: "exec"},
+			{header: tar.Header{Name: "dev/null", Typeflag: tar.TypeChar, Mode: 0o666, Devmajor: 1, Devminor: 3, ModTime: modTime}},
+			{header: tar.Header{Name: "usr/bin/ping", Typeflag: tar.TypeReg, Mode: 0o755, ModTime: modTime, Format: tar.FormatPAX,
+				PAXRecords: map[string]string{"SCHILY.xattr.security.capability": "cap"}}},
+		},
+		[]testTarEntry{
+			{header: tar.Header{Name: "usr/bin/passwd", Typeflag: tar.TypeReg, Mode: 0o755, Uid: 1000, Gid: 1000, ModTime: modTime, Size: 4}, body: "safe"},
+		},
+	)
+
+	passwd, err := img.FileMetadataFromSquash("/usr/bin/passwd")
+	require.NoError(t, err)
+	assert.Equal(t, 1000, passwd.UserID)
+	assert.Equal(t, os.FileMode(0o755), passwd.Mode)
+
+	lowerPasswd, err := img.Layers[0].FileMetadata("/usr/bin/passwd")
+	require.NoError(t, err)
+	assert.Equal(t, os.ModeSetuid|0o755, lowerPasswd.Mode)
+	assert.Equal(t, 42, lowerPasswd.GroupID)
+	assert.True(t, modTime.Equal(lowerPasswd.ModTime))
+
+	null, err := img.FileMetadataFromSquash("/dev/null")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), null.DeviceMajor)
+	assert.Equal(t, int64(3), null.DeviceMinor)
+	assert.Equal(t, os.ModeDevice|os.ModeCharDevice|0o666, null.Mode)
+
+	ping, err := img.FileMetadataFromSquash("/usr/bin/ping")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"security.capability": []byte("cap")}, ping.Xattrs)
+
+	_, err = img.FileMetadataFromSquash("/missing")
+	assert.Error(t, err)
+}
+
+func TestImage_SquashedTree_Deterministic(t *testing.T) {
+	lower := []testTarEntry{
+		regularEntry("etc/hosts", "hosts"),
+		regularEntry("etc/passwd", "passwd"),
+		regularEntry("usr/bin/a", "a"),
+		regularEntry("usr/bin/b", "b"),
+		regularEntry("usr/lib/c", "c"),
+	}
+	upper := []testTarEntry{
+		regularEntry("etc/hosts", "new hosts"),
+		regularEntry("opt/z", "z"),
+		regularEntry("opt/y", "y"),
+		regularEntry("usr/bin/.wh.a", ""),
+	}
+
+	reversed := func(entries []testTarEntry) []testTarEntry {
+		var result []testTarEntry
+		for i := len(entries) - 1; i >= 0; i-- {
+			result = append(result, entries[i])
+		}
+		return result
+	}
+
+	squashedPaths := func(img *Image) ([]file.Path, []file.Path) {
+		var filePaths []file.Path
+		for _, ref := range img.SquashedTree().AllFiles() {
+			filePaths = append(filePaths, ref.RealPath)
+		}
+		return img.SquashedTree().AllRealPaths(), filePaths
+	}
+
+	expectedRealPaths, expectedFilePaths := squashedPaths(newTestImage(t, lower, upper))
+	assert.True(t, sort.IsSorted(file.Paths(expectedRealPaths)))
+	assert.Equal(t, []file.Path{"/etc/hosts", "/etc/passwd", "/opt/y", "/opt/z", "/usr/bin/b", "/usr/lib/c"}, expectedFilePaths)
+
+	for i := 0; i < 5; i++ {
+		realPaths, filePaths := squashedPaths(newTestImage(t, lower, upper))
+		assert.Equal(t, expectedRealPaths, realPaths)
+		assert.Equal(t, expectedFilePaths, filePaths)
+
+		// the order of entries within the layer tars does not affect the results
+		realPaths, filePaths = squashedPaths(newTestImage(t, reversed(lower), reversed(upper)))
+		assert.Equal(t, expectedRealPaths, realPaths)
+		assert.Equal(t, expectedFilePaths, filePaths)
+	}
+}
+
+func TestImage_SquashedTree_OpaqueWhiteoutThreeLayers(t *testing.T) {
+	tests := []struct {
+		name     string
+		builder  *MockBuilder
+		expected []file.Path
+	}{
+		{
+			name: "recreated in a higher layer",
+			builder: NewMockBuilder().
+				AddFile("/app/data/x", "x", 0644).
+				AddFile("/app/other", "other", 0644).
+				AddLayer().
+				AddOpaqueWhiteout("/app/data").
+				AddLayer().
+				AddFile("/app/data/y", "y", 0644),
+			expected: []file.Path{"/app/data/y", "/app/other"},
+		},
+		{
+			name: "recreated in the same layer (after the opaque whiteout)",
+			builder: NewMockBuilder().
+				AddFile("/app/data/x", "x", 0644).
+				AddLayer().
+				AddOpaqueWhiteout("/app/data").
+				AddFile("/app/data/z", "z", 0644).
+				AddLayer().
+				AddFile("/app/data/y", "y", 0644),
+			expected: []file.Path{"/app/data/y", "/app/data/z"},
+		},
+		{
+			name: "recreated in the same layer (before the opaque whiteout)",
+			builder: NewMockBuilder().
+				AddFile("/app/data/x", "x", 0644).
+				AddFile("/app/data/nested/x", "x", 0644).
+				AddLayer().
+				AddFile("/app/data/z", "z", 0644).
+				AddOpaqueWhiteout("/app/data").
+				AddLayer().
+				AddFile("/app/data/y", "y", 0644),
+			expected: []file.Path{"/app/data/y", "/app/data/z"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			img, err := test.builder.Build()
+			require.NoError(t, err)
+			t.Cleanup(func() { _ = img.Cleanup() })
+
+			var paths []file.Path
+			for _, ref := range img.SquashedTree().AllFiles() {
+				paths = append(paths, ref.RealPath)
+			}
+			assert.Equal(t, test.expected, paths)
+
+			// the content of the recreated files must come from the layer that recreated them
+			reader, err := img.FileContentsFromSquash("/app/data/y")
+			require.NoError(t, err)
+			contents, err := ioutil.ReadAll(reader)
+			require.NoError(t, err)
+			assert.Equal(t, "y", string(contents))
+		})
+	}
+}
+
+func TestImage_FilesByMIMETypeFromSquash(t *testing.T) {
+	elf := "\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\x3e\x00" + strings.Repeat("\x00", 64)
+	pem := "-----BEGIN CERTIFICATE-----\nMIIBszCCAVmgAwIBAgIUd\n-----END CERTIFICATE-----\n"
+
+	img, err := NewMockBuilder().
+		AddFile("/usr/bin/app", elf, 0755).
+		AddFile("/usr/bin/removed", elf, 0755).
+		AddFile("/etc/ssl/cert.pem", pem, 0644).
+		AddFile("/etc/motd", "hello\n", 0644).
+		AddLayer().
+		AddWhiteout("/usr/bin/removed").
+		Build()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = img.Cleanup() })
+
+	tests := []struct {
+		mimeTypes []string
+		expected  []file.Path
+	}{
+		{
+			mimeTypes: []string{"application/x-executable"},
+			expected:  []file.Path{"/usr/bin/app"},
+		},
+		{
+			mimeTypes: []string{file.PEMMIMEType, "text/plain"},
+			expected:  []file.Path{"/etc/motd", "/etc/ssl/cert.pem"},
+		},
+		{
+			mimeTypes: []string{"application/x-mach-binary"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(strings.Join(test.mimeTypes, ","), func(t *testing.T) {
+			refs, err := img.FilesByMIMETypeFromSquash(test.mimeTypes...)
+			require.NoError(t, err)
+
+			var paths []file.Path
+			for _, ref := range refs {
+				paths = append(paths, ref.RealPath)
+			}
+			sort.Sort(file.Paths(paths))
+			assert.Equal(t, test.expected, paths)
+		})
+	}
+}
+
+// concurrencyTestLayers creates layers that each add a set of files and overwrite a file from the layer below.
+func concurrencyTestLayers(t testing.TB, count, files int) []v1.Layer {
+	t.Helper()
+	var layers []v1.Layer
+	for idx := 0; idx < count; idx++ {
+		var headers []tar.Header
+		var bodies []string
+		add := func(name, body string) {
+			headers = append(headers, tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0644, Size: int64(len(body)), ModTime: mockModTime})
+			bodies = append(bodies, body)
+		}
+		add("shared.txt", fmt.Sprintf("layer %d", idx))
+		for f := 0; f < files; f++ {
+			add(fmt.Sprintf("layer-%d/file-%d.txt", idx, f), strings.Repeat(fmt.Sprintf("%d-%d ", idx, f), 512))
+		}
+		layer, err := mockLayer(headers, bodies)
+		require.NoError(t, err)
+		layers = append(layers, layer)
+	}
+	return layers
+}
+
+func readConcurrencyTestImage(t testing.TB, layers []v1.Layer, workers int) (*Image, error) {
+	t.Helper()
+	img, err := mutate.AppendLayers(empty.Image, layers...)
+	require.NoError(t, err)
+
+	cacheDir, err := ioutil.TempDir("", "stereoscope-concurrency-test-")
+	require.NoError(t, err)
+
+	result := NewImage(img, cacheDir, WithReadConcurrency(workers))
+	t.Cleanup(func() {
+		_ = result.Cleanup()
+	})
+	return result, result.Read()
+}
+
+func TestImage_Read_Concurrency(t *testing.T) {
+	layers := concurrencyTestLayers(t, 12, 20)
+
+	serial, err := readConcurrencyTestImage(t, layers, 1)
+	require.NoError(t, err)
+	serialRefs, err := serial.FilesByMIMETypeFromSquash("text/plain")
+	require.NoError(t, err)
+
+	for _, workers := range []int{0, 2, 4, 32} {
+		t.Run(fmt.Sprintf("workers=%d", workers), func(t *testing.T) {
+			img, err := readConcurrencyTestImage(t, layers, workers)
+			require.NoError(t, err)
+
+			require.Len(t, img.Layers, len(layers))
+			for idx, layer := range img.Layers {
+				assert.Equal(t, uint(idx), layer.Metadata.Index)
+				assert.Equal(t, serial.Layers[idx].Metadata, layer.Metadata)
+			}
+			assert.Equal(t, serial.Metadata.Size, img.Metadata.Size)
+			assert.Equal(t, serial.SquashedTree().AllRealPaths(), img.SquashedTree().AllRealPaths())
+
+			// the squash must still be applied in layer order
+			reader, err := img.FileContentsFromSquash("/shared.txt")
+			require.NoError(t, err)
+			contents, err := ioutil.ReadAll(reader)
+			require.NoError(t, err)
+			assert.Equal(t, fmt.Sprintf("layer %d", len(layers)-1), string(contents))
+
+			// catalog queries are in the same order as when reading serially
+			refs, err := img.FilesByMIMETypeFromSquash("text/plain")
+			require.NoError(t, err)
+			require.Len(t, refs, len(serialRefs))
+			for idx := range refs {
+				assert.Equal(t, serialRefs[idx].RealPath, refs[idx].RealPath)
+			}
+		})
+	}
+}
+
+func TestImage_Read_ConcurrencyError(t *testing.T) {
+	layers := concurrencyTestLayers(t, 8, 5)
+	tarContent := compressionTestTar(t)
+	layers[5] = newBlobLayer(t, tarContent, tarContent, "application/vnd.oci.image.layer.v1.tar+bzip2")
+
+	_, err := readConcurrencyTestImage(t, layers, 4)
+	var unsupported *ErrUnsupportedLayerCompression
+	require.True(t, errors.As(err, &unsupported), "unexpected error: %+v", err)
+
+	img, err := mutate.AppendLayers(empty.Image, layers...)
+	require.NoError(t, err)
+	assert.Error(t, NewImage(img, t.TempDir(), WithReadConcurrency(-1)).Read())
+}
+
+func TestImage_ReadWithContext_Cancelled(t *testing.T) {
+	content := compressionTestTar(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the context is cancelled as soon as the layer contents are requested, so the read is interrupted mid-copy
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		cancel()
+		return ioutil.NopCloser(bytes.NewReader(content)), nil
+	})
+	require.NoError(t, err)
+	img, err := mutate.AppendLayers(empty.Image, layer)
+	require.NoError(t, err)
+
+	contentDir := t.TempDir()
+	result := NewImage(img, contentDir)
+	err = result.ReadWithContext(ctx)
+	assert.True(t, errors.Is(err, context.Canceled), "unexpected error: %+v", err)
+
+	// no partial layer caches are left behind
+	entries, err := ioutil.ReadDir(contentDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func BenchmarkImage_Read(b *testing.B) {
+	layers := concurrencyTestLayers(b, 24, 200)
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				img, err := readConcurrencyTestImage(b, layers, workers)
+				if err != nil {
+					b.Fatal(err)
+				}
+				_ = img.Cleanup()
+			}
+		})
+	}
+}
+
+func TestImage_Cleanup_Idempotent(t *testing.T) {
+	img, err := NewMockBuilder().AddFile("/a.txt", "contents", 0644).Build()
+	require.NoError(t, err)
+
+	extraDir, err := ioutil.TempDir("", "stereoscope-cleanup-test-")
+	require.NoError(t, err)
+	img.AddCleanup(func() error {
+		return os.RemoveAll(extraDir)
+	})
+
+	failures := 1
+	calls := 0
+	img.AddCleanup(func() error {
+		calls++
+		if failures > 0 {
+			failures--
+			return errors.New("cleanup failed")
+		}
+		return nil
+	})
+
+	// all removals are attempted even when one fails
+	err = img.Cleanup()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cleanup failed")
+	assert.NoDirExists(t, img.contentCacheDir)
+	assert.NoDirExists(t, extraDir)
+
+	// only the failed removal is retried
+	assert.NoError(t, img.Cleanup())
+	assert.Equal(t, 2, calls)
+
+	// nothing is left to do
+	assert.NoError(t, img.Cleanup())
+	assert.Equal(t, 2, calls)
+}
+
+func TestImage_Cleanup_FuncsBeforePaths(t *testing.T) {
+	img, err := NewMockBuilder().AddFile("/a.txt", "contents", 0644).Build()
+	require.NoError(t, err)
+
+	// registered functions may release resources within the content cache dir, so they run before it's removed
+	var existed bool
+	img.AddCleanup(func() error {
+		_, err := os.Stat(img.contentCacheDir)
+		existed = err == nil
+		return nil
+	})
+
+	require.NoError(t, img.Cleanup())
+	assert.True(t, existed, "expected the content cache dir to exist while running the cleanup functions")
+	assert.NoDirExists(t, img.contentCacheDir)
+}
+
+func TestImage_AddCleanup_Concurrent(t *testing.T) {
+	// the cleaner is created on first use for images that were not created with NewImage
+	img := &Image{}
+
+	var calls int32
+	var wg sync.WaitGroup
+	for n := 0; n < 10; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			img.AddCleanup(func() error {
+				atomic.AddInt32(&calls, 1)
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+
+	require.NoError(t, img.Cleanup())
+	assert.Equal(t, int32(10), atomic.LoadInt32(&calls))
+}
+
+func TestImage_LabelsAndAnnotations(t *testing.T) {
+	labels := map[string]string{
+		"maintainer": "someone",
+	}
+	annotations := map[string]string{
+		"org.opencontainers.image.source":   "https://github.com/anchore/stereoscope",
+		"org.opencontainers.image.revision": "abc123",
+	}
+
+	base, err := mutate.Config(empty.Image, v1.Config{Labels: labels})
+	require.NoError(t, err)
+	annotated := mutate.Annotations(base, annotations).(v1.Image)
+
+	manifest, err := base.Manifest()
+	require.NoError(t, err)
+	manifest.Annotations = map[string]string{
+		"org.opencontainers.image.source": "https://example.com/other",
+	}
+	otherManifest, err := json.Marshal(manifest)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name                string
+		img                 v1.Image
+		options             []AdditionalMetadata
+		expectedAnnotations map[string]string
+	}{
+		{
+			name:                "from the image manifest",
+			img:                 annotated,
+			expectedAnnotations: annotations,
+		},
+		{
+			name:                "no annotations",
+			img:                 base,
+			expectedAnnotations: nil,
+		},
+		{
+			name:    "from an overridden manifest",
+			img:     annotated,
+			options: []AdditionalMetadata{WithManifest(otherManifest)},
+			expectedAnnotations: map[string]string{
+				"org.opencontainers.image.source": "https://example.com/other",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			img := NewImage(test.img, t.TempDir(), test.options...)
+			require.NoError(t, img.Read())
+			t.Cleanup(func() { _ = img.Cleanup() })
+
+			assert.Equal(t, labels, img.Metadata.Labels)
+			assert.Equal(t, test.expectedAnnotations, img.Metadata.Annotations)
+		})
+	}
+}
+
+func TestImage_RawManifestAndConfig(t *testing.T) {
+	base, err := mutate.Config(empty.Image, v1.Config{Labels: map[string]string{"maintainer": "someone"}})
+	require.NoError(t, err)
+	expectedManifest, err := base.RawManifest()
+	require.NoError(t, err)
+	expectedConfig, err := base.RawConfigFile()
+	require.NoError(t, err)
+
+	img := NewImage(base, t.TempDir())
+	assert.Equal(t, expectedManifest, img.RawManifest(), "should be available before reading")
+	require.NoError(t, img.Read())
+	t.Cleanup(func() { _ = img.Cleanup() })
+
+	assert.Equal(t, expectedManifest, img.RawManifest())
+	assert.Equal(t, expectedConfig, img.RawConfig())
+	assert.Equal(t, img.Metadata.ID, fmt.Sprintf("sha256:%x", sha256.Sum256(img.RawConfig())))
+
+	// a non-canonical manifest (as provided by the source) must be preserved byte for byte
+	var manifest map[string]interface{}
+	require.NoError(t, json.Unmarshal(expectedManifest, &manifest))
+	indented, err := json.MarshalIndent(manifest, "", "   ")
+	require.NoError(t, err)
+
+	img = NewImage(base, t.TempDir(), WithManifest(indented))
+	require.NoError(t, img.Read())
+	t.Cleanup(func() { _ = img.Cleanup() })
+
+	assert.Equal(t, indented, img.RawManifest())
+	assert.Equal(t, img.Metadata.ManifestDigest, fmt.Sprintf("sha256:%x", sha256.Sum256(img.RawManifest())))
+}
+
+// sparseFixture is shared with the file package (generated by pkg/file/test-fixtures/generators/sparse.sh)
+const sparseFixture = "../file/test-fixtures/sparse-pax.tar"
+
+func TestImage_OpenPathSeekable(t *testing.T) {
+	layer, err := tarball.LayerFromFile(sparseFixture)
+	require.NoError(t, err)
+	img, err := mutate.AppendLayers(empty.Image, layer)
+	require.NoError(t, err)
+
+	// the sparse file has data at the start and end with a hole in between
+	expectedSparse := "head" + strings.Repeat("\x00", 1048572) + "tail"
+
+	tests := []struct {
+		name      string
+		path      file.Path
+		threshold int64
+		expected  string
+		spilled   bool
+	}{
+		{
+			name:      "regular files are seeked within the layer tar",
+			path:      "/after.txt",
+			threshold: 0,
+			expected:  "after\n",
+		},
+		{
+			name:      "sparse file under the threshold is held in memory",
+			path:      "/sparse.bin",
+			threshold: int64(len(expectedSparse)),
+			expected:  expectedSparse,
+		},
+		{
+			name:      "sparse file over the threshold is spilled",
+			path:      "/sparse.bin",
+			threshold: 1024,
+			expected:  expectedSparse,
+			spilled:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cacheDir := t.TempDir()
+			result := NewImage(img, cacheDir, WithContentSpillThreshold(test.threshold))
+			require.NoError(t, result.Read())
+			t.Cleanup(func() { _ = result.Cleanup() })
+
+			before, err := ioutil.ReadDir(cacheDir)
+			require.NoError(t, err)
+
+			reader, err := result.OpenPathSeekable(test.path)
+			require.NoError(t, err)
+
+			during, err := ioutil.ReadDir(cacheDir)
+			require.NoError(t, err)
+			if test.spilled {
+				assert.Len(t, during, len(before)+1)
+			} else {
+				assert.Len(t, during, len(before))
+			}
+
+			offset := int64(len(test.expected) - 4)
+			_, err = reader.Seek(offset, io.SeekStart)
+			require.NoError(t, err)
+			actual, err := ioutil.ReadAll(reader)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected[offset:], string(actual))
+
+			require.NoError(t, reader.Close())
+			after, err := ioutil.ReadDir(cacheDir)
+			require.NoError(t, err)
+			assert.Len(t, after, len(before))
+		})
+	}
+
+	assert.Error(t, NewImage(img, t.TempDir(), WithContentSpillThreshold(-1)).Read())
+}
+
+func TestImage_MemoryMappedLayers(t *testing.T) {
+	layer, err := tarball.LayerFromFile(sparseFixture)
+	require.NoError(t, err)
+	img, err := mutate.AppendLayers(empty.Image, layer)
+	require.NoError(t, err)
+
+	result := NewImage(img, t.TempDir(), WithMemoryMappedLayers(true))
+	require.NoError(t, result.Read())
+	t.Cleanup(func() { _ = result.Cleanup() })
+	if runtime.GOOS == "linux" || runtime.GOOS == "darwin" {
+		require.NotNil(t, result.Layers[0].mapped)
+	}
+
+	for p, expected := range map[file.Path]string{
+		"/after.txt": "after\n",
+		// sparse files are still read through the tar on disk
+		"/sparse.bin": "head" + strings.Repeat("\x00", 1048572) + "tail",
+	} {
+		reader, err := result.FileContentsFromSquash(p)
+		require.NoError(t, err)
+		actual, err := ioutil.ReadAll(reader)
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(actual), p)
+	}
+
+	// regular files are seekable without spilling
+	seekable, err := result.OpenPathSeekable("/after.txt")
+	require.NoError(t, err)
+	_, err = seekable.Seek(2, io.SeekStart)
+	require.NoError(t, err)
+	actual, err := ioutil.ReadAll(seekable)
+	require.NoError(t, err)
+	assert.Equal(t, "ter\n", string(actual))
+
+	// layers are unmapped on cleanup
+	reader, err := result.FileContentsFromSquash("/after.txt")
+	require.NoError(t, err)
+	require.NoError(t, result.Cleanup())
+	_, err = ioutil.ReadAll(reader)
+	assert.Error(t, err)
+}
+
+func TestLayer_Resolve(t *testing.T) {
+	img, err := NewMockBuilder().
+		AddFile("/etc/passwd", "root", 0644).
+		AddFile("/etc/hosts", "localhost", 0644).
+		AddLayer().
+		AddFile("/etc/hosts", "overridden", 0644).
+		AddSymlink("/etc/link", "/etc/passwd").
+		AddWhiteout("/etc/passwd").
+		Build()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = img.Cleanup() })
+
+	require.Nil(t, img.Layer(-1))
+	require.Nil(t, img.Layer(2))
+	lower, upper := img.Layer(0), img.Layer(1)
+	require.NotNil(t, lower)
+	require.NotNil(t, upper)
+
+	contentsOf := func(t *testing.T, ref *file.Reference) string {
+		t.Helper()
+		require.NotNil(t, ref)
+		reader, err := img.FileContentsByRef(*ref)
+		require.NoError(t, err)
+		defer reader.Close()
+		contents, err := ioutil.ReadAll(reader)
+		require.NoError(t, err)
+		return string(contents)
+	}
+
+	// the lower layer contents are available even though they are overridden or removed by the upper layer
+	ref, err := lower.Resolve("/etc/hosts")
+	require.NoError(t, err)
+	assert.Equal(t, "localhost", contentsOf(t, ref))
+
+	ref, err = lower.Resolve("/etc/passwd")
+	require.NoError(t, err)
+	assert.Equal(t, "root", contentsOf(t, ref))
+
+	ref, err = upper.Resolve("/etc/hosts")
+	require.NoError(t, err)
+	assert.Equal(t, "overridden", contentsOf(t, ref))
+
+	// the whiteout is a marker within the upper layer, not applied
+	ref, err = upper.Resolve("/etc/passwd")
+	require.NoError(t, err)
+	assert.Nil(t, ref)
+	ref, err = upper.Resolve("/etc/.wh.passwd")
+	require.NoError(t, err)
+	require.NotNil(t, ref)
+	assert.Equal(t, file.Path("/etc/.wh.passwd"), ref.RealPath)
+
+	// links are not followed unless asked to, and only resolve within the layer
+	ref, err = upper.Resolve("/etc/link")
+	require.NoError(t, err)
+	require.NotNil(t, ref)
+	assert.Equal(t, file.Path("/etc/link"), ref.RealPath)
+	ref, err = upper.Resolve("/etc/link", filetree.FollowBasenameLinks)
+	require.NoError(t, err)
+	assert.Nil(t, ref)
+}
@@ -3,26 +3,36 @@ package image
 import (
 	"archive/tar"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"io/ioutil"
 	"os"
 	"path"
 
 	"github.com/anchore/stereoscope/internal/bus"
+	"github.com/anchore/stereoscope/internal/contextio"
 	"github.com/anchore/stereoscope/internal/log"
 	"github.com/anchore/stereoscope/pkg/event"
 	"github.com/anchore/stereoscope/pkg/file"
 	"github.com/anchore/stereoscope/pkg/filetree"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
-	"github.com/google/go-containerregistry/pkg/v1/types"
 	"github.com/sylabs/squashfs"
 	"github.com/wagoodman/go-partybus"
 	"github.com/wagoodman/go-progress"
 )
 
-const SingularitySquashFSLayer = "application/vnd.sylabs.sif.layer.v1.squashfs"
+const (
+	SingularitySquashFSLayer = "application/vnd.sylabs.sif.layer.v1.squashfs"
+	// OCISquashFSLayer is the media type of a (non-standard) OCI layer that is a squashfs filesystem image instead of a
+	// tar, as used by some lazy-pulling runtimes.
+	OCISquashFSLayer = "application/vnd.oci.image.layer.v1.squashfs"
+	// OCIEROFSLayer is the media type of a (non-standard) OCI layer that is an erofs filesystem image, which cannot be
+	// read.
+	OCIEROFSLayer = "application/vnd.oci.image.layer.v1.erofs"
+)
 
 // Layer represents a single layer within a container image.
 type Layer struct {
@@ -39,6 +49,34 @@ type Layer struct {
 	SquashedTree *filetree.FileTree
 	// fileCatalog contains all file metadata for all files in all layers (not just this layer)
 	fileCatalog *FileCatalog
+	// limiter enforces the image size limits while the layer is read
+	limiter *sizeLimiter
+	// maxPathDepth is the maximum number of components of any path within the layer (0 = unlimited)
+	maxPathDepth int
+	// fileDigests computes the content digest of every regular file while indexing (see WithFileDigests)
+	fileDigests bool
+	// pathFilter decides which entries are indexed while the layer is read
+	pathFilter pathFilter
+	// history contains the image config history entries that describe this layer
+	history []v1.History
+	// cache persists the layer tar and index across images (optional, see WithLayerCache)
+	cache *layerCache
+	// releaseCache marks the cached layer as no longer in use by the image
+	releaseCache func()
+	// verifyDigests checks the layer content against the manifest digest and diff ID while reading
+	verifyDigests bool
+	// estargz indexes the layer from its eStargz table of contents when possible (see WithEStargzLayers)
+	estargz bool
+	// memoryMap maps the uncompressed layer tar into memory to read file contents from (see WithMemoryMappedLayers)
+	memoryMap bool
+	// mapped is the memory mapped layer tar (only when memoryMap is set and the tar could be mapped)
+	mapped *file.MappedTar
+	// squashfsFile is the open filesystem image of a (non-singularity) squashfs layer, used to read file contents
+	squashfsFile *os.File
+	// indexes persists layer tar indexes so that later reads may defer fetching the layer (optional, see WithLazyLayers)
+	indexes *layerIndexStore
+	// fetch fetches the uncompressed layer tar on first use (only for layers read lazily)
+	fetch func() error
 }
 
 // NewLayer provides a new, unread layer object.
@@ -48,7 +86,7 @@ func NewLayer(layer v1.Layer) *Layer {
 	}
 }
 
-func (l *Layer) uncompressedTarCache(uncompressedLayersCacheDir string) (string, error) {
+func (l *Layer) uncompressedTarCache(ctx context.Context, uncompressedLayersCacheDir string) (string, error) {
 	if uncompressedLayersCacheDir == "" {
 		return "", fmt.Errorf("no cache directory given")
 	}
@@ -59,17 +97,36 @@ func (l *Layer) uncompressedTarCache(uncompressedLayersCacheDir string) (string,
 		return tarPath, nil
 	}
 
-	rawReader, err := l.layer.Uncompressed()
+	var rawReader io.ReadCloser
+	var err error
+	if l.verifyDigests {
+		rawReader, err = verifiedLayerReader(l.layer, l.Metadata.Digest)
+	} else {
+		rawReader, err = UncompressedLayerReader(l.layer)
+	}
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("unable to read layer=%q: %w", l.Metadata.Digest, err)
 	}
+	defer rawReader.Close()
 
-	fh, err := os.Create(tarPath)
+	// note: layers may be read concurrently and an image may contain the same layer more than once, so the cache is
+	// written to a temp file and moved into place once complete (a partially written cache is never observed)
+	fh, err := ioutil.TempFile(uncompressedLayersCacheDir, path.Base(tarPath)+".*")
 	if err != nil {
 		return "", fmt.Errorf("unable to create layer cache dir=%q : %w", tarPath, err)
 	}
 
-	if _, err := io.Copy(fh, rawReader); err != nil {
+	_, err = io.Copy(fh, contextio.NewReader(ctx, l.limiter.reader(rawReader)))
+	if closeErr := fh.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(fh.Name())
+		return "", fmt.Errorf("unable to populate layer cache dir=%q : %w", tarPath, err)
+	}
+
+	if err := os.Rename(fh.Name(), tarPath); err != nil {
+		_ = os.Remove(fh.Name())
 		return "", fmt.Errorf("unable to populate layer cache dir=%q : %w", tarPath, err)
 	}
 
@@ -79,6 +136,10 @@ func (l *Layer) uncompressedTarCache(uncompressedLayersCacheDir string) (string,
 // Read parses information from the underlying layer tar into this struct. This includes layer metadata, the layer
 // file tree, and the layer squash tree.
 func (l *Layer) Read(catalog *FileCatalog, imgMetadata Metadata, idx int, uncompressedLayersCacheDir string) error {
+	return l.read(context.Background(), catalog, imgMetadata, idx, uncompressedLayersCacheDir)
+}
+
+func (l *Layer) read(ctx context.Context, catalog *FileCatalog, imgMetadata Metadata, idx int, uncompressedLayersCacheDir string) error {
 	var err error
 	l.Tree = filetree.NewFileTree()
 	l.fileCatalog = catalog
@@ -86,6 +147,7 @@ func (l *Layer) Read(catalog *FileCatalog, imgMetadata Metadata, idx int, uncomp
 	if err != nil {
 		return err
 	}
+	l.history = layerHistory(imgMetadata.Config.History, len(imgMetadata.Config.RootFS.DiffIDs), idx)
 
 	log.Debugf("layer metadata: index=%+v digest=%+v mediaType=%+v",
 		l.Metadata.Index,
@@ -95,50 +157,213 @@ func (l *Layer) Read(catalog *FileCatalog, imgMetadata Metadata, idx int, uncomp
 	monitor := trackReadProgress(l.Metadata)
 
 	switch l.Metadata.MediaType {
-	case types.OCILayer,
-		types.OCIUncompressedLayer,
-		types.OCIRestrictedLayer,
-		types.OCIUncompressedRestrictedLayer,
-		types.DockerLayer,
-		types.DockerForeignLayer,
-		types.DockerUncompressedLayer:
-
-		tarFilePath, err := l.uncompressedTarCache(uncompressedLayersCacheDir)
+	case SingularitySquashFSLayer, OCISquashFSLayer:
+		if err := l.readSquashFS(ctx, monitor, uncompressedLayersCacheDir); err != nil {
+			return err
+		}
+
+	case OCIEROFSLayer:
+		return fmt.Errorf("unsupported erofs layer=%q (only tar and squashfs layers can be read)", l.Metadata.Digest)
+
+	default:
+		// all other layers are (possibly compressed) tars, unsupported media types are rejected when decompressing
+		compression, err := LayerCompression(l.Metadata.MediaType)
+		if err != nil {
+			return err
+		}
+
+		if l.estargz && compression == GzipCompression {
+			indexed, err := l.readEStargz(ctx, monitor)
+			if err != nil {
+				return err
+			}
+			if indexed {
+				break
+			}
+		}
+
+		if l.cache != nil {
+			if err := l.readCached(ctx, monitor); err != nil {
+				return err
+			}
+			break
+		}
+
+		if l.indexes != nil {
+			if err := l.readLazy(ctx, monitor, uncompressedLayersCacheDir); err != nil {
+				return err
+			}
+			break
+		}
+
+		tarFilePath, err := l.uncompressedTarCache(ctx, uncompressedLayersCacheDir)
 		if err != nil {
 			return err
 		}
+		l.mapTar(tarFilePath)
 
-		l.indexedContent, err = file.NewTarIndex(tarFilePath, l.indexer(monitor))
+		l.indexedContent, err = file.NewTarIndex(tarFilePath, l.indexer(ctx, monitor, nil))
 		if err != nil {
 			return fmt.Errorf("failed to read layer=%q tar : %w", l.Metadata.Digest, err)
 		}
+	}
+
+	monitor.SetCompleted()
 
-	case SingularitySquashFSLayer:
-		r, err := l.layer.Uncompressed()
+	return nil
+}
+
+// readSquashFS indexes a squashfs layer. Singularity layers are read directly from the SIF file, while the blob of any
+// other squashfs layer is the (internally compressed) filesystem image itself, which is saved to the cache directory so
+// that it can be read at random. Note: since squashfs layers are not tars, they are neither cached in the layer cache
+// nor verified against the layer digest.
+func (l *Layer) readSquashFS(ctx context.Context, monitor *progress.Manual, uncompressedLayersCacheDir string) error {
+	var r io.Reader
+	if l.Metadata.MediaType == SingularitySquashFSLayer {
+		rc, err := l.layer.Uncompressed()
 		if err != nil {
 			return fmt.Errorf("failed to read layer=%q: %w", l.Metadata.Digest, err)
 		}
 		// defer r.Close() // TODO: if we close this here, we can't read file contents after we return.
+		r = rc
+	} else {
+		squashfsPath, err := l.squashfsCache(ctx, uncompressedLayersCacheDir)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(squashfsPath)
+		if err != nil {
+			return fmt.Errorf("failed to read layer=%q: %w", l.Metadata.Digest, err)
+		}
+		// note: the file remains open so that file contents can be read later (it is closed on image cleanup)
+		l.squashfsFile = f
+		r = f
+	}
 
-		// Walk the more efficient walk if we're blessed with an io.ReaderAt.
-		if ra, ok := r.(io.ReaderAt); ok {
-			err = file.WalkSquashFS(ra, l.squashfsVisitor(monitor))
-		} else {
-			err = file.WalkSquashFSFromReader(r, l.squashfsVisitor(monitor))
+	// Walk the more efficient walk if we're blessed with an io.ReaderAt.
+	var err error
+	if ra, ok := r.(io.ReaderAt); ok {
+		err = file.WalkSquashFS(ra, l.squashfsVisitor(ctx, monitor))
+	} else {
+		err = file.WalkSquashFSFromReader(r, l.squashfsVisitor(ctx, monitor))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to walk layer=%q: %w", l.Metadata.Digest, err)
+	}
+	return nil
+}
+
+// squashfsCache saves the squashfs layer blob to the given cache directory (as is, since squashfs compresses the
+// contents of each file internally), returning the path to the saved filesystem image.
+func (l *Layer) squashfsCache(ctx context.Context, uncompressedLayersCacheDir string) (string, error) {
+	if uncompressedLayersCacheDir == "" {
+		return "", fmt.Errorf("no cache directory given")
+	}
+
+	squashfsPath := path.Join(uncompressedLayersCacheDir, l.Metadata.Digest+".squashfs")
+	if _, err := os.Stat(squashfsPath); !os.IsNotExist(err) {
+		return squashfsPath, nil
+	}
+
+	blob, err := l.layer.Compressed()
+	if err != nil {
+		return "", fmt.Errorf("unable to read layer=%q: %w", l.Metadata.Digest, err)
+	}
+	defer blob.Close()
+
+	// note: the same as uncompressedTarCache, the blob is moved into place once complete
+	fh, err := ioutil.TempFile(uncompressedLayersCacheDir, path.Base(squashfsPath)+".*")
+	if err != nil {
+		return "", fmt.Errorf("unable to create layer cache dir=%q : %w", squashfsPath, err)
+	}
+
+	_, err = io.Copy(fh, contextio.NewReader(ctx, blob))
+	if closeErr := fh.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(fh.Name(), squashfsPath)
+	}
+	if err != nil {
+		_ = os.Remove(fh.Name())
+		return "", fmt.Errorf("unable to populate layer cache dir=%q : %w", squashfsPath, err)
+	}
+	return squashfsPath, nil
+}
+
+// readCached indexes the layer from the layer cache, only fetching and indexing the layer tar if it is not cached yet.
+func (l *Layer) readCached(ctx context.Context, monitor *progress.Manual) error {
+	l.releaseCache = l.cache.acquire(l.Metadata.Digest)
+
+	if entries, mimeTypes, ok := l.cache.load(l.Metadata.Digest); ok {
+		tarFilePath := l.cache.tarPath(l.Metadata.Digest)
+		info, err := os.Stat(tarFilePath)
+		if err != nil {
+			return fmt.Errorf("unable to read cached layer=%q: %w", l.Metadata.Digest, err)
+		}
+		// note: the layer is not decompressed again, however, it still counts toward the total size limit
+		if err := l.limiter.add(info.Size()); err != nil {
+			return err
 		}
+		l.mapTar(tarFilePath)
+		l.indexedContent, err = file.NewTarIndexFromEntries(entries, l.indexer(ctx, monitor, mimeTypes))
 		if err != nil {
-			return fmt.Errorf("failed to walk layer=%q: %w", l.Metadata.Digest, err)
+			return fmt.Errorf("failed to read cached layer=%q : %w", l.Metadata.Digest, err)
 		}
+		return nil
+	}
 
-	default:
-		return fmt.Errorf("unknown layer media type: %+v", l.Metadata.MediaType)
+	entryDir := l.cache.entryDir(l.Metadata.Digest)
+	if err := os.MkdirAll(entryDir, 0755); err != nil {
+		return fmt.Errorf("unable to create layer cache dir=%q : %w", entryDir, err)
+	}
+	tarFilePath, err := l.uncompressedTarCache(ctx, entryDir)
+	if err != nil {
+		return err
 	}
+	l.mapTar(tarFilePath)
 
-	monitor.SetCompleted()
+	mimeTypes := make(map[int64]string)
+	l.indexedContent, err = file.NewTarIndex(tarFilePath, l.indexer(ctx, monitor, mimeTypes))
+	if err != nil {
+		return fmt.Errorf("failed to read layer=%q tar : %w", l.Metadata.Digest, err)
+	}
 
+	if err := l.cache.store(l.Metadata.Digest, l.indexedContent.Entries(), mimeTypes); err != nil {
+		// the layer is still usable, it will only be indexed again next time
+		log.Warnf("unable to store layer=%q in the layer cache: %+v", l.Metadata.Digest, err)
+	}
 	return nil
 }
 
+// mapTar memory maps the given uncompressed layer tar when enabled (see WithMemoryMappedLayers). If the tar cannot be
+// mapped then file contents are read from the tar on disk instead.
+func (l *Layer) mapTar(tarFilePath string) {
+	if !l.memoryMap {
+		return
+	}
+	mapped, err := file.NewMappedTar(tarFilePath)
+	if err != nil {
+		log.Warnf("unable to memory map layer=%q (reading from disk instead): %+v", l.Metadata.Digest, err)
+		return
+	}
+	l.mapped = mapped
+}
+
+// Resolve returns the file reference for the given path relative to the layers "diff tree" (see Layer.Tree), which is
+// what this layer alone contained at the path, regardless of whether a higher layer overrides it. Nil is returned if
+// the layer does not contain the path. Whiteouts are not applied: a whiteout within this layer is a regular entry in
+// the tree (e.g. "/etc/.wh.passwd") and can be resolved like any other path. Links are resolved within the layer only
+// (links to paths from lower layers are dead), and the link itself is returned unless filetree.FollowBasenameLinks is
+// given.
+func (l *Layer) Resolve(path file.Path, options ...filetree.LinkResolutionOption) (*file.Reference, error) {
+	if l.Tree == nil {
+		return nil, fmt.Errorf("layer has not been read")
+	}
+	_, ref, err := l.Tree.File(path, options...)
+	return ref, err
+}
+
 // FetchContents reads the file contents for the given path from the underlying layer blob, relative to the layers "diff tree".
 // An error is returned if there is no file at the given path and layer or the read operation cannot continue.
 func (l *Layer) FileContents(path file.Path) (io.ReadCloser, error) {
@@ -151,6 +376,18 @@ func (l *Layer) FileContentsFromSquash(path file.Path) (io.ReadCloser, error) {
 	return fetchFileContentsByPath(l.SquashedTree, l.fileCatalog, path)
 }
 
+// FileMetadata returns the file metadata for the given path, relative to the layers "diff tree".
+// An error is returned if there is no file at the given path and layer.
+func (l *Layer) FileMetadata(path file.Path) (file.Metadata, error) {
+	return fetchFileMetadataByPath(l.Tree, l.fileCatalog, path)
+}
+
+// FileMetadataFromSquash returns the file metadata for the given path, relative to the layers squashed file tree.
+// An error is returned if there is no file at the given path and layer.
+func (l *Layer) FileMetadataFromSquash(path file.Path) (file.Metadata, error) {
+	return fetchFileMetadataByPath(l.SquashedTree, l.fileCatalog, path)
+}
+
 // FilesByMIMEType returns file references for files that match at least one of the given MIME types relative to each layer tree.
 func (l *Layer) FilesByMIMEType(mimeTypes ...string) ([]file.Reference, error) {
 	var refs []file.Reference
@@ -177,18 +414,59 @@ func (l *Layer) FilesByMIMETypeFromSquash(mimeTypes ...string) ([]file.Reference
 	return refs, nil
 }
 
-func (l *Layer) indexer(monitor *progress.Manual) file.TarIndexVisitor {
+// indexer adds each tar entry to the layer tree and the file catalog. The MIME types of all indexed entries are
+// recorded into the given map (keyed by the entry sequence), and any MIME type already within the map is used instead
+// of reading the entry contents.
+func (l *Layer) indexer(ctx context.Context, monitor *progress.Manual, mimeTypes map[int64]string) file.TarIndexVisitor {
 	return func(index file.TarIndexEntry) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		var err error
 		var entry = index.ToTarFileEntry()
 
-		var contents = index.Open()
-		defer func() {
-			if err := contents.Close(); err != nil {
-				log.Warnf("unable to close file while indexing layer: %+v", err)
+		if file.Path(entry.Header.Name).IsAufsMetadata() {
+			// the AUFS storage driver leaves behind metadata within layers that is not part of the image content
+			log.Debugf("ignoring AUFS metadata within layer=%q: %q", l.Metadata.Digest, entry.Header.Name)
+			return nil
+		}
+
+		if l.pathFilter.skip(file.Path(entry.Header.Name).ToAbsolute(), entry.Header.Typeflag == tar.TypeDir) {
+			return nil
+		}
+
+		opener := index.Open
+		if l.fetch != nil {
+			opener = l.lazyOpener(index)
+		} else if l.mapped != nil {
+			if err := l.mapped.Add(index); err != nil {
+				return err
+			}
+			opener = l.mapped.Opener(index)
+		}
+
+		var metadata file.Metadata
+		if mimeType, ok := mimeTypes[entry.Sequence]; ok {
+			metadata = file.NewMetadata(entry.Header, entry.Sequence, nil)
+			metadata.MIMEType = mimeType
+		} else {
+			var contents = opener()
+			defer func() {
+				if err := contents.Close(); err != nil {
+					log.Warnf("unable to close file while indexing layer: %+v", err)
+				}
+			}()
+			metadata = file.NewMetadata(entry.Header, entry.Sequence, contents)
+			if mimeTypes != nil {
+				mimeTypes[entry.Sequence] = metadata.MIMEType
 			}
-		}()
-		metadata := file.NewMetadata(entry.Header, entry.Sequence, contents)
+		}
+		if err := l.limiter.checkFile(metadata.Path, metadata.Size); err != nil {
+			return err
+		}
+		if err := checkPathDepth(l.maxPathDepth, metadata.Path, metadata.Linkname); err != nil {
+			return err
+		}
 
 		// note: the tar header name is independent of surrounding structure, for example, there may be a tar header entry
 		// for /some/path/to/file.txt without any entries to constituent paths (/some, /some/path, /some/path/to ).
@@ -200,43 +478,73 @@ func (l *Layer) indexer(monitor *progress.Manual) file.TarIndexVisitor {
 		//
 		// In summary: the set of all FileTrees can have NON-leaf nodes that don't exist in the FileCatalog, but
 		// the FileCatalog should NEVER have entries that don't appear in one (or more) FileTree(s).
-		var fileReference *file.Reference
-		switch metadata.TypeFlag {
-		case tar.TypeSymlink:
-			fileReference, err = l.Tree.AddSymLink(file.Path(metadata.Path), file.Path(metadata.Linkname))
-			if err != nil {
-				return err
-			}
-		case tar.TypeLink:
-			fileReference, err = l.Tree.AddHardLink(file.Path(metadata.Path), file.Path(metadata.Linkname))
-			if err != nil {
-				return err
-			}
-		case tar.TypeDir:
-			fileReference, err = l.Tree.AddDir(file.Path(metadata.Path))
-			if err != nil {
-				return err
-			}
-		default:
-			fileReference, err = l.Tree.AddFile(file.Path(metadata.Path))
-			if err != nil {
-				return err
-			}
-		}
-		if fileReference == nil {
-			return fmt.Errorf("could not add path=%q link=%q during tar iteration", metadata.Path, metadata.Linkname)
+		fileReference, err := l.addEntry(&metadata, func() (io.ReadCloser, error) { return opener(), nil })
+		if err != nil {
+			return err
 		}
 
 		l.Metadata.Size += metadata.Size
-		l.fileCatalog.Add(*fileReference, metadata, l, index.Open)
+		l.fileCatalog.Add(*fileReference, metadata, l, opener)
 
 		monitor.N++
 		return nil
 	}
 }
 
-func (l *Layer) squashfsVisitor(monitor *progress.Manual) file.SquashFSVisitor {
+// addEntry adds the tar entry described by the given metadata to the layer tree (recording the content digest of
+// regular files, see digestFile), returning the reference for the added path.
+func (l *Layer) addEntry(metadata *file.Metadata, open func() (io.ReadCloser, error)) (*file.Reference, error) {
+	var fileReference *file.Reference
+	var err error
+	switch metadata.TypeFlag {
+	case tar.TypeSymlink:
+		fileReference, err = l.Tree.AddSymLink(file.Path(metadata.Path), file.Path(metadata.Linkname))
+		if err != nil {
+			return nil, err
+		}
+	case tar.TypeLink:
+		fileReference, err = l.Tree.AddHardLink(file.Path(metadata.Path), file.Path(metadata.Linkname))
+		if err != nil {
+			return nil, err
+		}
+	case tar.TypeDir:
+		fileReference, err = l.Tree.AddDir(file.Path(metadata.Path))
+		if err != nil {
+			return nil, err
+		}
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		fileReference, err = l.Tree.AddSpecialFile(file.Path(metadata.Path), file.Type(metadata.TypeFlag))
+		if err != nil {
+			return nil, err
+		}
+	default:
+		fileReference, err = l.Tree.AddFile(file.Path(metadata.Path))
+		if err != nil {
+			return nil, err
+		}
+		if err := l.digestFile(metadata, open); err != nil {
+			return nil, err
+		}
+	}
+	if fileReference == nil {
+		return nil, fmt.Errorf("could not add path=%q link=%q during tar iteration", metadata.Path, metadata.Linkname)
+	}
+	return fileReference, nil
+}
+
+func (l *Layer) squashfsVisitor(ctx context.Context, monitor *progress.Manual) file.SquashFSVisitor {
 	return func(fsys fs.FS, path string, d fs.DirEntry) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if l.pathFilter.skip(file.Path(file.DirSeparator+path).Normalize(), d.IsDir()) {
+			if d.IsDir() {
+				// the contents of an excluded directory are not walked
+				return fs.SkipDir
+			}
+			return nil
+		}
+
 		ff, err := fsys.Open(path)
 		if err != nil {
 			return err
@@ -252,6 +560,27 @@ func (l *Layer) squashfsVisitor(monitor *progress.Manual) file.SquashFSVisitor {
 		if err != nil {
 			return err
 		}
+		// note: squashfs layers are not decompressed up front, so file sizes count toward the total limit instead
+		if err := l.limiter.checkFile(metadata.Path, metadata.Size); err != nil {
+			return err
+		}
+		if err := l.limiter.add(metadata.Size); err != nil {
+			return err
+		}
+		if err := checkPathDepth(l.maxPathDepth, metadata.Path, metadata.Linkname); err != nil {
+			return err
+		}
+
+		opener := func() io.ReadCloser {
+			r, err := fsys.Open(path)
+			if err != nil {
+				// The file.Opener interface doesn't give us a way to return an error, and callers
+				// don't seem to handle a nil return. So, return a zero-byte reader.
+				log.Debug(err)
+				return io.NopCloser(bytes.NewReader(nil)) // TODO
+			}
+			return r
+		}
 
 		var fileReference *file.Reference
 
@@ -266,11 +595,19 @@ func (l *Layer) squashfsVisitor(monitor *progress.Manual) file.SquashFSVisitor {
 			if err != nil {
 				return err
 			}
+		case file.TypeFromMode(metadata.Mode).IsSpecial():
+			fileReference, err = l.Tree.AddSpecialFile(file.Path(metadata.Path), file.TypeFromMode(metadata.Mode))
+			if err != nil {
+				return err
+			}
 		default:
 			fileReference, err = l.Tree.AddFile(file.Path(metadata.Path))
 			if err != nil {
 				return err
 			}
+			if err := l.digestFile(&metadata, func() (io.ReadCloser, error) { return fsys.Open(path) }); err != nil {
+				return err
+			}
 		}
 
 		if fileReference == nil {
@@ -278,16 +615,7 @@ func (l *Layer) squashfsVisitor(monitor *progress.Manual) file.SquashFSVisitor {
 		}
 
 		l.Metadata.Size += metadata.Size
-		l.fileCatalog.Add(*fileReference, metadata, l, func() io.ReadCloser {
-			r, err := fsys.Open(path)
-			if err != nil {
-				// The file.Opener interface doesn't give us a way to return an error, and callers
-				// don't seem to handle a nil return. So, return a zero-byte reader.
-				log.Debug(err)
-				return io.NopCloser(bytes.NewReader(nil)) // TODO
-			}
-			return r
-		})
+		l.fileCatalog.Add(*fileReference, metadata, l, opener)
 
 		monitor.N++
 		return nil
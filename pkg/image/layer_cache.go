@@ -0,0 +1,315 @@
+package image
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anchore/stereoscope/internal/log"
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+const (
+	layerCacheIndexFile    = "index.json"
+	layerCacheIndexVersion = 1
+)
+
+var (
+	layerCachesLock sync.Mutex
+	// layerCaches is every layer cache in use by this process (keyed by directory), so that all images using the same
+	// directory share which layers are in use
+	layerCaches = make(map[string]*layerCache)
+)
+
+// WithLayerCache persists the uncompressed contents and the index of every read layer to the given directory (keyed by
+// the layer digest), so that the same layer is neither fetched nor indexed again when found in another image (within
+// this or any later process). Once the cache exceeds the given total size in bytes, the least recently used layers are
+// removed (a size of 0 means that nothing is ever removed). Layers in use by an image that has not been cleaned up are
+// never removed, so the cache may exceed the size while they are in use. Only tar layers are cached (e.g. not
+// squashfs layers).
+func WithLayerCache(dir string, maxSize int64) AdditionalMetadata {
+	return func(image *Image) error {
+		cache, err := getLayerCache(dir, maxSize)
+		if err != nil {
+			return err
+		}
+		image.layerCache = cache
+		return nil
+	}
+}
+
+// layerCache is an on-disk cache of uncompressed layer tars. Each layer is stored within its own directory, along
+// with an index of the tar entries that is written only once the tar is complete (so the index indicates a valid
+// cache entry).
+type layerCache struct {
+	lock    sync.Mutex
+	dir     string
+	maxSize int64
+	// inUse is the number of read images using each cached layer (keyed by digest)
+	inUse map[string]int
+}
+
+// cachedLayerIndex is the persisted index of a cached layer tar.
+type cachedLayerIndex struct {
+	Version int                `json:"version"`
+	Entries []cachedLayerEntry `json:"entries"`
+}
+
+type cachedLayerEntry struct {
+	Sequence     int64      `json:"sequence"`
+	Header       tar.Header `json:"header"`
+	SeekPosition int64      `json:"seekPosition"`
+	// MIMEType is the MIME type detected for the entry contents (only for entries that were indexed, entries excluded
+	// by a path filter are detected once indexed by another image)
+	MIMEType *string `json:"mimeType,omitempty"`
+}
+
+func getLayerCache(dir string, maxSize int64) (*layerCache, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid layer cache dir=%q: %w", dir, err)
+	}
+	if err := os.MkdirAll(abs, 0755); err != nil {
+		return nil, fmt.Errorf("unable to create layer cache dir=%q: %w", dir, err)
+	}
+
+	layerCachesLock.Lock()
+	defer layerCachesLock.Unlock()
+
+	cache, ok := layerCaches[abs]
+	if !ok {
+		cache = &layerCache{
+			dir:   abs,
+			inUse: make(map[string]int),
+		}
+		layerCaches[abs] = cache
+	}
+	cache.lock.Lock()
+	cache.maxSize = maxSize
+	cache.lock.Unlock()
+	return cache, nil
+}
+
+// entryDir returns the directory that the layer with the given digest is cached within.
+func (c *layerCache) entryDir(digest string) string {
+	// note: ":" (e.g. "sha256:...") is not valid within windows paths
+	return filepath.Join(c.dir, strings.ReplaceAll(digest, ":", "-"))
+}
+
+// acquire marks the layer with the given digest as in use (so it is not evicted), returning a function to release it.
+func (c *layerCache) acquire(digest string) func() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.inUse[digest]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.lock.Lock()
+			defer c.lock.Unlock()
+			c.inUse[digest]--
+			if c.inUse[digest] <= 0 {
+				delete(c.inUse, digest)
+			}
+		})
+	}
+}
+
+// load returns the cached tar entries (and the detected MIME types, keyed by entry sequence) for the layer with the
+// given digest. False is returned if the layer is not cached, or the cache entry is invalid (in which case the layer is
+// indexed again, reusing the cached tar if there is one).
+func (c *layerCache) load(digest string) ([]file.TarIndexEntry, map[int64]string, bool) {
+	dir := c.entryDir(digest)
+	indexPath := filepath.Join(dir, layerCacheIndexFile)
+	contents, err := ioutil.ReadFile(indexPath)
+	if err != nil {
+		return nil, nil, false
+	}
+
+	tarPath := c.tarPath(digest)
+	if _, err := os.Stat(tarPath); err != nil {
+		return nil, nil, false
+	}
+
+	entries, mimeTypes, err := decodeLayerIndex(contents, tarPath)
+	if err != nil {
+		log.Warnf("ignoring invalid layer cache entry=%q", dir)
+		return nil, nil, false
+	}
+
+	// note: the index modification time tracks when the layer was last used (for eviction)
+	now := time.Now()
+	_ = os.Chtimes(indexPath, now, now)
+
+	log.Debugf("using cached layer=%q", digest)
+	return entries, mimeTypes, true
+}
+
+// tarPath is where the uncompressed tar for the layer with the given digest is cached.
+func (c *layerCache) tarPath(digest string) string {
+	return filepath.Join(c.entryDir(digest), digest+".tar")
+}
+
+// store persists the index for the (already cached) tar of the layer with the given digest, then evicts the least
+// recently used layers if the cache is too large.
+func (c *layerCache) store(digest string, entries []file.TarIndexEntry, mimeTypes map[int64]string) error {
+	contents, err := encodeLayerIndex(entries, mimeTypes)
+	if err != nil {
+		return err
+	}
+
+	// note: the index is written to a temp file and moved into place, so a partial index is never observed
+	if err := writeFileAtomic(c.entryDir(digest), layerCacheIndexFile, contents); err != nil {
+		return err
+	}
+
+	c.evict()
+	return nil
+}
+
+// evict removes the least recently used layers (that are not in use) until the cache is within the size limit.
+func (c *layerCache) evict() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.maxSize <= 0 {
+		return
+	}
+
+	entries, total := c.usage()
+	for _, entry := range entries {
+		if total <= c.maxSize {
+			return
+		}
+		if _, ok := c.inUse[entry.digest]; ok {
+			continue
+		}
+		log.Debugf("evicting cached layer=%q", entry.digest)
+		if err := os.RemoveAll(entry.dir); err != nil {
+			log.Warnf("unable to evict cached layer=%q: %+v", entry.digest, err)
+			continue
+		}
+		total -= entry.size
+	}
+}
+
+type layerCacheUsage struct {
+	digest   string
+	dir      string
+	size     int64
+	lastUsed time.Time
+}
+
+// usage returns all complete cache entries (least recently used first) and the total size of the cache.
+func (c *layerCache) usage() ([]layerCacheUsage, int64) {
+	dirs, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		log.Warnf("unable to read layer cache dir=%q: %+v", c.dir, err)
+		return nil, 0
+	}
+
+	var entries []layerCacheUsage
+	var total int64
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		dir := filepath.Join(c.dir, d.Name())
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+
+		entry := layerCacheUsage{
+			// note: the digest is restored from the directory name (see entryDir)
+			digest: strings.Replace(d.Name(), "-", ":", 1),
+			dir:    dir,
+		}
+		complete := false
+		for _, f := range files {
+			entry.size += f.Size()
+			if f.Name() == layerCacheIndexFile {
+				complete = true
+				entry.lastUsed = f.ModTime()
+			}
+		}
+		total += entry.size
+		if complete {
+			// note: incomplete entries may be in the process of being written, so they are never evicted
+			entries = append(entries, entry)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].lastUsed.Before(entries[j].lastUsed)
+	})
+	return entries, total
+}
+
+// encodeLayerIndex serializes the given tar entries (and the detected MIME types, keyed by entry sequence).
+func encodeLayerIndex(entries []file.TarIndexEntry, mimeTypes map[int64]string) ([]byte, error) {
+	index := cachedLayerIndex{
+		Version: layerCacheIndexVersion,
+		Entries: make([]cachedLayerEntry, len(entries)),
+	}
+	for idx, e := range entries {
+		index.Entries[idx] = cachedLayerEntry{
+			Sequence:     e.Sequence(),
+			Header:       e.Header(),
+			SeekPosition: e.SeekPosition(),
+		}
+		if mimeType, ok := mimeTypes[e.Sequence()]; ok {
+			index.Entries[idx].MIMEType = &mimeType
+		}
+	}
+	return json.Marshal(index)
+}
+
+// decodeLayerIndex restores the tar entries (and the detected MIME types, keyed by entry sequence) from a serialized
+// index, where the entries refer to the tar at the given path.
+func decodeLayerIndex(contents []byte, tarPath string) ([]file.TarIndexEntry, map[int64]string, error) {
+	var index cachedLayerIndex
+	if err := json.Unmarshal(contents, &index); err != nil {
+		return nil, nil, err
+	}
+	if index.Version != layerCacheIndexVersion {
+		return nil, nil, fmt.Errorf("unsupported layer index version=%d", index.Version)
+	}
+
+	entries := make([]file.TarIndexEntry, len(index.Entries))
+	mimeTypes := make(map[int64]string)
+	for idx, e := range index.Entries {
+		entries[idx] = file.NewTarIndexEntry(tarPath, e.Sequence, e.Header, e.SeekPosition)
+		if e.MIMEType != nil {
+			mimeTypes[e.Sequence] = *e.MIMEType
+		}
+	}
+	return entries, mimeTypes, nil
+}
+
+// writeFileAtomic writes the given contents to a temp file within the directory and moves it into place, so a partially
+// written file is never observed.
+func writeFileAtomic(dir, name string, contents []byte) error {
+	fh, err := ioutil.TempFile(dir, name+".*")
+	if err != nil {
+		return err
+	}
+	_, err = fh.Write(contents)
+	if closeErr := fh.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(fh.Name(), filepath.Join(dir, name))
+	}
+	if err != nil {
+		_ = os.Remove(fh.Name())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingLayer creates an in-memory layer from the given tar entries, counting how many times the layer is opened.
+func countingLayer(t *testing.T, opens *int, entries ...testTarEntry) v1.Layer {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, e := range entries {
+		hdr := e.header
+		require.NoError(t, tw.WriteHeader(&hdr))
+		_, err := tw.Write([]byte(e.body))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+
+	content := buf.Bytes()
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		*opens++
+		return ioutil.NopCloser(bytes.NewReader(content)), nil
+	})
+	require.NoError(t, err)
+	return layer
+}
+
+func readCachedImage(t *testing.T, cacheDir string, maxSize int64, layers ...v1.Layer) *Image {
+	t.Helper()
+	img, err := mutate.AppendLayers(empty.Image, layers...)
+	require.NoError(t, err)
+
+	result := NewImage(img, t.TempDir(), WithLayerCache(cacheDir, maxSize))
+	require.NoError(t, result.Read())
+	return result
+}
+
+func TestImage_LayerCache(t *testing.T) {
+	cacheDir := t.TempDir()
+	var opens int
+	layer := countingLayer(t, &opens,
+		testTarEntry{header: tar.Header{Name: "etc/", Typeflag: tar.TypeDir, Mode: 0755}},
+		regularEntry("etc/hosts", "127.0.0.1 localhost\n"),
+		regularEntry("bin/script.sh", "#!/bin/sh\necho hello\n"),
+		testTarEntry{header: tar.Header{Name: "bin/sh", Typeflag: tar.TypeSymlink, Linkname: "/bin/script.sh"}},
+	)
+
+	opens = 0
+	first := readCachedImage(t, cacheDir, 0, layer)
+	t.Cleanup(func() { _ = first.Cleanup() })
+	assert.Equal(t, 1, opens)
+
+	opens = 0
+	second := readCachedImage(t, cacheDir, 0, layer)
+	t.Cleanup(func() { _ = second.Cleanup() })
+	assert.Equal(t, 0, opens, "cached layer should not be fetched again")
+
+	assert.ElementsMatch(t, realPaths(first.SquashedTree().AllFiles()), realPaths(second.SquashedTree().AllFiles()))
+	assert.Equal(t, first.Metadata.Size, second.Metadata.Size)
+
+	for _, p := range []file.Path{"/etc/hosts", "/bin/script.sh"} {
+		expected, err := first.FileMetadataFromSquash(p)
+		require.NoError(t, err)
+		actual, err := second.FileMetadataFromSquash(p)
+		require.NoError(t, err)
+		assert.Equal(t, expected.MIMEType, actual.MIMEType)
+		assert.NotEmpty(t, actual.MIMEType)
+	}
+
+	reader, err := second.FileContentsFromSquash("/bin/sh")
+	require.NoError(t, err)
+	contents, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "#!/bin/sh\necho hello\n", string(contents))
+
+	// the cache outlives the image
+	require.NoError(t, first.Cleanup())
+	require.NoError(t, second.Cleanup())
+	cache, err := getLayerCache(cacheDir, 0)
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(cache.entryDir(first.Layers[0].Metadata.Digest), layerCacheIndexFile))
+}
+
+func TestImage_LayerCache_Eviction(t *testing.T) {
+	cacheDir := t.TempDir()
+	var opens int
+	body := string(bytes.Repeat([]byte("a"), 4096))
+	older := countingLayer(t, &opens, regularEntry("older", body))
+	newer := countingLayer(t, &opens, regularEntry("newer", body))
+
+	// the cache may only hold a single layer, however, layers in use are never evicted
+	first := readCachedImage(t, cacheDir, 6000, older)
+	second := readCachedImage(t, cacheDir, 6000, newer)
+	t.Cleanup(func() { _ = second.Cleanup() })
+
+	cache, err := getLayerCache(cacheDir, 6000)
+	require.NoError(t, err)
+	olderDigest := first.Layers[0].Metadata.Digest
+	newerDigest := second.Layers[0].Metadata.Digest
+	assert.DirExists(t, cache.entryDir(olderDigest))
+	assert.DirExists(t, cache.entryDir(newerDigest))
+
+	// once released, the least recently used layer is evicted on the next store
+	require.NoError(t, first.Cleanup())
+	third := readCachedImage(t, cacheDir, 6000, countingLayer(t, &opens, regularEntry("third", body)))
+	t.Cleanup(func() { _ = third.Cleanup() })
+
+	assert.NoDirExists(t, cache.entryDir(olderDigest))
+	assert.DirExists(t, cache.entryDir(newerDigest))
+	assert.DirExists(t, cache.entryDir(third.Layers[0].Metadata.Digest))
+}
+
+func TestImage_LayerCache_InvalidIndex(t *testing.T) {
+	cacheDir := t.TempDir()
+	var opens int
+	layer := countingLayer(t, &opens, regularEntry("etc/hosts", "127.0.0.1 localhost\n"))
+
+	first := readCachedImage(t, cacheDir, 0, layer)
+	require.NoError(t, first.Cleanup())
+
+	cache, err := getLayerCache(cacheDir, 0)
+	require.NoError(t, err)
+	indexPath := filepath.Join(cache.entryDir(first.Layers[0].Metadata.Digest), layerCacheIndexFile)
+	require.NoError(t, ioutil.WriteFile(indexPath, []byte("{not json"), 0644))
+
+	// an invalid cache entry is indexed again (the cached tar is still complete, so it is not fetched again)
+	opens = 0
+	second := readCachedImage(t, cacheDir, 0, layer)
+	t.Cleanup(func() { _ = second.Cleanup() })
+	assert.Equal(t, 0, opens)
+
+	r, err := second.FileContentsFromSquash("/etc/hosts")
+	require.NoError(t, err)
+	contents, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1 localhost\n", string(contents))
+
+	_, _, ok := cache.load(first.Layers[0].Metadata.Digest)
+	assert.True(t, ok, "the index should be stored again")
+}
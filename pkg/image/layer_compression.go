@@ -0,0 +1,176 @@
+package image
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/anchore/stereoscope/internal/log"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+const (
+	OCIZstdLayer           types.MediaType = "application/vnd.oci.image.layer.v1.tar+zstd"
+	OCIZstdRestrictedLayer types.MediaType = "application/vnd.oci.image.layer.nondistributable.v1.tar+zstd"
+)
+
+// Compression is the compression format of a (tar) layer blob.
+type Compression string
+
+const (
+	NoCompression   Compression = "none"
+	GzipCompression Compression = "gzip"
+	ZstdCompression Compression = "zstd"
+)
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	bzip2Magic = []byte("BZh")
+	xzMagic    = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+)
+
+// ErrUnsupportedLayerCompression is returned when a tar layer is compressed with a format that cannot be decompressed.
+type ErrUnsupportedLayerCompression struct {
+	MediaType types.MediaType
+	// Compression is the format detected from the layer content (if known)
+	Compression string
+}
+
+func (e *ErrUnsupportedLayerCompression) Error() string {
+	if e.Compression != "" {
+		return fmt.Sprintf("unsupported layer compression=%q for media type=%q", e.Compression, e.MediaType)
+	}
+	return fmt.Sprintf("unsupported layer compression for media type=%q", e.MediaType)
+}
+
+// LayerCompression returns the compression format of a tar layer blob with the given (manifest descriptor) media type.
+func LayerCompression(mediaType types.MediaType) (Compression, error) {
+	switch mediaType {
+	case types.OCILayer,
+		types.OCIRestrictedLayer,
+		types.DockerLayer,
+		types.DockerForeignLayer:
+		return GzipCompression, nil
+	case OCIZstdLayer,
+		OCIZstdRestrictedLayer:
+		return ZstdCompression, nil
+	case types.OCIUncompressedLayer,
+		types.OCIUncompressedRestrictedLayer,
+		types.DockerUncompressedLayer:
+		return NoCompression, nil
+	}
+
+	// e.g. "application/vnd.oci.image.layer.v1.tar+bzip2" is a tar layer, but not one that can be read
+	mt := string(mediaType)
+	if strings.Contains(mt, ".tar+") || strings.Contains(mt, ".tar.") {
+		return "", &ErrUnsupportedLayerCompression{MediaType: mediaType}
+	}
+	return "", fmt.Errorf("unknown layer media type: %+v", mediaType)
+}
+
+// UncompressedLayerReader returns the uncompressed tar stream for the given layer. The decompression format is selected
+// by the layer media type, however, since layers are not always labeled correctly (e.g. a docker-archive layer with a
+// gzip media type that was saved uncompressed), the raw layer blob is sniffed to correct the selection when the magic
+// bytes indicate another format. Note: only the raw blob is ever sniffed, never content that was already decompressed.
+func UncompressedLayerReader(layer v1.Layer) (io.ReadCloser, error) {
+	mediaType, err := layer.MediaType()
+	if err != nil {
+		return nil, err
+	}
+
+	compression, err := LayerCompression(mediaType)
+	if err != nil {
+		return nil, err
+	}
+
+	if compression != ZstdCompression {
+		// the GCR lib decompresses gzip content (and passes uncompressed content through as-is)
+		rc, err := layer.Uncompressed()
+		if err == nil {
+			return rc, nil
+		}
+		// the GCR lib rejects any blob that is neither gzip compressed nor uncompressed, sniff the raw blob instead
+		log.Debugf("unable to decompress layer with media type=%q, sniffing content: %+v", mediaType, err)
+		compression = NoCompression
+	}
+
+	// the GCR lib only decompresses gzip content, so the raw blob must be used
+	rc, err := layer.Compressed()
+	if err != nil {
+		return nil, err
+	}
+	return decompressingReader(rc, mediaType, compression)
+}
+
+// decompressingReader wraps the given reader with a decompressor for the expected compression format, unless the magic
+// bytes of the content indicate another format.
+func decompressingReader(rc io.ReadCloser, mediaType types.MediaType, expected Compression) (io.ReadCloser, error) {
+	br := bufio.NewReader(rc)
+	// note: a short peek (e.g. an empty layer) is not an error, there is just no magic to match
+	magic, _ := br.Peek(len(xzMagic))
+
+	compression := expected
+	switch {
+	case bytes.HasPrefix(magic, zstdMagic):
+		compression = ZstdCompression
+	case bytes.HasPrefix(magic, gzipMagic):
+		compression = GzipCompression
+	case isBzip2Magic(magic):
+		_ = rc.Close()
+		return nil, &ErrUnsupportedLayerCompression{MediaType: mediaType, Compression: "bzip2"}
+	case bytes.HasPrefix(magic, xzMagic):
+		_ = rc.Close()
+		return nil, &ErrUnsupportedLayerCompression{MediaType: mediaType, Compression: "xz"}
+	}
+
+	if compression != expected {
+		log.Debugf("layer with media type=%q has %s compressed content", mediaType, compression)
+	}
+
+	switch compression {
+	case ZstdCompression:
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			_ = rc.Close()
+			return nil, fmt.Errorf("unable to read zstd layer with media type=%q: %w", mediaType, err)
+		}
+		return &decompressedReadCloser{Reader: zr, close: func() error {
+			zr.Close()
+			return rc.Close()
+		}}, nil
+	case GzipCompression:
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			_ = rc.Close()
+			return nil, fmt.Errorf("unable to read gzip layer with media type=%q: %w", mediaType, err)
+		}
+		return &decompressedReadCloser{Reader: gr, close: func() error {
+			_ = gr.Close()
+			return rc.Close()
+		}}, nil
+	}
+	return &decompressedReadCloser{Reader: br, close: rc.Close}, nil
+}
+
+// isBzip2Magic indicates if the given bytes begin with the bzip2 magic, which is followed by the block size (a digit from
+// 1 to 9).
+func isBzip2Magic(magic []byte) bool {
+	n := len(bzip2Magic)
+	return len(magic) > n && bytes.HasPrefix(magic, bzip2Magic) && magic[n] >= '1' && magic[n] <= '9'
+}
+
+type decompressedReadCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (r *decompressedReadCloser) Close() error {
+	return r.close()
+}
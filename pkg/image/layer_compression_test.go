@@ -0,0 +1,258 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// blobLayer is a layer with a fixed (raw) blob and media type, as it would be described by a manifest descriptor.
+type blobLayer struct {
+	blob      []byte
+	diffID    v1.Hash
+	mediaType types.MediaType
+}
+
+func newBlobLayer(t *testing.T, blob []byte, uncompressed []byte, mediaType types.MediaType) v1.Layer {
+	t.Helper()
+	diffID, _, err := v1.SHA256(bytes.NewReader(uncompressed))
+	require.NoError(t, err)
+	layer, err := partial.CompressedToLayer(&blobLayer{blob: blob, diffID: diffID, mediaType: mediaType})
+	require.NoError(t, err)
+	return layer
+}
+
+func (b *blobLayer) Digest() (v1.Hash, error) {
+	h, _, err := v1.SHA256(bytes.NewReader(b.blob))
+	return h, err
+}
+
+func (b *blobLayer) DiffID() (v1.Hash, error) {
+	return b.diffID, nil
+}
+
+func (b *blobLayer) Compressed() (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewReader(b.blob)), nil
+}
+
+func (b *blobLayer) Size() (int64, error) {
+	return int64(len(b.blob)), nil
+}
+
+func (b *blobLayer) MediaType() (types.MediaType, error) {
+	return b.mediaType, nil
+}
+
+func compressionTestTar(t *testing.T) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	content := "hello from a compressed layer"
+	require.NoError(t, tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     "etc/greeting",
+		Mode:     0644,
+		Size:     int64(len(content)),
+		ModTime:  mockModTime,
+	}))
+	_, err := io.WriteString(tw, content)
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+func gzipBytes(t *testing.T, b []byte) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	w := gzip.NewWriter(buf)
+	_, err := w.Write(b)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func zstdBytes(t *testing.T, b []byte) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	w, err := zstd.NewWriter(buf)
+	require.NoError(t, err)
+	_, err = w.Write(b)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestLayerCompression(t *testing.T) {
+	tests := []struct {
+		mediaType   types.MediaType
+		expected    Compression
+		unsupported bool
+		wantErr     bool
+	}{
+		{mediaType: types.OCILayer, expected: GzipCompression},
+		{mediaType: types.OCIRestrictedLayer, expected: GzipCompression},
+		{mediaType: types.DockerLayer, expected: GzipCompression},
+		{mediaType: types.DockerForeignLayer, expected: GzipCompression},
+		{mediaType: OCIZstdLayer, expected: ZstdCompression},
+		{mediaType: OCIZstdRestrictedLayer, expected: ZstdCompression},
+		{mediaType: types.OCIUncompressedLayer, expected: NoCompression},
+		{mediaType: types.OCIUncompressedRestrictedLayer, expected: NoCompression},
+		{mediaType: types.DockerUncompressedLayer, expected: NoCompression},
+		{mediaType: "application/vnd.oci.image.layer.v1.tar+bzip2", unsupported: true, wantErr: true},
+		{mediaType: "application/vnd.example.rootfs.diff.tar.xz", unsupported: true, wantErr: true},
+		{mediaType: types.OCIConfigJSON, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(string(test.mediaType), func(t *testing.T) {
+			actual, err := LayerCompression(test.mediaType)
+			if !test.wantErr {
+				require.NoError(t, err)
+				assert.Equal(t, test.expected, actual)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), string(test.mediaType))
+			var unsupported *ErrUnsupportedLayerCompression
+			assert.Equal(t, test.unsupported, errors.As(err, &unsupported))
+		})
+	}
+}
+
+func TestUncompressedLayerReader(t *testing.T) {
+	tarContent := compressionTestTar(t)
+
+	// a tar where the first entry name begins with the bzip2 magic (without a block size)
+	magicBuf := &bytes.Buffer{}
+	tw := tar.NewWriter(magicBuf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "BZh.txt", Mode: 0644, ModTime: mockModTime}))
+	require.NoError(t, tw.Close())
+	magicTar := magicBuf.Bytes()
+
+	tests := []struct {
+		name      string
+		blob      []byte
+		mediaType types.MediaType
+		expected  []byte
+		wantErr   string
+	}{
+		{
+			name:      "gzip",
+			blob:      gzipBytes(t, tarContent),
+			mediaType: types.OCILayer,
+		},
+		{
+			name:      "zstd",
+			blob:      zstdBytes(t, tarContent),
+			mediaType: OCIZstdLayer,
+		},
+		{
+			name:      "uncompressed",
+			blob:      tarContent,
+			mediaType: types.OCIUncompressedLayer,
+		},
+		{
+			name:      "zstd content labeled as gzip",
+			blob:      zstdBytes(t, tarContent),
+			mediaType: types.DockerLayer,
+		},
+		{
+			name:      "uncompressed content labeled as gzip",
+			blob:      tarContent,
+			mediaType: types.DockerLayer,
+		},
+		{
+			name:      "gzip content labeled as zstd",
+			blob:      gzipBytes(t, tarContent),
+			mediaType: OCIZstdLayer,
+		},
+		{
+			name:      "xz content",
+			blob:      append([]byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, tarContent...),
+			mediaType: types.DockerLayer,
+			wantErr:   `unsupported layer compression="xz" for media type="application/vnd.docker.image.rootfs.diff.tar.gzip"`,
+		},
+		{
+			name:      "bzip2 content",
+			blob:      append([]byte("BZh9"), tarContent...),
+			mediaType: types.DockerLayer,
+			wantErr:   `unsupported layer compression="bzip2" for media type="application/vnd.docker.image.rootfs.diff.tar.gzip"`,
+		},
+		{
+			// only the raw blob is sniffed, the uncompressed tar may start with anything (e.g. a path with magic bytes)
+			name:      "gzip content with a tar that starts with magic bytes",
+			blob:      gzipBytes(t, magicTar),
+			mediaType: types.OCILayer,
+			expected:  magicTar,
+		},
+		{
+			name:      "uncompressed content that starts with bzip2 magic without a block size",
+			blob:      magicTar,
+			mediaType: types.DockerLayer,
+			expected:  magicTar,
+		},
+		{
+			name:      "unsupported media type",
+			blob:      tarContent,
+			mediaType: "application/vnd.oci.image.layer.v1.tar+bzip2",
+			wantErr:   `unsupported layer compression for media type="application/vnd.oci.image.layer.v1.tar+bzip2"`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rc, err := UncompressedLayerReader(newBlobLayer(t, test.blob, tarContent, test.mediaType))
+			if test.wantErr != "" {
+				require.EqualError(t, err, test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			defer rc.Close()
+
+			expected := test.expected
+			if expected == nil {
+				expected = tarContent
+			}
+			actual, err := ioutil.ReadAll(rc)
+			require.NoError(t, err)
+			assert.Equal(t, expected, actual)
+		})
+	}
+}
+
+func TestImage_Read_ZstdLayer(t *testing.T) {
+	tarContent := compressionTestTar(t)
+	layer := newBlobLayer(t, zstdBytes(t, tarContent), tarContent, OCIZstdLayer)
+
+	img, err := mutate.AppendLayers(empty.Image, layer)
+	require.NoError(t, err)
+
+	result := NewImage(img, t.TempDir())
+	require.NoError(t, result.Read())
+	t.Cleanup(func() {
+		require.NoError(t, result.Cleanup())
+	})
+
+	require.Len(t, result.Layers, 1)
+	assert.Equal(t, OCIZstdLayer, result.Layers[0].Metadata.MediaType)
+
+	rc, err := result.FileContentsFromSquash(file.Path("/etc/greeting"))
+	require.NoError(t, err)
+	defer rc.Close()
+	actual, err := ioutil.ReadAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, "hello from a compressed layer", string(actual))
+}
@@ -0,0 +1,127 @@
+package image
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree"
+	"github.com/anchore/stereoscope/pkg/filetree/filenode"
+)
+
+// LayerDiff describes the paths that a single layer contributes relative to the squash of all layers below it.
+type LayerDiff struct {
+	// Added are paths within the layer that do not exist in the lower squash tree
+	Added []file.Path
+	// Modified are paths within the layer that replace an existing path in the lower squash tree
+	Modified []file.Path
+	// Deleted are paths in the lower squash tree that are removed by whiteout or opaque whiteout entries in the layer
+	Deleted []file.Path
+}
+
+// LayerDiff returns the added, modified, and deleted paths for the layer at the given index relative to the squash
+// of all lower layers. Paths that are only implied by the layer (parent directories without a tar entry) are not
+// considered to be contributed by the layer.
+func (i *Image) LayerDiff(idx int) (*LayerDiff, error) {
+	if idx < 0 || idx >= len(i.Layers) {
+		return nil, fmt.Errorf("invalid layer index=%d (image has %d layers)", idx, len(i.Layers))
+	}
+
+	layer := i.Layers[idx]
+	if layer.Tree == nil {
+		return nil, fmt.Errorf("layer %d has not been read", idx)
+	}
+
+	var lower *filetree.FileTree
+	if idx > 0 {
+		lower = i.Layers[idx-1].SquashedTree
+		if lower == nil {
+			return nil, fmt.Errorf("layer %d does not have a squashed tree", idx-1)
+		}
+	}
+
+	return newLayerDiff(layer.Tree, lower)
+}
+
+// newLayerDiff compares the given layer tree to the squash of all lower layers (nil for the lowest layer).
+func newLayerDiff(tree, lower *filetree.FileTree) (*LayerDiff, error) {
+	var diff LayerDiff
+	contributed := file.NewPathSet()
+	deleted := file.NewPathSet()
+
+	lowerPaths := file.NewPathSet()
+	if lower != nil {
+		for _, p := range lower.AllRealPaths() {
+			lowerPaths.Add(p)
+		}
+	}
+
+	// removeFromLower marks the given path and all descendants in the lower squash tree as deleted. Only the subtree of
+	// the path within the lower squash tree is walked (not every lower path).
+	removeFromLower := func(dir file.Path, includeDir bool) error {
+		if lower == nil {
+			return nil
+		}
+		if _, exists := lower.Type(dir); !exists {
+			return nil
+		}
+		return lower.WalkFrom(dir, func(_ file.Path, f filenode.FileNode) error {
+			// note: when an ancestor of the directory is a link the paths walked are within the link target (not
+			// the directory), which are not removed
+			p := f.RealPath
+			if (p == dir && includeDir) || (p != dir && p.HasPrefix(dir)) {
+				deleted.Add(p)
+			}
+			return nil
+		})
+	}
+
+	for _, p := range tree.AllRealPaths() {
+		target, kind, err := p.UnWhiteoutPath()
+		switch kind {
+		case file.OpaqueDirWhiteout:
+			if err != nil {
+				return nil, fmt.Errorf("unable to find parent of opaque whiteout=%q: %w", p, err)
+			}
+			// opaque whiteouts remove all lower contents of the parent directory, but not the directory itself
+			if err := removeFromLower(target, false); err != nil {
+				return nil, fmt.Errorf("unable to find lower paths within opaque whiteout=%q: %w", p, err)
+			}
+		case file.FileWhiteout:
+			if err != nil {
+				return nil, fmt.Errorf("unable to find original path for whiteout=%q: %w", p, err)
+			}
+			if err := removeFromLower(target, true); err != nil {
+				return nil, fmt.Errorf("unable to find lower paths for whiteout=%q: %w", p, err)
+			}
+		default:
+			_, ref, err := tree.File(p)
+			if err != nil {
+				return nil, err
+			}
+			if ref == nil {
+				// this path is only implied by descendants in the layer, not contributed by it
+				continue
+			}
+			contributed.Add(p)
+			if lowerPaths.Contains(p) {
+				diff.Modified = append(diff.Modified, p)
+			} else {
+				diff.Added = append(diff.Added, p)
+			}
+		}
+	}
+
+	for p := range deleted {
+		// a path that was removed and then re-added in the same layer is a modification, not a deletion
+		if !contributed.Contains(p) {
+			diff.Deleted = append(diff.Deleted, p)
+		}
+	}
+
+	sort.Sort(file.Paths(diff.Added))
+	sort.Sort(file.Paths(diff.Modified))
+	sort.Sort(file.Paths(diff.Deleted))
+
+	return &diff, nil
+}
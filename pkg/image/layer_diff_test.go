@@ -0,0 +1,76 @@
+package image
+
+import (
+	"context"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wagoodman/go-progress"
+)
+
+// layerTree builds a layer diff tree where every given path has a file reference (as if it were a tar entry).
+func layerTree(t *testing.T, dirs []string, files []string) *filetree.FileTree {
+	t.Helper()
+	tr := filetree.NewFileTree()
+	for _, d := range dirs {
+		_, err := tr.AddDir(file.Path(d))
+		require.NoError(t, err)
+	}
+	for _, f := range files {
+		_, err := tr.AddFile(file.Path(f))
+		require.NoError(t, err)
+	}
+	return tr
+}
+
+func toPaths(values ...string) []file.Path {
+	var paths []file.Path
+	for _, v := range values {
+		paths = append(paths, file.Path(v))
+	}
+	return paths
+}
+
+func TestImage_LayerDiff(t *testing.T) {
+	img := Image{
+		Layers: []*Layer{
+			{Tree: layerTree(t,
+				[]string{"/etc", "/opt", "/opt/app", "/var"},
+				[]string{"/etc/hosts", "/etc/passwd", "/opt/app/a.txt", "/opt/app/b.txt", "/var/log.txt"},
+			)},
+			{Tree: layerTree(t,
+				[]string{"/opt/app"},
+				[]string{"/etc/passwd", "/etc/.wh.hosts", "/opt/app/.wh..wh..opq", "/opt/app/b.txt", "/usr/bin/tool", "/.wh.var"},
+			)},
+		},
+	}
+	require.NoError(t, img.squash(context.Background(), &progress.Manual{}))
+
+	t.Run("first layer is all additions", func(t *testing.T) {
+		diff, err := img.LayerDiff(0)
+		require.NoError(t, err)
+		assert.Equal(t, toPaths("/etc", "/etc/hosts", "/etc/passwd", "/opt", "/opt/app", "/opt/app/a.txt", "/opt/app/b.txt", "/var", "/var/log.txt"), diff.Added)
+		assert.Empty(t, diff.Modified)
+		assert.Empty(t, diff.Deleted)
+	})
+
+	t.Run("upper layer", func(t *testing.T) {
+		diff, err := img.LayerDiff(1)
+		require.NoError(t, err)
+		// note: /usr is only implied by /usr/bin/tool, so is not reported
+		assert.Equal(t, toPaths("/usr/bin/tool"), diff.Added)
+		assert.Equal(t, toPaths("/etc/passwd", "/opt/app", "/opt/app/b.txt"), diff.Modified)
+		// note: /opt/app/b.txt is re-added after the opaque whiteout, so is not considered deleted
+		assert.Equal(t, toPaths("/etc/hosts", "/opt/app/a.txt", "/var", "/var/log.txt"), diff.Deleted)
+	})
+
+	t.Run("invalid index", func(t *testing.T) {
+		_, err := img.LayerDiff(2)
+		assert.Error(t, err)
+		_, err = img.LayerDiff(-1)
+		assert.Error(t, err)
+	})
+}
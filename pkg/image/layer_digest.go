@@ -0,0 +1,154 @@
+package image
+
+import (
+	"crypto"
+	// register the digest algorithms (see digestAlgorithms)
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// ErrLayerDigestMismatch is returned when reading a layer with digest verification enabled (see WithDigestVerification)
+// and the layer content does not match the digest recorded for it.
+type ErrLayerDigestMismatch struct {
+	// Layer is the expected layer diff ID (the digest of the uncompressed layer tar)
+	Layer string
+	// Uncompressed indicates that the uncompressed tar does not match the diff ID from the image config, otherwise the
+	// (compressed) layer blob does not match the digest from the manifest
+	Uncompressed bool
+	Expected     string
+	Actual       string
+}
+
+func (e *ErrLayerDigestMismatch) Error() string {
+	if e.Uncompressed {
+		return fmt.Sprintf("layer=%q content does not match the diff id (actual=%s)", e.Layer, e.Actual)
+	}
+	return fmt.Sprintf("layer=%q blob does not match the manifest digest=%s (actual=%s)", e.Layer, e.Expected, e.Actual)
+}
+
+// WithDigestVerification verifies the content of every tar layer while it is read: the (compressed) layer blob must
+// match the digest from the image manifest, and the uncompressed tar must match the diff ID from the image config.
+// Reading is aborted with an ErrLayerDigestMismatch otherwise. This is recommended when reading untrusted images. Layers
+// read from the layer cache (see WithLayerCache) are not verified again.
+func WithDigestVerification(enabled bool) AdditionalMetadata {
+	return func(image *Image) error {
+		image.verifyDigests = enabled
+		return nil
+	}
+}
+
+// digestAlgorithms are the supported algorithms for layer digests (by the name used within a digest, e.g. "sha256:...").
+var digestAlgorithms = map[string]crypto.Hash{
+	"sha256": crypto.SHA256,
+	"sha384": crypto.SHA384,
+	"sha512": crypto.SHA512,
+}
+
+// newDigestHash returns a new hash for the algorithm named by the given digest (e.g. "sha512:...").
+func newDigestHash(digest string) (hash.Hash, error) {
+	algorithm := strings.SplitN(digest, ":", 2)[0]
+	h, ok := digestAlgorithms[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unsupported digest algorithm=%q for digest=%q", algorithm, digest)
+	}
+	return h.New(), nil
+}
+
+// formatDigest formats the sum of the given hash as a digest with the same algorithm as the expected digest.
+func formatDigest(expected string, h hash.Hash) string {
+	return fmt.Sprintf("%s:%x", strings.SplitN(expected, ":", 2)[0], h.Sum(nil))
+}
+
+// verifiedLayerReader returns the uncompressed tar stream for the given layer (see UncompressedLayerReader), where the
+// compressed blob and the uncompressed tar are hashed as the stream is read. Once the stream is exhausted both digests
+// are checked, and an ErrLayerDigestMismatch is returned instead of io.EOF if either does not match.
+func verifiedLayerReader(layer v1.Layer, diffID string) (io.ReadCloser, error) {
+	mediaType, err := layer.MediaType()
+	if err != nil {
+		return nil, err
+	}
+	compression, err := LayerCompression(mediaType)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := layer.Digest()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get digest for layer=%q: %w", diffID, err)
+	}
+
+	compressedHash, err := newDigestHash(digest.String())
+	if err != nil {
+		return nil, fmt.Errorf("unable to verify layer=%q: %w", diffID, err)
+	}
+	uncompressedHash, err := newDigestHash(diffID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to verify layer=%q: %w", diffID, err)
+	}
+
+	compressed, err := layer.Compressed()
+	if err != nil {
+		return nil, err
+	}
+
+	raw := io.TeeReader(compressed, compressedHash)
+	uncompressed, err := decompressingReader(&decompressedReadCloser{Reader: raw, close: compressed.Close}, mediaType, compression)
+	if err != nil {
+		return nil, err
+	}
+
+	return &verifyingReader{
+		uncompressed:     uncompressed,
+		raw:              raw,
+		diffID:           diffID,
+		digest:           digest.String(),
+		compressedHash:   compressedHash,
+		uncompressedHash: uncompressedHash,
+	}, nil
+}
+
+type verifyingReader struct {
+	uncompressed io.ReadCloser
+	// raw is the compressed blob (hashed as it is read)
+	raw              io.Reader
+	diffID           string
+	digest           string
+	compressedHash   hash.Hash
+	uncompressedHash hash.Hash
+}
+
+func (r *verifyingReader) Read(p []byte) (int, error) {
+	n, err := r.uncompressed.Read(p)
+	r.uncompressedHash.Write(p[:n])
+	if err == io.EOF {
+		if verifyErr := r.verify(); verifyErr != nil {
+			return n, verifyErr
+		}
+	}
+	return n, err
+}
+
+func (r *verifyingReader) verify() error {
+	// note: the decompressor may not consume any trailing bytes of the blob, which still count toward the digest
+	if _, err := io.Copy(ioutil.Discard, r.raw); err != nil {
+		return fmt.Errorf("unable to read layer=%q: %w", r.diffID, err)
+	}
+
+	if actual := formatDigest(r.digest, r.compressedHash); actual != r.digest {
+		return &ErrLayerDigestMismatch{Layer: r.diffID, Expected: r.digest, Actual: actual}
+	}
+	if actual := formatDigest(r.diffID, r.uncompressedHash); actual != r.diffID {
+		return &ErrLayerDigestMismatch{Layer: r.diffID, Uncompressed: true, Expected: r.diffID, Actual: actual}
+	}
+	return nil
+}
+
+func (r *verifyingReader) Close() error {
+	return r.uncompressed.Close()
+}
@@ -0,0 +1,114 @@
+package image
+
+import (
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tamperedLayer is a layer that reports the given digest and diff ID (if set) instead of those of its content.
+type tamperedLayer struct {
+	v1.Layer
+	digest *v1.Hash
+	diffID *v1.Hash
+}
+
+func (l tamperedLayer) Digest() (v1.Hash, error) {
+	if l.digest != nil {
+		return *l.digest, nil
+	}
+	return l.Layer.Digest()
+}
+
+func (l tamperedLayer) DiffID() (v1.Hash, error) {
+	if l.diffID != nil {
+		return *l.diffID, nil
+	}
+	return l.Layer.DiffID()
+}
+
+func TestWithDigestVerification(t *testing.T) {
+	bogus, err := v1.NewHash("sha256:0000000000000000000000000000000000000000000000000000000000000000")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		layer        func(v1.Layer) v1.Layer
+		verify       bool
+		uncompressed *bool
+	}{
+		{
+			name:   "matching digests",
+			layer:  func(l v1.Layer) v1.Layer { return l },
+			verify: true,
+		},
+		{
+			// the blob is hashed with the algorithm named by the manifest digest
+			name:   "matching sha512 manifest digest",
+			layer:  func(l v1.Layer) v1.Layer { return tamperedLayer{Layer: l, digest: sha512Digest(t, l)} },
+			verify: true,
+		},
+		{
+			name:         "mismatched manifest digest",
+			layer:        func(l v1.Layer) v1.Layer { return tamperedLayer{Layer: l, digest: &bogus} },
+			verify:       true,
+			uncompressed: boolRef(false),
+		},
+		{
+			name:         "mismatched diff id",
+			layer:        func(l v1.Layer) v1.Layer { return tamperedLayer{Layer: l, diffID: &bogus} },
+			verify:       true,
+			uncompressed: boolRef(true),
+		},
+		{
+			name:  "not verified",
+			layer: func(l v1.Layer) v1.Layer { return tamperedLayer{Layer: l, digest: &bogus, diffID: &bogus} },
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			layer := test.layer(newTestLayer(t, regularEntry("etc/hosts", "127.0.0.1 localhost\n")))
+			img, err := mutate.AppendLayers(empty.Image, layer)
+			require.NoError(t, err)
+
+			result := NewImage(img, t.TempDir(), WithDigestVerification(test.verify))
+			err = result.Read()
+			t.Cleanup(func() { _ = result.Cleanup() })
+
+			if test.uncompressed == nil {
+				require.NoError(t, err)
+				assert.True(t, result.SquashedTree().HasPath("/etc/hosts"))
+				return
+			}
+			var mismatch *ErrLayerDigestMismatch
+			require.True(t, errors.As(err, &mismatch), "unexpected error: %+v", err)
+			assert.Equal(t, *test.uncompressed, mismatch.Uncompressed)
+			assert.Equal(t, bogus.String(), mismatch.Expected)
+		})
+	}
+}
+
+// sha512Digest returns the sha512 digest of the compressed layer blob.
+func sha512Digest(t *testing.T, l v1.Layer) *v1.Hash {
+	t.Helper()
+	rc, err := l.Compressed()
+	require.NoError(t, err)
+	defer rc.Close()
+	h := sha512.New()
+	_, err = io.Copy(h, rc)
+	require.NoError(t, err)
+	return &v1.Hash{Algorithm: "sha512", Hex: fmt.Sprintf("%x", h.Sum(nil))}
+}
+
+func boolRef(b bool) *bool {
+	return &b
+}
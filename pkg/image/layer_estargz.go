@@ -0,0 +1,115 @@
+package image
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/wagoodman/go-progress"
+
+	"github.com/anchore/stereoscope/internal/log"
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+// RandomAccessLayer is a layer whose compressed blob can be read at random (e.g. a registry layer read with HTTP range
+// requests). This allows an eStargz layer to be indexed from its table of contents (see WithEStargzLayers).
+type RandomAccessLayer interface {
+	v1.Layer
+	// CompressedReaderAt returns a reader for the compressed layer blob, along with the size of the blob.
+	CompressedReaderAt() (io.ReaderAt, int64, error)
+}
+
+// WithEStargzLayers indexes every eStargz layer (a gzip layer with a table of contents describing where each file is
+// within the compressed blob) from its table of contents, so the layer is never downloaded or decompressed in full.
+// Only the byte ranges of the files whose contents are read are fetched. This only applies to layers that can be read
+// at random (see RandomAccessLayer, e.g. layers from a registry that supports range requests). All other layers
+// (e.g. plain gzip layers) are read in full as usual. This is disabled by default since there are tradeoffs:
+//   - the MIME type of each file is not known (detecting it would require reading the contents of every file)
+//   - layers are not verified against their digest (see WithDigestVerification, eStargz layers are read in full when
+//     verification is enabled)
+//   - when file digests are computed (see WithFileDigests) the contents of every regular file are fetched
+func WithEStargzLayers(enabled bool) AdditionalMetadata {
+	return func(image *Image) error {
+		image.estargzLayers = enabled
+		return nil
+	}
+}
+
+// readEStargz indexes the layer from its eStargz table of contents, returning false (without any changes to the layer)
+// when the layer cannot be read at random or is not an eStargz layer, in which case the layer must be read in full.
+func (l *Layer) readEStargz(ctx context.Context, monitor *progress.Manual) (bool, error) {
+	randomAccess, ok := l.layer.(RandomAccessLayer)
+	if !ok || l.verifyDigests {
+		return false, nil
+	}
+
+	readerAt, size, err := randomAccess.CompressedReaderAt()
+	if err != nil {
+		log.Debugf("unable to read layer=%q at random, reading in full: %+v", l.Metadata.Digest, err)
+		return false, nil
+	}
+	toc, err := estargz.Open(io.NewSectionReader(readerAt, 0, size))
+	if err != nil {
+		log.Debugf("layer=%q is not an eStargz layer, reading in full: %+v", l.Metadata.Digest, err)
+		return false, nil
+	}
+
+	log.Debugf("indexing layer=%q from the eStargz table of contents", l.Metadata.Digest)
+	err = file.WalkEStargz(toc, func(name string, entry *estargz.TOCEntry) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		metadata := file.NewMetadataFromEStargzEntry(name, entry)
+		if l.pathFilter.skip(file.Path(metadata.Path), metadata.IsDir) {
+			return nil
+		}
+		// note: eStargz layers are not decompressed up front, so file sizes count toward the total limit instead
+		if err := l.limiter.checkFile(metadata.Path, metadata.Size); err != nil {
+			return err
+		}
+		if err := l.limiter.add(metadata.Size); err != nil {
+			return err
+		}
+		if err := checkPathDepth(l.maxPathDepth, metadata.Path, metadata.Linkname); err != nil {
+			return err
+		}
+
+		open := func() (io.ReadCloser, error) {
+			contents, err := toc.OpenFile(name)
+			if err != nil {
+				return nil, err
+			}
+			return ioutil.NopCloser(contents), nil
+		}
+		opener := func() io.ReadCloser {
+			if metadata.TypeFlag != tar.TypeReg {
+				// only regular files have contents within the layer
+				return ioutil.NopCloser(io.LimitReader(nil, 0))
+			}
+			contents, err := open()
+			if err != nil {
+				return errorReadCloser{err: err}
+			}
+			return contents
+		}
+
+		fileReference, err := l.addEntry(&metadata, open)
+		if err != nil {
+			return err
+		}
+
+		l.Metadata.Size += metadata.Size
+		l.fileCatalog.Add(*fileReference, metadata, l, opener)
+
+		monitor.N++
+		return nil
+	})
+	if err != nil {
+		return true, fmt.Errorf("failed to read layer=%q table of contents: %w", l.Metadata.Digest, err)
+	}
+	return true, nil
+}
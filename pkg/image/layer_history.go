@@ -0,0 +1,47 @@
+package image
+
+import (
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// History returns the image config history entries that describe this layer: the entry that created the layer
+// followed by any empty layer entries (e.g. ENV, CMD, LABEL instructions) up until the entry for the next layer. This
+// mirrors how each empty layer entry describes a change to the image config made on top of the layer below it. Any
+// empty layer entries before the first layer are attributed to the first layer. If the history entries cannot be
+// aligned with the image layers (e.g. the history is missing or incomplete) then no history is returned.
+func (l *Layer) History() []v1.History {
+	return l.history
+}
+
+// layerHistory returns the history entries for the layer at the given index, given the image config history and the
+// number of layers in the image.
+func layerHistory(history []v1.History, layerCount, idx int) []v1.History {
+	var nonEmpty int
+	for _, h := range history {
+		if !h.EmptyLayer {
+			nonEmpty++
+		}
+	}
+	if nonEmpty != layerCount || idx < 0 || idx >= layerCount {
+		// there is no reliable way to correlate history entries with layer blobs
+		return nil
+	}
+
+	var result []v1.History
+	var seen int
+	for _, h := range history {
+		owner := seen - 1
+		if !h.EmptyLayer {
+			owner = seen
+			seen++
+		}
+		if owner < 0 {
+			// an empty layer entry before the first layer
+			owner = 0
+		}
+		if owner == idx {
+			result = append(result, h)
+		}
+	}
+	return result
+}
@@ -0,0 +1,100 @@
+package image
+
+import (
+	"testing"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_layerHistory(t *testing.T) {
+	arg := v1.History{CreatedBy: "ARG VERSION", EmptyLayer: true}
+	base := v1.History{CreatedBy: "ADD file:abc in /"}
+	cmd := v1.History{CreatedBy: "CMD [\"/bin/sh\"]", EmptyLayer: true}
+	run := v1.History{CreatedBy: "RUN make"}
+	env := v1.History{CreatedBy: "ENV A=B", EmptyLayer: true}
+
+	tests := []struct {
+		name       string
+		history    []v1.History
+		layerCount int
+		expected   [][]v1.History
+	}{
+		{
+			name:       "one entry per layer",
+			history:    []v1.History{base, run},
+			layerCount: 2,
+			expected:   [][]v1.History{{base}, {run}},
+		},
+		{
+			name:       "empty entries belong to the layer below",
+			history:    []v1.History{base, cmd, run, env},
+			layerCount: 2,
+			expected:   [][]v1.History{{base, cmd}, {run, env}},
+		},
+		{
+			name:       "empty entries before the first layer",
+			history:    []v1.History{arg, base, run},
+			layerCount: 2,
+			expected:   [][]v1.History{{arg, base}, {run}},
+		},
+		{
+			name:       "missing history",
+			layerCount: 2,
+			expected:   [][]v1.History{nil, nil},
+		},
+		{
+			name:       "history does not match the layers",
+			history:    []v1.History{base, cmd},
+			layerCount: 2,
+			expected:   [][]v1.History{nil, nil},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var actual [][]v1.History
+			for idx := 0; idx < test.layerCount; idx++ {
+				actual = append(actual, layerHistory(test.history, test.layerCount, idx))
+			}
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestLayer_History(t *testing.T) {
+	// the history of the final stage of a multi-stage build, where only the last stage contributes history entries
+	created := v1.Time{Time: time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)}
+	history := []v1.History{
+		{Created: created, CreatedBy: "/bin/sh -c #(nop) ADD file:abc in / "},
+		{Created: created, CreatedBy: "/bin/sh -c #(nop)  CMD [\"/bin/sh\"]", EmptyLayer: true},
+		{Created: created, CreatedBy: "/bin/sh -c #(nop) COPY file:def in /app "},
+		{Created: created, CreatedBy: "/bin/sh -c #(nop)  ENTRYPOINT [\"/app\"]", EmptyLayer: true},
+	}
+
+	img, err := mutate.AppendLayers(empty.Image,
+		newTestLayer(t, regularEntry("etc/os-release", "alpine")),
+		newTestLayer(t, regularEntry("app", "binary")),
+	)
+	require.NoError(t, err)
+	cfg, err := img.ConfigFile()
+	require.NoError(t, err)
+	cfg = cfg.DeepCopy()
+	cfg.History = history
+	img, err = mutate.ConfigFile(img, cfg)
+	require.NoError(t, err)
+
+	result := NewImage(img, t.TempDir())
+	require.NoError(t, result.Read())
+	t.Cleanup(func() { _ = result.Cleanup() })
+
+	require.Len(t, result.Layers, 2)
+	assert.Equal(t, history[:2], result.Layers[0].History())
+	assert.Equal(t, history[2:], result.Layers[1].History())
+	assert.Equal(t, "/bin/sh -c #(nop) COPY file:def in /app ", result.Layers[1].History()[0].CreatedBy)
+	assert.Equal(t, created, result.Layers[1].History()[0].Created)
+}
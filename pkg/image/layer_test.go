@@ -0,0 +1,57 @@
+package image
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImage_Read_SquashFSLayer(t *testing.T) {
+	contents, err := ioutil.ReadFile("test-fixtures/hello.squashfs")
+	require.NoError(t, err)
+
+	img, err := mutate.AppendLayers(empty.Image,
+		static.NewLayer(contents, OCISquashFSLayer),
+		newTestLayer(t, regularEntry("etc/hosts", "hosts\n")),
+	)
+	require.NoError(t, err)
+
+	result := NewImage(img, t.TempDir())
+	t.Cleanup(func() { _ = result.Cleanup() })
+	require.NoError(t, result.Read())
+
+	require.Len(t, result.Layers, 2)
+	assert.Equal(t, OCISquashFSLayer, string(result.Layers[0].Metadata.MediaType))
+
+	// squashfs layers are squashed with tar layers the same as any other layer
+	assert.True(t, result.SquashedTree().HasPath("/hello.txt"))
+	assert.True(t, result.SquashedTree().HasPath("/etc/hosts"))
+
+	reader, err := result.FileContentsFromSquash("/hello.txt")
+	require.NoError(t, err)
+	actual, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	assert.Equal(t, "Hello from Sylabs!\n", string(actual))
+
+	// the filesystem image is closed on cleanup
+	squashfsFile := result.Layers[0].squashfsFile
+	require.NotNil(t, squashfsFile)
+	require.NoError(t, result.Cleanup())
+	assert.ErrorIs(t, squashfsFile.Close(), os.ErrClosed)
+}
+
+func TestImage_Read_EROFSLayer(t *testing.T) {
+	img, err := mutate.AppendLayers(empty.Image, static.NewLayer([]byte("not supported"), OCIEROFSLayer))
+	require.NoError(t, err)
+
+	result := NewImage(img, t.TempDir())
+	t.Cleanup(func() { _ = result.Cleanup() })
+	assert.Error(t, result.Read())
+}
@@ -0,0 +1,154 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/anchore/stereoscope/internal/log"
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/wagoodman/go-progress"
+)
+
+// WithLazyLayers defers fetching each layer until the contents of a file within the layer are first requested (e.g.
+// reading a path found with a Resolve), instead of fetching every layer while the image is read. The file trees (and
+// so the squash) still need to know every path within every layer, which cannot be known from the image manifest
+// alone, so the tar index of every read layer is persisted to the given directory (keyed by the layer digest). A layer
+// is read lazily only once its index is found within the directory, so the first read of any layer still fetches and
+// indexes it up front (storing the index for next time).
+//
+// Tradeoffs compared to the default (eager) mode:
+//   - errors fetching (or verifying) a lazy layer surface when reading file contents instead of when reading the image
+//   - the total uncompressed size limit (see WithMaxUncompressedSize) is only enforced as lazy layers are fetched
+//   - file contents are read from the tar on disk (not memory mapped, see WithMemoryMappedLayers)
+//   - a layer with an entry whose MIME type was not stored (e.g. excluded by a path filter when the index was stored)
+//     is fetched while reading the image, as the contents are needed to detect the MIME type
+//   - when file digests are computed (see WithFileDigests) every layer is fetched while reading the image, as the
+//     contents of every regular file are needed
+//
+// When a layer cache is also used (see WithLayerCache) cached layers are read from the cache instead, since the cached
+// tar is already on disk.
+func WithLazyLayers(indexDir string) AdditionalMetadata {
+	return func(image *Image) error {
+		abs, err := filepath.Abs(indexDir)
+		if err != nil {
+			return fmt.Errorf("invalid layer index dir=%q: %w", indexDir, err)
+		}
+		if err := os.MkdirAll(abs, 0755); err != nil {
+			return fmt.Errorf("unable to create layer index dir=%q: %w", indexDir, err)
+		}
+		image.layerIndexes = &layerIndexStore{dir: abs}
+		return nil
+	}
+}
+
+// layerIndexStore persists the tar index of layers (without the layer tar itself), so that a later read of the same
+// layer knows every path within the layer without fetching it.
+type layerIndexStore struct {
+	dir string
+}
+
+// indexPath is where the index for the layer with the given digest is stored.
+func (s *layerIndexStore) indexPath(digest string) string {
+	// note: ":" (e.g. "sha256:...") is not valid within windows paths
+	return filepath.Join(s.dir, strings.ReplaceAll(digest, ":", "-")+".json")
+}
+
+// load returns the stored tar entries (referring to the tar at the given path) and the detected MIME types (keyed by
+// entry sequence) for the layer with the given digest. False is returned if there is no valid index for the layer.
+func (s *layerIndexStore) load(digest, tarPath string) ([]file.TarIndexEntry, map[int64]string, bool) {
+	indexPath := s.indexPath(digest)
+	contents, err := ioutil.ReadFile(indexPath)
+	if err != nil {
+		return nil, nil, false
+	}
+	entries, mimeTypes, err := decodeLayerIndex(contents, tarPath)
+	if err != nil {
+		log.Warnf("ignoring invalid layer index=%q", indexPath)
+		return nil, nil, false
+	}
+	return entries, mimeTypes, true
+}
+
+// store persists the index for the layer with the given digest.
+func (s *layerIndexStore) store(digest string, entries []file.TarIndexEntry, mimeTypes map[int64]string) error {
+	contents, err := encodeLayerIndex(entries, mimeTypes)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.dir, filepath.Base(s.indexPath(digest)), contents)
+}
+
+// readLazy indexes the layer from the stored index without fetching the layer tar, which is fetched (into the given
+// directory) once the contents of any file are opened. If there is no stored index then the layer is fetched and
+// indexed up front, and the index is stored.
+func (l *Layer) readLazy(ctx context.Context, monitor *progress.Manual, uncompressedLayersCacheDir string) error {
+	tarFilePath := path.Join(uncompressedLayersCacheDir, l.Metadata.Digest+".tar")
+	entries, mimeTypes, ok := l.indexes.load(l.Metadata.Digest, tarFilePath)
+	if !ok {
+		tarFilePath, err := l.uncompressedTarCache(ctx, uncompressedLayersCacheDir)
+		if err != nil {
+			return err
+		}
+		mimeTypes = make(map[int64]string)
+		l.indexedContent, err = file.NewTarIndex(tarFilePath, l.indexer(ctx, monitor, mimeTypes))
+		if err != nil {
+			return fmt.Errorf("failed to read layer=%q tar : %w", l.Metadata.Digest, err)
+		}
+		if err := l.indexes.store(l.Metadata.Digest, l.indexedContent.Entries(), mimeTypes); err != nil {
+			// the layer is still usable, it will only be fetched up front again next time
+			log.Warnf("unable to store index for layer=%q: %+v", l.Metadata.Digest, err)
+		}
+		return nil
+	}
+
+	log.Debugf("deferring fetch of layer=%q until file contents are read", l.Metadata.Digest)
+	var once sync.Once
+	var fetchErr error
+	l.fetch = func() error {
+		once.Do(func() {
+			// note: the image read may be done (and its context canceled) by the time the first file is opened
+			_, fetchErr = l.uncompressedTarCache(context.Background(), uncompressedLayersCacheDir)
+			if fetchErr == nil {
+				log.Debugf("fetched lazy layer=%q", l.Metadata.Digest)
+			}
+		})
+		return fetchErr
+	}
+
+	var err error
+	l.indexedContent, err = file.NewTarIndexFromEntries(entries, l.indexer(ctx, monitor, mimeTypes))
+	if err != nil {
+		return fmt.Errorf("failed to read layer=%q index : %w", l.Metadata.Digest, err)
+	}
+	return nil
+}
+
+// lazyOpener opens the contents of the given entry, first fetching the layer tar if it has not been fetched yet.
+func (l *Layer) lazyOpener(entry file.TarIndexEntry) file.Opener {
+	return func() io.ReadCloser {
+		if err := l.fetch(); err != nil {
+			return errorReadCloser{err: err}
+		}
+		return entry.Open()
+	}
+}
+
+// errorReadCloser fails every read with the given error (e.g. when the contents could not be fetched).
+type errorReadCloser struct {
+	err error
+}
+
+func (r errorReadCloser) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+func (errorReadCloser) Close() error {
+	return nil
+}
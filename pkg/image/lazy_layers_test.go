@@ -0,0 +1,80 @@
+package image
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readLazyImage(t *testing.T, indexDir string, layers ...v1.Layer) *Image {
+	t.Helper()
+	img, err := mutate.AppendLayers(empty.Image, layers...)
+	require.NoError(t, err)
+
+	result := NewImage(img, t.TempDir(), WithLazyLayers(indexDir))
+	require.NoError(t, result.Read())
+	t.Cleanup(func() { _ = result.Cleanup() })
+	return result
+}
+
+func TestImage_LazyLayers(t *testing.T) {
+	indexDir := t.TempDir()
+	var lowerOpens, upperOpens int
+	lower := countingLayer(t, &lowerOpens,
+		regularEntry("etc/hosts", "lower hosts\n"),
+		regularEntry("etc/passwd", "root:x:0:0\n"),
+		regularEntry("bin/script.sh", "#!/bin/sh\necho lower\n"),
+	)
+	upper := countingLayer(t, &upperOpens,
+		regularEntry("etc/hosts", "upper hosts\n"),
+		testTarEntry{header: tar.Header{Name: "etc/.wh.passwd", Typeflag: tar.TypeReg}},
+	)
+
+	// the first read of each layer fetches it up front to store the index
+	lowerOpens, upperOpens = 0, 0
+	first := readLazyImage(t, indexDir, lower, upper)
+	assert.Equal(t, 1, lowerOpens)
+	assert.Equal(t, 1, upperOpens)
+
+	// later reads defer fetching until file contents are read
+	lowerOpens, upperOpens = 0, 0
+	second := readLazyImage(t, indexDir, lower, upper)
+	assert.Equal(t, 0, lowerOpens)
+	assert.Equal(t, 0, upperOpens)
+
+	assert.ElementsMatch(t, realPaths(first.SquashedTree().AllFiles()), realPaths(second.SquashedTree().AllFiles()))
+	assert.False(t, second.SquashedTree().HasPath("/etc/passwd"))
+
+	expected, err := first.FileMetadataFromSquash("/bin/script.sh")
+	require.NoError(t, err)
+	actual, err := second.FileMetadataFromSquash("/bin/script.sh")
+	require.NoError(t, err)
+	assert.Equal(t, expected.MIMEType, actual.MIMEType)
+	assert.Equal(t, 0, lowerOpens+upperOpens, "metadata should not fetch layers")
+
+	// only the layer holding the topmost version of the path is fetched, and only once
+	for i := 0; i < 2; i++ {
+		reader, err := second.FileContentsFromSquash("/etc/hosts")
+		require.NoError(t, err)
+		contents, err := ioutil.ReadAll(reader)
+		require.NoError(t, err)
+		require.NoError(t, reader.Close())
+		assert.Equal(t, "upper hosts\n", string(contents))
+	}
+	assert.Equal(t, 0, lowerOpens)
+	assert.Equal(t, 1, upperOpens)
+
+	reader, err := second.Layers[0].FileContents(file.Path("/bin/script.sh"))
+	require.NoError(t, err)
+	contents, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "#!/bin/sh\necho lower\n", string(contents))
+	assert.Equal(t, 1, lowerOpens)
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package image
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+// mknod creates the character or block device with the given device number at the given location, which is not
+// supported on this platform.
+func mknod(_ string, _ file.Type, _ os.FileMode, _, _ int64) error {
+	return fmt.Errorf("%w on this platform", ErrDevicesNotSupported)
+}
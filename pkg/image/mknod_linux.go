@@ -0,0 +1,37 @@
+//go:build linux
+// +build linux
+
+package image
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+// mknod creates the character or block device with the given device number at the given location. Creating device
+// nodes requires root, so an ErrDevicesNotSupported is returned otherwise.
+func mknod(target string, fileType file.Type, mode os.FileMode, major, minor int64) error {
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("%w: requires root", ErrDevicesNotSupported)
+	}
+
+	bits := uint32(mode & os.ModePerm)
+	switch fileType {
+	case file.TypeCharacterDevice:
+		bits |= syscall.S_IFCHR
+	case file.TypeBlockDevice:
+		bits |= syscall.S_IFBLK
+	default:
+		return fmt.Errorf("file type=%s is not a device", fileType)
+	}
+	return syscall.Mknod(target, bits, int(mkdev(major, minor)))
+}
+
+// mkdev encodes the device number the same way as the glibc makedev macro.
+func mkdev(major, minor int64) uint64 {
+	ma, mi := uint64(major), uint64(minor)
+	return (mi & 0xff) | ((ma & 0xfff) << 8) | ((mi &^ 0xff) << 12) | ((ma &^ 0xfff) << 32)
+}
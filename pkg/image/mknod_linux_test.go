@@ -0,0 +1,54 @@
+//go:build linux
+// +build linux
+
+package image
+
+import (
+	"archive/tar"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImage_Extract_Devices(t *testing.T) {
+	img := newTestImage(t, []testTarEntry{
+		{header: tar.Header{Name: "dev/null", Typeflag: tar.TypeChar, Mode: 0666, Devmajor: 1, Devminor: 3}},
+	})
+
+	dest := t.TempDir()
+	require.NoError(t, img.Extract(dest, ExtractOptions{CreateDevices: true}))
+
+	info, err := os.Lstat(filepath.Join(dest, "dev", "null"))
+	if os.Geteuid() != 0 {
+		// device nodes are skipped when not running as root
+		assert.True(t, os.IsNotExist(err))
+		return
+	}
+	require.NoError(t, err)
+	assert.True(t, info.Mode()&os.ModeCharDevice != 0)
+	assert.Equal(t, os.FileMode(0666), info.Mode().Perm())
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	require.True(t, ok)
+	assert.Equal(t, mkdev(1, 3), uint64(stat.Rdev))
+}
+
+func TestMknod_RequiresRoot(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("requires running as a regular user")
+	}
+	err := mknod(filepath.Join(t.TempDir(), "null"), file.TypeCharacterDevice, 0666, 1, 3)
+	assert.True(t, errors.Is(err, ErrDevicesNotSupported))
+}
+
+func TestMkdev(t *testing.T) {
+	assert.Equal(t, uint64(0x103), mkdev(1, 3))
+	assert.Equal(t, uint64(0x800), mkdev(8, 0))
+	assert.Equal(t, uint64(0x100000000103), mkdev(0x1001, 3))
+}
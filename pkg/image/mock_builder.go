@@ -0,0 +1,226 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+// mockModTime is the modification time used for all mock entries (so that built images are reproducible).
+var mockModTime = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// MockBuilder builds an image from layers described in code, without any image fixtures on disk. This is useful for
+// exercising squash and link resolution behavior in tests. Paths are added to the current layer (the last one
+// started with AddLayer), and any invalid operation (e.g. a whiteout for a path that no lower layer provides) is
+// reported from Build.
+type MockBuilder struct {
+	layers [][]tar.Header
+	bodies [][]string
+	// lower is the squash of all completed layers (for validating whiteouts)
+	lower *filetree.FileTree
+	// current is the tree of the layer being built
+	current *filetree.FileTree
+	err     error
+}
+
+// NewMockBuilder creates a new MockBuilder with a single (empty) layer.
+func NewMockBuilder() *MockBuilder {
+	b := &MockBuilder{
+		lower: filetree.NewFileTree(),
+	}
+	return b.AddLayer()
+}
+
+// AddLayer completes the current layer and starts a new (empty) layer, which all following paths are added to.
+func (b *MockBuilder) AddLayer() *MockBuilder {
+	if b.current != nil && b.err == nil {
+		// note: the squash is merged into a copy, so the lower squash is only replaced when the merge succeeds
+		squashed, err := b.lower.Copy()
+		if err == nil {
+			err = squashed.Merge(b.current)
+		}
+		if err != nil {
+			b.setErr(fmt.Errorf("unable to squash layer %d: %w", len(b.layers)-1, err))
+		} else {
+			b.lower = squashed
+		}
+	}
+	// a new layer is always started (even if the squash failed), so that nothing is added to a completed layer
+	b.current = filetree.NewFileTree()
+	b.layers = append(b.layers, nil)
+	b.bodies = append(b.bodies, nil)
+	return b
+}
+
+// AddFile adds a regular file with the given contents and permissions to the current layer.
+func (b *MockBuilder) AddFile(path file.Path, content string, mode os.FileMode) *MockBuilder {
+	return b.add(tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     string(path),
+		Mode:     int64(mode.Perm()),
+		Size:     int64(len(content)),
+	}, content)
+}
+
+// AddDir adds a directory with the given permissions to the current layer. Note: parent directories of all added
+// paths are implied, so this is only needed for empty directories (or to set directory permissions).
+func (b *MockBuilder) AddDir(path file.Path, mode os.FileMode) *MockBuilder {
+	return b.add(tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     string(path),
+		Mode:     int64(mode.Perm()),
+	}, "")
+}
+
+// AddSymlink adds a symlink at the given path that points to the given (absolute or relative) target to the current layer.
+func (b *MockBuilder) AddSymlink(from, to file.Path) *MockBuilder {
+	return b.add(tar.Header{
+		Typeflag: tar.TypeSymlink,
+		Name:     string(from),
+		Linkname: string(to),
+		Mode:     0777,
+	}, "")
+}
+
+// AddWhiteout adds a whiteout to the current layer that removes the given path (and any children) provided by lower
+// layers. The path must exist in the squash of all lower layers.
+func (b *MockBuilder) AddWhiteout(path file.Path) *MockBuilder {
+	if !b.lowerHasPath(path) {
+		b.setErr(fmt.Errorf("whiteout in layer %d references path=%q which no lower layer provides", len(b.layers)-1, path))
+		return b
+	}
+	parent, base := path.Split()
+	if base == "" {
+		b.setErr(fmt.Errorf("unable to whiteout path=%q: no parent", path))
+		return b
+	}
+	return b.add(tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     string(parent.Join(file.WhiteoutPrefix + base)),
+	}, "")
+}
+
+// AddOpaqueWhiteout adds an opaque whiteout to the current layer that removes all lower layer contents of the given
+// directory (but not the directory itself). The directory must exist in the squash of all lower layers.
+func (b *MockBuilder) AddOpaqueWhiteout(dir file.Path) *MockBuilder {
+	if !b.lowerHasPath(dir) {
+		b.setErr(fmt.Errorf("opaque whiteout in layer %d references directory=%q which no lower layer provides", len(b.layers)-1, dir))
+		return b
+	}
+	return b.add(tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     string(dir.Join(file.OpaqueWhiteout)),
+	}, "")
+}
+
+// Build creates and reads an image made of all layers added to the builder. The layer contents are held in memory,
+// however (as with any image) reading the image caches layer content to a temp directory, which is removed by
+// Image.Cleanup().
+func (b *MockBuilder) Build() (*Image, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	var layers []v1.Layer
+	for idx, headers := range b.layers {
+		layer, err := mockLayer(headers, b.bodies[idx])
+		if err != nil {
+			return nil, fmt.Errorf("unable to create layer %d: %w", idx, err)
+		}
+		layers = append(layers, layer)
+	}
+
+	img, err := mutate.AppendLayers(empty.Image, layers...)
+	if err != nil {
+		return nil, err
+	}
+
+	contentCacheDir, err := ioutil.TempDir("", "stereoscope-mock-image-")
+	if err != nil {
+		return nil, err
+	}
+
+	result := NewImage(img, contentCacheDir)
+	if err := result.Read(); err != nil {
+		_ = result.Cleanup()
+		return nil, err
+	}
+	return result, nil
+}
+
+func (b *MockBuilder) add(header tar.Header, body string) *MockBuilder {
+	if b.err != nil {
+		return b
+	}
+
+	p := file.Path(header.Name)
+	if !p.IsAbsolutePath() {
+		b.setErr(fmt.Errorf("path must be absolute: %q", p))
+		return b
+	}
+	// tar entry names are relative to the root
+	header.Name = strings.TrimPrefix(string(p.Normalize()), file.DirSeparator)
+	header.ModTime = mockModTime
+
+	var err error
+	switch header.Typeflag {
+	case tar.TypeDir:
+		_, err = b.current.AddDir(p)
+	case tar.TypeSymlink:
+		_, err = b.current.AddSymLink(p, file.Path(header.Linkname))
+	default:
+		_, err = b.current.AddFile(p)
+	}
+	if err != nil {
+		b.setErr(fmt.Errorf("unable to add path=%q to layer %d: %w", p, len(b.layers)-1, err))
+		return b
+	}
+
+	idx := len(b.layers) - 1
+	b.layers[idx] = append(b.layers[idx], header)
+	b.bodies[idx] = append(b.bodies[idx], body)
+	return b
+}
+
+func (b *MockBuilder) lowerHasPath(p file.Path) bool {
+	return b.err == nil && p.IsAbsolutePath() && b.lower.HasPath(p)
+}
+
+func (b *MockBuilder) setErr(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+func mockLayer(headers []tar.Header, bodies []string) (v1.Layer, error) {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for idx := range headers {
+		if err := tw.WriteHeader(&headers[idx]); err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(tw, bodies[idx]); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	content := buf.Bytes()
+
+	return tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(content)), nil
+	})
+}
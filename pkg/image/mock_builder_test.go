@@ -0,0 +1,99 @@
+package image
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree"
+)
+
+func TestMockBuilder_Build(t *testing.T) {
+	img, err := NewMockBuilder().
+		AddFile("/etc/hosts", "hosts", 0644).
+		AddFile("/app/data/x", "x", 0600).
+		AddFile("/app/remove-me", "gone", 0644).
+		AddDir("/empty", 0755).
+		AddLayer().
+		AddOpaqueWhiteout("/app/data").
+		AddWhiteout("/app/remove-me").
+		AddFile("/app/data/y", "y", 0644).
+		AddSymlink("/app/hosts", "/etc/hosts").
+		Build()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = img.Cleanup() })
+
+	require.Len(t, img.Layers, 2)
+
+	var paths []file.Path
+	for _, ref := range img.SquashedTree().AllFiles(file.AllTypes...) {
+		paths = append(paths, ref.RealPath)
+	}
+	assert.Equal(t, []file.Path{"/app/data/y", "/app/hosts", "/empty", "/etc/hosts"}, paths)
+
+	// link resolution and content reads work as with any other image
+	_, ref, err := img.SquashedTree().File("/app/hosts", filetree.FollowBasenameLinks)
+	require.NoError(t, err)
+	require.NotNil(t, ref)
+	assert.Equal(t, file.Path("/etc/hosts"), ref.RealPath)
+
+	reader, err := img.FileContentsFromSquash("/app/data/y")
+	require.NoError(t, err)
+	contents, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "y", string(contents))
+
+	metadata, err := img.FileMetadataFromSquash("/etc/hosts")
+	require.NoError(t, err)
+	assert.Equal(t, "-rw-r--r--", metadata.Mode.String())
+}
+
+func TestMockBuilder_InvalidOperations(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder *MockBuilder
+	}{
+		{
+			name:    "whiteout in the first layer",
+			builder: NewMockBuilder().AddWhiteout("/etc/hosts"),
+		},
+		{
+			name: "whiteout for a path only in the same layer",
+			builder: NewMockBuilder().
+				AddLayer().
+				AddFile("/etc/hosts", "hosts", 0644).
+				AddWhiteout("/etc/hosts"),
+		},
+		{
+			name: "whiteout for a path removed by a lower layer",
+			builder: NewMockBuilder().
+				AddFile("/etc/hosts", "hosts", 0644).
+				AddLayer().
+				AddWhiteout("/etc/hosts").
+				AddLayer().
+				AddWhiteout("/etc/hosts"),
+		},
+		{
+			name: "opaque whiteout for an unknown directory",
+			builder: NewMockBuilder().
+				AddFile("/etc/hosts", "hosts", 0644).
+				AddLayer().
+				AddOpaqueWhiteout("/usr"),
+		},
+		{
+			name:    "relative path",
+			builder: NewMockBuilder().AddFile("etc/hosts", "hosts", 0644),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			img, err := test.builder.Build()
+			assert.Error(t, err)
+			assert.Nil(t, img)
+		})
+	}
+}
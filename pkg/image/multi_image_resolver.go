@@ -0,0 +1,126 @@
+package image
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree"
+)
+
+// MultiImageResolver is a read-only view of several (read) images merged into one squashed tree, as if the layers of
+// every image were concatenated into a single image (e.g. an app image that is layered on top of a separately
+// distributed base image). Conflicts are resolved the same as between layers: images are applied in the order given,
+// so a path within a later image overrides the same path within any earlier image, and whiteouts within a later image
+// remove paths from earlier images (opaque directory whiteouts hide all earlier contents of the directory). Links are
+// resolved within the merged tree, so a link within a later image may refer to a path within an earlier image.
+type MultiImageResolver struct {
+	images []*Image
+	tree   *filetree.FileTree
+}
+
+// NewMultiImageResolver merges the squashed trees of the given (read) images, from lowest to highest precedence.
+func NewMultiImageResolver(images ...*Image) (*MultiImageResolver, error) {
+	unionTree := filetree.NewUnionFileTree()
+	for idx, img := range images {
+		if idx == 0 {
+			unionTree.PushTree(img.SquashedTree())
+			continue
+		}
+		// note: the layers of later images are applied individually (not the squash), so that any whiteouts within the
+		// first layers are applied to the earlier images
+		for _, layer := range img.Layers {
+			if layer.Tree != nil {
+				unionTree.PushTree(layer.Tree)
+			}
+		}
+	}
+
+	tree, err := unionTree.Squash()
+	if err != nil {
+		return nil, fmt.Errorf("unable to merge images: %w", err)
+	}
+	return &MultiImageResolver{
+		images: images,
+		tree:   tree,
+	}, nil
+}
+
+// SquashedTree returns the merged squash of all images. The returned tree must not be mutated.
+func (r *MultiImageResolver) SquashedTree() *filetree.FileTree {
+	return r.tree
+}
+
+// Resolve returns the file reference for the given path within the merged tree (links are handled the same as
+// FileTree.File). Nil is returned if the path does not exist.
+func (r *MultiImageResolver) Resolve(path file.Path, options ...filetree.LinkResolutionOption) (*file.Reference, error) {
+	exists, ref, err := r.tree.File(path, options...)
+	if err != nil || !exists {
+		return nil, err
+	}
+	return ref, nil
+}
+
+// HasPath indicates if the given path exists within the merged tree.
+func (r *MultiImageResolver) HasPath(path file.Path, options ...filetree.LinkResolutionOption) bool {
+	return r.tree.HasPath(path, options...)
+}
+
+// FilesByGlob returns the results of the glob query against the merged tree (see FileTree.FilesByGlob).
+func (r *MultiImageResolver) FilesByGlob(query string, options ...filetree.LinkResolutionOption) ([]filetree.GlobResult, error) {
+	return r.tree.FilesByGlob(query, options...)
+}
+
+// AllFiles returns all files within the merged tree (see FileTree.AllFiles).
+func (r *MultiImageResolver) AllFiles(types ...file.Type) []file.Reference {
+	return r.tree.AllFiles(types...)
+}
+
+// ImageFor returns the image that the given reference (from the merged tree) belongs to, or nil if there is none.
+func (r *MultiImageResolver) ImageFor(ref file.Reference) *Image {
+	for idx := len(r.images) - 1; idx >= 0; idx-- {
+		if r.images[idx].FileCatalog.Exists(ref) {
+			return r.images[idx]
+		}
+	}
+	return nil
+}
+
+// FileMetadata returns the file metadata for the given path within the merged tree (see
+// Image.FileMetadataFromSquash), from whichever image provides the path.
+func (r *MultiImageResolver) FileMetadata(path file.Path) (file.Metadata, error) {
+	ref, img, err := r.resolveWithImage(path)
+	if err != nil {
+		return file.Metadata{}, err
+	}
+	entry, err := img.FileCatalog.Get(*ref)
+	if err != nil {
+		return file.Metadata{}, err
+	}
+	return entry.Metadata, nil
+}
+
+// FileContents reads the file contents for the given path within the merged tree (see Image.FileContentsFromSquash),
+// from whichever image provides the path.
+func (r *MultiImageResolver) FileContents(path file.Path) (io.ReadCloser, error) {
+	ref, img, err := r.resolveWithImage(path)
+	if err != nil {
+		return nil, err
+	}
+	return img.FileCatalog.FileContents(*ref)
+}
+
+func (r *MultiImageResolver) resolveWithImage(path file.Path) (*file.Reference, *Image, error) {
+	ref, err := r.Resolve(path, filetree.FollowBasenameLinks)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ref == nil {
+		return nil, nil, fmt.Errorf("could not find file path in Tree: %s", path)
+	}
+	img := r.ImageFor(*ref)
+	if img == nil {
+		return nil, nil, fmt.Errorf("could not find file path in any image: %s", path)
+	}
+	return ref, img, nil
+}
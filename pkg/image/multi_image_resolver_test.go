@@ -0,0 +1,83 @@
+package image
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultiImageResolver(t *testing.T) {
+	base := newTestImage(t,
+		[]testTarEntry{
+			regularEntry("etc/os-release", "base os\n"),
+			regularEntry("etc/hosts", "base hosts\n"),
+			regularEntry("etc/removed", "removed\n"),
+			regularEntry("opt/old/file", "old\n"),
+		},
+		[]testTarEntry{
+			regularEntry("usr/lib/libc.so", "libc\n"),
+		},
+	)
+	app := newTestImage(t,
+		[]testTarEntry{
+			regularEntry("etc/hosts", "app hosts\n"),
+			{header: tar.Header{Name: "etc/.wh.removed", Typeflag: tar.TypeReg}},
+			{header: tar.Header{Name: "opt/old/.wh..wh..opq", Typeflag: tar.TypeReg}},
+			regularEntry("opt/old/new", "new\n"),
+		},
+		[]testTarEntry{
+			{header: tar.Header{Name: "app/libc.so", Typeflag: tar.TypeSymlink, Linkname: "/usr/lib/libc.so"}},
+		},
+	)
+
+	resolver, err := NewMultiImageResolver(base, app)
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []file.Path{
+		"/app/libc.so",
+		"/etc/hosts",
+		"/etc/os-release",
+		"/opt/old/new",
+		"/usr/lib/libc.so",
+	}, realPaths(resolver.AllFiles(file.TypeReg, file.TypeSymlink)))
+
+	// the inputs are not modified
+	assert.True(t, base.SquashedTree().HasPath("/etc/removed"))
+	assert.False(t, app.SquashedTree().HasPath("/usr/lib/libc.so"))
+
+	for p, expected := range map[file.Path]string{
+		// later images override earlier images...
+		"/etc/hosts": "app hosts\n",
+		// ...while paths only within earlier images remain...
+		"/etc/os-release": "base os\n",
+		// ...and links within later images may resolve to earlier images
+		"/app/libc.so": "libc\n",
+	} {
+		reader, err := resolver.FileContents(p)
+		require.NoError(t, err, p)
+		contents, err := ioutil.ReadAll(reader)
+		require.NoError(t, err)
+		require.NoError(t, reader.Close())
+		assert.Equal(t, expected, string(contents), p)
+	}
+
+	metadata, err := resolver.FileMetadata("/etc/os-release")
+	require.NoError(t, err)
+	assert.Equal(t, "/etc/os-release", metadata.Path)
+
+	ref, err := resolver.Resolve("/etc/hosts")
+	require.NoError(t, err)
+	require.NotNil(t, ref)
+	assert.Same(t, app, resolver.ImageFor(*ref))
+
+	ref, err = resolver.Resolve("/etc/removed")
+	require.NoError(t, err)
+	assert.Nil(t, ref)
+
+	_, err = resolver.FileContents("/opt/old/file")
+	assert.Error(t, err)
+}
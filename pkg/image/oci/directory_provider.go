@@ -3,9 +3,11 @@ package oci
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/anchore/stereoscope/pkg/file"
 	"github.com/anchore/stereoscope/pkg/image"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/layout"
 )
 
@@ -13,20 +15,30 @@ import (
 type DirectoryImageProvider struct {
 	path      string
 	tmpDirGen *file.TempDirGenerator
+	platform  *image.Platform
+	refName   string
 }
 
-// NewProviderFromPath creates a new provider instance for the specific image already at the given path.
-func NewProviderFromPath(path string, tmpDirGen *file.TempDirGenerator) *DirectoryImageProvider {
+// refNameAnnotation is the index descriptor annotation holding the reference (typically the tag) of a manifest, as
+// written by tools such as "skopeo copy docker://<img> oci:<dir>:<tag>".
+const refNameAnnotation = "org.opencontainers.image.ref.name"
+
+// NewProviderFromPath creates a new provider instance for the specific image already at the given path. If a ref name
+// is given then only the index entries with a matching "org.opencontainers.image.ref.name" annotation are considered
+// (e.g. for a layout holding several tagged images), and if a platform is given then the matching manifest is selected
+// from a multi-arch index. Otherwise the index must describe a single image.
+func NewProviderFromPath(path string, tmpDirGen *file.TempDirGenerator, platform *image.Platform, refName string) *DirectoryImageProvider {
 	return &DirectoryImageProvider{
 		path:      path,
 		tmpDirGen: tmpDirGen,
+		platform:  platform,
+		refName:   refName,
 	}
 }
 
 // Provide an image object that represents the OCI image as a directory.
 func (p *DirectoryImageProvider) Provide(_ context.Context, userMetadata ...image.AdditionalMetadata) (*image.Image, error) {
-	pathObj, err := layout.FromPath(p.path)
-	if err != nil {
+	if _, err := layout.FromPath(p.path); err != nil {
 		return nil, fmt.Errorf("unable to read image from OCI directory path %q: %w", p.path, err)
 	}
 
@@ -35,18 +47,13 @@ func (p *DirectoryImageProvider) Provide(_ context.Context, userMetadata ...imag
 		return nil, fmt.Errorf("unable to parse OCI directory index: %w", err)
 	}
 
-	indexManifest, err := index.IndexManifest()
+	selected, err := p.selectManifest(index)
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse OCI directory indexManifest: %w", err)
-	}
-
-	// for now, lets only support one image indexManifest (it is not clear how to handle multiple manifests)
-	if len(indexManifest.Manifests) != 1 {
-		return nil, fmt.Errorf("unexpected number of OCI directory manifests (found %d)", len(indexManifest.Manifests))
+		return nil, err
 	}
+	manifest := selected.descriptor
 
-	manifest := indexManifest.Manifests[0]
-	img, err := pathObj.Image(manifest.Digest)
+	img, err := selected.index.Image(manifest.Digest)
 	if err != nil {
 		return nil, fmt.Errorf("unable to parse OCI directory as an image: %w", err)
 	}
@@ -55,6 +62,15 @@ func (p *DirectoryImageProvider) Provide(_ context.Context, userMetadata ...imag
 		image.WithManifestDigest(manifest.Digest.String()),
 	}
 
+	if p.platform != nil && manifest.Platform != nil {
+		// note: the platform is taken from the selected manifest rather than the request, since an unset variant on
+		// the request matches any variant
+		metadata = append(metadata,
+			image.WithArchitecture(manifest.Platform.Architecture, manifest.Platform.Variant),
+			image.WithOS(manifest.Platform.OS),
+		)
+	}
+
 	// make a best-effort attempt at getting the raw indexManifest
 	rawManifest, err := img.RawManifest()
 	if err == nil {
@@ -71,3 +87,185 @@ func (p *DirectoryImageProvider) Provide(_ context.Context, userMetadata ...imag
 
 	return image.NewImage(img, contentTempDir, metadata...), nil
 }
+
+// indexedManifest is an image manifest descriptor along with the (possibly nested) index that references it.
+type indexedManifest struct {
+	index      v1.ImageIndex
+	descriptor v1.Descriptor
+	// refName is the ref name annotation of the top-level index entry that leads to the manifest (if any)
+	refName string
+}
+
+// selectManifest finds the single image manifest described by the given index (descending into nested indexes),
+// narrowing the candidates to those with the provider ref name, and then those matching the provider platform, when
+// either is given.
+func (p *DirectoryImageProvider) selectManifest(index v1.ImageIndex) (*indexedManifest, error) {
+	candidates, err := imageManifests(index)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.refName != "" {
+		var matches []indexedManifest
+		for _, candidate := range candidates {
+			if candidate.refName == p.refName {
+				matches = append(matches, candidate)
+			}
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no OCI directory manifest found for ref name=%q (available ref names: %s)", p.refName, availableRefNames(candidates))
+		}
+		candidates = matches
+	}
+
+	if p.platform != nil {
+		var matches []indexedManifest
+		for _, candidate := range candidates {
+			if platformMatches(p.platform, candidate.descriptor.Platform) {
+				matches = append(matches, candidate)
+			}
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no OCI directory manifest found for platform=%q (available platforms: %s)", p.platform.String(), availablePlatforms(candidates))
+		}
+		candidates = matches
+	}
+
+	// it is not clear how to handle multiple manifests, so require the caller to narrow the selection with a platform
+	if len(candidates) != 1 {
+		return nil, fmt.Errorf("unexpected number of OCI directory manifests (found %d, select one of the available platforms: %s)", len(candidates), availablePlatforms(candidates))
+	}
+
+	return &candidates[0], nil
+}
+
+// ListPlatforms returns the platforms of all image manifests within the OCI directory (in index order), any of which
+// may be selected with the provider platform. Manifests without a platform are not listed.
+func (p *DirectoryImageProvider) ListPlatforms() ([]image.Platform, error) {
+	index, err := layout.ImageIndexFromPath(p.path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse OCI directory index: %w", err)
+	}
+
+	manifests, err := imageManifests(index)
+	if err != nil {
+		return nil, err
+	}
+
+	var platforms []image.Platform
+	for _, manifest := range manifests {
+		if manifest.descriptor.Platform == nil {
+			continue
+		}
+		platforms = append(platforms, image.Platform{
+			OS:           manifest.descriptor.Platform.OS,
+			Architecture: manifest.descriptor.Platform.Architecture,
+			Variant:      manifest.descriptor.Platform.Variant,
+		})
+	}
+	return platforms, nil
+}
+
+// availablePlatforms describes the platforms of the given manifests (for error messages).
+func availablePlatforms(manifests []indexedManifest) string {
+	var platforms []string
+	for _, manifest := range manifests {
+		if manifest.descriptor.Platform == nil {
+			platforms = append(platforms, "<none>")
+			continue
+		}
+		platforms = append(platforms, (&image.Platform{
+			OS:           manifest.descriptor.Platform.OS,
+			Architecture: manifest.descriptor.Platform.Architecture,
+			Variant:      manifest.descriptor.Platform.Variant,
+		}).String())
+	}
+	if len(platforms) == 0 {
+		return "<none>"
+	}
+	return strings.Join(platforms, ", ")
+}
+
+// availableRefNames describes the distinct ref names of the given manifests (for error messages).
+func availableRefNames(manifests []indexedManifest) string {
+	var refNames []string
+	seen := make(map[string]bool)
+	for _, manifest := range manifests {
+		if manifest.refName == "" || seen[manifest.refName] {
+			continue
+		}
+		seen[manifest.refName] = true
+		refNames = append(refNames, manifest.refName)
+	}
+	if len(refNames) == 0 {
+		return "<none>"
+	}
+	return strings.Join(refNames, ", ")
+}
+
+// isAttestation indicates if the descriptor is an attestation manifest (e.g. the provenance attached by docker buildx
+// for the "unknown/unknown" platform) rather than an image that can be run.
+func isAttestation(desc v1.Descriptor) bool {
+	return desc.Annotations["vnd.docker.reference.type"] == "attestation-manifest"
+}
+
+// imageManifests returns all image manifests referenced by the index, recursively flattening any
+// nested index manifests. Attestation manifests are not included.
+func imageManifests(index v1.ImageIndex) ([]indexedManifest, error) {
+	return indexManifests(index, "")
+}
+
+// indexManifests returns the image manifests referenced by the index (see imageManifests), where manifests without a
+// ref name annotation of their own take the ref name of the nested index entry that leads to them.
+func indexManifests(index v1.ImageIndex, refName string) ([]indexedManifest, error) {
+	indexManifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse OCI directory indexManifest: %w", err)
+	}
+
+	var manifests []indexedManifest
+	for _, desc := range indexManifest.Manifests {
+		if isAttestation(desc) {
+			continue
+		}
+		descRefName := refName
+		if name, ok := desc.Annotations[refNameAnnotation]; ok {
+			descRefName = name
+		}
+		if !desc.MediaType.IsIndex() {
+			manifests = append(manifests, indexedManifest{index: index, descriptor: desc, refName: descRefName})
+			continue
+		}
+
+		child, err := index.ImageIndex(desc.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read nested OCI directory index %q: %w", desc.Digest, err)
+		}
+
+		childManifests, err := indexManifests(child, descRefName)
+		if err != nil {
+			return nil, err
+		}
+
+		manifests = append(manifests, childManifests...)
+	}
+	return manifests, nil
+}
+
+// platformMatches indicates if the descriptor platform satisfies the requested platform. An unset variant on the
+// request matches any variant.
+func platformMatches(requested *image.Platform, actual *v1.Platform) bool {
+	if actual == nil {
+		return false
+	}
+	if requested.OS != "" && requested.OS != actual.OS {
+		return false
+	}
+	if requested.Architecture != "" && requested.Architecture != actual.Architecture {
+		return false
+	}
+	if requested.Variant != "" && requested.Variant != actual.Variant {
+		return false
+	}
+	return true
+}
@@ -4,7 +4,14 @@ import (
 	"testing"
 
 	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func Test_NewProviderFromPath(t *testing.T) {
@@ -13,7 +20,7 @@ func Test_NewProviderFromPath(t *testing.T) {
 	generator := file.TempDirGenerator{}
 
 	//WHEN
-	provider := NewProviderFromPath(path, &generator)
+	provider := NewProviderFromPath(path, &generator, nil, "")
 
 	//THEN
 	assert.NotNil(t, provider.path)
@@ -34,7 +41,7 @@ func Test_Directory_Provide(t *testing.T) {
 	}
 
 	for _, tc := range tests {
-		provider := NewProviderFromPath(tc.path, file.NewTempDirGenerator("tempDir"))
+		provider := NewProviderFromPath(tc.path, file.NewTempDirGenerator("tempDir"), nil, "")
 		t.Run(tc.name, func(t *testing.T) {
 			//WHEN
 			image, err := provider.Provide(nil)
@@ -51,3 +58,163 @@ func Test_Directory_Provide(t *testing.T) {
 		})
 	}
 }
+
+func Test_Directory_Provide_Platform(t *testing.T) {
+	amd64, err := random.Image(64, 1)
+	require.NoError(t, err)
+	arm64, err := random.Image(64, 1)
+	require.NoError(t, err)
+
+	amd64Digest, err := amd64.Digest()
+	require.NoError(t, err)
+	arm64Digest, err := arm64.Digest()
+	require.NoError(t, err)
+
+	// the arm64 image is held within a nested index to ensure nested indexes are flattened
+	nested := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{
+		Add: arm64,
+		Descriptor: v1.Descriptor{
+			Platform: &v1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"},
+		},
+	})
+
+	dir := t.TempDir()
+	lp, err := layout.Write(dir, empty.Index)
+	require.NoError(t, err)
+	require.NoError(t, lp.AppendImage(amd64, layout.WithPlatform(v1.Platform{OS: "linux", Architecture: "amd64"})))
+	require.NoError(t, lp.AppendIndex(nested))
+
+	tests := []struct {
+		name            string
+		platform        *image.Platform
+		expectedDigest  string
+		expectedVariant string
+		expectedErr     bool
+	}{
+		{
+			name:        "multiple manifests without a platform",
+			expectedErr: true,
+		},
+		{
+			name:           "select top-level manifest",
+			platform:       &image.Platform{OS: "linux", Architecture: "amd64"},
+			expectedDigest: amd64Digest.String(),
+		},
+		{
+			name:            "select manifest from nested index",
+			platform:        &image.Platform{OS: "linux", Architecture: "arm64"},
+			expectedDigest:  arm64Digest.String(),
+			expectedVariant: "v8",
+		},
+		{
+			name:            "select manifest by variant",
+			platform:        &image.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"},
+			expectedDigest:  arm64Digest.String(),
+			expectedVariant: "v8",
+		},
+		{
+			name:        "no matching platform",
+			platform:    &image.Platform{OS: "linux", Architecture: "s390x"},
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			provider := NewProviderFromPath(dir, file.NewTempDirGenerator("tempDir"), tc.platform, "")
+			img, err := provider.Provide(nil)
+			if tc.expectedErr {
+				assert.Error(t, err)
+				assert.Nil(t, img)
+				return
+			}
+			require.NoError(t, err)
+			require.NoError(t, img.Read())
+			defer img.Cleanup()
+			assert.Equal(t, tc.expectedDigest, img.Metadata.ManifestDigest)
+			assert.Equal(t, tc.platform.Architecture, img.Metadata.Architecture)
+			assert.Equal(t, tc.expectedVariant, img.Metadata.Variant)
+		})
+	}
+}
+
+func Test_Directory_Provide_RefName(t *testing.T) {
+	first, err := random.Image(64, 1)
+	require.NoError(t, err)
+	second, err := random.Image(64, 1)
+	require.NoError(t, err)
+	amd64, err := random.Image(64, 1)
+	require.NoError(t, err)
+	arm64, err := random.Image(64, 1)
+	require.NoError(t, err)
+
+	digest := func(img v1.Image) string {
+		d, err := img.Digest()
+		require.NoError(t, err)
+		return d.String()
+	}
+	tagged := func(refName string) layout.Option {
+		return layout.WithAnnotations(map[string]string{refNameAnnotation: refName})
+	}
+
+	// several tagged manifests without platforms (as written by skopeo), along with a tagged multi-arch index
+	dir := t.TempDir()
+	lp, err := layout.Write(dir, empty.Index)
+	require.NoError(t, err)
+	require.NoError(t, lp.AppendImage(first, tagged("v1")))
+	require.NoError(t, lp.AppendImage(second, tagged("v2")))
+	multiArch := mutate.AppendManifests(empty.Index,
+		mutate.IndexAddendum{Add: amd64, Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "amd64"}}},
+		mutate.IndexAddendum{Add: arm64, Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "arm64"}}},
+	)
+	require.NoError(t, lp.AppendIndex(multiArch, tagged("multi")))
+
+	tests := []struct {
+		name           string
+		refName        string
+		platform       *image.Platform
+		expectedDigest string
+		expectedErr    string
+	}{
+		{
+			name:        "multiple tagged manifests without a ref name",
+			expectedErr: "unexpected number of OCI directory manifests",
+		},
+		{
+			name:           "select tagged manifest",
+			refName:        "v2",
+			expectedDigest: digest(second),
+		},
+		{
+			name:           "select platform within tagged index",
+			refName:        "multi",
+			platform:       &image.Platform{OS: "linux", Architecture: "arm64"},
+			expectedDigest: digest(arm64),
+		},
+		{
+			name:        "tagged index still requires a platform",
+			refName:     "multi",
+			expectedErr: "unexpected number of OCI directory manifests",
+		},
+		{
+			name:        "no matching ref name",
+			refName:     "v3",
+			expectedErr: `no OCI directory manifest found for ref name="v3" (available ref names: v1, v2, multi)`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			img, err := NewProviderFromPath(dir, file.NewTempDirGenerator("tempDir"), tc.platform, tc.refName).Provide(nil)
+			if tc.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.NoError(t, img.Read())
+			defer img.Cleanup()
+			assert.Equal(t, tc.expectedDigest, img.Metadata.ManifestDigest)
+		})
+	}
+}
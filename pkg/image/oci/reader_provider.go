@@ -0,0 +1,47 @@
+package oci
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/anchore/stereoscope/internal/contextio"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+)
+
+// ReaderImageProvider is an image.Provider for an OCI image (V1) tar that is streamed from a reader (e.g. an
+// oci-archive piped to stdin).
+type ReaderImageProvider struct {
+	reader    io.Reader
+	tmpDirGen *file.TempDirGenerator
+	platform  *image.Platform
+}
+
+// NewProviderFromReader creates a new provider instance for the OCI image tar stream from the given reader.
+func NewProviderFromReader(reader io.Reader, tmpDirGen *file.TempDirGenerator, platform *image.Platform) *ReaderImageProvider {
+	return &ReaderImageProvider{
+		reader:    reader,
+		tmpDirGen: tmpDirGen,
+		platform:  platform,
+	}
+}
+
+// Provide an image object that represents the OCI image tar read from the configured reader.
+func (p *ReaderImageProvider) Provide(ctx context.Context, metadata ...image.AdditionalMetadata) (*image.Image, error) {
+	// note: an OCI archive is a tar of an OCI layout directory, so the stream can be extracted in a single pass (no
+	// random access is needed) and then used with the directory provider.
+	tempDir, err := p.tmpDirGen.NewDirectory("oci-tarball-image")
+	if err != nil {
+		return nil, err
+	}
+
+	if err = file.UntarToDirectory(contextio.NewReader(ctx, p.reader), tempDir); err != nil {
+		// don't leave a partially extracted layout behind (e.g. when cancelled)
+		_ = os.RemoveAll(tempDir)
+		return nil, err
+	}
+
+	return NewProviderFromPath(tempDir, p.tmpDirGen, p.platform, "").Provide(ctx, metadata...)
+}
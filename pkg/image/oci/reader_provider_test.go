@@ -0,0 +1,36 @@
+package oci
+
+import (
+	"os"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ReaderProvide(t *testing.T) {
+	f, err := os.Open("test-fixtures/file.tar")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = f.Close() })
+
+	generator := file.NewTempDirGenerator("tempDir")
+	t.Cleanup(func() { _ = generator.Cleanup() })
+
+	image, err := NewProviderFromReader(f, generator, nil).Provide(nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, image)
+}
+
+func Test_ReaderProvide_Fails(t *testing.T) {
+	f, err := os.Open("test-fixtures/invalid_file")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = f.Close() })
+
+	generator := file.NewTempDirGenerator("tempDir")
+	t.Cleanup(func() { _ = generator.Cleanup() })
+
+	image, err := NewProviderFromReader(f, generator, nil).Provide(nil)
+	assert.Error(t, err)
+	assert.Nil(t, image)
+}
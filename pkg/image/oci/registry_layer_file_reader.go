@@ -0,0 +1,320 @@
+package oci
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+
+	"github.com/anchore/stereoscope/internal/log"
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+var errRangeRequestsNotSupported = errors.New("registry does not support range requests")
+
+// RegistryLayerFileReader fetches individual files from a single layer blob in a registry without reading the whole
+// image. When the layer is an eStargz layer (a gzip layer with a table of contents describing where each file is
+// within the compressed blob) and the registry supports HTTP range requests, only the byte ranges for the table of
+// contents and the requested files are downloaded. Otherwise, the full layer is downloaded once (to a temp dir) and
+// indexed, and all files are read from the downloaded layer. Note: to read whole images from the table of contents of
+// each eStargz layer, see image.WithEStargzLayers instead.
+type RegistryLayerFileReader struct {
+	ctx             context.Context
+	blob            name.Digest
+	tmpDirGen       *file.TempDirGenerator
+	registryOptions image.RegistryOptions
+	platform        *image.Platform
+
+	lock sync.Mutex
+	// toc is the table of contents for an eStargz layer read with range requests (nil if not available)
+	toc *estargz.Reader
+	// index is the tar index for the fully downloaded layer (nil if the layer has not been downloaded)
+	index *file.TarIndex
+}
+
+// NewLayerFileReader creates a reader for individual files within the given layer (by compressed digest) of the
+// image referenced by the provider.
+func (p *RegistryImageProvider) NewLayerFileReader(ctx context.Context, layerDigest string) (*RegistryLayerFileReader, error) {
+	ref, err := name.ParseReference(p.imageStr, prepareReferenceOptions(p.registryOptions)...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse registry reference=%q: %+v", p.imageStr, err)
+	}
+
+	blob, err := name.NewDigest(fmt.Sprintf("%s@%s", ref.Context().Name(), layerDigest), prepareReferenceOptions(p.registryOptions)...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse layer digest=%q: %w", layerDigest, err)
+	}
+
+	return &RegistryLayerFileReader{
+		ctx:             ctx,
+		blob:            blob,
+		tmpDirGen:       p.tmpDirGen,
+		registryOptions: p.registryOptions,
+		platform:        p.platform,
+	}, nil
+}
+
+// Open returns the contents of the regular file at the given path within the layer.
+func (r *RegistryLayerFileReader) Open(path file.Path) (io.ReadCloser, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+
+	if r.toc != nil {
+		sr, err := r.toc.OpenFile(string(path))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil, &file.ErrFileNotFound{Path: string(path)}
+			}
+			return nil, err
+		}
+		return ioutil.NopCloser(sr), nil
+	}
+
+	return r.openFromIndex(path)
+}
+
+// Files returns the metadata of every entry within the layer, sorted by path. For eStargz layers read with range
+// requests the entries are built from the table of contents alone, so no file contents are downloaded (the MIME type
+// is not populated, the tar sequence is not known and is -1, and implied parent directories are included). Otherwise,
+// the full layer is downloaded and indexed. The eStargz table of contents and landmark files are not included.
+func (r *RegistryLayerFileReader) Files() ([]file.Metadata, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+
+	var results []file.Metadata
+	if r.toc != nil {
+		err := file.WalkEStargz(r.toc, func(name string, entry *estargz.TOCEntry) error {
+			results = append(results, file.NewMetadataFromEStargzEntry(name, entry))
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to read layer=%q: %w", r.blob, err)
+		}
+	} else {
+		for _, entry := range r.index.Entries() {
+			header := entry.Header()
+			if file.IsEStargzMetadata(header.Name) {
+				continue
+			}
+			results = append(results, file.NewMetadata(header, entry.Sequence(), nil))
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Path < results[j].Path
+	})
+	return results, nil
+}
+
+// open reads the eStargz table of contents of the layer with range requests, falling back to downloading the full
+// layer when that is not possible (e.g. the layer is not an eStargz layer or the registry does not support range
+// requests).
+func (r *RegistryLayerFileReader) open() error {
+	if r.toc != nil || r.index != nil {
+		return nil
+	}
+	if err := r.openTOC(); err != nil {
+		log.Debugf("unable to read layer=%q with range requests, falling back to a full download: %+v", r.blob, err)
+		return r.download()
+	}
+	return nil
+}
+
+// openTOC reads the eStargz table of contents of the layer blob using range requests.
+func (r *RegistryLayerFileReader) openTOC() error {
+	readerAt, err := newRangeReaderAt(r.ctx, r.blob, r.registryOptions)
+	if err != nil {
+		return err
+	}
+
+	toc, err := estargz.Open(io.NewSectionReader(readerAt, 0, readerAt.size))
+	if err != nil {
+		return fmt.Errorf("unable to read eStargz table of contents: %w", err)
+	}
+	r.toc = toc
+	return nil
+}
+
+// download fetches and indexes the entire (uncompressed) layer.
+func (r *RegistryLayerFileReader) download() error {
+	layer, err := remote.Layer(r.blob, prepareRemoteOptions(r.ctx, r.blob, r.registryOptions, r.platform)...)
+	if err != nil {
+		return fmt.Errorf("unable to fetch layer=%q: %w", r.blob, err)
+	}
+
+	tempDir, err := r.tmpDirGen.NewDirectory("oci-registry-layer")
+	if err != nil {
+		return err
+	}
+
+	reader, err := image.UncompressedLayerReader(layer)
+	if err != nil {
+		return fmt.Errorf("unable to read layer=%q: %w", r.blob, err)
+	}
+	defer reader.Close()
+
+	tarPath := filepath.Join(tempDir, "layer.tar")
+	f, err := os.Create(tarPath)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, reader)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("unable to download layer=%q: %w", r.blob, err)
+	}
+
+	r.index, err = file.NewTarIndex(tarPath, nil)
+	return err
+}
+
+func (r *RegistryLayerFileReader) openFromIndex(path file.Path) (io.ReadCloser, error) {
+	// note: tar entry names may encode the same path in several ways (e.g. "etc/hosts" or "./etc/hosts")
+	entries, err := r.index.EntriesByPath(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, &file.ErrFileNotFound{Path: string(path)}
+	}
+	// the last entry for a path within a tar is the one that is extracted
+	entry := entries[len(entries)-1]
+	if entry.Header.Typeflag != tar.TypeReg && entry.Header.Typeflag != tar.TypeRegA {
+		return nil, fmt.Errorf("path=%q is not a regular file", path)
+	}
+	if rc, ok := entry.Reader.(io.ReadCloser); ok {
+		return rc, nil
+	}
+	return ioutil.NopCloser(entry.Reader), nil
+}
+
+// newRangeReaderAt creates an io.ReaderAt for the given registry blob that reads with HTTP range requests.
+func newRangeReaderAt(ctx context.Context, blob name.Digest, registryOptions image.RegistryOptions) (*rangeReaderAt, error) {
+	registry := blob.Context().Registry
+
+	var base http.RoundTripper = remote.DefaultTransport
+	if registryOptions.InsecureSkipTLSVerify {
+		base = &http.Transport{
+			// nolint: gosec
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}
+	}
+
+	auth := registryOptions.Authenticator(registry.RegistryStr())
+	if auth == nil {
+		var err error
+		auth, err = authn.DefaultKeychain.Resolve(registry)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rt, err := transport.NewWithContext(ctx, registry, auth, base, []string{blob.Scope(transport.PullScope)})
+	if err != nil {
+		return nil, err
+	}
+
+	readerAt := &rangeReaderAt{
+		ctx:    ctx,
+		client: &http.Client{Transport: rt},
+		url:    fmt.Sprintf("%s://%s/v2/%s/blobs/%s", registry.Scheme(), registry.RegistryStr(), blob.Context().RepositoryStr(), blob.DigestStr()),
+	}
+	if err := readerAt.readSize(); err != nil {
+		return nil, err
+	}
+	return readerAt, nil
+}
+
+var _ io.ReaderAt = (*rangeReaderAt)(nil)
+
+// rangeReaderAt is an io.ReaderAt for a registry blob where each read is an HTTP range request.
+type rangeReaderAt struct {
+	ctx    context.Context
+	client *http.Client
+	url    string
+	size   int64
+}
+
+func (r *rangeReaderAt) readSize() error {
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodHead, r.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status for blob=%q: %s", r.url, resp.Status)
+	}
+	if resp.ContentLength <= 0 {
+		return fmt.Errorf("unable to determine size of blob=%q", r.url)
+	}
+	r.size = resp.ContentLength
+	return nil
+}
+
+// ReadAt implements io.ReaderAt by requesting only the given byte range from the registry.
+func (r *rangeReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	end := off + int64(len(p)) - 1
+	if end >= r.size {
+		end = r.size - 1
+	}
+
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, end))
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		// the registry responded with the full blob (or an error), there is no point in continuing to read
+		return 0, fmt.Errorf("%w: %s", errRangeRequestsNotSupported, resp.Status)
+	}
+
+	n, err := io.ReadFull(resp.Body, p[:end-off+1])
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
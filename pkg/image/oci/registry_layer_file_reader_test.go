@@ -0,0 +1,409 @@
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	containerregistryV1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+// countingResponseWriter tracks the number of body bytes written
+type countingResponseWriter struct {
+	http.ResponseWriter
+	count *int64
+}
+
+func (w countingResponseWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	atomic.AddInt64(w.count, int64(n))
+	return n, err
+}
+
+// rangeRegistry wraps the in-memory registry with range request support for the given blobs (since the in-memory
+// registry always responds with the full blob) while counting all blob bytes served.
+type rangeRegistry struct {
+	registry      http.Handler
+	blobs         map[string][]byte
+	supportsRange bool
+	served        int64
+}
+
+func (r *rangeRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !strings.Contains(req.URL.Path, "/blobs/sha256:") || req.Method != http.MethodGet {
+		r.registry.ServeHTTP(w, req)
+		return
+	}
+
+	counter := countingResponseWriter{ResponseWriter: w, count: &r.served}
+	digest := req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:]
+	blob, ok := r.blobs[digest]
+	if !r.supportsRange || !ok {
+		r.registry.ServeHTTP(counter, req)
+		return
+	}
+	http.ServeContent(counter, req, "", time.Time{}, bytes.NewReader(blob))
+}
+
+// gzipTOCCompressor is an eStargz gzip compressor that writes the footer by hand, since the estargz library relies on
+// the exact output of compress/gzip when writing the footer (which differs across go versions).
+type gzipTOCCompressor struct {
+	*estargz.GzipCompressor
+}
+
+func (c *gzipTOCCompressor) WriteTOCAndFooter(w io.Writer, off int64, toc *estargz.JTOC, diffHash hash.Hash) (digest.Digest, error) {
+	tocJSON, err := json.Marshal(toc)
+	if err != nil {
+		return "", err
+	}
+	gz := gzip.NewWriter(w)
+	gw := io.Writer(gz)
+	if diffHash != nil {
+		gw = io.MultiWriter(gz, diffHash)
+	}
+	tw := tar.NewWriter(gw)
+	if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: estargz.TOCTarName, Size: int64(len(tocJSON))}); err != nil {
+		return "", err
+	}
+	if _, err := tw.Write(tocJSON); err != nil {
+		return "", err
+	}
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+	if err := gz.Close(); err != nil {
+		return "", err
+	}
+
+	// an empty gzip member with the TOC offset in the "SG" extra field (RFC1952)
+	subfield := fmt.Sprintf("%016xSTARGZ", off)
+	footer := []byte{0x1f, 0x8b, 0x08, 0x04, 0, 0, 0, 0, 0, 0xff}
+	footer = append(footer, byte(4+len(subfield)), 0, 'S', 'G', byte(len(subfield)), 0)
+	footer = append(footer, subfield...)
+	// a final, empty, stored deflate block followed by the (zero) crc32 and size
+	footer = append(footer, 0x01, 0x00, 0x00, 0xff, 0xff, 0, 0, 0, 0, 0, 0, 0, 0)
+	if len(footer) != estargz.FooterSize {
+		return "", fmt.Errorf("unexpected footer size: %d", len(footer))
+	}
+	if _, err := w.Write(footer); err != nil {
+		return "", err
+	}
+	return digest.FromBytes(tocJSON), nil
+}
+
+func layerTar(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, n := range []string{"big.bin", "etc/target.txt"} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: n, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(files[n]))}))
+		_, err := tw.Write(files[n])
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+func layerFromBytes(t *testing.T, b []byte) containerregistryV1.Layer {
+	t.Helper()
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(b)), nil
+	})
+	require.NoError(t, err)
+	return layer
+}
+
+// newTestLayerFileReader pushes the image to a registry served by the given handler and creates a reader for the given
+// layer within it (the bytes served are counted from this point on).
+func newTestLayerFileReader(t *testing.T, handler *rangeRegistry, img containerregistryV1.Image, layer containerregistryV1.Hash) *RegistryLayerFileReader {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	ref, err := name.ParseReference(fmt.Sprintf("%s/layers:latest", u.Host))
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref, img))
+	atomic.StoreInt64(&handler.served, 0)
+
+	generator := file.NewTempDirGenerator("stereoscope-layer-reader-test")
+	t.Cleanup(func() { _ = generator.Cleanup() })
+
+	provider := NewProviderFromRegistry(ref.String(), generator, image.RegistryOptions{}, nil)
+	reader, err := provider.NewLayerFileReader(context.Background(), layer.String())
+	require.NoError(t, err)
+	return reader
+}
+
+// esgzLayerBytes converts the given layer tar to an eStargz layer blob.
+func esgzLayerBytes(t *testing.T, tarBytes []byte) []byte {
+	t.Helper()
+	esgzBuf := &bytes.Buffer{}
+	esgzWriter := estargz.NewWriterWithCompressor(esgzBuf, &gzipTOCCompressor{estargz.NewGzipCompressor()})
+	require.NoError(t, esgzWriter.AppendTar(bytes.NewReader(tarBytes)))
+	_, err := esgzWriter.Close()
+	require.NoError(t, err)
+	return esgzBuf.Bytes()
+}
+
+func TestRegistryLayerFileReader_Open(t *testing.T) {
+	big := make([]byte, 2*1024*1024)
+	_, err := rand.Read(big)
+	require.NoError(t, err)
+	files := map[string][]byte{
+		"big.bin":        big,
+		"etc/target.txt": []byte("the target file\n"),
+	}
+	tarBytes := layerTar(t, files)
+
+	// an eStargz layer includes a table of contents, allowing for reading individual files with range requests
+	esgzBytes := esgzLayerBytes(t, tarBytes)
+
+	esgzLayer := layerFromBytes(t, esgzBytes)
+	plainLayer := layerFromBytes(t, tarBytes)
+
+	esgzDigest, err := esgzLayer.Digest()
+	require.NoError(t, err)
+	plainDigest, err := plainLayer.Digest()
+	require.NoError(t, err)
+
+	img, err := mutate.AppendLayers(empty.Image, esgzLayer, plainLayer)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		layer         containerregistryV1.Hash
+		supportsRange bool
+		path          file.Path
+		expected      []byte
+		partial       bool
+		wantErr       error
+	}{
+		{
+			name:          "eStargz layer with range requests",
+			layer:         esgzDigest,
+			supportsRange: true,
+			path:          "/etc/target.txt",
+			expected:      files["etc/target.txt"],
+			partial:       true,
+		},
+		{
+			name:          "eStargz layer without range requests",
+			layer:         esgzDigest,
+			supportsRange: false,
+			path:          "/etc/target.txt",
+			expected:      files["etc/target.txt"],
+		},
+		{
+			name:          "gzip layer with range requests",
+			layer:         plainDigest,
+			supportsRange: true,
+			path:          "etc/target.txt",
+			expected:      files["etc/target.txt"],
+		},
+		{
+			name:          "missing file with range requests",
+			layer:         esgzDigest,
+			supportsRange: true,
+			path:          "/etc/missing.txt",
+			wantErr:       &file.ErrFileNotFound{},
+		},
+		{
+			name:          "missing file without range requests",
+			layer:         plainDigest,
+			supportsRange: false,
+			path:          "/etc/missing.txt",
+			wantErr:       &file.ErrFileNotFound{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := &rangeRegistry{
+				registry:      registry.New(),
+				blobs:         map[string][]byte{esgzDigest.String(): esgzBytes},
+				supportsRange: test.supportsRange,
+			}
+			reader := newTestLayerFileReader(t, handler, img, test.layer)
+
+			rc, err := reader.Open(test.path)
+			if test.wantErr != nil {
+				var notFound *file.ErrFileNotFound
+				assert.True(t, errors.As(err, &notFound), "unexpected error: %+v", err)
+				return
+			}
+			require.NoError(t, err)
+			actual, err := ioutil.ReadAll(rc)
+			require.NoError(t, err)
+			require.NoError(t, rc.Close())
+			assert.Equal(t, test.expected, actual)
+
+			served := atomic.LoadInt64(&handler.served)
+			if test.partial {
+				assert.Less(t, served, int64(len(big)/10), "expected only a fraction of the layer to be downloaded")
+			} else {
+				assert.GreaterOrEqual(t, served, int64(len(big)), "expected the full layer to be downloaded")
+			}
+		})
+	}
+}
+
+func TestRegistryLayerFileReader_Files(t *testing.T) {
+	big := make([]byte, 2*1024*1024)
+	_, err := rand.Read(big)
+	require.NoError(t, err)
+	tarBytes := layerTar(t, map[string][]byte{
+		"big.bin":        big,
+		"etc/target.txt": []byte("the target file\n"),
+	})
+	esgzBytes := esgzLayerBytes(t, tarBytes)
+
+	esgzLayer := layerFromBytes(t, esgzBytes)
+	esgzDigest, err := esgzLayer.Digest()
+	require.NoError(t, err)
+	img, err := mutate.AppendLayers(empty.Image, esgzLayer)
+	require.NoError(t, err)
+
+	for _, supportsRange := range []bool{true, false} {
+		t.Run(fmt.Sprintf("range requests=%v", supportsRange), func(t *testing.T) {
+			handler := &rangeRegistry{
+				registry:      registry.New(),
+				blobs:         map[string][]byte{esgzDigest.String(): esgzBytes},
+				supportsRange: supportsRange,
+			}
+			reader := newTestLayerFileReader(t, handler, img, esgzDigest)
+
+			files, err := reader.Files()
+			require.NoError(t, err)
+
+			// the eStargz table of contents and landmarks are not part of the layer content (note: implied directories
+			// are only found within the table of contents)
+			var paths []string
+			var target file.Metadata
+			for _, f := range files {
+				if f.IsDir {
+					continue
+				}
+				paths = append(paths, f.Path)
+				if f.Path == "/etc/target.txt" {
+					target = f
+				}
+			}
+			assert.Equal(t, []string{"/big.bin", "/etc/target.txt"}, paths)
+
+			assert.Equal(t, byte(tar.TypeReg), target.TypeFlag)
+			assert.Equal(t, int64(len("the target file\n")), target.Size)
+			assert.Equal(t, os.FileMode(0644), target.Mode)
+
+			served := atomic.LoadInt64(&handler.served)
+			if supportsRange {
+				// only the table of contents is read
+				assert.Less(t, served, int64(len(big)/10), "expected only a fraction of the layer to be downloaded")
+			} else {
+				assert.GreaterOrEqual(t, served, int64(len(big)), "expected the full layer to be downloaded")
+			}
+		})
+	}
+}
+
+func Test_Registry_Provide_EStargzLayers(t *testing.T) {
+	big := make([]byte, 2*1024*1024)
+	_, err := rand.Read(big)
+	require.NoError(t, err)
+
+	// the eStargz layer is above a (small) plain gzip layer, which is always read in full
+	plainLayer := layerFromBytes(t, layerTar(t, map[string][]byte{
+		"etc/target.txt": []byte("the lower target file\n"),
+	}))
+	esgzBytes := esgzLayerBytes(t, layerTar(t, map[string][]byte{
+		"big.bin":        big,
+		"etc/target.txt": []byte("the target file\n"),
+	}))
+	esgzLayer := layerFromBytes(t, esgzBytes)
+	esgzDigest, err := esgzLayer.Digest()
+	require.NoError(t, err)
+
+	img, err := mutate.AppendLayers(empty.Image, plainLayer, esgzLayer)
+	require.NoError(t, err)
+
+	for _, supportsRange := range []bool{true, false} {
+		t.Run(fmt.Sprintf("range requests=%v", supportsRange), func(t *testing.T) {
+			handler := &rangeRegistry{
+				registry:      registry.New(),
+				blobs:         map[string][]byte{esgzDigest.String(): esgzBytes},
+				supportsRange: supportsRange,
+			}
+			server := httptest.NewServer(handler)
+			t.Cleanup(server.Close)
+			u, err := url.Parse(server.URL)
+			require.NoError(t, err)
+
+			ref, err := name.ParseReference(fmt.Sprintf("%s/layers:latest", u.Host))
+			require.NoError(t, err)
+			require.NoError(t, remote.Write(ref, img))
+			atomic.StoreInt64(&handler.served, 0)
+
+			generator := file.NewTempDirGenerator("stereoscope-estargz-test")
+			t.Cleanup(func() { _ = generator.Cleanup() })
+
+			provider := NewProviderFromRegistry(ref.String(), generator, image.RegistryOptions{}, nil)
+			resolved, err := provider.Provide(context.Background(), image.WithEStargzLayers(true))
+			require.NoError(t, err)
+			t.Cleanup(func() { _ = resolved.Cleanup() })
+			require.NoError(t, resolved.Read())
+
+			assert.True(t, resolved.SquashedTree().HasPath("/big.bin"))
+
+			metadata, err := resolved.FileMetadataFromSquash("/big.bin")
+			require.NoError(t, err)
+			assert.Equal(t, int64(len(big)), metadata.Size)
+
+			rc, err := resolved.FileContentsFromSquash("/etc/target.txt")
+			require.NoError(t, err)
+			actual, err := ioutil.ReadAll(rc)
+			require.NoError(t, err)
+			require.NoError(t, rc.Close())
+			assert.Equal(t, "the target file\n", string(actual))
+
+			served := atomic.LoadInt64(&handler.served)
+			if supportsRange {
+				// only the table of contents and the file read are downloaded from the eStargz layer (note: the table of
+				// contents and landmarks are not part of the layer content)
+				assert.False(t, resolved.SquashedTree().HasPath("/"+estargz.TOCTarName))
+				assert.Less(t, served, int64(len(big)/10), "expected only a fraction of the layer to be downloaded")
+			} else {
+				assert.GreaterOrEqual(t, served, int64(len(big)), "expected the full layer to be downloaded")
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package oci
+
+import (
+	"context"
+	"io"
+
+	"github.com/anchore/stereoscope/internal/bus"
+	"github.com/anchore/stereoscope/pkg/event"
+	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/google/go-containerregistry/pkg/name"
+	containerregistryV1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/wagoodman/go-partybus"
+	"github.com/wagoodman/go-progress"
+)
+
+// registryImage is an image fetched from a registry that reports the download progress of each layer blob (see
+// event.DownloadLayer) and stops any download promptly once the given context is cancelled. Each layer blob can also be
+// read at random with HTTP range requests (see image.RandomAccessLayer).
+type registryImage struct {
+	containerregistryV1.Image
+	ctx             context.Context
+	repo            name.Repository
+	registryOptions image.RegistryOptions
+}
+
+// Layers implements containerregistryV1.Image.
+func (i *registryImage) Layers() ([]containerregistryV1.Layer, error) {
+	layers, err := i.Image.Layers()
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped := make([]containerregistryV1.Layer, len(layers))
+	for idx, layer := range layers {
+		// note: the uncompressed contents are read through the (progress reporting) compressed contents
+		compressed, err := partial.CompressedToLayer(&registryLayer{Layer: layer, ctx: i.ctx})
+		if err != nil {
+			return nil, err
+		}
+		wrapped[idx] = &randomAccessLayer{Layer: compressed, image: i}
+	}
+	return wrapped, nil
+}
+
+var _ image.RandomAccessLayer = (*randomAccessLayer)(nil)
+
+// randomAccessLayer is a registry layer whose blob can be read at random with HTTP range requests.
+type randomAccessLayer struct {
+	containerregistryV1.Layer
+	image *registryImage
+}
+
+// CompressedReaderAt implements image.RandomAccessLayer. Note: this fails when the registry does not report the blob
+// size, and reads fail when the registry does not support range requests.
+func (l *randomAccessLayer) CompressedReaderAt() (io.ReaderAt, int64, error) {
+	digest, err := l.Layer.Digest()
+	if err != nil {
+		return nil, 0, err
+	}
+	readerAt, err := newRangeReaderAt(l.image.ctx, l.image.repo.Digest(digest.String()), l.image.registryOptions)
+	if err != nil {
+		return nil, 0, err
+	}
+	return readerAt, readerAt.size, nil
+}
+
+type registryLayer struct {
+	containerregistryV1.Layer
+	ctx context.Context
+}
+
+// Compressed implements partial.CompressedLayer, publishing a download event for the layer blob.
+func (l *registryLayer) Compressed() (io.ReadCloser, error) {
+	if err := l.ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	digest, err := l.Layer.Digest()
+	if err != nil {
+		return nil, err
+	}
+
+	// note: the size is best-effort, without it the progress has no total
+	size, _ := l.Layer.Size()
+
+	rc, err := l.Layer.Compressed()
+	if err != nil {
+		return nil, err
+	}
+
+	prog := &progress.Manual{Total: size}
+	bus.Publish(partybus.Event{
+		Type:   event.DownloadLayer,
+		Source: digest.String(),
+		Value:  progress.Progressable(prog),
+	})
+
+	return &downloadReader{ReadCloser: rc, ctx: l.ctx, prog: prog}, nil
+}
+
+// downloadReader tracks the bytes read from a layer blob download.
+type downloadReader struct {
+	io.ReadCloser
+	ctx  context.Context
+	prog *progress.Manual
+}
+
+func (r *downloadReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		r.prog.Err = err
+		return 0, err
+	}
+
+	n, err := r.ReadCloser.Read(p)
+	r.prog.N += int64(n)
+	switch {
+	case err == io.EOF:
+		r.prog.SetCompleted()
+	case err != nil:
+		r.prog.Err = err
+	}
+	return n, err
+}
@@ -0,0 +1,108 @@
+package oci
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wagoodman/go-partybus"
+	"github.com/wagoodman/go-progress"
+
+	"github.com/anchore/stereoscope/internal/bus"
+	"github.com/anchore/stereoscope/pkg/event"
+	"github.com/anchore/stereoscope/pkg/event/parsers"
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+)
+
+// recordingPublisher synchronously records all published events.
+type recordingPublisher struct {
+	lock   sync.Mutex
+	events []partybus.Event
+}
+
+func (p *recordingPublisher) Publish(e partybus.Event) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.events = append(p.events, e)
+}
+
+func (p *recordingPublisher) eventsOf(ty partybus.EventType) []partybus.Event {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	var result []partybus.Event
+	for _, e := range p.events {
+		if e.Type == ty {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+func pushRandomImage(t *testing.T, layers int) string {
+	t.Helper()
+	server := httptest.NewServer(registry.New())
+	t.Cleanup(server.Close)
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	img, err := random.Image(1024, int64(layers))
+	require.NoError(t, err)
+	ref, err := name.ParseReference(fmt.Sprintf("%s/progress:latest", u.Host))
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref, img))
+	return ref.String()
+}
+
+func Test_Registry_Provide_DownloadProgress(t *testing.T) {
+	publisher := &recordingPublisher{}
+	bus.SetPublisher(publisher)
+	t.Cleanup(func() { bus.SetPublisher(nil) })
+
+	provider := NewProviderFromRegistry(pushRandomImage(t, 3), file.NewTempDirGenerator("test"), image.RegistryOptions{InsecureUseHTTP: true}, nil)
+	img, err := provider.Provide(context.Background())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = img.Cleanup() })
+	require.NoError(t, img.Read())
+
+	downloads := publisher.eventsOf(event.DownloadLayer)
+	require.Len(t, downloads, 3)
+	for _, e := range downloads {
+		digest, prog, err := parsers.ParseDownloadLayer(e)
+		require.NoError(t, err)
+		assert.NotEmpty(t, digest)
+		assert.True(t, prog.Size() > 0)
+		assert.Equal(t, prog.Size(), prog.Current())
+		assert.True(t, progress.IsCompleted(prog))
+	}
+
+	reads := publisher.eventsOf(event.ReadImage)
+	require.Len(t, reads, 1)
+	_, prog, err := parsers.ParseReadImage(reads[0])
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), prog.Size())
+	assert.Equal(t, prog.Size(), prog.Current())
+}
+
+func Test_Registry_Provide_DownloadCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	provider := NewProviderFromRegistry(pushRandomImage(t, 1), file.NewTempDirGenerator("test"), image.RegistryOptions{InsecureUseHTTP: true}, nil)
+	img, err := provider.Provide(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = img.Cleanup() })
+
+	cancel()
+	err = img.Read()
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, context.Canceled), "unexpected error: %+v", err)
+}
@@ -3,6 +3,7 @@ package oci
 import (
 	"context"
 	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"net/http"
 
@@ -13,6 +14,7 @@ import (
 	"github.com/google/go-containerregistry/pkg/name"
 	containerregistryV1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 // RegistryImageProvider is an image.Provider capable of fetching and representing a container image fetched from a remote registry (described by the OCI distribution spec).
@@ -47,16 +49,43 @@ func (p *RegistryImageProvider) Provide(ctx context.Context, userMetadata ...ima
 		return nil, fmt.Errorf("unable to parse registry reference=%q: %+v", p.imageStr, err)
 	}
 
-	descriptor, err := remote.Get(ref, prepareRemoteOptions(ctx, ref, p.registryOptions, p.platform)...)
+	// note: the image is pulled from the mirror, however, it is still reported relative to the requested registry
+	pullRef, err := mirrorReference(ref, p.registryOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	remoteOptions := prepareRemoteOptions(ctx, pullRef, p.registryOptions, p.platform)
+
+	// note: a reference with a digest is always fetched by digest (any tag is only informational), in which case the
+	// registry client verifies that the fetched manifest matches the digest
+	if digest, ok := ref.(name.Digest); ok {
+		p.warnOnTagMismatch(digest, remoteOptions)
+	}
+
+	descriptor, err := remote.Get(pullRef, remoteOptions...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get image descriptor from registry: %+v", err)
 	}
 
-	img, err := descriptor.Image()
+	var img containerregistryV1.Image
+	if isSchema1(descriptor.MediaType) {
+		log.Warnf("image=%q uses a deprecated docker v2 schema 1 manifest, the image config and history are reconstructed from the manifest", p.imageStr)
+		img, err = schema1Image(pullRef.Context(), descriptor.Manifest, remoteOptions...)
+	} else {
+		img, err = descriptor.Image()
+	}
 	if err != nil {
+		if p.platform != nil && descriptor.MediaType.IsIndex() {
+			return nil, fmt.Errorf("image=%q does not have a manifest for platform=%q: %w", p.imageStr, p.platform.String(), err)
+		}
 		return nil, fmt.Errorf("failed to get image from registry: %+v", err)
 	}
 
+	if err := validatePlatform(p.platform, img); err != nil {
+		return nil, fmt.Errorf("image=%q: %w", p.imageStr, err)
+	}
+
 	// craft a repo digest from the registry reference and the known digest
 	// note: the descriptor is fetched from the registry, and the descriptor digest is the same as the repo digest
 	repoDigest := fmt.Sprintf("%s/%s@%s", ref.Context().RegistryStr(), ref.Context().RepositoryStr(), descriptor.Digest.String())
@@ -66,21 +95,92 @@ func (p *RegistryImageProvider) Provide(ctx context.Context, userMetadata ...ima
 	}
 
 	// make a best effort to get the manifest, should not block getting an image though if it fails
-	if manifestBytes, err := img.RawManifest(); err == nil {
+	if isSchema1(descriptor.MediaType) {
+		// note: report the manifest from the registry (not the reconstructed one), the digest of a signed schema 1
+		// manifest does not include the signatures
+		metadata = append(metadata, image.WithManifest(descriptor.Manifest), image.WithManifestDigest(descriptor.Digest.String()))
+	} else if manifestBytes, err := img.RawManifest(); err == nil {
 		metadata = append(metadata, image.WithManifest(manifestBytes))
 	}
 
-	if p.platform != nil {
+	// note: the platform is recorded from the image config, not the requested platform (a single-platform manifest is
+	// returned as-is, and the registry may select a different variant from an index)
+	if platform := configPlatform(img); platform != nil {
 		metadata = append(metadata,
-			image.WithArchitecture(p.platform.Architecture, p.platform.Variant),
-			image.WithOS(p.platform.OS),
+			image.WithArchitecture(platform.Architecture, platform.Variant),
+			image.WithOS(platform.OS),
 		)
 	}
 
 	// apply user-supplied metadata last to override any default behavior
 	metadata = append(metadata, userMetadata...)
 
-	return image.NewImage(img, imageTempDir, metadata...), nil
+	registryImg := &registryImage{Image: img, ctx: ctx, repo: pullRef.Context(), registryOptions: p.registryOptions}
+	return image.NewImage(registryImg, imageTempDir, metadata...), nil
+}
+
+// warnOnTagMismatch logs a warning if the image reference has both a tag and a digest, and the tag currently refers to
+// a different digest within the registry (the digest is used regardless).
+func (p *RegistryImageProvider) warnOnTagMismatch(digest name.Digest, remoteOptions []remote.Option) {
+	tag, ok := image.ReferenceTag(p.imageStr, prepareReferenceOptions(p.registryOptions)...)
+	if !ok {
+		return
+	}
+
+	pullTag, err := mirrorReference(tag, p.registryOptions)
+	if err != nil {
+		log.Debugf("unable to check tag=%q of image=%q: %+v", tag.TagStr(), p.imageStr, err)
+		return
+	}
+
+	descriptor, err := remote.Head(pullTag, remoteOptions...)
+	if err != nil {
+		log.Debugf("unable to check tag=%q of image=%q: %+v", tag.TagStr(), p.imageStr, err)
+		return
+	}
+
+	if descriptor.Digest.String() != digest.DigestStr() {
+		log.Warnf("image=%q: tag=%q refers to digest=%q, using the given digest=%q instead", p.imageStr, tag.TagStr(), descriptor.Digest.String(), digest.DigestStr())
+	}
+}
+
+// configPlatform returns the platform described by the image config (nil if the config could not be read or does not
+// describe a platform).
+func configPlatform(img containerregistryV1.Image) *image.Platform {
+	rawConfig, err := img.RawConfigFile()
+	if err != nil {
+		log.Debugf("unable to read image config to determine platform: %+v", err)
+		return nil
+	}
+	// note: the parsed config file does not include the architecture variant, so the raw config is parsed instead
+	var cfg ocispec.Image
+	if err := json.Unmarshal(rawConfig, &cfg); err != nil || cfg.Architecture == "" {
+		return nil
+	}
+	return &image.Platform{OS: cfg.OS, Architecture: cfg.Architecture, Variant: cfg.Variant}
+}
+
+// validatePlatform ensures the fetched image is for the requested platform. This is necessary since a reference to a
+// single-platform manifest is returned as-is by the registry, regardless of the platform requested.
+func validatePlatform(platform *image.Platform, img containerregistryV1.Image) error {
+	if platform == nil {
+		return nil
+	}
+
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		return fmt.Errorf("unable to read image config to verify platform: %w", err)
+	}
+
+	// note: the image config does not record the architecture variant, so only the OS and architecture can be verified
+	mismatch := (platform.OS != "" && cfg.OS != "" && platform.OS != cfg.OS) ||
+		(platform.Architecture != "" && cfg.Architecture != "" && platform.Architecture != cfg.Architecture)
+
+	if mismatch {
+		actual := image.Platform{OS: cfg.OS, Architecture: cfg.Architecture}
+		return fmt.Errorf("requested platform=%q but the image platform is %q", platform.String(), actual.String())
+	}
+	return nil
 }
 
 func prepareReferenceOptions(registryOptions image.RegistryOptions) []name.Option {
@@ -91,10 +191,36 @@ func prepareReferenceOptions(registryOptions image.RegistryOptions) []name.Optio
 	return options
 }
 
+// mirrorReference returns the given reference rewritten to the mirror configured for its registry (if any).
+func mirrorReference(ref name.Reference, registryOptions image.RegistryOptions) (name.Reference, error) {
+	mirror := registryOptions.Mirror(ref.Context().RegistryStr())
+	if mirror == "" {
+		return ref, nil
+	}
+
+	var mirrored string
+	switch r := ref.(type) {
+	case name.Digest:
+		mirrored = fmt.Sprintf("%s/%s@%s", mirror, r.RepositoryStr(), r.DigestStr())
+	case name.Tag:
+		mirrored = fmt.Sprintf("%s/%s:%s", mirror, r.RepositoryStr(), r.TagStr())
+	default:
+		return nil, fmt.Errorf("unsupported registry reference=%q", ref.String())
+	}
+
+	mirrorRef, err := name.ParseReference(mirrored, prepareReferenceOptions(registryOptions)...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to use mirror=%q for registry=%q: %w", mirror, ref.Context().RegistryStr(), err)
+	}
+	log.Debugf("pulling image=%q from mirror=%q", ref.String(), mirror)
+	return mirrorRef, nil
+}
+
 func prepareRemoteOptions(ctx context.Context, ref name.Reference, registryOptions image.RegistryOptions, p *image.Platform) (options []remote.Option) {
 	options = append(options, remote.WithContext(ctx))
 
 	if registryOptions.InsecureSkipTLSVerify {
+		log.Warnf("TLS certificate verification is disabled for registry=%q", ref.Context().RegistryStr())
 		t := &http.Transport{
 			// nolint: gosec
 			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
@@ -116,7 +242,9 @@ func prepareRemoteOptions(ctx context.Context, ref name.Reference, registryOptio
 	if authenticator != nil {
 		options = append(options, remote.WithAuth(authenticator))
 	} else {
-		// use the Keychain specified from a docker config file.
+		// use the Keychain specified from a docker config file, which resolves per-registry credential helpers
+		// ("credHelpers"), the global credential store ("credsStore"), and inline "auths" entries (falling back to
+		// anonymous access when there are no credentials for the registry).
 		log.Debugf("no registry credentials configured, using the default keychain")
 		options = append(options, remote.WithAuthFromKeychain(authn.DefaultKeychain))
 	}
@@ -2,13 +2,26 @@ package oci
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/anchore/stereoscope/pkg/file"
 	"github.com/anchore/stereoscope/pkg/image"
 	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	containerregistryV1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func Test_NewProviderFromRegistry(t *testing.T) {
@@ -94,6 +107,99 @@ func Test_Registry_Provide(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func platformImage(t *testing.T, os, arch string) containerregistryV1.Image {
+	t.Helper()
+	img, err := random.Image(64, 1)
+	require.NoError(t, err)
+	cfg, err := img.ConfigFile()
+	require.NoError(t, err)
+	cfg = cfg.DeepCopy()
+	cfg.OS = os
+	cfg.Architecture = arch
+	img, err = mutate.ConfigFile(img, cfg)
+	require.NoError(t, err)
+	return img
+}
+
+func Test_Registry_Provide_Platform(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	amd64 := platformImage(t, "linux", "amd64")
+	arm64 := platformImage(t, "linux", "arm64")
+
+	index := mutate.AppendManifests(empty.Index,
+		mutate.IndexAddendum{Add: amd64, Descriptor: containerregistryV1.Descriptor{Platform: &containerregistryV1.Platform{OS: "linux", Architecture: "amd64"}}},
+		mutate.IndexAddendum{Add: arm64, Descriptor: containerregistryV1.Descriptor{Platform: &containerregistryV1.Platform{OS: "linux", Architecture: "arm64"}}},
+	)
+
+	indexRef, err := name.ParseReference(fmt.Sprintf("%s/multi:latest", u.Host))
+	require.NoError(t, err)
+	require.NoError(t, remote.WriteIndex(indexRef, index))
+
+	singleRef, err := name.ParseReference(fmt.Sprintf("%s/single:latest", u.Host))
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(singleRef, arm64))
+
+	tests := []struct {
+		name         string
+		imageStr     string
+		platform     *image.Platform
+		expectedArch string
+		expectedErr  bool
+	}{
+		{
+			name:         "select platform from index",
+			imageStr:     indexRef.String(),
+			platform:     &image.Platform{OS: "linux", Architecture: "arm64"},
+			expectedArch: "arm64",
+		},
+		{
+			name:        "platform missing from index",
+			imageStr:    indexRef.String(),
+			platform:    &image.Platform{OS: "linux", Architecture: "s390x"},
+			expectedErr: true,
+		},
+		{
+			name:         "single platform image matches",
+			imageStr:     singleRef.String(),
+			platform:     &image.Platform{OS: "linux", Architecture: "arm64"},
+			expectedArch: "arm64",
+		},
+		{
+			// the platform is recorded from the image config, even when no platform was requested
+			name:         "single platform image without a requested platform",
+			imageStr:     singleRef.String(),
+			expectedArch: "arm64",
+		},
+		{
+			name:        "single platform image does not match",
+			imageStr:    singleRef.String(),
+			platform:    &image.Platform{OS: "linux", Architecture: "amd64"},
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			provider := NewProviderFromRegistry(test.imageStr, file.NewTempDirGenerator("test"), image.RegistryOptions{InsecureUseHTTP: true}, test.platform)
+			img, err := provider.Provide(context.Background())
+			if test.expectedErr {
+				assert.Error(t, err)
+				assert.Nil(t, img)
+				return
+			}
+			require.NoError(t, err)
+			require.NoError(t, img.Read())
+			defer img.Cleanup()
+			assert.Equal(t, test.expectedArch, img.Metadata.Architecture)
+			assert.Equal(t, "linux", img.Metadata.OS)
+		})
+	}
+}
+
 func Test_prepareReferenceOptions(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -129,3 +235,171 @@ func Test_prepareReferenceOptions(t *testing.T) {
 		})
 	}
 }
+
+func Test_Registry_Provide_Schema1(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	repo, err := name.NewRepository(fmt.Sprintf("%s/legacy", u.Host))
+	require.NoError(t, err)
+
+	base, err := random.Layer(64, types.DockerLayer)
+	require.NoError(t, err)
+	top, err := random.Layer(64, types.DockerLayer)
+	require.NoError(t, err)
+	emptyLayer, err := random.Layer(0, types.DockerLayer)
+	require.NoError(t, err)
+
+	var blobSums []string
+	for _, l := range []containerregistryV1.Layer{base, top, emptyLayer} {
+		require.NoError(t, remote.WriteLayer(repo, l))
+		digest, err := l.Digest()
+		require.NoError(t, err)
+		blobSums = append(blobSums, digest.String())
+	}
+
+	// note: schema 1 layers and history are ordered from the top layer to the base layer
+	manifest := fmt.Sprintf(`{
+  "schemaVersion": 1,
+  "name": "legacy",
+  "tag": "latest",
+  "architecture": "amd64",
+  "fsLayers": [
+    {"blobSum": %[3]q},
+    {"blobSum": %[2]q},
+    {"blobSum": %[1]q}
+  ],
+  "history": [
+    {"v1Compatibility": "{\"id\":\"c\",\"parent\":\"b\",\"architecture\":\"amd64\",\"os\":\"linux\",\"created\":\"2016-01-03T00:00:00Z\",\"config\":{\"Env\":[\"PATH=/bin\"],\"Cmd\":[\"/app\"],\"Labels\":{\"legacy\":\"true\"}},\"container_config\":{\"Cmd\":[\"/bin/sh\",\"-c\",\"#(nop) CMD [\\\"/app\\\"]\"]},\"throwaway\":true}"},
+    {"v1Compatibility": "{\"id\":\"b\",\"parent\":\"a\",\"created\":\"2016-01-02T00:00:00Z\",\"container_config\":{\"Cmd\":[\"/bin/sh\",\"-c\",\"make install\"]}}"},
+    {"v1Compatibility": "{\"id\":\"a\",\"created\":\"2016-01-01T00:00:00Z\",\"container_config\":{\"Cmd\":[\"/bin/sh\",\"-c\",\"#(nop) ADD file:abc in /\"]}}"}
+  ]
+}`, blobSums[0], blobSums[1], blobSums[2])
+
+	req, err := http.NewRequest(http.MethodPut, fmt.Sprintf("%s/v2/legacy/manifests/latest", server.URL), strings.NewReader(manifest))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", string(types.DockerManifestSchema1))
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	provider := NewProviderFromRegistry(repo.Tag("latest").String(), file.NewTempDirGenerator("test"), image.RegistryOptions{InsecureUseHTTP: true}, nil)
+	img, err := provider.Provide(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, img.Read())
+	defer img.Cleanup()
+
+	assert.Equal(t, "amd64", img.Metadata.Config.Architecture)
+	assert.Equal(t, "linux", img.Metadata.Config.OS)
+	assert.Equal(t, []string{"/app"}, img.Metadata.Config.Config.Cmd)
+	assert.Equal(t, map[string]string{"legacy": "true"}, img.Metadata.Labels)
+	assert.Equal(t, []byte(manifest), img.Metadata.RawManifest)
+
+	// the throwaway (empty) layer is not included
+	require.Len(t, img.Layers, 2)
+	for idx, expected := range []containerregistryV1.Layer{base, top} {
+		diffID, err := expected.DiffID()
+		require.NoError(t, err)
+		assert.Equal(t, diffID.String(), img.Layers[idx].Metadata.Digest)
+	}
+
+	var createdBy []string
+	for _, h := range img.Metadata.Config.History {
+		createdBy = append(createdBy, h.CreatedBy)
+	}
+	assert.Equal(t, []string{
+		"/bin/sh -c #(nop) ADD file:abc in /",
+		"/bin/sh -c make install",
+		"/bin/sh -c #(nop) CMD [\"/app\"]",
+	}, createdBy)
+	require.Len(t, img.Layers[1].History(), 2)
+	assert.True(t, img.Layers[1].History()[1].EmptyLayer)
+}
+
+func Test_Registry_Provide_Mirror(t *testing.T) {
+	mirrored, err := name.ParseReference(pushRandomImage(t, 1))
+	require.NoError(t, err)
+
+	// the requested registry does not exist, so the image can only be pulled from the mirror
+	requested := fmt.Sprintf("registry.invalid/%s:latest", mirrored.Context().RepositoryStr())
+	options := image.RegistryOptions{
+		InsecureUseHTTP: true,
+		Mirrors:         map[string]string{"registry.invalid": mirrored.Context().RegistryStr()},
+	}
+
+	provider := NewProviderFromRegistry(requested, file.NewTempDirGenerator("test"), options, nil)
+	img, err := provider.Provide(context.Background())
+	require.NoError(t, err)
+	defer img.Cleanup()
+	require.NoError(t, img.Read())
+
+	// the image is reported relative to the requested registry
+	require.Len(t, img.Metadata.RepoDigests, 1)
+	assert.True(t, strings.HasPrefix(img.Metadata.RepoDigests[0], "registry.invalid/progress@sha256:"), img.Metadata.RepoDigests[0])
+}
+
+func Test_Registry_Provide_Digest(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	t.Cleanup(server.Close)
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	pinned, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	latest, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	pinnedRef, err := name.ParseReference(fmt.Sprintf("%s/pinned:v1", u.Host))
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(pinnedRef, pinned))
+	latestRef, err := name.ParseReference(fmt.Sprintf("%s/pinned:v2", u.Host))
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(latestRef, latest))
+
+	pinnedDigest, err := pinned.Digest()
+	require.NoError(t, err)
+	pinnedID, err := pinned.ConfigName()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		image   string
+		wantErr require.ErrorAssertionFunc
+	}{
+		{
+			name:  "digest",
+			image: fmt.Sprintf("%s/pinned@%s", u.Host, pinnedDigest),
+		},
+		{
+			// the tag refers to a different image, however, the digest is preferred
+			name:  "tag and digest",
+			image: fmt.Sprintf("%s/pinned:v2@%s", u.Host, pinnedDigest),
+		},
+		{
+			name:    "unknown digest",
+			image:   fmt.Sprintf("%s/pinned@sha256:%s", u.Host, strings.Repeat("0", 64)),
+			wantErr: require.Error,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.wantErr == nil {
+				test.wantErr = require.NoError
+			}
+			provider := NewProviderFromRegistry(test.image, file.NewTempDirGenerator("test"), image.RegistryOptions{InsecureUseHTTP: true}, nil)
+			img, err := provider.Provide(context.Background())
+			test.wantErr(t, err)
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { _ = img.Cleanup() })
+			require.NoError(t, img.Read())
+
+			assert.Equal(t, pinnedID.String(), img.Metadata.ID)
+			assert.Equal(t, []string{fmt.Sprintf("%s/pinned@%s", u.Host, pinnedDigest)}, img.Metadata.RepoDigests)
+		})
+	}
+}
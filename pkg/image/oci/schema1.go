@@ -0,0 +1,124 @@
+package oci
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	containerregistryV1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// schema1Manifest is a (deprecated) docker image manifest v2 schema 1. Layers and history are ordered from the top
+// (most recent) layer to the base layer, and there is no config blob: the config is embedded within the history.
+type schema1Manifest struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Architecture  string `json:"architecture"`
+	FSLayers      []struct {
+		BlobSum string `json:"blobSum"`
+	} `json:"fsLayers"`
+	History []struct {
+		V1Compatibility string `json:"v1Compatibility"`
+	} `json:"history"`
+}
+
+// schema1Compatibility is the legacy (v1) image json embedded in each schema 1 history entry.
+type schema1Compatibility struct {
+	Architecture    string                     `json:"architecture"`
+	OS              string                     `json:"os"`
+	Author          string                     `json:"author"`
+	Comment         string                     `json:"comment"`
+	Created         containerregistryV1.Time   `json:"created"`
+	Config          containerregistryV1.Config `json:"config"`
+	ContainerConfig struct {
+		Cmd []string
+	} `json:"container_config"`
+	// Throwaway indicates that the layer is empty (e.g. ENV or CMD instructions)
+	Throwaway bool `json:"throwaway"`
+}
+
+func isSchema1(mediaType types.MediaType) bool {
+	return mediaType == types.DockerManifestSchema1 || mediaType == types.DockerManifestSchema1Signed
+}
+
+// schema1Image converts a schema 1 manifest into an image, fetching layers from the given repository. Layer ordering,
+// the config, and the history are reconstructed from the manifest. Since schema 1 manifests do not record the layer
+// diff IDs, each layer is decompressed once to compute its diff ID when the image config is first read.
+func schema1Image(repo name.Repository, rawManifest []byte, options ...remote.Option) (containerregistryV1.Image, error) {
+	var manifest schema1Manifest
+	if err := json.Unmarshal(rawManifest, &manifest); err != nil {
+		return nil, fmt.Errorf("unable to parse schema 1 manifest: %w", err)
+	}
+	if manifest.SchemaVersion != 1 {
+		return nil, fmt.Errorf("unexpected schema version for schema 1 manifest: %d", manifest.SchemaVersion)
+	}
+	if len(manifest.FSLayers) != len(manifest.History) {
+		return nil, fmt.Errorf("schema 1 manifest has %d layers but %d history entries", len(manifest.FSLayers), len(manifest.History))
+	}
+	if len(manifest.FSLayers) == 0 {
+		return nil, fmt.Errorf("schema 1 manifest has no layers")
+	}
+
+	var top schema1Compatibility
+	var layers []containerregistryV1.Layer
+	var history []containerregistryV1.History
+
+	// note: process from the base layer to the top layer
+	for idx := len(manifest.FSLayers) - 1; idx >= 0; idx-- {
+		var compat schema1Compatibility
+		if err := json.Unmarshal([]byte(manifest.History[idx].V1Compatibility), &compat); err != nil {
+			return nil, fmt.Errorf("unable to parse schema 1 history entry %d: %w", idx, err)
+		}
+		if idx == 0 {
+			top = compat
+		}
+
+		history = append(history, containerregistryV1.History{
+			Author:     compat.Author,
+			Created:    compat.Created,
+			CreatedBy:  strings.Join(compat.ContainerConfig.Cmd, " "),
+			Comment:    compat.Comment,
+			EmptyLayer: compat.Throwaway,
+		})
+
+		if compat.Throwaway {
+			continue
+		}
+
+		digest, err := containerregistryV1.NewHash(manifest.FSLayers[idx].BlobSum)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schema 1 layer digest %q: %w", manifest.FSLayers[idx].BlobSum, err)
+		}
+		layer, err := remote.Layer(repo.Digest(digest.String()), options...)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get schema 1 layer=%q: %w", digest, err)
+		}
+		layers = append(layers, layer)
+	}
+
+	img, err := mutate.AppendLayers(empty.Image, layers...)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("unable to create config for schema 1 image: %w", err)
+	}
+	cfg = cfg.DeepCopy()
+	cfg.Architecture = top.Architecture
+	if cfg.Architecture == "" {
+		cfg.Architecture = manifest.Architecture
+	}
+	cfg.OS = top.OS
+	cfg.Author = top.Author
+	cfg.Created = top.Created
+	cfg.Config = top.Config
+	cfg.History = history
+
+	return mutate.ConfigFile(img, cfg)
+}
@@ -13,33 +13,61 @@ import (
 type TarballImageProvider struct {
 	path      string
 	tmpDirGen *file.TempDirGenerator
+	platform  *image.Platform
 }
 
-// NewProviderFromTarball creates a new provider instance for the specific image tarball already at the given path.
-func NewProviderFromTarball(path string, tmpDirGen *file.TempDirGenerator) *TarballImageProvider {
+// NewProviderFromTarball creates a new provider instance for the specific image tarball already at the given path. If a
+// platform is given then the matching manifest is selected from a multi-platform index (e.g. from "docker buildx build
+// --platform linux/amd64,linux/arm64 --output type=oci,dest=<name>.tar"), otherwise the index must describe a single image.
+func NewProviderFromTarball(path string, tmpDirGen *file.TempDirGenerator, platform *image.Platform) *TarballImageProvider {
 	return &TarballImageProvider{
 		path:      path,
 		tmpDirGen: tmpDirGen,
+		platform:  platform,
 	}
 }
 
 // Provide an image object that represents the OCI image from a tarball.
 func (p *TarballImageProvider) Provide(ctx context.Context, metadata ...image.AdditionalMetadata) (*image.Image, error) {
+	tempDir, err := p.extract()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewProviderFromPath(tempDir, p.tmpDirGen, p.platform, "").Provide(ctx, metadata...)
+}
+
+// ListPlatforms returns the platforms of all image manifests within the OCI tarball (see
+// DirectoryImageProvider.ListPlatforms).
+func (p *TarballImageProvider) ListPlatforms() ([]image.Platform, error) {
+	tempDir, err := p.extract()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = os.RemoveAll(tempDir)
+	}()
+
+	return NewProviderFromPath(tempDir, p.tmpDirGen, nil, "").ListPlatforms()
+}
+
+// extract untars the OCI tarball (an OCI layout directory) to a new temp directory.
+func (p *TarballImageProvider) extract() (string, error) {
 	// note: we are untaring the image and using the existing directory provider, we could probably enhance the google
 	// container registry lib to do this without needing to untar to a temp dir (https://github.com/google/go-containerregistry/issues/726)
 	f, err := os.Open(p.path)
 	if err != nil {
-		return nil, fmt.Errorf("unable to open OCI tarball: %w", err)
+		return "", fmt.Errorf("unable to open OCI tarball: %w", err)
 	}
+	defer f.Close()
 
 	tempDir, err := p.tmpDirGen.NewDirectory("oci-tarball-image")
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
 	if err = file.UntarToDirectory(f, tempDir); err != nil {
-		return nil, err
+		return "", err
 	}
-
-	return NewProviderFromPath(tempDir, p.tmpDirGen).Provide(ctx, metadata...)
+	return tempDir, nil
 }
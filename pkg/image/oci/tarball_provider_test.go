@@ -4,7 +4,9 @@ import (
 	"testing"
 
 	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func Test_NewProviderFromTarball(t *testing.T) {
@@ -13,7 +15,7 @@ func Test_NewProviderFromTarball(t *testing.T) {
 	generator := file.TempDirGenerator{}
 
 	//WHEN
-	provider := NewProviderFromTarball(path, &generator)
+	provider := NewProviderFromTarball(path, &generator, nil)
 
 	//THEN
 	assert.NotNil(t, provider.path)
@@ -22,7 +24,7 @@ func Test_NewProviderFromTarball(t *testing.T) {
 
 func Test_TarballProvide(t *testing.T) {
 	//GIVEN
-	provider := NewProviderFromTarball("test-fixtures/file.tar", file.NewTempDirGenerator("tempDir"))
+	provider := NewProviderFromTarball("test-fixtures/file.tar", file.NewTempDirGenerator("tempDir"), nil)
 
 	//WHEN
 	image, err := provider.Provide(nil)
@@ -34,7 +36,7 @@ func Test_TarballProvide(t *testing.T) {
 
 func Test_TarballProvide_Fails(t *testing.T) {
 	//GIVEN
-	provider := NewProviderFromTarball("", file.NewTempDirGenerator("tempDir"))
+	provider := NewProviderFromTarball("", file.NewTempDirGenerator("tempDir"), nil)
 
 	//WHEN
 	image, err := provider.Provide(nil)
@@ -43,3 +45,69 @@ func Test_TarballProvide_Fails(t *testing.T) {
 	assert.Error(t, err)
 	assert.Nil(t, image)
 }
+
+// note: test-fixtures/multi-platform.tar is generated by test-fixtures/generators/multi-platform.go
+func Test_TarballProvide_MultiPlatform(t *testing.T) {
+	tests := []struct {
+		platform     string
+		expectedArch string
+		expectedFile file.Path
+	}{
+		{
+			platform:     "linux/amd64",
+			expectedArch: "amd64",
+			expectedFile: "/amd64.txt",
+		},
+		{
+			// an unset variant matches any variant
+			platform:     "linux/arm64",
+			expectedArch: "arm64",
+			expectedFile: "/arm64.txt",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.platform, func(t *testing.T) {
+			platform, err := image.NewPlatform(test.platform)
+			require.NoError(t, err)
+			generator := file.NewTempDirGenerator("tempDir")
+			t.Cleanup(func() { _ = generator.Cleanup() })
+
+			img, err := NewProviderFromTarball("test-fixtures/multi-platform.tar", generator, platform).Provide(nil)
+			require.NoError(t, err)
+			require.NoError(t, img.Read())
+			t.Cleanup(func() { _ = img.Cleanup() })
+
+			assert.Equal(t, test.expectedArch, img.Metadata.Architecture)
+			assert.True(t, img.SquashedTree().HasPath(test.expectedFile))
+		})
+	}
+}
+
+func Test_TarballProvide_MultiPlatform_Fails(t *testing.T) {
+	generator := file.NewTempDirGenerator("tempDir")
+	t.Cleanup(func() { _ = generator.Cleanup() })
+
+	// the attestation manifest is never a candidate, however, the platform must still be selected
+	_, err := NewProviderFromTarball("test-fixtures/multi-platform.tar", generator, nil).Provide(nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "linux/amd64, linux/arm64/v8")
+
+	platform, err := image.NewPlatform("linux/s390x")
+	require.NoError(t, err)
+	_, err = NewProviderFromTarball("test-fixtures/multi-platform.tar", generator, platform).Provide(nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `no OCI directory manifest found for platform="linux/s390x" (available platforms: linux/amd64, linux/arm64/v8)`)
+}
+
+func Test_TarballImageProvider_ListPlatforms(t *testing.T) {
+	generator := file.NewTempDirGenerator("tempDir")
+	t.Cleanup(func() { _ = generator.Cleanup() })
+
+	platforms, err := NewProviderFromTarball("test-fixtures/multi-platform.tar", generator, nil).ListPlatforms()
+	require.NoError(t, err)
+	assert.Equal(t, []image.Platform{
+		{OS: "linux", Architecture: "amd64"},
+		{OS: "linux", Architecture: "arm64", Variant: "v8"},
+	}, platforms)
+}
@@ -0,0 +1,133 @@
+//go:build ignore
+// +build ignore
+
+// generates an OCI layout archive with a multi-platform index: a linux/amd64 image, a linux/arm64/v8 image, and an
+// attestation manifest for the amd64 image (attached the way buildx does, as an "unknown/unknown" platform manifest)
+// usage: go run multi-platform.go <output-tar>
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+// layer creates a layer with a single regular file (with a zero mtime, which keeps the generated tar stable)
+func layer(path, contents string) v1.Layer {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	must(tw.WriteHeader(&tar.Header{Name: path, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(contents))}))
+	_, err := tw.Write([]byte(contents))
+	must(err)
+	must(tw.Close())
+	b := buf.Bytes()
+	l, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(b)), nil
+	})
+	must(err)
+	return l
+}
+
+// platformImage creates a single layer image with the OS and architecture of the given platform in its config
+// (note: the variant is only recorded on the index descriptor)
+func platformImage(p v1.Platform, path string) v1.Image {
+	img, err := mutate.AppendLayers(empty.Image, layer(path, p.OS+"/"+p.Architecture+"\n"))
+	must(err)
+	cfg, err := img.ConfigFile()
+	must(err)
+	cfg = cfg.DeepCopy()
+	cfg.OS = p.OS
+	cfg.Architecture = p.Architecture
+	img, err = mutate.ConfigFile(img, cfg)
+	must(err)
+	return img
+}
+
+// archive writes the contents of the given directory to a tar (with zeroed ownership and mtimes)
+func archive(dir, output string) {
+	out, err := os.Create(output)
+	must(err)
+	defer out.Close()
+
+	tw := tar.NewWriter(out)
+	must(filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = rel
+		hdr.ModTime = time.Unix(0, 0)
+		hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+		if info.IsDir() {
+			hdr.Name += "/"
+			return tw.WriteHeader(hdr)
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		_, err = tw.Write(b)
+		return err
+	}))
+	must(tw.Close())
+}
+
+func must(err error) {
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func main() {
+	if len(os.Args) != 2 {
+		log.Fatal("usage: go run multi-platform.go <output-tar>")
+	}
+
+	dir, err := ioutil.TempDir("", "multi-platform")
+	must(err)
+	defer os.RemoveAll(dir)
+
+	lp, err := layout.Write(dir, empty.Index)
+	must(err)
+
+	amd64 := v1.Platform{OS: "linux", Architecture: "amd64"}
+	arm64 := v1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}
+	unknown := v1.Platform{OS: "unknown", Architecture: "unknown"}
+
+	amd64Image := platformImage(amd64, "amd64.txt")
+	must(lp.AppendImage(amd64Image, layout.WithPlatform(amd64)))
+	must(lp.AppendImage(platformImage(arm64, "arm64.txt"), layout.WithPlatform(arm64)))
+
+	amd64Digest, err := amd64Image.Digest()
+	must(err)
+	must(lp.AppendImage(platformImage(unknown, "attestation.json"),
+		layout.WithPlatform(unknown),
+		layout.WithAnnotations(map[string]string{
+			"vnd.docker.reference.type":   "attestation-manifest",
+			"vnd.docker.reference.digest": amd64Digest.String(),
+		}),
+	))
+
+	archive(dir, os.Args[1])
+}
@@ -0,0 +1,51 @@
+package image
+
+import (
+	"fmt"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+// DefaultMaxPathDepth is the maximum number of components of any path within an image (see WithMaxPathDepth).
+const DefaultMaxPathDepth = 1024
+
+// ErrPathTooDeep is returned when reading an image with a path (or link target) that has more components than the
+// maximum path depth (see WithMaxPathDepth).
+type ErrPathTooDeep struct {
+	// Path is the offending path
+	Path string
+	// Limit is the maximum number of path components allowed
+	Limit int
+}
+
+func (e *ErrPathTooDeep) Error() string {
+	return fmt.Sprintf("path exceeds the maximum depth (path=%s, limit=%d)", e.Path, e.Limit)
+}
+
+// WithMaxPathDepth sets the maximum number of components of any path within the image (by default
+// DefaultMaxPathDepth), after which reading is aborted with an ErrPathTooDeep. This guards against crafted images with
+// absurdly deep paths, which would otherwise exhaust resources in recursive tree operations. A limit of 0 disables the
+// check.
+func WithMaxPathDepth(maxDepth int) AdditionalMetadata {
+	return func(image *Image) error {
+		if maxDepth < 0 {
+			return fmt.Errorf("invalid max path depth: %d", maxDepth)
+		}
+		image.maxPathDepth = maxDepth
+		return nil
+	}
+}
+
+// checkPathDepth returns an ErrPathTooDeep if any of the given paths have more components than the given limit (0 means
+// there is no limit). Empty paths are ignored (e.g. the link target of a regular file).
+func checkPathDepth(limit int, paths ...string) error {
+	if limit == 0 {
+		return nil
+	}
+	for _, p := range paths {
+		if p != "" && file.Path(p).CountSegments() > limit {
+			return &ErrPathTooDeep{Path: p, Limit: limit}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package image
+
+import (
+	"archive/tar"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImage_Read_MaxPathDepth(t *testing.T) {
+	deep := strings.Repeat("d/", 9) + "file.txt"
+	deepLink := "/" + strings.Repeat("l/", 10)
+
+	tests := []struct {
+		name         string
+		entries      []testTarEntry
+		options      []AdditionalMetadata
+		expectedPath string
+		wantErr      bool
+	}{
+		{
+			name:    "within the default limit",
+			entries: []testTarEntry{regularEntry(deep, "contents")},
+		},
+		{
+			name:    "at the limit",
+			entries: []testTarEntry{regularEntry(deep, "contents")},
+			options: []AdditionalMetadata{WithMaxPathDepth(10)},
+		},
+		{
+			name:         "path exceeds the limit",
+			entries:      []testTarEntry{regularEntry(deep, "contents")},
+			options:      []AdditionalMetadata{WithMaxPathDepth(9)},
+			expectedPath: "/" + deep,
+			wantErr:      true,
+		},
+		{
+			name: "link target exceeds the limit",
+			entries: []testTarEntry{
+				{header: tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: deepLink}},
+			},
+			options:      []AdditionalMetadata{WithMaxPathDepth(9)},
+			expectedPath: deepLink,
+			wantErr:      true,
+		},
+		{
+			name:    "no limit",
+			entries: []testTarEntry{regularEntry(deep, "contents")},
+			options: []AdditionalMetadata{WithMaxPathDepth(0)},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			img, err := mutate.AppendLayers(empty.Image, newTestLayer(t, test.entries...))
+			require.NoError(t, err)
+
+			result := NewImage(img, t.TempDir(), test.options...)
+			t.Cleanup(func() { _ = result.Cleanup() })
+			err = result.Read()
+			if !test.wantErr {
+				require.NoError(t, err)
+				return
+			}
+
+			var depthErr *ErrPathTooDeep
+			require.True(t, errors.As(err, &depthErr), "unexpected error: %+v", err)
+			assert.Equal(t, test.expectedPath, depthErr.Path)
+			assert.Equal(t, 9, depthErr.Limit)
+		})
+	}
+}
+
+func TestImage_Read_MaxPathDepth_Invalid(t *testing.T) {
+	img := NewImage(empty.Image, t.TempDir(), WithMaxPathDepth(-1))
+	assert.Error(t, img.Read())
+}
@@ -0,0 +1,101 @@
+package image
+
+import (
+	"fmt"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+// WithIncludedPaths restricts the files indexed from each layer to those matching at least one of the given
+// gitignore-style patterns (see file.CompilePattern), or living under a directory that matches (e.g. "/etc" or
+// "/usr/lib/**/*.so"). Directories are always indexed (so that the tree structure and directory metadata is kept),
+// only their contents are filtered. Files that are not indexed do not appear in any layer tree, the squash tree, or
+// the file catalog, so they cannot be resolved or read from the image.
+func WithIncludedPaths(patterns ...string) AdditionalMetadata {
+	return func(image *Image) error {
+		compiled, err := compilePatterns(patterns)
+		if err != nil {
+			return err
+		}
+		image.pathFilter.include = append(image.pathFilter.include, compiled...)
+		return nil
+	}
+}
+
+// WithExcludedPaths skips indexing any path in each layer that matches one of the given gitignore-style patterns (see
+// file.CompilePattern), along with everything under a matching directory (e.g. "/usr/share/doc"). Exclusions take
+// precedence over WithIncludedPaths. Excluded paths do not appear in any layer tree, the squash tree, or the file
+// catalog, so they cannot be resolved or read from the image. Whiteouts for excluded paths are ignored. A negated
+// pattern keeps paths excluded by an earlier pattern (e.g. "/etc/*.conf" followed by "!/etc/resolv.conf", see
+// file.MatchAny), however, as with gitignore a path cannot be kept once a parent directory is excluded.
+func WithExcludedPaths(patterns ...string) AdditionalMetadata {
+	return func(image *Image) error {
+		compiled, err := compilePatterns(patterns)
+		if err != nil {
+			return err
+		}
+		image.pathFilter.exclude = append(image.pathFilter.exclude, compiled...)
+		return nil
+	}
+}
+
+func compilePatterns(patterns []string) ([]*file.CompiledPattern, error) {
+	var compiled []*file.CompiledPattern
+	for _, pattern := range patterns {
+		c, err := file.CompilePattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("unable to compile path filter: %w", err)
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled, nil
+}
+
+// pathFilter decides which layer entries are indexed. The zero value indexes everything.
+type pathFilter struct {
+	include []*file.CompiledPattern
+	exclude []*file.CompiledPattern
+}
+
+// skip indicates if the entry for the given (absolute) path should not be indexed. Whiteouts are considered with
+// respect to the path that they remove.
+func (f pathFilter) skip(p file.Path, isDir bool) bool {
+	if len(f.include) == 0 && len(f.exclude) == 0 {
+		return false
+	}
+
+	if p.IsWhiteout() {
+		target, _, err := p.UnWhiteoutPath()
+		if err != nil {
+			return false
+		}
+		// note: any whiteout may remove a directory (along with included children), so whiteouts are only skipped
+		// when the path they remove is excluded
+		p = target
+		isDir = true
+	}
+
+	if anyMatch(f.exclude, p) {
+		return true
+	}
+	if len(f.include) == 0 || isDir {
+		return false
+	}
+	return !anyMatch(f.include, p)
+}
+
+// anyMatch indicates if the given path, or any of its parent directories, matches the patterns (see file.MatchAny).
+func anyMatch(patterns []*file.CompiledPattern, p file.Path) bool {
+	if len(patterns) == 0 {
+		return false
+	}
+	// note: this is invoked for every layer entry, so the parent directories are not collected into a slice
+	matched := file.MatchAny(file.DirSeparator, patterns)
+	if !matched {
+		p.EachComponent(func(_ string, fullPath file.Path) bool {
+			matched = file.MatchAny(fullPath, patterns)
+			return !matched
+		})
+	}
+	return matched
+}
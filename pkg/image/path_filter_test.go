@@ -0,0 +1,127 @@
+package image
+
+import (
+	"archive/tar"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+func TestImage_Read_PathFilters(t *testing.T) {
+	docDir := testTarEntry{header: tar.Header{Name: "usr/share/doc/", Typeflag: tar.TypeDir, Mode: 0755}}
+	lower := []testTarEntry{
+		docDir,
+		regularEntry("usr/share/doc/readme", "docs"),
+		regularEntry("usr/share/doc/pkg/copyright", "copyright"),
+		regularEntry("usr/lib/a.so", "a"),
+		regularEntry("usr/lib/sub/b.so", "b"),
+		regularEntry("usr/lib/sub/c.txt", "c"),
+		regularEntry("etc/hosts", "hosts"),
+	}
+	upper := []testTarEntry{
+		regularEntry("usr/share/doc/.wh.readme", ""),
+		regularEntry("usr/lib/.wh.sub", ""),
+	}
+
+	tests := []struct {
+		name     string
+		options  []AdditionalMetadata
+		expected []string
+	}{
+		{
+			name: "no filters",
+			expected: []string{
+				"/etc/hosts",
+				"/usr/lib/a.so",
+				"/usr/share/doc",
+				"/usr/share/doc/pkg/copyright",
+			},
+		},
+		{
+			name:    "exclude directory contents",
+			options: []AdditionalMetadata{WithExcludedPaths("/usr/share/doc/**")},
+			expected: []string{
+				"/etc/hosts",
+				"/usr/lib/a.so",
+				"/usr/share/doc",
+			},
+		},
+		{
+			name:    "exclude directory",
+			options: []AdditionalMetadata{WithExcludedPaths("/usr/share")},
+			expected: []string{
+				"/etc/hosts",
+				"/usr/lib/a.so",
+			},
+		},
+		{
+			// the whiteout of the (not included) directory must still apply to included children
+			name:    "include pattern",
+			options: []AdditionalMetadata{WithIncludedPaths("*.so")},
+			expected: []string{
+				"/usr/lib/a.so",
+				"/usr/share/doc",
+			},
+		},
+		{
+			name:    "include directory",
+			options: []AdditionalMetadata{WithIncludedPaths("/etc")},
+			expected: []string{
+				"/etc/hosts",
+				"/usr/share/doc",
+			},
+		},
+		{
+			// a path within an excluded directory cannot be re-included
+			name:    "negated exclusions",
+			options: []AdditionalMetadata{WithExcludedPaths("/usr/lib/*", "!/usr/lib/a.so", "/usr/share/**", "!copyright")},
+			expected: []string{
+				"/etc/hosts",
+				"/usr/lib/a.so",
+			},
+		},
+		{
+			name:    "exclusions take precedence",
+			options: []AdditionalMetadata{WithIncludedPaths("/usr/**"), WithExcludedPaths("/usr/lib/**")},
+			expected: []string{
+				"/usr/share/doc",
+				"/usr/share/doc/pkg/copyright",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			img, err := mutate.AppendLayers(empty.Image, newTestLayer(t, lower...), newTestLayer(t, upper...))
+			require.NoError(t, err)
+
+			result := NewImage(img, t.TempDir(), test.options...)
+			require.NoError(t, result.Read())
+			t.Cleanup(func() { _ = result.Cleanup() })
+
+			// note: implied directories have no reference, so only paths with a tar entry are listed
+			var actual []string
+			for _, ref := range result.SquashedTree().AllFiles(file.AllTypes...) {
+				actual = append(actual, string(ref.RealPath))
+			}
+			assert.ElementsMatch(t, test.expected, actual)
+
+			for _, ref := range result.SquashedTree().AllFiles(file.AllTypes...) {
+				assert.True(t, result.FileCatalog.Exists(ref), "missing catalog entry for %q", ref.RealPath)
+			}
+		})
+	}
+}
+
+func TestWithExcludedPaths_InvalidPattern(t *testing.T) {
+	img := NewImage(empty.Image, t.TempDir(), WithExcludedPaths("/usr/[a-"))
+	assert.Error(t, img.Read())
+
+	img = NewImage(empty.Image, t.TempDir(), WithIncludedPaths(""))
+	assert.Error(t, img.Read())
+}
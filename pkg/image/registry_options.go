@@ -3,6 +3,7 @@ package image
 import (
 	"github.com/anchore/stereoscope/internal/log"
 	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
 )
 
 // RegistryOptions for the OCI registry provider.
@@ -11,6 +12,29 @@ type RegistryOptions struct {
 	InsecureUseHTTP       bool
 	Credentials           []RegistryCredentials
 	Platform              string
+	// Mirrors maps a registry host (e.g. "docker.io") to the host of a mirror that images should be pulled from instead
+	// (e.g. "mirror.internal:5000"). Credentials and the other options are applied to the mirror.
+	Mirrors map[string]string
+}
+
+// Mirror returns the host of the mirror configured for the given registry (or "" if there is none). Registry hosts are
+// compared after normalization, so "docker.io" and "index.docker.io" refer to the same registry.
+func (r RegistryOptions) Mirror(registry string) string {
+	registry = normalizeRegistry(registry)
+	for host, mirror := range r.Mirrors {
+		if normalizeRegistry(host) == registry {
+			return mirror
+		}
+	}
+	return ""
+}
+
+func normalizeRegistry(registry string) string {
+	reg, err := name.NewRegistry(registry)
+	if err != nil {
+		return registry
+	}
+	return reg.RegistryStr()
 }
 
 // Authenticator returns an object capable of authenticating against the given registry. If no credentials match the
@@ -163,3 +163,34 @@ func TestRegistryOptions_Authenticator(t *testing.T) {
 		})
 	}
 }
+
+func TestRegistryOptions_Mirror(t *testing.T) {
+	options := RegistryOptions{
+		Mirrors: map[string]string{
+			"docker.io":      "mirror.internal:5000",
+			"localhost:5000": "localhost:6000",
+		},
+	}
+
+	tests := []struct {
+		registry string
+		expected string
+	}{
+		{registry: "docker.io", expected: "mirror.internal:5000"},
+		{registry: "index.docker.io", expected: "mirror.internal:5000"},
+		{registry: "localhost:5000", expected: "localhost:6000"},
+		{registry: "localhost", expected: ""},
+		{registry: "ghcr.io", expected: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.registry, func(t *testing.T) {
+			if actual := options.Mirror(test.registry); actual != test.expected {
+				t.Errorf("unexpected mirror: %q != %q", actual, test.expected)
+			}
+		})
+	}
+	if actual := (RegistryOptions{}).Mirror("docker.io"); actual != "" {
+		t.Errorf("unexpected mirror: %q", actual)
+	}
+}
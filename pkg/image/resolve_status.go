@@ -0,0 +1,135 @@
+package image
+
+import (
+	"fmt"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+// ResolveStatus describes whether a path exists within the squashed tree, and if not, whether it ever existed.
+type ResolveStatus string
+
+const (
+	// ResolveFound indicates that the path exists within the squashed tree
+	ResolveFound ResolveStatus = "found"
+	// ResolveDeleted indicates that the path existed in a lower layer but was removed by an upper layer (by a whiteout,
+	// an opaque whiteout, or an ancestor directory being replaced with a non-directory)
+	ResolveDeleted ResolveStatus = "deleted"
+	// ResolveNotFound indicates that the path never existed within any layer
+	ResolveNotFound ResolveStatus = "not-found"
+)
+
+// ResolveResult is the outcome of resolving a path with Image.ResolveWithStatus.
+type ResolveResult struct {
+	Status ResolveStatus
+	// Reference is the file reference within the squashed tree (only when found, and nil for directories implied by
+	// other paths)
+	Reference *file.Reference
+	// Layer is the index of the layer that provided the path (when found) or that removed the path (when deleted),
+	// otherwise -1
+	Layer int
+	// LowerLayer is the index of the layer whose squash last contained the path before it was removed (only when
+	// deleted, otherwise -1)
+	LowerLayer int
+	// DeletedBy is the entry within the removing layer responsible for the removal: the whiteout (e.g. "/etc/.wh.hosts"
+	// or "/etc/.wh..wh..opq"), or the non-directory that replaced an ancestor directory (only when deleted)
+	DeletedBy file.Path
+}
+
+// ResolveWithStatus resolves the given path within the squashed tree (as with FileMetadataFromSquash), additionally
+// distinguishing a path that was deleted by an upper layer from a path that never existed. The history is found from
+// the squashed tree retained for each layer, so this is only available until Cleanup is called.
+func (i *Image) ResolveWithStatus(p file.Path) (ResolveResult, error) {
+	p = p.Normalize()
+	result := ResolveResult{Status: ResolveNotFound, Layer: -1, LowerLayer: -1}
+	if len(i.Layers) == 0 {
+		return result, nil
+	}
+
+	exists, ref, err := i.SquashedTree().File(p)
+	if err != nil {
+		return result, err
+	}
+	if exists {
+		result.Status = ResolveFound
+		result.Reference = ref
+		if ref != nil {
+			entry, err := i.FileCatalog.Get(*ref)
+			if err != nil {
+				return result, fmt.Errorf("unable to get metadata for path=%q: %w", p, err)
+			}
+			if entry.Layer != nil {
+				result.Layer = int(entry.Layer.Metadata.Index)
+			}
+		}
+		return result, nil
+	}
+
+	// find the highest layer squash that still contained the path, the layer above it removed the path
+	for idx := len(i.Layers) - 2; idx >= 0; idx-- {
+		squashed := i.Layers[idx].SquashedTree
+		if squashed == nil || !squashed.HasPath(p) {
+			continue
+		}
+		result.Status = ResolveDeleted
+		result.LowerLayer = idx
+		result.Layer = idx + 1
+		result.DeletedBy = i.Layers[idx+1].deletedBy(p)
+		return result, nil
+	}
+	return result, nil
+}
+
+// deletedBy finds the entry within this layer tree that removes the given path from lower layers: a whiteout for the
+// path (or an ancestor), an opaque whiteout within an ancestor, or a non-directory that replaces an ancestor. Returns
+// an empty path if there is no such entry.
+func (l *Layer) deletedBy(p file.Path) file.Path {
+	for current := p; !current.IsRoot(); {
+		parent, err := current.ParentPath()
+		if err != nil {
+			return ""
+		}
+		whiteout := current.WithBasename(file.WhiteoutPrefix + current.Basename())
+		if l.Tree.HasPath(whiteout) {
+			return whiteout
+		}
+		opaque := current.WithBasename(file.OpaqueWhiteout)
+		if l.Tree.HasPath(opaque) {
+			return opaque
+		}
+		if current != p {
+			if ty, exists := l.Tree.Type(current); exists && ty != file.TypeDir {
+				return current
+			}
+		}
+		current = parent
+	}
+	return ""
+}
+
+// LayerForPath returns the index of the topmost layer that provides the given path within the squashed tree (after
+// whiteouts are applied), which is the layer the squashed file originates from. Links within ancestors of the path
+// are followed, however, a link at the path itself is attributed to the layer providing the link (not the layer
+// providing its target). An error is returned if the path does not exist or is a directory implied by other paths
+// (without an entry in any layer).
+func (i *Image) LayerForPath(p file.Path) (int, error) {
+	exists, ref, err := i.SquashedTree().File(p)
+	if err != nil {
+		return -1, err
+	}
+	if !exists {
+		return -1, fmt.Errorf("could not find file path in Tree: %s", p)
+	}
+	if ref == nil {
+		return -1, fmt.Errorf("no layer provides the implied directory: %s", p)
+	}
+
+	entry, err := i.FileCatalog.Get(*ref)
+	if err != nil {
+		return -1, fmt.Errorf("unable to get metadata for path=%q: %w", p, err)
+	}
+	if entry.Layer == nil {
+		return -1, fmt.Errorf("no layer recorded for path=%q", p)
+	}
+	return int(entry.Layer.Metadata.Index), nil
+}
@@ -0,0 +1,136 @@
+package image
+
+import (
+	"archive/tar"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImage_ResolveWithStatus(t *testing.T) {
+	img := newTestImage(t,
+		[]testTarEntry{
+			regularEntry("etc/hosts", "127.0.0.1 localhost\n"),
+			regularEntry("etc/passwd", "root:x:0:0::/root:/bin/sh\n"),
+			regularEntry("opt/app/bin/tool", "tool"),
+			regularEntry("var/log/old.log", "old"),
+			regularEntry("srv/data/file", "data"),
+		},
+		[]testTarEntry{
+			regularEntry("etc/.wh.hosts", ""),
+			regularEntry("etc/.wh.passwd", ""),
+			regularEntry("opt/.wh.app", ""),
+			regularEntry("var/log/.wh..wh..opq", ""),
+			// a directory replaced with a file
+			regularEntry("srv/data", "not a directory"),
+		},
+		[]testTarEntry{
+			regularEntry("etc/passwd", "root:x:0:0::/root:/bin/bash\n"),
+		},
+	)
+
+	tests := []struct {
+		path     file.Path
+		expected ResolveResult
+	}{
+		{
+			path:     "/etc/passwd",
+			expected: ResolveResult{Status: ResolveFound, Layer: 2, LowerLayer: -1},
+		},
+		{
+			path:     "/etc/hosts",
+			expected: ResolveResult{Status: ResolveDeleted, Layer: 1, LowerLayer: 0, DeletedBy: "/etc/.wh.hosts"},
+		},
+		{
+			// removed along with the whited out ancestor (including directories implied by other paths)
+			path:     "/opt/app/bin/tool",
+			expected: ResolveResult{Status: ResolveDeleted, Layer: 1, LowerLayer: 0, DeletedBy: "/opt/.wh.app"},
+		},
+		{
+			path:     "/opt/app/bin",
+			expected: ResolveResult{Status: ResolveDeleted, Layer: 1, LowerLayer: 0, DeletedBy: "/opt/.wh.app"},
+		},
+		{
+			path:     "/var/log/old.log",
+			expected: ResolveResult{Status: ResolveDeleted, Layer: 1, LowerLayer: 0, DeletedBy: "/var/log/.wh..wh..opq"},
+		},
+		{
+			path:     "/srv/data/file",
+			expected: ResolveResult{Status: ResolveDeleted, Layer: 1, LowerLayer: 0, DeletedBy: "/srv/data"},
+		},
+		{
+			path:     "/etc/missing",
+			expected: ResolveResult{Status: ResolveNotFound, Layer: -1, LowerLayer: -1},
+		},
+		{
+			path:     "/etc",
+			expected: ResolveResult{Status: ResolveFound, Layer: -1, LowerLayer: -1},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.path), func(t *testing.T) {
+			actual, err := img.ResolveWithStatus(test.path)
+			require.NoError(t, err)
+			if test.expected.Status == ResolveFound && test.expected.Layer >= 0 {
+				require.NotNil(t, actual.Reference)
+				assert.Equal(t, test.path, actual.Reference.RealPath)
+			}
+			actual.Reference = nil
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestImage_LayerForPath(t *testing.T) {
+	img := newTestImage(t,
+		[]testTarEntry{
+			regularEntry("usr/lib/libc.so.6", "libc"),
+			regularEntry("usr/lib/libssl.so", "old ssl"),
+			regularEntry("etc/hosts", "127.0.0.1 localhost\n"),
+			regularEntry("etc/issue", "lower\n"),
+		},
+		[]testTarEntry{
+			{header: tar.Header{Name: "lib", Typeflag: tar.TypeSymlink, Linkname: "usr/lib"}},
+			{header: tar.Header{Name: "usr/lib/libc.so", Typeflag: tar.TypeSymlink, Linkname: "libc.so.6"}},
+			regularEntry("etc/.wh.hosts", ""),
+		},
+		[]testTarEntry{
+			regularEntry("usr/lib/libssl.so", "new ssl"),
+		},
+	)
+
+	tests := []struct {
+		path     file.Path
+		expected int
+		wantErr  bool
+	}{
+		{path: "/usr/lib/libc.so.6", expected: 0},
+		// the upper version of the file wins
+		{path: "/usr/lib/libssl.so", expected: 2},
+		// links are attributed to the layer providing the link, not its target
+		{path: "/usr/lib/libc.so", expected: 1},
+		{path: "/lib", expected: 1},
+		// links within ancestors are followed
+		{path: "/lib/libssl.so", expected: 2},
+		{path: "/etc/issue", expected: 0},
+		{path: "/etc/hosts", wantErr: true},
+		{path: "/does/not/exist", wantErr: true},
+		// implied by other paths
+		{path: "/usr", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(string(test.path), func(t *testing.T) {
+			actual, err := img.LayerForPath(test.path)
+			if test.wantErr {
+				assert.Error(t, err)
+				assert.Equal(t, -1, actual)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
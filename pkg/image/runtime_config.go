@@ -0,0 +1,63 @@
+package image
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// RuntimeConfig is the configuration used when running a container from the image (e.g. set with the ENTRYPOINT,
+// CMD, ENV, WORKDIR, USER, EXPOSE, and VOLUME Dockerfile instructions).
+type RuntimeConfig struct {
+	Entrypoint []string
+	Cmd        []string
+	// Env are the environment variables as "KEY=VALUE" strings (in the order found in the config)
+	Env        []string
+	WorkingDir string
+	User       string
+	// ExposedPorts are the exposed ports with the protocol (e.g. "80/tcp"), sorted
+	ExposedPorts []string
+	// Volumes are the paths of the volume mount points, sorted
+	Volumes []string
+}
+
+// Config returns the runtime configuration from the image config. Docker and OCI image configs share the same runtime
+// config fields, so either format is supported. The raw config is parsed (so that any config given with WithConfig is
+// respected), falling back to the config read from the image.
+func (i *Image) Config() (RuntimeConfig, error) {
+	config := i.Metadata.Config
+	if len(i.Metadata.RawConfig) > 0 {
+		parsed, err := v1.ParseConfigFile(bytes.NewReader(i.Metadata.RawConfig))
+		if err != nil {
+			return RuntimeConfig{}, fmt.Errorf("unable to parse image config: %w", err)
+		}
+		config = *parsed
+	}
+	return newRuntimeConfig(config.Config), nil
+}
+
+func newRuntimeConfig(config v1.Config) RuntimeConfig {
+	return RuntimeConfig{
+		Entrypoint:   config.Entrypoint,
+		Cmd:          config.Cmd,
+		Env:          config.Env,
+		WorkingDir:   config.WorkingDir,
+		User:         config.User,
+		ExposedPorts: sortedKeys(config.ExposedPorts),
+		Volumes:      sortedKeys(config.Volumes),
+	}
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+	if len(set) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,79 @@
+package image
+
+import (
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImage_Config(t *testing.T) {
+	base, err := mutate.Config(empty.Image, v1.Config{
+		Entrypoint:   []string{"/entrypoint.sh"},
+		Cmd:          []string{"serve", "--port=8080"},
+		Env:          []string{"PATH=/usr/local/bin:/usr/bin", "EMPTY="},
+		WorkingDir:   "/app",
+		User:         "1000:1000",
+		ExposedPorts: map[string]struct{}{"8080/tcp": {}, "53/udp": {}},
+		Volumes:      map[string]struct{}{"/data": {}, "/cache": {}},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		options  []AdditionalMetadata
+		expected RuntimeConfig
+	}{
+		{
+			name: "from the image config",
+			expected: RuntimeConfig{
+				Entrypoint:   []string{"/entrypoint.sh"},
+				Cmd:          []string{"serve", "--port=8080"},
+				Env:          []string{"PATH=/usr/local/bin:/usr/bin", "EMPTY="},
+				WorkingDir:   "/app",
+				User:         "1000:1000",
+				ExposedPorts: []string{"53/udp", "8080/tcp"},
+				Volumes:      []string{"/cache", "/data"},
+			},
+		},
+		{
+			name: "from a given docker config",
+			options: []AdditionalMetadata{
+				WithConfig([]byte(`{"architecture":"amd64","os":"linux","config":{"Cmd":["/bin/sh"],"Env":["A=B"],"User":"root"},"container_config":{"Cmd":["/bin/sh","-c","#(nop) CMD [\"/bin/sh\"]"]},"rootfs":{"type":"layers","diff_ids":[]}}`)),
+			},
+			expected: RuntimeConfig{
+				Cmd:  []string{"/bin/sh"},
+				Env:  []string{"A=B"},
+				User: "root",
+			},
+		},
+		{
+			name: "without runtime config",
+			options: []AdditionalMetadata{
+				WithConfig([]byte(`{"architecture":"arm64","os":"linux","rootfs":{"type":"layers","diff_ids":[]}}`)),
+			},
+			expected: RuntimeConfig{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			img := NewImage(base, t.TempDir(), test.options...)
+			require.NoError(t, img.Read())
+			t.Cleanup(func() { _ = img.Cleanup() })
+
+			actual, err := img.Config()
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+
+	img := NewImage(base, t.TempDir(), WithConfig([]byte("not json")))
+	require.NoError(t, img.Read())
+	t.Cleanup(func() { _ = img.Cleanup() })
+	_, err = img.Config()
+	assert.Error(t, err)
+}
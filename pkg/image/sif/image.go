@@ -7,6 +7,7 @@ import (
 	"io"
 	"os"
 
+	"github.com/anchore/stereoscope/internal/log"
 	"github.com/anchore/stereoscope/pkg/image"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/partial"
@@ -109,6 +110,19 @@ func newSIFImage(path string) (*sifImage, error) {
 		return nil, errors.New("short read while calculating hash")
 	}
 
+	cfg := v1.Config{
+		Labels: sifLabels(f),
+	}
+
+	var history []v1.History
+	if def := sifDefinition(f); def != "" {
+		// the definition file is the closest analog to the build instructions recorded in an OCI image history
+		history = append(history, v1.History{
+			Created:   v1.Time{Time: f.CreatedAt()},
+			CreatedBy: def,
+		})
+	}
+
 	im := sifImage{
 		path: path,
 		arch: arch,
@@ -121,6 +135,8 @@ func newSIFImage(path string) (*sifImage, error) {
 			},
 			Architecture: arch,
 			OS:           "linux",
+			Config:       cfg,
+			History:      history,
 			RootFS: v1.RootFS{
 				Type:    "layers",
 				DiffIDs: []v1.Hash{h},
@@ -130,6 +146,53 @@ func newSIFImage(path string) (*sifImage, error) {
 	return &im, nil
 }
 
+// sifLabels returns the labels from all JSON label data objects within the SIF image (labels from later objects take
+// precedence). Label objects that cannot be parsed are skipped.
+func sifLabels(f *sif.FileImage) map[string]string {
+	descriptors, err := f.GetDescriptors(sif.WithDataType(sif.DataLabels))
+	if err != nil || len(descriptors) == 0 {
+		return nil
+	}
+
+	labels := make(map[string]string)
+	for _, d := range descriptors {
+		data, err := d.GetData()
+		if err != nil {
+			log.Warnf("unable to read SIF labels object (id=%d): %+v", d.ID(), err)
+			continue
+		}
+
+		var objLabels map[string]string
+		if err := json.Unmarshal(data, &objLabels); err != nil {
+			log.Warnf("unable to parse SIF labels object (id=%d): %+v", d.ID(), err)
+			continue
+		}
+
+		for k, v := range objLabels {
+			labels[k] = v
+		}
+	}
+
+	if len(labels) == 0 {
+		return nil
+	}
+	return labels
+}
+
+// sifDefinition returns the contents of the definition file the SIF image was built from (if present).
+func sifDefinition(f *sif.FileImage) string {
+	d, err := f.GetDescriptor(sif.WithDataType(sif.DataDeffile))
+	if err != nil {
+		return ""
+	}
+	data, err := d.GetData()
+	if err != nil {
+		log.Warnf("unable to read SIF definition file object: %+v", err)
+		return ""
+	}
+	return string(data)
+}
+
 // RawConfigFile returns the serialized bytes of this image's config file.
 func (im *sifImage) RawConfigFile() ([]byte, error) {
 	return json.Marshal(im.cfg)
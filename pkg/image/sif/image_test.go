@@ -1,11 +1,15 @@
 package sif
 
 import (
+	"bytes"
 	"errors"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/sylabs/sif/v2/pkg/sif"
 )
 
@@ -56,3 +60,43 @@ func Test_newSIFImage(t *testing.T) {
 		})
 	}
 }
+
+func Test_newSIFImage_LabelsAndDefinition(t *testing.T) {
+	const definition = "Bootstrap: docker\nFrom: alpine:latest\n"
+
+	newInput := func(dt sif.DataType, data string, opts ...sif.DescriptorInputOpt) sif.DescriptorInput {
+		di, err := sif.NewDescriptorInput(dt, strings.NewReader(data), opts...)
+		require.NoError(t, err)
+		return di
+	}
+
+	path := filepath.Join(t.TempDir(), "labels.sif")
+	f, err := sif.CreateContainerAtPath(path,
+		sif.OptCreateDeterministic(),
+		sif.OptCreateWithDescriptors(
+			newInput(sif.DataPartition, "not-really-squashfs", sif.OptPartitionMetadata(sif.FsSquash, sif.PartPrimSys, "amd64")),
+			newInput(sif.DataDeffile, definition),
+			newInput(sif.DataLabels, `{"org.label-schema.schema-version": "1.0", "maintainer": "someone"}`),
+			newInput(sif.DataLabels, `not json`),
+		),
+	)
+	require.NoError(t, err)
+	require.NoError(t, f.UnloadContainer())
+
+	im, err := newSIFImage(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		"org.label-schema.schema-version": "1.0",
+		"maintainer":                      "someone",
+	}, im.cfg.Config.Labels)
+
+	require.Len(t, im.cfg.History, 1)
+	assert.Equal(t, definition, im.cfg.History[0].CreatedBy)
+
+	raw, err := im.RawConfigFile()
+	require.NoError(t, err)
+	cfg, err := v1.ParseConfigFile(bytes.NewReader(raw))
+	require.NoError(t, err)
+	assert.Equal(t, "someone", cfg.Config.Labels["maintainer"])
+}
@@ -0,0 +1,105 @@
+package image
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// ErrSizeLimitExceeded is returned when reading an image that exceeds the maximum total uncompressed size (see
+// WithMaxUncompressedSize) or contains a file larger than the maximum file size (see WithMaxFileSize).
+type ErrSizeLimitExceeded struct {
+	// Path is the offending file (empty when the total uncompressed size limit is exceeded)
+	Path string
+	// Limit is the limit in bytes that was exceeded
+	Limit int64
+}
+
+func (e *ErrSizeLimitExceeded) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("image exceeds the maximum total uncompressed size (limit=%d bytes)", e.Limit)
+	}
+	return fmt.Sprintf("file exceeds the maximum file size (path=%s, limit=%d bytes)", e.Path, e.Limit)
+}
+
+// WithMaxUncompressedSize sets the maximum number of bytes that may be decompressed across all layers while the image
+// is read, after which reading is aborted with an ErrSizeLimitExceeded. By default there is no limit, however, when
+// reading untrusted images a limit should be set (e.g. a few times the size of the largest expected image, such as
+// 10 GB) to guard against decompression bombs.
+func WithMaxUncompressedSize(maxBytes int64) AdditionalMetadata {
+	return func(image *Image) error {
+		if maxBytes < 0 {
+			return fmt.Errorf("invalid max uncompressed size: %d", maxBytes)
+		}
+		image.maxUncompressedSize = maxBytes
+		return nil
+	}
+}
+
+// WithMaxFileSize sets the maximum size in bytes of any single file within the image, after which reading is aborted
+// with an ErrSizeLimitExceeded. By default there is no limit.
+func WithMaxFileSize(maxBytes int64) AdditionalMetadata {
+	return func(image *Image) error {
+		if maxBytes < 0 {
+			return fmt.Errorf("invalid max file size: %d", maxBytes)
+		}
+		image.maxFileSize = maxBytes
+		return nil
+	}
+}
+
+// sizeLimiter tracks the cumulative number of bytes decompressed across all layers of an image (which may be read
+// concurrently). A zero limit means there is no limit. A nil sizeLimiter imposes no limits.
+type sizeLimiter struct {
+	// total must be first to guarantee 64-bit alignment for atomic operations
+	total    int64
+	maxTotal int64
+	maxFile  int64
+}
+
+func newSizeLimiter(maxTotal, maxFile int64) *sizeLimiter {
+	return &sizeLimiter{
+		maxTotal: maxTotal,
+		maxFile:  maxFile,
+	}
+}
+
+// add records the given number of decompressed bytes, returning an error if the total limit is exceeded.
+func (s *sizeLimiter) add(n int64) error {
+	if s == nil || s.maxTotal == 0 {
+		return nil
+	}
+	if atomic.AddInt64(&s.total, n) > s.maxTotal {
+		return &ErrSizeLimitExceeded{Limit: s.maxTotal}
+	}
+	return nil
+}
+
+// checkFile returns an error if the given file size exceeds the file size limit.
+func (s *sizeLimiter) checkFile(path string, size int64) error {
+	if s == nil || s.maxFile == 0 || size <= s.maxFile {
+		return nil
+	}
+	return &ErrSizeLimitExceeded{Path: path, Limit: s.maxFile}
+}
+
+// reader counts all bytes read from the given reader toward the total limit.
+func (s *sizeLimiter) reader(r io.Reader) io.Reader {
+	if s == nil || s.maxTotal == 0 {
+		return r
+	}
+	return &limitedReader{reader: r, limiter: s}
+}
+
+type limitedReader struct {
+	reader  io.Reader
+	limiter *sizeLimiter
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.reader.Read(p)
+	if limitErr := l.limiter.add(int64(n)); limitErr != nil {
+		return n, limitErr
+	}
+	return n, err
+}
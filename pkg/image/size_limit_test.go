@@ -0,0 +1,79 @@
+package image
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImage_Read_SizeLimits(t *testing.T) {
+	layers := func(t *testing.T) []v1.Layer {
+		return []v1.Layer{
+			newTestLayer(t, regularEntry("small.txt", "small")),
+			newTestLayer(t, regularEntry("big.txt", strings.Repeat("b", 4096))),
+		}
+	}
+
+	tests := []struct {
+		name          string
+		options       []AdditionalMetadata
+		expectedPath  string
+		expectedLimit int64
+		wantErr       bool
+	}{
+		{
+			name: "unlimited by default",
+		},
+		{
+			name:    "within the limits",
+			options: []AdditionalMetadata{WithMaxUncompressedSize(1 << 20), WithMaxFileSize(4096)},
+		},
+		{
+			name:          "file size exceeded",
+			options:       []AdditionalMetadata{WithMaxFileSize(4095)},
+			expectedPath:  "/big.txt",
+			expectedLimit: 4095,
+			wantErr:       true,
+		},
+		{
+			// each layer tar alone is within the limit, but not both together
+			name:          "total size exceeded across layers",
+			options:       []AdditionalMetadata{WithMaxUncompressedSize(6 * 1024), WithReadConcurrency(1)},
+			expectedLimit: 6 * 1024,
+			wantErr:       true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			img, err := mutate.AppendLayers(empty.Image, layers(t)...)
+			require.NoError(t, err)
+
+			result := NewImage(img, t.TempDir(), test.options...)
+			t.Cleanup(func() { _ = result.Cleanup() })
+			err = result.Read()
+			if !test.wantErr {
+				require.NoError(t, err)
+				return
+			}
+
+			var limitErr *ErrSizeLimitExceeded
+			require.True(t, errors.As(err, &limitErr), "unexpected error: %+v", err)
+			assert.Equal(t, test.expectedPath, limitErr.Path)
+			assert.Equal(t, test.expectedLimit, limitErr.Limit)
+		})
+	}
+}
+
+func TestImage_Read_SizeLimits_Invalid(t *testing.T) {
+	for _, option := range []AdditionalMetadata{WithMaxUncompressedSize(-1), WithMaxFileSize(-1)} {
+		img := NewImage(empty.Image, t.TempDir(), option)
+		assert.Error(t, img.Read())
+	}
+}
@@ -28,6 +28,7 @@ const (
 	OciRegistrySource
 	PodmanDaemonSource
 	SingularitySource
+	ContainerdDaemonSource
 )
 
 const SchemeSeparator = ":"
@@ -41,6 +42,7 @@ var sourceStr = [...]string{
 	"OciRegistry",
 	"PodmanDaemon",
 	"Singularity",
+	"ContainerdDaemon",
 }
 
 var AllSources = []Source{
@@ -51,6 +53,7 @@ var AllSources = []Source{
 	OciRegistrySource,
 	PodmanDaemonSource,
 	SingularitySource,
+	ContainerdDaemonSource,
 }
 
 // Source is a concrete a selection of valid concrete image providers.
@@ -64,6 +67,22 @@ func isRegistryReference(imageSpec string) bool {
 	return err == nil
 }
 
+// ReferenceTag returns the tag given explicitly within the image reference, which may also be pinned to a digest (e.g.
+// "alpine:3.14" and "alpine:3.14@sha256:..." are both tagged "3.14"). False is returned when no tag is given (the
+// default "latest" tag is never implied).
+func ReferenceTag(imageSpec string, options ...name.Option) (name.Tag, bool) {
+	base := strings.SplitN(imageSpec, "@", 2)[0]
+	// note: a ":" before the last separator is a registry port (e.g. "localhost:5000/alpine")
+	if !strings.Contains(base[strings.LastIndex(base, "/")+1:], ":") {
+		return name.Tag{}, false
+	}
+	tag, err := name.NewTag(base, options...)
+	if err != nil {
+		return name.Tag{}, false
+	}
+	return tag, true
+}
+
 // ParseSourceScheme attempts to resolve a concrete image source selection from a scheme in a user string.
 func ParseSourceScheme(source string) Source {
 	source = strings.ToLower(source)
@@ -82,6 +101,8 @@ func ParseSourceScheme(source string) Source {
 		return OciRegistrySource
 	case "singularity":
 		return SingularitySource
+	case "containerd":
+		return ContainerdDaemonSource
 	}
 	return UnknownSource
 }
@@ -27,6 +27,12 @@ func TestDetectSource(t *testing.T) {
 			source:           PodmanDaemonSource,
 			expectedLocation: "something:latest",
 		},
+		{
+			name:             "containerd",
+			input:            "containerd:something:latest",
+			source:           ContainerdDaemonSource,
+			expectedLocation: "something:latest",
+		},
 		{
 			name:             "docker-archive",
 			input:            "docker-archive:a/place.tar",
@@ -476,3 +482,32 @@ func getDummySIF(t *testing.T, path string, opts ...sif.CreateOpt) afero.Fs {
 
 	return fs
 }
+
+func TestReferenceTag(t *testing.T) {
+	const digest = "sha256:d4ff818577bc193b309b355b02ebc9220427090057b54a59e73b79bdfe139b83"
+	cases := []struct {
+		reference string
+		tag       string
+	}{
+		{reference: "alpine:3.14", tag: "3.14"},
+		{reference: "alpine:3.14@" + digest, tag: "3.14"},
+		{reference: "localhost:5000/alpine:edge@" + digest, tag: "edge"},
+		{reference: "alpine"},
+		{reference: "alpine@" + digest},
+		{reference: "localhost:5000/alpine"},
+		{reference: "localhost:5000/alpine@" + digest},
+		{reference: "alpine:not/valid"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.reference, func(t *testing.T) {
+			tag, ok := ReferenceTag(c.reference)
+			if ok != (c.tag != "") {
+				t.Fatalf("unexpected tag presence: %v", ok)
+			}
+			if ok && tag.TagStr() != c.tag {
+				t.Errorf("expected tag %q, got %q", c.tag, tag.TagStr())
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package image
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree"
+)
+
+// SquashEventKind describes what happened to a path while squashing the image layers.
+type SquashEventKind string
+
+const (
+	// SquashOverwritten indicates that a path contributed by a lower layer was replaced by an upper layer
+	SquashOverwritten SquashEventKind = "overwritten"
+	// SquashDeleted indicates that a path contributed by a lower layer was removed by a whiteout (or an opaque
+	// whiteout, or by a lower directory being replaced with a non-directory) in an upper layer
+	SquashDeleted SquashEventKind = "deleted"
+	// SquashOpaqueCleared indicates that all lower contents of a directory were removed by an opaque whiteout
+	SquashOpaqueCleared SquashEventKind = "opaque-cleared"
+	// SquashDanglingWhiteout indicates a whiteout for a path that does not exist in any lower layer
+	SquashDanglingWhiteout SquashEventKind = "dangling-whiteout"
+)
+
+// SquashEvent is a single entry in the audit log of the image squash.
+type SquashEvent struct {
+	Kind SquashEventKind
+	// Path is the affected path (for whiteouts this is the path that is whited out, not the whiteout entry)
+	Path file.Path
+	// Layer is the index of the layer that caused the event
+	Layer int
+	// LowerLayer is the index of the layer that last contributed the affected path (only for overwritten and deleted
+	// paths, otherwise -1)
+	LowerLayer int
+}
+
+func (e SquashEvent) String() string {
+	if e.LowerLayer >= 0 {
+		return fmt.Sprintf("%s: %s (layer %d by layer %d)", e.Kind, e.Path, e.LowerLayer, e.Layer)
+	}
+	return fmt.Sprintf("%s: %s (layer %d)", e.Kind, e.Path, e.Layer)
+}
+
+// SquashReport returns the audit log of the image squash: every path that was overwritten or deleted, every directory
+// cleared by an opaque whiteout, and every whiteout that did not match any lower path. The report is recorded while
+// the image is read, and events are ordered by layer (and within each layer, in the order that the squash applies
+// them). Only paths that have an entry in a layer are tracked (directories implied by other paths are not).
+func (i *Image) SquashReport() []SquashEvent {
+	return i.squashReport
+}
+
+// squashRecorder builds the squash report incrementally as each layer is squashed onto the layers below it.
+type squashRecorder struct {
+	// origins is the index of the layer that last contributed each path in the current squash
+	origins map[file.Path]int
+	events  []SquashEvent
+}
+
+func newSquashRecorder() *squashRecorder {
+	return &squashRecorder{
+		origins: make(map[file.Path]int),
+	}
+}
+
+// record captures the events for squashing the given layer tree onto the given lower squash tree (nil for the first
+// layer).
+func (r *squashRecorder) record(idx int, upper, lower *filetree.FileTree) error {
+	var whiteouts, opaques, contributed []file.Path
+	for _, p := range upper.AllRealPaths() {
+		if !p.IsWhiteout() {
+			if _, ref, err := upper.File(p); err != nil {
+				return err
+			} else if ref != nil {
+				contributed = append(contributed, p)
+			}
+			continue
+		}
+		target, kind, err := p.UnWhiteoutPath()
+		if err != nil {
+			return fmt.Errorf("unable to find original path for whiteout=%q: %w", p, err)
+		}
+		if kind == file.OpaqueDirWhiteout {
+			opaques = append(opaques, target)
+		} else {
+			whiteouts = append(whiteouts, target)
+		}
+	}
+
+	// note: this is the same order that the layers are merged in (opaque directories first, then whiteouts, and
+	// finally the layer contents)
+	for _, dir := range opaques {
+		r.add(SquashEvent{Kind: SquashOpaqueCleared, Path: dir, Layer: idx, LowerLayer: -1})
+		if _, err := r.delete(idx, lower, dir, false); err != nil {
+			return err
+		}
+	}
+	for _, target := range whiteouts {
+		removed, err := r.delete(idx, lower, target, true)
+		if err != nil {
+			return err
+		}
+		if !removed && (lower == nil || !lower.HasPath(target)) {
+			r.add(SquashEvent{Kind: SquashDanglingWhiteout, Path: target, Layer: idx, LowerLayer: -1})
+		}
+	}
+	for _, p := range contributed {
+		if lower != nil {
+			upperType, _ := upper.Type(p)
+			if lowerType, exists := lower.Type(p); exists && lowerType == file.TypeDir && upperType != file.TypeDir {
+				// a directory replaced with any other type loses all lower contents
+				if _, err := r.delete(idx, lower, p, false); err != nil {
+					return err
+				}
+			}
+		}
+		if lowerIdx, ok := r.origins[p]; ok {
+			r.add(SquashEvent{Kind: SquashOverwritten, Path: p, Layer: idx, LowerLayer: lowerIdx})
+		}
+		r.origins[p] = idx
+	}
+	return nil
+}
+
+// delete records the removal of all paths within the given directory (and the directory itself if requested),
+// returning whether any path was removed. Only the subtree of the directory within the lower squash tree is walked
+// (every tracked path within the directory is in the lower squash), not every tracked path.
+func (r *squashRecorder) delete(idx int, lower *filetree.FileTree, dir file.Path, includeDir bool) (bool, error) {
+	var removed []file.Path
+	if _, ok := r.origins[dir]; ok && includeDir {
+		removed = append(removed, dir)
+	}
+	if lower != nil {
+		refs, err := lower.FilesUnder(dir, file.AllTypes...)
+		if err != nil {
+			return false, fmt.Errorf("unable to find paths within dir=%q: %w", dir, err)
+		}
+		for _, ref := range refs {
+			// note: when the directory is a link, the paths found are within the link target (not the directory)
+			if _, ok := r.origins[ref.RealPath]; ok && ref.RealPath != dir && ref.RealPath.HasPrefix(dir) {
+				removed = append(removed, ref.RealPath)
+			}
+		}
+	}
+	sort.Sort(file.Paths(removed))
+	for _, p := range removed {
+		r.add(SquashEvent{Kind: SquashDeleted, Path: p, Layer: idx, LowerLayer: r.origins[p]})
+		delete(r.origins, p)
+	}
+	return len(removed) > 0, nil
+}
+
+func (r *squashRecorder) add(event SquashEvent) {
+	r.events = append(r.events, event)
+}
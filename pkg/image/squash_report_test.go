@@ -0,0 +1,56 @@
+package image
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImage_SquashReport(t *testing.T) {
+	img, err := NewMockBuilder().
+		AddDir("/etc", 0755).
+		AddFile("/etc/hosts", "stale", 0644).
+		AddFile("/etc/removed", "removed", 0644).
+		AddDir("/var/cache", 0755).
+		AddFile("/var/cache/a", "a", 0644).
+		AddFile("/var/cache/b", "b", 0644).
+		AddFile("/opt/tool/bin", "tool", 0755).
+		AddLayer().
+		AddFile("/etc/hosts", "127.0.0.1 localhost\n", 0644).
+		AddWhiteout("/etc/removed").
+		AddOpaqueWhiteout("/var/cache").
+		AddFile("/var/cache/b", "new b", 0644).
+		// a whiteout for a path that no lower layer provides
+		AddFile("/etc/.wh.missing", "", 0644).
+		AddLayer().
+		// a directory replaced with a file loses all lower contents
+		AddFile("/opt/tool", "not a directory", 0644).
+		AddFile("/etc/hosts", "::1 localhost\n", 0644).
+		Build()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = img.Cleanup() })
+
+	expected := []SquashEvent{
+		{Kind: SquashOpaqueCleared, Path: "/var/cache", Layer: 1, LowerLayer: -1},
+		{Kind: SquashDeleted, Path: "/var/cache/a", Layer: 1, LowerLayer: 0},
+		{Kind: SquashDeleted, Path: "/var/cache/b", Layer: 1, LowerLayer: 0},
+		{Kind: SquashDanglingWhiteout, Path: "/etc/missing", Layer: 1, LowerLayer: -1},
+		{Kind: SquashDeleted, Path: "/etc/removed", Layer: 1, LowerLayer: 0},
+		{Kind: SquashOverwritten, Path: "/etc/hosts", Layer: 1, LowerLayer: 0},
+		{Kind: SquashOverwritten, Path: "/etc/hosts", Layer: 2, LowerLayer: 1},
+		{Kind: SquashDeleted, Path: "/opt/tool/bin", Layer: 2, LowerLayer: 0},
+	}
+	assert.Equal(t, expected, img.SquashReport())
+
+	assert.Equal(t, "overwritten: /etc/hosts (layer 1 by layer 2)", expected[6].String())
+	assert.Equal(t, "opaque-cleared: /var/cache (layer 1)", expected[0].String())
+
+	// nothing is reported for a single layer
+	single, err := NewMockBuilder().
+		AddFile("/etc/hosts", "127.0.0.1 localhost\n", 0644).
+		Build()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = single.Cleanup() })
+	assert.Empty(t, single.SquashReport())
+}
@@ -0,0 +1,83 @@
+package image
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+// SquashedDigest returns a content-addressable digest (e.g. "sha256:...") of the squashed filesystem, independent of
+// how the image is split into layers. Each path in the squash tree (with all whiteouts already applied) contributes its
+// path, mode (including the file type), and a value: the sha256 of the contents for regular files, or the link target
+// for symlinks and hardlinks (links are never followed). Directories implied by other paths (without an entry in any
+// layer) have no metadata and do not contribute to the digest. Tuples are hashed in path order.
+func (i *Image) SquashedDigest() (string, error) {
+	// note: the file type is taken from the tree (not the metadata) since not all layer formats record a tar type flag
+	var refs []typedReference
+	tree := i.SquashedTree()
+	for _, ty := range file.AllTypes {
+		for _, ref := range tree.AllFiles(ty) {
+			refs = append(refs, typedReference{Reference: ref, fileType: ty})
+		}
+	}
+	sort.Slice(refs, func(a, b int) bool {
+		return refs[a].RealPath < refs[b].RealPath
+	})
+
+	hasher := sha256.New()
+	for _, ref := range refs {
+		entry, err := i.FileCatalog.Get(ref.Reference)
+		if err != nil {
+			return "", fmt.Errorf("unable to get metadata for path=%q: %w", ref.RealPath, err)
+		}
+
+		var value string
+		switch ref.fileType {
+		case file.TypeReg:
+			value, err = i.contentDigest(ref.Reference)
+			if err != nil {
+				return "", err
+			}
+		case file.TypeSymlink, file.TypeHardLink:
+			value = entry.Metadata.Linkname
+		}
+
+		// NUL cannot appear within a path or link target, so each tuple is unambiguous
+		if _, err := fmt.Fprintf(hasher, "%s\x00%o\x00%s\x00", ref.RealPath, uint32(entry.Metadata.Mode), value); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("sha256:%x", hasher.Sum(nil)), nil
+}
+
+// digestPrefix is the algorithm prefix of recorded content digests (see file.Metadata.Digest)
+const digestPrefix = "sha256:"
+
+type typedReference struct {
+	file.Reference
+	fileType file.Type
+}
+
+// contentDigest returns the (hex) sha256 of the contents of the given regular file, using the digest recorded while
+// indexing when there is one (see WithFileDigests) instead of reading the contents again.
+func (i *Image) contentDigest(ref file.Reference) (string, error) {
+	if entry, err := i.FileCatalog.Get(ref); err == nil && strings.HasPrefix(entry.Metadata.Digest, digestPrefix) {
+		return strings.TrimPrefix(entry.Metadata.Digest, digestPrefix), nil
+	}
+
+	reader, err := i.FileCatalog.FileContents(ref)
+	if err != nil {
+		return "", fmt.Errorf("unable to read contents for path=%q: %w", ref.RealPath, err)
+	}
+	defer reader.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, reader); err != nil {
+		return "", fmt.Errorf("unable to read contents for path=%q: %w", ref.RealPath, err)
+	}
+	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
+}
@@ -0,0 +1,107 @@
+package image
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImage_SquashedDigest(t *testing.T) {
+	digestOf := func(t *testing.T, builder *MockBuilder) string {
+		t.Helper()
+		img, err := builder.Build()
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = img.Cleanup() })
+
+		digest, err := img.SquashedDigest()
+		require.NoError(t, err)
+		assert.Regexp(t, "^sha256:[0-9a-f]{64}$", digest)
+		return digest
+	}
+
+	base := func() *MockBuilder {
+		return NewMockBuilder().
+			AddDir("/etc", 0755).
+			AddFile("/etc/hosts", "127.0.0.1 localhost\n", 0644).
+			AddFile("/usr/bin/app", "binary", 0755).
+			AddSymlink("/usr/bin/link", "app")
+	}
+	expected := digestOf(t, base())
+
+	tests := []struct {
+		name    string
+		builder *MockBuilder
+		same    bool
+	}{
+		{
+			name:    "same filesystem",
+			builder: base(),
+			same:    true,
+		},
+		{
+			name: "same filesystem split across layers",
+			builder: NewMockBuilder().
+				AddDir("/etc", 0755).
+				AddFile("/usr/bin/app", "binary", 0755).
+				AddLayer().
+				AddSymlink("/usr/bin/link", "app").
+				AddLayer().
+				AddFile("/etc/hosts", "127.0.0.1 localhost\n", 0644),
+			same: true,
+		},
+		{
+			name: "overwritten and whited out files are not included",
+			builder: NewMockBuilder().
+				AddDir("/etc", 0755).
+				AddFile("/etc/hosts", "stale", 0600).
+				AddFile("/usr/bin/app", "binary", 0755).
+				AddFile("/usr/bin/removed", "removed", 0755).
+				AddLayer().
+				AddWhiteout("/usr/bin/removed").
+				AddFile("/etc/hosts", "127.0.0.1 localhost\n", 0644).
+				AddSymlink("/usr/bin/link", "app"),
+			same: true,
+		},
+		{
+			name: "different contents",
+			builder: NewMockBuilder().
+				AddDir("/etc", 0755).
+				AddFile("/etc/hosts", "127.0.0.1 localhost\n", 0644).
+				AddFile("/usr/bin/app", "other binary", 0755).
+				AddSymlink("/usr/bin/link", "app"),
+		},
+		{
+			name: "different mode",
+			builder: NewMockBuilder().
+				AddDir("/etc", 0755).
+				AddFile("/etc/hosts", "127.0.0.1 localhost\n", 0600).
+				AddFile("/usr/bin/app", "binary", 0755).
+				AddSymlink("/usr/bin/link", "app"),
+		},
+		{
+			name: "different link target",
+			builder: NewMockBuilder().
+				AddDir("/etc", 0755).
+				AddFile("/etc/hosts", "127.0.0.1 localhost\n", 0644).
+				AddFile("/usr/bin/app", "binary", 0755).
+				AddSymlink("/usr/bin/link", "/usr/bin/app"),
+		},
+		{
+			name: "additional empty directory",
+			builder: base().
+				AddDir("/tmp", 0755),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual := digestOf(t, test.builder)
+			if test.same {
+				assert.Equal(t, expected, actual)
+			} else {
+				assert.NotEqual(t, expected, actual)
+			}
+		})
+	}
+}
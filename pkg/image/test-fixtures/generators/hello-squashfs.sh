@@ -0,0 +1,12 @@
+#!/usr/bin/env bash
+set -ue
+
+# generates a squashfs filesystem image with a single file, used as the blob of a squashfs (non-tar) OCI layer
+# (requires mksquashfs from squashfs-tools)
+FIXTURE_PATH=$1
+
+WORK_DIR=$(mktemp -d)
+trap "rm -rf ${WORK_DIR}" EXIT
+
+echo "Hello from Sylabs!" > ${WORK_DIR}/hello.txt
+mksquashfs ${WORK_DIR} ${FIXTURE_PATH} -noappend -all-root
@@ -0,0 +1,37 @@
+#!/usr/bin/env bash
+set -ue
+
+# generates the layer tars of an image where the middle layer has an opaque whiteout at the root ("./.wh..wh..opq"),
+# which removes everything from the lower layer while keeping the same-layer and higher-layer additions
+# (requires GNU tar)
+FIXTURE_DIR=$1
+
+WORK_DIR=$(mktemp -d)
+trap "rm -rf ${WORK_DIR}" EXIT
+
+mkdir -p ${FIXTURE_DIR}
+
+layer() {
+  # note: sort by name and a fixed mtime keep the generated tars stable
+  tar --sort=name --owner=0 --group=0 --mtime=@1577836800 -C "${WORK_DIR}/$1" -cvf "${FIXTURE_DIR}/$1.tar" .
+}
+
+# lower layer (everything here is removed by the root opaque whiteout)
+mkdir -p ${WORK_DIR}/layer-1/etc ${WORK_DIR}/layer-1/bin ${WORK_DIR}/layer-1/app
+echo "127.0.0.1 localhost" > ${WORK_DIR}/layer-1/etc/hosts
+echo "busybox" > ${WORK_DIR}/layer-1/bin/busybox
+ln -s busybox ${WORK_DIR}/layer-1/bin/sh
+ln ${WORK_DIR}/layer-1/bin/busybox ${WORK_DIR}/layer-1/bin/ls
+echo "lower" > ${WORK_DIR}/layer-1/app/config.txt
+layer layer-1
+
+# the root opaque whiteout along with same-layer additions
+mkdir -p ${WORK_DIR}/layer-2/app
+touch ${WORK_DIR}/layer-2/.wh..wh..opq
+echo "same layer" > ${WORK_DIR}/layer-2/app/config.txt
+layer layer-2
+
+# higher layer additions
+mkdir -p ${WORK_DIR}/layer-3/etc
+echo "higher layer" > ${WORK_DIR}/layer-3/etc/motd
+layer layer-3
@@ -0,0 +1,68 @@
+package image
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree"
+)
+
+// Whiteout is a single whiteout entry declared within a layer.
+type Whiteout struct {
+	// Path is the logical path affected by the whiteout: the removed path for file whiteouts, or the directory whose
+	// lower contents are removed for opaque whiteouts (not the raw ".wh." entry).
+	Path file.Path
+	// Kind indicates if the whiteout removes a single path or all lower contents of a directory.
+	Kind file.WhiteoutKind
+	// ExistsInLowerLayers indicates if the path exists in the squash of all lower layers (a whiteout for a path that
+	// never existed has no effect).
+	ExistsInLowerLayers bool
+}
+
+// Whiteouts returns all whiteouts declared by each layer (indexed the same as Layers) sorted by path.
+func (i *Image) Whiteouts() ([][]Whiteout, error) {
+	results := make([][]Whiteout, len(i.Layers))
+	var lower *filetree.FileTree
+	for idx, layer := range i.Layers {
+		if layer.Tree == nil {
+			return nil, fmt.Errorf("layer %d has not been read", idx)
+		}
+
+		whiteouts, err := layerWhiteouts(layer.Tree, lower)
+		if err != nil {
+			return nil, fmt.Errorf("unable to find whiteouts for layer %d: %w", idx, err)
+		}
+		results[idx] = whiteouts
+		lower = layer.SquashedTree
+	}
+	return results, nil
+}
+
+func layerWhiteouts(tree, lower *filetree.FileTree) ([]Whiteout, error) {
+	var whiteouts []Whiteout
+	for _, p := range tree.AllRealPaths() {
+		if !p.IsWhiteout() {
+			continue
+		}
+
+		target, kind, err := p.UnWhiteoutPath()
+		if err != nil {
+			return nil, err
+		}
+
+		whiteouts = append(whiteouts, Whiteout{
+			Path:                target,
+			Kind:                kind,
+			ExistsInLowerLayers: lower != nil && lower.HasPath(target),
+		})
+	}
+
+	sort.Slice(whiteouts, func(i, j int) bool {
+		if whiteouts[i].Path == whiteouts[j].Path {
+			return whiteouts[i].Kind < whiteouts[j].Kind
+		}
+		return whiteouts[i].Path < whiteouts[j].Path
+	})
+	return whiteouts, nil
+}
@@ -0,0 +1,148 @@
+package image
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImage_Whiteouts(t *testing.T) {
+	img := newTestImage(t,
+		[]testTarEntry{
+			regularEntry("etc/hosts", "hosts"),
+			regularEntry("opt/app/a.txt", "a"),
+		},
+		[]testTarEntry{
+			regularEntry("etc/.wh.hosts", ""),
+			regularEntry("etc/.wh.never-existed", ""),
+			regularEntry("opt/app/.wh..wh..opq", ""),
+		},
+		[]testTarEntry{
+			regularEntry("new.txt", "new"),
+		},
+	)
+
+	whiteouts, err := img.Whiteouts()
+	require.NoError(t, err)
+	require.Len(t, whiteouts, 3)
+
+	assert.Empty(t, whiteouts[0])
+	assert.Equal(t, []Whiteout{
+		{Path: "/etc/hosts", Kind: file.FileWhiteout, ExistsInLowerLayers: true},
+		{Path: "/etc/never-existed", Kind: file.FileWhiteout, ExistsInLowerLayers: false},
+		{Path: "/opt/app", Kind: file.OpaqueDirWhiteout, ExistsInLowerLayers: true},
+	}, whiteouts[1])
+	assert.Empty(t, whiteouts[2])
+}
+
+func TestImage_AufsMetadataIgnored(t *testing.T) {
+	img := newTestImage(t,
+		[]testTarEntry{
+			regularEntry(".wh..wh.aufs", ""),
+			{header: tar.Header{Name: ".wh..wh.plnk/", Typeflag: tar.TypeDir, Mode: 0700}},
+			regularEntry(".wh..wh.plnk/1234.5678", "linked"),
+			{header: tar.Header{Name: ".wh..wh.orph/", Typeflag: tar.TypeDir, Mode: 0700}},
+			regularEntry("etc/hosts", "hosts"),
+			regularEntry("opt/old/a.txt", "a"),
+		},
+		[]testTarEntry{
+			regularEntry(".wh..wh.aufs", ""),
+			// a renamed directory is represented as a whiteout of the old name along with the new contents
+			regularEntry("opt/.wh.old", ""),
+			regularEntry("opt/new/a.txt", "a"),
+			regularEntry("opt/new/.wh..wh..opq", ""),
+		},
+	)
+
+	for idx, layer := range img.Layers {
+		for _, p := range layer.Tree.AllRealPaths() {
+			assert.False(t, p.IsAufsMetadata(), "layer %d has AUFS metadata path=%q", idx, p)
+		}
+	}
+
+	var paths []file.Path
+	for _, ref := range img.SquashedTree().AllFiles() {
+		paths = append(paths, ref.RealPath)
+	}
+	assert.Equal(t, []file.Path{"/etc/hosts", "/opt/new/a.txt"}, paths)
+
+	whiteouts, err := img.Whiteouts()
+	require.NoError(t, err)
+	assert.Equal(t, []Whiteout{
+		{Path: "/opt/new", Kind: file.OpaqueDirWhiteout, ExistsInLowerLayers: false},
+		{Path: "/opt/old", Kind: file.FileWhiteout, ExistsInLowerLayers: true},
+	}, whiteouts[1])
+}
+
+func TestImage_Whiteouts_ImplicitParents(t *testing.T) {
+	// note: none of the layers have entries for any directory
+	img := newTestImage(t,
+		[]testTarEntry{
+			regularEntry("foo", "foo"),
+			regularEntry("a/b", "b"),
+			regularEntry("a/c", "c"),
+		},
+		[]testTarEntry{
+			regularEntry(".wh.foo", ""),
+			regularEntry("a/.wh.b", ""),
+		},
+	)
+
+	var paths []file.Path
+	for _, ref := range img.SquashedTree().AllFiles() {
+		paths = append(paths, ref.RealPath)
+	}
+	assert.Equal(t, []file.Path{"/a/c"}, paths)
+
+	whiteouts, err := img.Whiteouts()
+	require.NoError(t, err)
+	assert.Equal(t, []Whiteout{
+		{Path: "/a/b", Kind: file.FileWhiteout, ExistsInLowerLayers: true},
+		{Path: "/foo", Kind: file.FileWhiteout, ExistsInLowerLayers: true},
+	}, whiteouts[1])
+
+	diff, err := img.LayerDiff(1)
+	require.NoError(t, err)
+	assert.Equal(t, []file.Path{"/a/b", "/foo"}, diff.Deleted)
+}
+
+func TestImage_Whiteouts_RootOpaqueWhiteout(t *testing.T) {
+	// the middle layer has a root opaque whiteout ("./.wh..wh..opq"), see generators/root-opaque-whiteout.sh
+	var layers []v1.Layer
+	for _, name := range []string{"layer-1.tar", "layer-2.tar", "layer-3.tar"} {
+		layer, err := tarball.LayerFromFile(filepath.Join("test-fixtures/root-opaque-whiteout", name))
+		require.NoError(t, err)
+		layers = append(layers, layer)
+	}
+	v1Img, err := mutate.AppendLayers(empty.Image, layers...)
+	require.NoError(t, err)
+
+	img := NewImage(v1Img, t.TempDir())
+	require.NoError(t, img.Read())
+	t.Cleanup(func() { _ = img.Cleanup() })
+
+	// everything from the lower layer is removed, while the same-layer and higher-layer additions are kept
+	assert.Equal(t, []file.Path{"/", "/app", "/app/config.txt", "/etc", "/etc/motd"}, img.SquashedTree().AllRealPaths())
+
+	reader, err := img.FileContentsFromSquash("/app/config.txt")
+	require.NoError(t, err)
+	contents, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	assert.Equal(t, "same layer\n", string(contents))
+
+	whiteouts, err := img.Whiteouts()
+	require.NoError(t, err)
+	assert.Equal(t, []Whiteout{
+		{Path: "/", Kind: file.OpaqueDirWhiteout, ExistsInLowerLayers: true},
+	}, whiteouts[1])
+}
@@ -6,7 +6,8 @@ import (
 	"github.com/anchore/stereoscope/pkg/tree/node"
 )
 
-// Tree represents a simple Tree data structure.
+// Tree represents a simple Tree data structure. Reads are safe for concurrent use only while the tree is not being
+// mutated (mutations are not synchronized).
 type Tree struct {
 	nodes    map[node.ID]node.Node
 	children map[node.ID]map[node.ID]node.Node